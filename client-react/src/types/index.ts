@@ -21,8 +21,14 @@ export type MessageType =
   | 'ACTOR_INFO'
   | 'ACTOR_UPDATE';
 
+export interface Participant {
+  name: string;
+  clientType: 'foundry' | 'phone';
+}
+
 export interface RoomStatusPayload {
   foundryConnected: boolean;
+  participants?: Participant[];
 }
 
 export interface WSMessage<T = unknown> {
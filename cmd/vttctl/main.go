@@ -0,0 +1,182 @@
+// Package main provides vttctl, a command-line tool for manual testing
+// against a VTT Remote relay. It joins a room like a phone would, sends
+// MOVE or ROLL_DICE messages from flags, and prints what the room relays.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sam-phinizy/vtt-remote/pkg/client"
+	"github.com/sam-phinizy/vtt-remote/pkg/relay"
+)
+
+const usage = `Usage: vttctl <command> [flags]
+
+Commands:
+  move    Send a MOVE, then print messages for -wait
+  roll    Send a ROLL_DICE, then print messages for -wait
+  watch   Print the room's messages until interrupted
+
+Run "vttctl <command> -h" for a command's flags.
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "vttctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// connFlags are the flags every command takes.
+type connFlags struct {
+	url       string
+	room      string
+	name      string
+	password  string
+	authToken string
+	verbose   bool
+}
+
+// register binds f's fields to flags on fs.
+func (f *connFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.url, "url", envOr("VTT_URL", "ws://localhost:8080/ws"), "Relay WebSocket URL ($VTT_URL)")
+	fs.StringVar(&f.room, "room", "", "Room code to join (required)")
+	fs.StringVar(&f.name, "name", "vttctl", "Display name shown to the room")
+	fs.StringVar(&f.password, "password", "", "Room password, if the room has one")
+	fs.StringVar(&f.authToken, "auth-token", os.Getenv("VTT_AUTH_TOKEN"), "Relay auth token ($VTT_AUTH_TOKEN)")
+	fs.BoolVar(&f.verbose, "v", false, "Log connection and reconnect events to stderr")
+}
+
+// connect joins the room named by f.
+func (f *connFlags) connect(stderr io.Writer) (*client.Client, error) {
+	if f.room == "" {
+		return nil, errors.New("-room is required")
+	}
+	opts := client.Options{
+		DisplayName: f.name,
+		Password:    f.password,
+		AuthToken:   f.authToken,
+	}
+	if f.verbose {
+		opts.OnLog = func(level relay.LogLevel, message string) {
+			fmt.Fprintf(stderr, "[%s] %s\n", level, message)
+		}
+	}
+	return client.Connect(f.url, f.room, opts)
+}
+
+// envOr returns the environment variable key, or fallback if it is unset.
+func envOr(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return fallback
+}
+
+// run executes the command in args, printing received messages to stdout.
+// It returns when the command finishes or ctx is cancelled.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return errors.New("no command given")
+	}
+
+	cmd, args := args[0], args[1:]
+	fs := flag.NewFlagSet("vttctl "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var conn connFlags
+	conn.register(fs)
+
+	var (
+		msgType relay.MessageType
+		payload any
+		wait    time.Duration
+	)
+	switch cmd {
+	case "move":
+		var p relay.MovePayload
+		fs.StringVar(&p.TokenID, "token", "", "Token ID to move (required)")
+		fs.StringVar(&p.Direction, "dir", "", "Direction: up, down, left, right, up-left, up-right, down-left, or down-right")
+		fs.IntVar(&p.Distance, "distance", 0, "Grid squares to move (default 1)")
+		fs.DurationVar(&wait, "wait", 2*time.Second, "How long to print replies after sending")
+		msgType, payload = relay.TypeMove, &p
+	case "roll":
+		var p relay.RollDicePayload
+		fs.StringVar(&p.TokenID, "token", "", "Token ID rolling (required)")
+		fs.StringVar(&p.Formula, "formula", "", "Roll formula, e.g. 2d6+3 (required)")
+		fs.BoolVar(&p.PostToChat, "chat", false, "Post the roll to Foundry chat")
+		fs.DurationVar(&wait, "wait", 2*time.Second, "How long to print replies after sending")
+		msgType, payload = relay.TypeRollDice, &p
+	case "watch":
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stderr, usage)
+		return flag.ErrHelp
+	default:
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	// Check the payload up front, as the relay would drop it
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		if err := relay.ValidatePayload(msgType, data); err != nil {
+			return err
+		}
+	}
+
+	c, err := conn.connect(stderr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if payload == nil {
+		return watch(ctx, c, stdout)
+	}
+	if err := c.Send(msgType, payload); err != nil {
+		return fmt.Errorf("send %s: %w", msgType, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	return watch(ctx, c, stdout)
+}
+
+// watch prints c's messages, one per line, until ctx is done.
+func watch(ctx context.Context, c *client.Client, stdout io.Writer) error {
+	for {
+		select {
+		case env, ok := <-c.Messages():
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(stdout, "%s %s\n", env.Type, env.Payload)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sam-phinizy/vtt-remote/pkg/client"
+	"github.com/sam-phinizy/vtt-remote/pkg/natsutil"
+	"github.com/sam-phinizy/vtt-remote/pkg/relay"
+)
+
+// setupTestRelay serves a relay backed by embedded NATS and returns its
+// WebSocket URL.
+func setupTestRelay(t *testing.T) string {
+	t.Helper()
+	ns, err := natsutil.Start()
+	if err != nil {
+		t.Fatalf("Failed to start NATS: %v", err)
+	}
+	t.Cleanup(ns.Shutdown)
+	r, err := relay.NewRelay(relay.Config{NatsURL: ns.ClientURL()})
+	if err != nil {
+		t.Fatalf("Failed to create relay: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		r.HandleClient(conn)
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+// connectFoundry joins room as a Foundry client, consuming its
+// ROOM_STATUS.
+func connectFoundry(t *testing.T, url, room string) *client.Client {
+	t.Helper()
+	c, err := client.Connect(url, room, client.Options{ClientType: relay.ClientTypeFoundry})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	nextOfType(t, c, relay.TypeRoomStatus)
+	return c
+}
+
+// nextOfType reads c's messages until one of msgType arrives.
+func nextOfType(t *testing.T, c *client.Client, msgType relay.MessageType) *relay.Envelope {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case env, ok := <-c.Messages():
+			if !ok {
+				t.Fatalf("Messages closed waiting for %s", msgType)
+			}
+			if env.Type == msgType {
+				return env
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %s", msgType)
+		}
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe to read while run writes to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestMoveRoundTrip(t *testing.T) {
+	url := setupTestRelay(t)
+	foundry := connectFoundry(t, url, "GAME1")
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"move", "--url", url, "--room", "GAME1", "--dir", "up", "--token", "tok1", "--wait", "200ms"}
+	done := make(chan error, 1)
+	go func() { done <- run(context.Background(), args, &stdout, &stderr) }()
+
+	env := nextOfType(t, foundry, relay.TypeMove)
+	var move relay.MovePayload
+	if err := json.Unmarshal(env.Payload, &move); err != nil {
+		t.Fatalf("Invalid MOVE payload: %v", err)
+	}
+	if move.TokenID != "tok1" || move.Direction != "up" {
+		t.Errorf("MOVE = %+v, want tok1 up", move)
+	}
+
+	// Foundry's answer is printed while vttctl waits
+	if err := foundry.Send(relay.TypeMoveAck, relay.MoveAckPayload{TokenID: "tok1", X: 100, Y: 50}); err != nil {
+		t.Fatalf("Send MOVE_ACK: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v (stderr %q)", err, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "MOVE_ACK ") {
+		t.Errorf("Output missing MOVE_ACK:\n%s", stdout.String())
+	}
+}
+
+func TestWatch(t *testing.T) {
+	url := setupTestRelay(t)
+	foundry := connectFoundry(t, url, "GAME2")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var stdout syncBuffer
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, []string{"watch", "--url", url, "--room", "GAME2"}, &stdout, &stdout) }()
+
+	// The watcher has joined once Foundry sees it in ROOM_STATUS
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(stdout.String(), "ROOM_STATUS") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Watcher never joined; output %q", stdout.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := foundry.Send(relay.TypeMoveAck, relay.MoveAckPayload{TokenID: "tok1", X: 1, Y: 2}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	for !strings.Contains(stdout.String(), "MOVE_ACK ") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Watcher didn't print MOVE_ACK; output %q", stdout.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Cancelling, as Ctrl-C does, ends the watch cleanly
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run = %v after cancel", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("run didn't return after cancel")
+	}
+}
+
+func TestRunInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"no command", nil, "no command"},
+		{"unknown command", []string{"jump"}, "unknown command"},
+		{"missing room", []string{"watch"}, "-room is required"},
+		{"bad direction", []string{"move", "--room", "GAME1", "--dir", "sideways", "--token", "tok1"}, "unknown direction"},
+		{"missing token", []string{"move", "--room", "GAME1", "--dir", "up"}, "tokenId is required"},
+		{"missing formula", []string{"roll", "--room", "GAME1", "--token", "tok1"}, "formula is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := run(context.Background(), tt.args, &out, &out)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("run = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
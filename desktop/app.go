@@ -1,31 +1,54 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
 	"embed"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"math/rand/v2"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/grandcat/zeroconf"
+	"github.com/skip2/go-qrcode"
 	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
 
+	"github.com/sam-phinizy/vtt-remote/pkg/certgen"
+	"github.com/sam-phinizy/vtt-remote/pkg/discovery"
 	"github.com/sam-phinizy/vtt-remote/pkg/natsutil"
 	"github.com/sam-phinizy/vtt-remote/pkg/relay"
+	"github.com/sam-phinizy/vtt-remote/pkg/roomcode"
 )
 
 //go:embed phone-client/*
 var phoneClientFS embed.FS
 
+//go:embed foundry-module/*
+var foundryModuleFS embed.FS
+
+// Build information, set at link time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=...".
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
 // ServerState represents the current state of the relay server.
 type ServerState string
 
@@ -40,8 +63,11 @@ const (
 type ServerStatus struct {
 	State         ServerState `json:"state"`
 	Port          int         `json:"port"`
-	LocalIP       string      `json:"localIP"`
+	LocalIP       string      `json:"localIP"`  // address used in the server URL and QR code
+	LocalIPs      []string    `json:"localIPs"` // every candidate LAN address, IPv4 first
 	LocalHostname string      `json:"localHostname"`
+	TLS           bool        `json:"tls"`
+	Fingerprint   string      `json:"fingerprint,omitempty"` // SHA-256 of the self-signed cert
 	Error         string      `json:"error,omitempty"`
 }
 
@@ -51,6 +77,34 @@ type ClientStats struct {
 	FoundryCount int `json:"foundryCount"`
 	PhoneCount   int `json:"phoneCount"`
 	TotalClients int `json:"totalClients"`
+
+	AverageSessionSeconds float64 `json:"averageSessionSeconds"`
+
+	Rooms []RoomStats `json:"rooms"` // Sorted by room code
+}
+
+// RoomStats holds per-room client counts for the stats table.
+type RoomStats struct {
+	Room         string `json:"room"`
+	FoundryCount int    `json:"foundryCount"`
+	PhoneCount   int    `json:"phoneCount"`
+	LastActivity string `json:"lastActivity"`
+}
+
+// RoomDetails describes one active room for the admin view.
+type RoomDetails struct {
+	Room             string          `json:"room"`
+	FoundryConnected bool            `json:"foundryConnected"`
+	PhoneCount       int             `json:"phoneCount"`
+	Clients          []ClientDetails `json:"clients"`
+}
+
+// ClientDetails describes one connected client.
+type ClientDetails struct {
+	ID              string  `json:"id"`
+	Type            string  `json:"type"`
+	ConnectedAt     string  `json:"connectedAt"`
+	DurationSeconds float64 `json:"durationSeconds"`
 }
 
 // LogEntry represents a single log message.
@@ -62,10 +116,26 @@ type LogEntry struct {
 
 // FoundryModuleStatus contains module installation status.
 type FoundryModuleStatus struct {
-	Installed  bool   `json:"installed"`
-	Version    string `json:"version,omitempty"`
-	DataPath   string `json:"dataPath"`
-	PathExists bool   `json:"pathExists"`
+	Installed       bool   `json:"installed"`
+	Version         string `json:"version,omitempty"`
+	BundledVersion  string `json:"bundledVersion,omitempty"`
+	UpdateAvailable bool   `json:"updateAvailable"`
+	DataPath        string `json:"dataPath"`
+	PathExists      bool   `json:"pathExists"`
+}
+
+// foundryModuleID is the Foundry module's id and install directory name.
+const foundryModuleID = "arcane-grimoire-vtt-remote"
+
+// bundledModule holds the Foundry module shipped with the app. The build
+// copies dist/foundry-module into foundry-module before embedding it.
+var bundledModule, _ = fs.Sub(foundryModuleFS, "foundry-module")
+
+// VersionInfo describes the running build.
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
 }
 
 // App struct contains the application state.
@@ -75,24 +145,70 @@ type App struct {
 	nats        *natsutil.EmbeddedNATS
 	relay       *relay.Relay
 	httpServer  *http.Server
-	mdnsServer  *zeroconf.Server
+	mdnsServers []*zeroconf.Server
 	serverState ServerState
 	port        int
 	logs        []LogEntry
+
+	tlsSelfSigned bool   // serve HTTPS/WSS with a certificate generated on each start
+	fingerprint   string // fingerprint of the current certificate, if any
+	portAttempts  int    // ports tried, counting up from port, before giving up
+	mdnsLegacy    bool   // also register under the generic _http._tcp type
+	mdnsRoom      string // room hint in the current mDNS TXT records
+	advertiseIP   string // address chosen for the QR code; empty uses getLocalIP
+	maxConns      int    // concurrent WebSocket connections allowed (0 = no limit)
+	connectRate   int    // new WebSocket connections allowed per client IP per minute (0 = no limit)
+	foundryPath   string // Foundry data path of the last successful install
+	lastError     string // why the running server is in StateError, if known
+
+	logCapacity  int                    // log entries kept, oldest dropped first
+	minLevel     relay.LogLevel         // entries below it are counted but not kept or emitted
+	logCounts    map[relay.LogLevel]int // entries seen per level, including filtered ones
+	settingsFile string                 // where persisted settings live; empty disables saving
 }
 
+// defaultPortAttempts is how many consecutive ports StartServer tries
+// when the configured one is busy.
+const defaultPortAttempts = 10
+
+// defaultMaxConnections caps concurrent WebSocket connections, well
+// above what one game table needs.
+const defaultMaxConnections = 256
+
+// defaultConnectRate caps new WebSocket connections per client IP per
+// minute, enough for phones reconnecting over flaky Wi-Fi.
+const defaultConnectRate = 60
+
+// defaultLogCapacity is how many log entries are kept by default.
+const defaultLogCapacity = 500
+
+// maxLogCapacity bounds SetLogCapacity so a typo can't hold unbounded
+// memory.
+const maxLogCapacity = 100000
+
 // NewApp creates a new App application struct.
-func NewApp() *App {
+// When tlsSelfSigned is true the server uses HTTPS/WSS with a fresh
+// self-signed certificate each time it starts.
+func NewApp(tlsSelfSigned bool) *App {
 	return &App{
-		port:        8080,
-		serverState: StateStopped,
-		logs:        make([]LogEntry, 0),
+		port:          8080,
+		serverState:   StateStopped,
+		logs:          make([]LogEntry, 0),
+		tlsSelfSigned: tlsSelfSigned,
+		portAttempts:  defaultPortAttempts,
+		mdnsLegacy:    true,
+		maxConns:      defaultMaxConnections,
+		connectRate:   defaultConnectRate,
+		logCapacity:   defaultLogCapacity,
+		minLevel:      relay.LogDebug,
+		logCounts:     make(map[relay.LogLevel]int),
 	}
 }
 
 // startup is called when the app starts.
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+	a.loadSettings()
 }
 
 // shutdown is called when the app closes.
@@ -109,11 +225,13 @@ func (a *App) StartServer() error {
 		return fmt.Errorf("server already running")
 	}
 	a.serverState = StateStarting
+	a.lastError = ""
 	port := a.port
+	attempts := a.portAttempts
 	a.mu.Unlock()
 
 	a.emitStatus()
-	a.addLog("info", "Starting server...")
+	a.addLog("info", fmt.Sprintf("Starting server (VTT Remote %s, commit %s)...", version, commit))
 
 	// Start embedded NATS
 	nats, err := natsutil.Start()
@@ -134,6 +252,14 @@ func (a *App) StartServer() error {
 		OnLog: func(level relay.LogLevel, msg string) {
 			a.addLog(string(level), msg)
 		},
+		ResumeTTL:         2 * time.Minute,
+		EnableCompression: true,
+		RoomCodeMode:      roomcode.Pronounceable, // Easy to read out over voice chat
+		ServerVersion:     version,
+		OnClientEvent: func(relay.ClientEvent) {
+			a.emitStats()
+			a.refreshMDNSRoom()
+		},
 	})
 	if err != nil {
 		nats.Shutdown()
@@ -157,18 +283,47 @@ func (a *App) StartServer() error {
 		mux.Handle("/", fileServer)
 	}
 
-	// WebSocket endpoint
+	// WebSocket endpoint (same-host, loopback, and LAN origins only)
+	originHosts := []string{"localhost", "127.0.0.1", "::1", getLocalHostname(), "vtt-remote.local"}
+	for _, ip := range listLocalIPs() {
+		originHosts = append(originHosts, ip.String())
+	}
+	origins := relay.NewOriginChecker(originHosts)
 	upgrader := websocket.Upgrader{
-		CheckOrigin: func(req *http.Request) bool { return true },
+		CheckOrigin:       origins.Check,
+		EnableCompression: r.CompressionEnabled(),
+		Subprotocols:      r.Subprotocols(),
 	}
+	limiter := relay.NewConnLimiter(a.maxConns)
+	ipLimiter := relay.NewIPRateLimiter(a.connectRate)
 	mux.HandleFunc("/ws", func(w http.ResponseWriter, req *http.Request) {
+		if ip := relay.ClientIP(req, false); !ipLimiter.Allow(ip) {
+			a.addLog("warn", fmt.Sprintf("Rejected connection from %s: connection rate limit reached", ip))
+			http.Error(w, "Too many connection attempts", http.StatusTooManyRequests)
+			return
+		}
+		if !r.Authorize(req) {
+			a.addLog("warn", fmt.Sprintf("Rejected unauthorized connection from %s", req.RemoteAddr))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !limiter.TryAcquire() {
+			a.addLog("warn", fmt.Sprintf("Rejected connection from %s: connection limit reached", req.RemoteAddr))
+			http.Error(w, "Too many connections", http.StatusServiceUnavailable)
+			return
+		}
+		defer limiter.Release()
 		conn, err := upgrader.Upgrade(w, req, nil)
 		if err != nil {
 			a.addLog("warn", fmt.Sprintf("WebSocket upgrade failed: %v", err))
 			return
 		}
+		if !r.CheckSubprotocol(req, conn) {
+			a.addLog("warn", fmt.Sprintf("Rejected connection from %s: unsupported subprotocol", req.RemoteAddr))
+			return
+		}
 		a.addLog("info", fmt.Sprintf("New connection from %s", req.RemoteAddr))
-		r.HandleClient(conn)
+		r.HandleClientContext(req.Context(), conn)
 	})
 
 	// Health endpoint
@@ -178,14 +333,77 @@ func (a *App) StartServer() error {
 		_, _ = w.Write([]byte(`{"status":"ok"}`))
 	})
 
+	// Room code reservation for the Foundry module
+	mux.HandleFunc("POST /rooms", func(w http.ResponseWriter, req *http.Request) {
+		if !r.Authorize(req) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		res, err := r.ReserveRoom()
+		if err != nil {
+			a.addLog("warn", fmt.Sprintf("Room reservation failed: %v", err))
+			http.Error(w, "No room code available", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(res)
+	})
+
 	httpServer := &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
 		Handler: mux,
 	}
 
-	// Start HTTP server in goroutine
+	fingerprint := ""
+	if a.tlsSelfSigned {
+		cert, err := certgen.Generate([]string{"vtt-remote.local", getLocalHostname()}, listLocalIPs())
+		if err != nil {
+			r.Close()
+			nats.Shutdown()
+			a.mu.Lock()
+			a.serverState = StateError
+			a.mu.Unlock()
+			a.emitStatus()
+			a.addLog("error", fmt.Sprintf("Failed to generate certificate: %v", err))
+			return err
+		}
+		httpServer.TLSConfig = cert.TLSConfig()
+		fingerprint = cert.Fingerprint()
+		a.addLog("info", fmt.Sprintf("Self-signed certificate fingerprint: %s", fingerprint))
+	}
+
+	// Bind before reporting success so a busy port surfaces as an error,
+	// falling back to the next free port if another app holds this one
+	ln, err := a.listen(port, attempts)
+	if err != nil {
+		r.Close()
+		nats.Shutdown()
+		a.mu.Lock()
+		a.serverState = StateError
+		a.mu.Unlock()
+		a.emitStatus()
+		a.addLog("error", fmt.Sprintf("Failed to bind HTTP port: %v", err))
+		return err
+	}
+	if bound := ln.Addr().(*net.TCPAddr).Port; bound != port {
+		port = bound
+		a.mu.Lock()
+		a.port = port
+		a.mu.Unlock()
+		a.addLog("info", fmt.Sprintf("Using port %d instead", port))
+	}
+	httpServer.Addr = ln.Addr().String()
+
+	// Serve in the background; errors after this point are reported
+	// asynchronously
 	go func() {
-		if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if httpServer.TLSConfig != nil {
+			err = httpServer.ServeTLS(ln, "", "")
+		} else {
+			err = httpServer.Serve(ln)
+		}
+		if err != http.ErrServerClosed {
 			a.mu.Lock()
 			a.serverState = StateError
 			a.mu.Unlock()
@@ -194,40 +412,75 @@ func (a *App) StartServer() error {
 		}
 	}()
 
-	// Give server time to start
-	time.Sleep(50 * time.Millisecond)
-
 	// Store references and set running state
 	a.mu.Lock()
 	a.nats = nats
 	a.relay = r
 	a.httpServer = httpServer
+	a.fingerprint = fingerprint
 	a.serverState = StateRunning
 	a.mu.Unlock()
 
 	// Register mDNS hostname (vtt-remote.local)
-	mdns, err := zeroconf.Register(
-		"vtt-remote",     // Instance name (becomes vtt-remote.local)
-		"_http._tcp",     // Service type
-		"local.",         // Domain
-		port,             // Port
-		[]string{"path=/ws"}, // TXT records
-		nil,              // Interfaces (nil = all)
-	)
-	if err != nil {
-		a.addLog("warn", fmt.Sprintf("mDNS registration failed: %v", err))
-	} else {
+	serviceTypes := []string{discovery.ServiceType}
+	if a.mdnsLegacy {
+		serviceTypes = append(serviceTypes, discovery.LegacyServiceType)
+	}
+	for _, serviceType := range serviceTypes {
+		mdns, err := zeroconf.Register(
+			"vtt-remote",                // Instance name (becomes vtt-remote.local)
+			serviceType,                 // Service type
+			discovery.Domain,            // Domain
+			port,                        // Port
+			discovery.Text(version, ""), // TXT records; the room hint follows Foundry
+			nil,                         // Interfaces (nil = all)
+		)
+		if err != nil {
+			a.addLog("warn", fmt.Sprintf("mDNS registration as %s failed: %v", serviceType, err))
+			continue
+		}
 		a.mu.Lock()
-		a.mdnsServer = mdns
+		a.mdnsServers = append(a.mdnsServers, mdns)
 		a.mu.Unlock()
-		a.addLog("info", "Registered vtt-remote.local via mDNS")
+		a.addLog("info", fmt.Sprintf("Registered vtt-remote.local via mDNS as %s", serviceType))
 	}
 
 	a.emitStatus()
 	a.addLog("info", fmt.Sprintf("Server started on port %d", port))
+
+	// Listening isn't proof the WebSocket path works, so try it
+	go func() { _ = a.RunSelfCheck() }()
 	return nil
 }
 
+// listen binds the first free port from start, trying up to attempts
+// consecutive ports. Only "address in use" errors move on to the next
+// port; anything else is returned immediately.
+func (a *App) listen(start, attempts int) (net.Listener, error) {
+	for port := start; port < start+max(attempts, 1) && port <= 65535; port++ {
+		ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err == nil {
+			return ln, nil
+		}
+		if !isAddrInUse(err) {
+			return nil, err
+		}
+		a.addLog("warn", fmt.Sprintf("Port %d is in use", port))
+	}
+	if attempts <= 1 {
+		return nil, fmt.Errorf("port %d is in use by another application", start)
+	}
+	return nil, fmt.Errorf("ports %d-%d are all in use", start, min(start+attempts-1, 65535))
+}
+
+// isAddrInUse reports whether err is a bind failure because the port is
+// taken. Windows reports WSAEADDRINUSE rather than EADDRINUSE.
+func isAddrInUse(err error) bool {
+	const wsaeaddrinuse = 10048
+	var errno syscall.Errno
+	return errors.As(err, &errno) && (errno == syscall.EADDRINUSE || errno == wsaeaddrinuse)
+}
+
 // StopServer stops the relay server.
 func (a *App) StopServer() error {
 	a.mu.Lock()
@@ -240,17 +493,20 @@ func (a *App) StopServer() error {
 	httpServer := a.httpServer
 	relayInstance := a.relay
 	natsInstance := a.nats
-	mdnsInstance := a.mdnsServer
+	mdnsServers := a.mdnsServers
 	a.httpServer = nil
 	a.relay = nil
 	a.nats = nil
-	a.mdnsServer = nil
+	a.mdnsServers = nil
+	a.mdnsRoom = ""
+	a.fingerprint = ""
+	a.lastError = ""
 	a.serverState = StateStopped
 	a.mu.Unlock()
 
 	// Shutdown outside of lock
-	if mdnsInstance != nil {
-		mdnsInstance.Shutdown()
+	for _, mdns := range mdnsServers {
+		mdns.Shutdown()
 	}
 	if httpServer != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -258,6 +514,12 @@ func (a *App) StopServer() error {
 		cancel()
 	}
 	if relayInstance != nil {
+		// http.Server.Shutdown does not close hijacked WebSocket connections
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := relayInstance.Shutdown(ctx); err != nil {
+			a.addLog("warn", fmt.Sprintf("Client drain incomplete: %v", err))
+		}
+		cancel()
 		relayInstance.Close()
 	}
 	if natsInstance != nil {
@@ -269,16 +531,130 @@ func (a *App) StopServer() error {
 	return nil
 }
 
+// RestartServer stops the server if it is running or has failed, then
+// starts it again on the configured port. Status is emitted at each step
+// so the UI shows the transition. It returns the start error, if any.
+func (a *App) RestartServer() error {
+	a.mu.RLock()
+	state := a.serverState
+	a.mu.RUnlock()
+	if state == StateStarting {
+		return fmt.Errorf("server is still starting")
+	}
+
+	if state != StateStopped {
+		a.addLog("info", "Restarting server...")
+		if err := a.StopServer(); err != nil {
+			return err
+		}
+	}
+	return a.StartServer()
+}
+
+// selfCheckTimeout bounds each step of the self-check.
+const selfCheckTimeout = 5 * time.Second
+
+// RunSelfCheck connects to the running server like a phone would, joins
+// a throwaway room, and waits for its ROOM_STATUS. A failure puts the
+// server in StateError with the reason; a later success clears it.
+// StartServer runs it automatically.
+func (a *App) RunSelfCheck() error {
+	a.mu.RLock()
+	httpServer, port, useTLS := a.httpServer, a.port, a.tlsSelfSigned
+	a.mu.RUnlock()
+	if httpServer == nil {
+		return fmt.Errorf("server not running")
+	}
+
+	scheme := "ws"
+	if useTLS {
+		scheme = "wss"
+	}
+	err := selfCheck(fmt.Sprintf("%s://127.0.0.1:%d/ws", scheme, port), selfCheckTimeout)
+
+	a.mu.Lock()
+	if a.httpServer != httpServer {
+		// Stopped or restarted while checking; the result is stale
+		a.mu.Unlock()
+		return err
+	}
+	if err != nil {
+		a.serverState = StateError
+		a.lastError = fmt.Sprintf("Self-check failed: %v", err)
+	} else if a.lastError != "" {
+		a.serverState = StateRunning
+		a.lastError = ""
+	}
+	a.mu.Unlock()
+	a.emitStatus()
+
+	if err != nil {
+		a.addLog("error", fmt.Sprintf("Self-check failed: %v", err))
+		return err
+	}
+	a.addLog("info", "Self-check passed: WebSocket relay is answering")
+	return nil
+}
+
+// selfCheck dials wsURL, sends JOIN to a random room, and waits for the
+// relay's ROOM_STATUS.
+func selfCheck(wsURL string, timeout time.Duration) error {
+	dialer := websocket.Dialer{
+		HandshakeTimeout: timeout,
+		// The server's self-signed certificate is our own, reached over loopback
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	conn, _, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %s: %w", wsURL, err)
+	}
+	defer conn.Close()
+
+	join, err := relay.MakeEnvelope(relay.TypeJoin, relay.JoinPayload{
+		Room: fmt.Sprintf("CHK%05d", rand.IntN(100000)),
+	})
+	if err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	if err := conn.WriteMessage(websocket.TextMessage, join); err != nil {
+		return fmt.Errorf("cannot send JOIN: %w", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("no ROOM_STATUS after JOIN: %w", err)
+		}
+		if env, err := relay.ParseEnvelope(data); err == nil && env.Type == relay.TypeRoomStatus {
+			break
+		}
+	}
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	return nil
+}
+
 // GetStatus returns current server status.
 func (a *App) GetStatus() ServerStatus {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
+	return a.statusLocked()
+}
 
+// statusLocked builds the status reported by GetStatus and the
+// serverStatus event. Caller must hold a.mu lock.
+func (a *App) statusLocked() ServerStatus {
 	return ServerStatus{
 		State:         a.serverState,
 		Port:          a.port,
-		LocalIP:       getLocalIP(),
+		LocalIP:       a.localIPLocked(),
+		LocalIPs:      localIPStrings(),
 		LocalHostname: getLocalHostname(),
+		TLS:           a.tlsSelfSigned,
+		Fingerprint:   a.fingerprint,
+		Error:         a.lastError,
 	}
 }
 
@@ -292,32 +668,225 @@ func (a *App) GetStats() ClientStats {
 	}
 
 	stats := a.relay.Stats()
+	rooms := make([]RoomStats, 0, len(stats.Rooms))
+	for code, room := range stats.Rooms {
+		rooms = append(rooms, RoomStats{
+			Room:         code,
+			FoundryCount: room.FoundryCount,
+			PhoneCount:   room.PhoneCount,
+			LastActivity: room.LastActivity.Format("15:04:05"),
+		})
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Room < rooms[j].Room })
+
 	return ClientStats{
 		RoomCount:    stats.RoomCount,
 		FoundryCount: stats.FoundryCount,
 		PhoneCount:   stats.PhoneCount,
 		TotalClients: stats.ClientCount,
+
+		AverageSessionSeconds: stats.AverageSessionDuration.Seconds(),
+		Rooms:                 rooms,
 	}
 }
 
-// SetPort configures the server port (while stopped).
-func (a *App) SetPort(port int) error {
+// refreshMDNSRoom updates the room hint in the mDNS TXT records when the
+// set of rooms with Foundry connected changes.
+func (a *App) refreshMDNSRoom() {
+	a.mu.RLock()
+	r := a.relay
+	a.mu.RUnlock()
+	if r == nil {
+		return
+	}
+	room := roomHint(r.ListRooms())
+
 	a.mu.Lock()
 	defer a.mu.Unlock()
+	if room == a.mdnsRoom || len(a.mdnsServers) == 0 {
+		return
+	}
+	a.mdnsRoom = room
+	for _, mdns := range a.mdnsServers {
+		mdns.SetText(discovery.Text(version, room))
+	}
+}
+
+// roomHint returns the only room with Foundry connected, or "" if there
+// are none or several.
+func roomHint(rooms []relay.RoomInfo) string {
+	hint := ""
+	for _, room := range rooms {
+		if !room.FoundryConnected {
+			continue
+		}
+		if hint != "" {
+			return ""
+		}
+		hint = room.Room
+	}
+	return hint
+}
+
+// GetRooms returns details of every active room.
+func (a *App) GetRooms() []RoomDetails {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.relay == nil {
+		return []RoomDetails{}
+	}
+
+	rooms := a.relay.ListRooms()
+	details := make([]RoomDetails, 0, len(rooms))
+	for _, room := range rooms {
+		clients := make([]ClientDetails, 0, len(room.Clients))
+		for _, c := range room.Clients {
+			clients = append(clients, ClientDetails{
+				ID:              c.ID,
+				Type:            string(c.Type),
+				ConnectedAt:     c.ConnectedAt.Format("15:04:05"),
+				DurationSeconds: c.Duration.Seconds(),
+			})
+		}
+		details = append(details, RoomDetails{
+			Room:             room.Room,
+			FoundryConnected: room.FoundryConnected,
+			PhoneCount:       room.PhoneCount,
+			Clients:          clients,
+		})
+	}
+	return details
+}
+
+// CloseRoom disconnects every client in a room.
+func (a *App) CloseRoom(room string) error {
+	a.mu.RLock()
+	r := a.relay
+	a.mu.RUnlock()
+
+	if r == nil {
+		return fmt.Errorf("server not running")
+	}
+	return r.CloseRoom(room)
+}
+
+// KickClient disconnects a single client from a room.
+func (a *App) KickClient(room, clientID string) error {
+	a.mu.RLock()
+	r := a.relay
+	a.mu.RUnlock()
+
+	if r == nil {
+		return fmt.Errorf("server not running")
+	}
+	return r.KickClient(room, clientID)
+}
+
+// Announce sends an ANNOUNCEMENT with message to every client in a room.
+func (a *App) Announce(room, message string) error {
+	a.mu.RLock()
+	r := a.relay
+	a.mu.RUnlock()
+
+	if r == nil {
+		return fmt.Errorf("server not running")
+	}
+	if strings.TrimSpace(message) == "" {
+		return fmt.Errorf("message is empty")
+	}
+	return r.Broadcast(room, relay.TypeAnnouncement, relay.AnnouncementPayload{Message: message})
+}
 
+// SetPort configures the server port (while stopped) and saves it for
+// the next launch.
+func (a *App) SetPort(port int) error {
+	a.mu.Lock()
 	if a.serverState == StateRunning {
+		a.mu.Unlock()
 		return fmt.Errorf("cannot change port while running")
 	}
 	if port < 1 || port > 65535 {
+		a.mu.Unlock()
 		return fmt.Errorf("invalid port number: %d", port)
 	}
 	a.port = port
+	a.mu.Unlock()
+	return a.saveSettings()
+}
+
+// SetAdvertiseIP chooses which local address goes in the server URL and
+// QR code. It must be one of ServerStatus.LocalIPs; empty restores the
+// automatic choice.
+func (a *App) SetAdvertiseIP(ip string) error {
+	if ip != "" {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return fmt.Errorf("invalid IP address: %s", ip)
+		}
+		found := false
+		for _, candidate := range listLocalIPs() {
+			if candidate.Equal(parsed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s is not an address of this machine", ip)
+		}
+		ip = parsed.String()
+	}
+
+	a.mu.Lock()
+	a.advertiseIP = ip
+	a.emitStatusLocked()
+	a.mu.Unlock()
 	return nil
 }
 
-// GetServerURL returns the full server URL for QR code.
+// localIPLocked returns the address to advertise to phones.
+// Caller must hold a.mu lock.
+func (a *App) localIPLocked() string {
+	if a.advertiseIP != "" {
+		return a.advertiseIP
+	}
+	return getLocalIP()
+}
+
+// GetServerURL returns the full server URL for QR code, using https
+// when the server runs with a self-signed certificate.
 func (a *App) GetServerURL() string {
-	return fmt.Sprintf("http://%s:%d", getLocalIP(), a.port)
+	a.mu.RLock()
+	host, port, useTLS := a.localIPLocked(), a.port, a.tlsSelfSigned
+	a.mu.RUnlock()
+	scheme := "http://"
+	if useTLS {
+		scheme = "https://"
+	}
+	return scheme + net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// GetServerQR returns a PNG QR code of the phone client URL, or nil if
+// the server is not running.
+func (a *App) GetServerQR() []byte {
+	a.mu.RLock()
+	running := a.serverState == StateRunning
+	a.mu.RUnlock()
+	if !running {
+		return nil
+	}
+
+	png, err := qrcode.Encode(a.GetServerURL(), qrcode.Medium, 256)
+	if err != nil {
+		a.addLog("warn", fmt.Sprintf("Failed to generate QR code: %v", err))
+		return nil
+	}
+	return png
+}
+
+// GetVersion returns the build information embedded at link time.
+func (a *App) GetVersion() VersionInfo {
+	return VersionInfo{Version: version, Commit: commit, BuildDate: buildDate}
 }
 
 // DetectFoundryPath attempts to find Foundry VTT data directory.
@@ -367,17 +936,79 @@ func (a *App) GetModuleStatus(dataPath string) FoundryModuleStatus {
 		return status
 	}
 
-	modulePath := filepath.Join(dataPath, "modules", "arcane-grimoire-vtt-remote")
+	modulePath := filepath.Join(dataPath, "modules", foundryModuleID)
 	manifestPath := filepath.Join(modulePath, "module.json")
 
-	if _, err := os.Stat(manifestPath); err == nil {
-		status.Installed = true
-		// Could parse module.json for version
+	if _, err := os.Stat(manifestPath); err != nil {
+		return status
+	}
+	status.Installed = true
+
+	version, err := readModuleVersion(os.DirFS(modulePath))
+	if err != nil {
+		a.addLog("warn", fmt.Sprintf("Could not read installed module version from %s: %v", manifestPath, err))
+		return status
+	}
+	status.Version = version
+
+	// A missing bundle just means there is nothing to update from
+	bundled, err := readModuleVersion(bundledModule)
+	if err == nil {
+		status.BundledVersion = bundled
+		status.UpdateAvailable = compareVersions(bundled, version) > 0
 	}
 
 	return status
 }
 
+// readModuleVersion returns the version field of the module.json manifest
+// at the root of fsys.
+func readModuleVersion(fsys fs.FS) (string, error) {
+	data, err := fs.ReadFile(fsys, "module.json")
+	if err != nil {
+		return "", err
+	}
+	var manifest struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", fmt.Errorf("parse module.json: %w", err)
+	}
+	if manifest.Version == "" {
+		return "", fmt.Errorf("module.json has no version")
+	}
+	return manifest.Version, nil
+}
+
+// compareVersions compares dotted versions such as "0.1.3" numerically,
+// returning -1, 0, or 1. A leading "v" is ignored, missing parts count as
+// zero, and non-numeric parts compare as strings.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		if xerr == nil && yerr == nil {
+			if xn != yn {
+				return cmp.Compare(xn, yn)
+			}
+			continue
+		}
+		if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
 // InstallModule copies the Foundry module to the data directory.
 func (a *App) InstallModule(dataPath string) error {
 	if dataPath == "" {
@@ -385,7 +1016,14 @@ func (a *App) InstallModule(dataPath string) error {
 	}
 
 	modulesDir := filepath.Join(dataPath, "modules")
-	targetDir := filepath.Join(modulesDir, "arcane-grimoire-vtt-remote")
+	targetDir, err := moduleInstallDir(dataPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fs.Stat(bundledModule, "module.json"); err != nil {
+		return fmt.Errorf("this build does not include the Foundry module")
+	}
 
 	// Create modules directory if needed
 	if err := os.MkdirAll(modulesDir, 0755); err != nil {
@@ -400,28 +1038,37 @@ func (a *App) InstallModule(dataPath string) error {
 		return fmt.Errorf("failed to create module directory: %w", err)
 	}
 
-	// Copy module files from dist/foundry-module
-	sourceDir := filepath.Join("..", "dist", "foundry-module")
-
-	err := filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+	// Copy the embedded module files
+	err = fs.WalkDir(bundledModule, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		relPath, _ := filepath.Rel(sourceDir, path)
-		targetPath := filepath.Join(targetDir, relPath)
+		// Skip placeholders such as .gitkeep
+		if path != "." && strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		targetPath := filepath.Join(targetDir, filepath.FromSlash(path))
 
-		if info.IsDir() {
-			return os.MkdirAll(targetPath, info.Mode())
+		if d.IsDir() {
+			return os.MkdirAll(targetPath, 0755)
 		}
 
-		srcFile, err := os.Open(path)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		srcFile, err := bundledModule.Open(path)
 		if err != nil {
 			return err
 		}
 		defer srcFile.Close()
 
-		dstFile, err := os.Create(targetPath)
+		// Embedded files are read-only, so keep their other bits but
+		// make the copy writable for later reinstalls
+		dstFile, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm()|0644)
 		if err != nil {
 			return err
 		}
@@ -436,9 +1083,61 @@ func (a *App) InstallModule(dataPath string) error {
 	}
 
 	a.addLog("info", fmt.Sprintf("Module installed to %s", targetDir))
+
+	a.mu.Lock()
+	a.foundryPath = dataPath
+	a.mu.Unlock()
+	if err := a.saveSettings(); err != nil {
+		a.addLog("warn", err.Error())
+	}
 	return nil
 }
 
+// UninstallModule removes the Foundry module from the data directory.
+func (a *App) UninstallModule(dataPath string) error {
+	if dataPath == "" {
+		return fmt.Errorf("no data path specified")
+	}
+
+	targetDir, err := moduleInstallDir(dataPath)
+	if err != nil {
+		a.addLog("error", fmt.Sprintf("Refusing to uninstall module: %v", err))
+		return err
+	}
+
+	if _, err := os.Lstat(targetDir); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("module is not installed in %s", dataPath)
+	} else if err != nil {
+		return fmt.Errorf("failed to check module directory: %w", err)
+	}
+
+	// RemoveAll deletes a symlinked install's link, not its target
+	if err := os.RemoveAll(targetDir); err != nil {
+		return fmt.Errorf("failed to remove module: %w", err)
+	}
+
+	a.addLog("info", fmt.Sprintf("Module removed from %s", targetDir))
+	return nil
+}
+
+// moduleInstallDir returns the module's directory under dataPath's modules
+// folder. It refuses data paths containing ".." so a bad path can never
+// point RemoveAll somewhere unexpected.
+func moduleInstallDir(dataPath string) (string, error) {
+	for _, part := range strings.FieldsFunc(dataPath, func(r rune) bool { return r == '/' || r == filepath.Separator }) {
+		if part == ".." {
+			return "", fmt.Errorf("data path %s must not contain \"..\"", dataPath)
+		}
+	}
+
+	modulesDir := filepath.Join(dataPath, "modules")
+	targetDir := filepath.Join(modulesDir, foundryModuleID)
+	if rel, err := filepath.Rel(modulesDir, targetDir); err != nil || rel != foundryModuleID {
+		return "", fmt.Errorf("module directory %s is outside %s", targetDir, modulesDir)
+	}
+	return targetDir, nil
+}
+
 // GetLogs returns recent log entries.
 func (a *App) GetLogs() []LogEntry {
 	a.mu.RLock()
@@ -449,6 +1148,53 @@ func (a *App) GetLogs() []LogEntry {
 	return logs
 }
 
+// ExportLogs writes the log buffer to path, one entry per line: as JSON
+// objects if path ends in .json, .jsonl, or .ndjson, otherwise as text
+// like the log panel's.
+func (a *App) ExportLogs(path string) error {
+	if path == "" {
+		return fmt.Errorf("no export path specified")
+	}
+	logs := a.GetLogs()
+
+	var out strings.Builder
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".jsonl", ".ndjson":
+		enc := json.NewEncoder(&out)
+		for _, entry := range logs {
+			if err := enc.Encode(entry); err != nil {
+				return fmt.Errorf("failed to encode logs: %w", err)
+			}
+		}
+	default:
+		for _, entry := range logs {
+			fmt.Fprintf(&out, "%s [%s] %s\n", entry.Timestamp, entry.Level, entry.Message)
+		}
+	}
+	if err := os.WriteFile(path, []byte(out.String()), 0644); err != nil {
+		return fmt.Errorf("failed to export logs: %w", err)
+	}
+
+	a.addLog("info", fmt.Sprintf("Exported %d log entries to %s", len(logs), path))
+	return nil
+}
+
+// ChooseLogExportPath shows a save dialog for ExportLogs. It returns ""
+// if the user cancels.
+func (a *App) ChooseLogExportPath() (string, error) {
+	if a.ctx == nil {
+		return "", fmt.Errorf("no window to show a dialog in")
+	}
+	return wailsruntime.SaveFileDialog(a.ctx, wailsruntime.SaveDialogOptions{
+		Title:           "Export Logs",
+		DefaultFilename: "vtt-remote-logs-" + time.Now().Format("2006-01-02") + ".txt",
+		Filters: []wailsruntime.FileFilter{
+			{DisplayName: "Text (*.txt)", Pattern: "*.txt"},
+			{DisplayName: "JSON Lines (*.jsonl)", Pattern: "*.jsonl"},
+		},
+	})
+}
+
 // ClearLogs clears the log buffer.
 func (a *App) ClearLogs() {
 	a.mu.Lock()
@@ -456,7 +1202,8 @@ func (a *App) ClearLogs() {
 	a.logs = make([]LogEntry, 0)
 }
 
-// addLog adds a log entry and emits to frontend.
+// addLog adds a log entry and emits to frontend. Entries below the
+// minimum level are only counted.
 func (a *App) addLog(level, message string) {
 	entry := LogEntry{
 		Timestamp: time.Now().Format("15:04:05"),
@@ -465,11 +1212,13 @@ func (a *App) addLog(level, message string) {
 	}
 
 	a.mu.Lock()
-	a.logs = append(a.logs, entry)
-	// Keep only last 500 entries
-	if len(a.logs) > 500 {
-		a.logs = a.logs[len(a.logs)-500:]
+	a.logCounts[relay.LogLevel(level)]++
+	if !relay.LogLevel(level).AtLeast(a.minLevel) {
+		a.mu.Unlock()
+		return
 	}
+	a.logs = append(a.logs, entry)
+	a.trimLogsLocked()
 	a.mu.Unlock()
 
 	// Emit to frontend
@@ -478,6 +1227,174 @@ func (a *App) addLog(level, message string) {
 	}
 }
 
+// trimLogsLocked drops the oldest entries beyond logCapacity.
+// Callers must hold a.mu.
+func (a *App) trimLogsLocked() {
+	if len(a.logs) > a.logCapacity {
+		a.logs = a.logs[len(a.logs)-a.logCapacity:]
+	}
+}
+
+// SetLogCapacity sets how many log entries are kept, dropping the oldest
+// if there are already more, and saves it for the next launch.
+func (a *App) SetLogCapacity(n int) error {
+	if n < 1 || n > maxLogCapacity {
+		return fmt.Errorf("log capacity must be between 1 and %d, got %d", maxLogCapacity, n)
+	}
+	a.mu.Lock()
+	a.logCapacity = n
+	a.trimLogsLocked()
+	a.mu.Unlock()
+	return a.saveSettings()
+}
+
+// SetLogLevel sets the least severe level (debug, info, warn, or error)
+// kept in the log, and saves it for the next launch. Entries already
+// kept are not removed.
+func (a *App) SetLogLevel(level string) error {
+	minLevel, err := relay.ParseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.minLevel = minLevel
+	a.mu.Unlock()
+	return a.saveSettings()
+}
+
+// GetLogCounts returns how many entries have been logged at each level,
+// including those below the minimum level.
+func (a *App) GetLogCounts() map[string]int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	counts := make(map[string]int, len(a.logCounts))
+	for level, n := range a.logCounts {
+		counts[string(level)] = n
+	}
+	return counts
+}
+
+// Settings are the App preferences persisted between launches.
+type Settings struct {
+	Port        int    `json:"port,omitempty"`
+	FoundryPath string `json:"foundryPath,omitempty"` // from the last successful module install
+	LogCapacity int    `json:"logCapacity,omitempty"`
+	LogLevel    string `json:"logLevel,omitempty"`
+}
+
+// GetSettings returns the current settings.
+func (a *App) GetSettings() Settings {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.settingsLocked()
+}
+
+// settingsLocked returns the current settings. Callers must hold a.mu.
+func (a *App) settingsLocked() Settings {
+	return Settings{
+		Port:        a.port,
+		FoundryPath: a.foundryPath,
+		LogCapacity: a.logCapacity,
+		LogLevel:    string(a.minLevel),
+	}
+}
+
+// SaveSettings applies s and writes it to the settings file. Every field
+// must be valid, and the port can only change while the server is
+// stopped.
+func (a *App) SaveSettings(s Settings) error {
+	if s.Port < 1 || s.Port > 65535 {
+		return fmt.Errorf("invalid port number: %d", s.Port)
+	}
+	if s.LogCapacity < 1 || s.LogCapacity > maxLogCapacity {
+		return fmt.Errorf("log capacity must be between 1 and %d, got %d", maxLogCapacity, s.LogCapacity)
+	}
+	minLevel, err := relay.ParseLogLevel(s.LogLevel)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	if s.Port != a.port && a.serverState == StateRunning {
+		a.mu.Unlock()
+		return fmt.Errorf("cannot change port while running")
+	}
+	a.port = s.Port
+	a.foundryPath = s.FoundryPath
+	a.logCapacity = s.LogCapacity
+	a.trimLogsLocked()
+	a.minLevel = minLevel
+	a.mu.Unlock()
+	return a.saveSettings()
+}
+
+// defaultSettingsFile returns the settings file in the user's config
+// directory, or "" if there is none.
+func defaultSettingsFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "vtt-remote", "settings.json")
+}
+
+// loadSettings applies settings saved by an earlier launch. A missing
+// file leaves the defaults; an unreadable or corrupt one is logged and
+// ignored, as are invalid fields.
+func (a *App) loadSettings() {
+	if a.settingsFile == "" {
+		return
+	}
+	data, err := os.ReadFile(a.settingsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	var saved Settings
+	if err == nil {
+		err = json.Unmarshal(data, &saved)
+	}
+	if err != nil {
+		a.addLog("warn", fmt.Sprintf("Ignoring settings file %s: %v", a.settingsFile, err))
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if saved.Port >= 1 && saved.Port <= 65535 {
+		a.port = saved.Port
+	}
+	a.foundryPath = saved.FoundryPath
+	if saved.LogCapacity >= 1 && saved.LogCapacity <= maxLogCapacity {
+		a.logCapacity = saved.LogCapacity
+		a.trimLogsLocked()
+	}
+	if minLevel, err := relay.ParseLogLevel(saved.LogLevel); err == nil {
+		a.minLevel = minLevel
+	}
+}
+
+// saveSettings writes the current settings to settingsFile.
+func (a *App) saveSettings() error {
+	if a.settingsFile == "" {
+		return nil
+	}
+	a.mu.RLock()
+	current := a.settingsLocked()
+	a.mu.RUnlock()
+
+	data, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(a.settingsFile), 0755); err != nil {
+		return fmt.Errorf("failed to save settings: %w", err)
+	}
+	if err := os.WriteFile(a.settingsFile, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to save settings: %w", err)
+	}
+	return nil
+}
+
 // emitStatus emits the current server status to the frontend.
 // Must be called WITHOUT holding the lock - it will acquire its own.
 func (a *App) emitStatus() {
@@ -486,30 +1403,75 @@ func (a *App) emitStatus() {
 	}
 }
 
+// emitStats pushes fresh client stats to the frontend.
+// Must be called WITHOUT holding the lock - it will acquire its own.
+func (a *App) emitStats() {
+	if a.ctx != nil {
+		wailsruntime.EventsEmit(a.ctx, "stats", a.GetStats())
+	}
+}
+
 // emitStatusLocked emits status when lock is already held.
 // Caller must hold a.mu lock.
 func (a *App) emitStatusLocked() {
 	if a.ctx != nil {
-		status := ServerStatus{
-			State:         a.serverState,
-			Port:          a.port,
-			LocalIP:       getLocalIP(),
-			LocalHostname: getLocalHostname(),
-		}
-		wailsruntime.EventsEmit(a.ctx, "serverStatus", status)
+		wailsruntime.EventsEmit(a.ctx, "serverStatus", a.statusLocked())
 	}
 }
 
-// getLocalIP returns the preferred outbound IP of this machine.
+// getLocalIP returns the preferred outbound IP of this machine. Without
+// a default route it falls back to the first candidate from
+// listLocalIPs, then to "localhost".
 func getLocalIP() string {
-	conn, err := net.Dial("udp", "8.8.8.8:80")
+	if conn, err := net.Dial("udp", "8.8.8.8:80"); err == nil {
+		defer conn.Close()
+		return conn.LocalAddr().(*net.UDPAddr).IP.String()
+	}
+	if ips := listLocalIPs(); len(ips) > 0 {
+		return ips[0].String()
+	}
+	return "localhost"
+}
+
+// interfaceAddrs lists the machine's interface addresses. Tests replace it.
+var interfaceAddrs = net.InterfaceAddrs
+
+// listLocalIPs returns the addresses phones on the LAN could use to reach
+// this machine: every interface address except loopback, link-local,
+// and multicast, with IPv4 before IPv6.
+func listLocalIPs() []net.IP {
+	addrs, err := interfaceAddrs()
 	if err != nil {
-		return "localhost"
+		return nil
 	}
-	defer conn.Close()
 
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
-	return localAddr.IP.String()
+	var v4, v6 []net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipNet.IP
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() {
+			continue
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			v4 = append(v4, ip4)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	return append(v4, v6...)
+}
+
+// localIPStrings returns listLocalIPs as strings.
+func localIPStrings() []string {
+	ips := listLocalIPs()
+	strs := make([]string, len(ips))
+	for i, ip := range ips {
+		strs[i] = ip.String()
+	}
+	return strs
 }
 
 // getLocalHostname returns the machine's .local mDNS hostname.
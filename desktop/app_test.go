@@ -0,0 +1,770 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sam-phinizy/vtt-remote/pkg/relay"
+)
+
+// bindPort holds a listener on a random free port for the test's duration.
+func bindPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to bind: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestListenFallback(t *testing.T) {
+	a := NewApp(false)
+	busy := bindPort(t)
+
+	ln, err := a.listen(busy, defaultPortAttempts)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+	if port <= busy || port >= busy+defaultPortAttempts {
+		t.Errorf("listen(%d) bound %d, want a later port within %d", busy, port, defaultPortAttempts)
+	}
+
+	logged := false
+	for _, entry := range a.GetLogs() {
+		if strings.Contains(entry.Message, "in use") {
+			logged = true
+		}
+	}
+	if !logged {
+		t.Error("Expected a log line for the busy port")
+	}
+}
+
+func TestListenExhausted(t *testing.T) {
+	a := NewApp(false)
+	busy := bindPort(t)
+
+	if _, err := a.listen(busy, 1); err == nil {
+		t.Error("Expected an error when the only allowed port is busy")
+	}
+}
+
+func TestStartServerPortBusy(t *testing.T) {
+	a := NewApp(false)
+	a.portAttempts = 1
+	busy := bindPort(t)
+	if err := a.SetPort(busy); err != nil {
+		t.Fatal(err)
+	}
+
+	err := a.StartServer()
+	if err == nil {
+		a.StopServer()
+		t.Fatal("StartServer succeeded on a busy port")
+	}
+	if !strings.Contains(err.Error(), strconv.Itoa(busy)) || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("Error %q does not name the busy port", err)
+	}
+	if state := a.GetStatus().State; state != StateError {
+		t.Errorf("State = %s, want error", state)
+	}
+
+	// The failed start released everything, so a retry can succeed
+	a.portAttempts = defaultPortAttempts
+	if err := a.StartServer(); err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	a.StopServer()
+}
+
+func TestStartServerPortFallback(t *testing.T) {
+	a := NewApp(false)
+	busy := bindPort(t)
+	if err := a.SetPort(busy); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.StartServer(); err != nil {
+		t.Fatalf("StartServer: %v", err)
+	}
+	defer a.StopServer()
+
+	status := a.GetStatus()
+	if status.State != StateRunning {
+		t.Fatalf("State = %s, want running", status.State)
+	}
+	if status.Port == busy {
+		t.Errorf("Server reports busy port %d", busy)
+	}
+	if !strings.HasSuffix(a.GetServerURL(), ":"+strconv.Itoa(status.Port)) {
+		t.Errorf("GetServerURL() = %s, want port %d", a.GetServerURL(), status.Port)
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(status.Port))
+	if err != nil {
+		t.Fatalf("Server not listening on port %d: %v", status.Port, err)
+	}
+	conn.Close()
+}
+
+func TestStatusTLS(t *testing.T) {
+	a := NewApp(true)
+	if err := a.SetPort(bindPort(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.StartServer(); err != nil {
+		t.Fatalf("StartServer: %v", err)
+	}
+	defer a.StopServer()
+
+	status := a.GetStatus()
+	if !status.TLS || status.Fingerprint == "" {
+		t.Errorf("GetStatus() = %+v, want TLS with a fingerprint", status)
+	}
+
+	// The serverStatus event carries the same status
+	a.mu.RLock()
+	emitted := a.statusLocked()
+	a.mu.RUnlock()
+	if !reflect.DeepEqual(emitted, status) {
+		t.Errorf("serverStatus event = %+v, want %+v", emitted, status)
+	}
+}
+
+func TestRestartServer(t *testing.T) {
+	// The configured port stays busy, so each start falls back to a later one
+	a := NewApp(false)
+	if err := a.SetPort(bindPort(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	// From stopped, restarting just starts
+	if err := a.RestartServer(); err != nil {
+		t.Fatalf("RestartServer from stopped: %v", err)
+	}
+	defer a.StopServer()
+
+	if err := a.RestartServer(); err != nil {
+		t.Fatalf("RestartServer from running: %v", err)
+	}
+	status := a.GetStatus()
+	if status.State != StateRunning {
+		t.Fatalf("State = %s, want running", status.State)
+	}
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(status.Port))
+	if err != nil {
+		t.Fatalf("Server not listening on port %d after restart: %v", status.Port, err)
+	}
+	conn.Close()
+}
+
+func TestRestartServerFromError(t *testing.T) {
+	a := NewApp(false)
+	a.portAttempts = 1
+	busy := bindPort(t)
+	if err := a.SetPort(busy); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.StartServer(); err == nil {
+		a.StopServer()
+		t.Fatal("StartServer succeeded on a busy port")
+	}
+
+	a.portAttempts = defaultPortAttempts
+	if err := a.RestartServer(); err != nil {
+		t.Fatalf("RestartServer from error: %v", err)
+	}
+	defer a.StopServer()
+	if status := a.GetStatus(); status.State != StateRunning || status.Port == busy {
+		t.Errorf("GetStatus() = %+v, want running on a port other than %d", status, busy)
+	}
+}
+
+func TestRunSelfCheck(t *testing.T) {
+	a := NewApp(false)
+	if err := a.RunSelfCheck(); err == nil {
+		t.Error("RunSelfCheck succeeded with the server stopped")
+	}
+
+	if err := a.SetPort(bindPort(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.StartServer(); err != nil {
+		t.Fatalf("StartServer: %v", err)
+	}
+	defer a.StopServer()
+	if err := a.RunSelfCheck(); err != nil {
+		t.Fatalf("RunSelfCheck: %v", err)
+	}
+	if status := a.GetStatus(); status.State != StateRunning || status.Error != "" {
+		t.Errorf("GetStatus() = %+v, want running without error", status)
+	}
+}
+
+func TestConnectRateLimit(t *testing.T) {
+	a := NewApp(false)
+	a.connectRate = 3
+	if err := a.SetPort(bindPort(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.StartServer(); err != nil {
+		t.Fatalf("StartServer: %v", err)
+	}
+	defer a.StopServer()
+
+	// The startup self-check may have used one of the three
+	wsURL := "ws://127.0.0.1:" + strconv.Itoa(a.GetStatus().Port) + "/ws"
+	accepted := 0
+	for range 4 {
+		conn, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		if err == nil {
+			conn.Close()
+			accepted++
+			continue
+		}
+		if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("Dial = %v, want success or 429", err)
+		}
+		break
+	}
+	if accepted < 2 || accepted > 3 {
+		t.Errorf("Accepted %d rapid connections, want the limit of 3 less any self-check", accepted)
+	}
+}
+
+func TestSelfCheckBrokenRelay(t *testing.T) {
+	// Accepts the upgrade but never answers JOIN
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+		conn.ReadMessage()
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	err := selfCheck(wsURL, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "ROOM_STATUS") {
+		t.Errorf("selfCheck = %v, want a missing ROOM_STATUS error", err)
+	}
+	if err := selfCheck("ws://"+closedAddr(t)+"/ws", time.Second); err == nil || !strings.Contains(err.Error(), "cannot connect") {
+		t.Errorf("selfCheck(closed port) = %v, want a connect error", err)
+	}
+}
+
+// closedAddr returns a local address with nothing listening on it.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+// installManifest writes manifest as the installed module.json under a new
+// Foundry data directory and returns the directory.
+func installManifest(t *testing.T, manifest []byte) string {
+	t.Helper()
+	dataPath := t.TempDir()
+	moduleDir := filepath.Join(dataPath, "modules", "arcane-grimoire-vtt-remote")
+	if err := os.MkdirAll(moduleDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(moduleDir, "module.json"), manifest, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dataPath
+}
+
+// useBundledModule replaces bundledModule for the test's duration.
+func useBundledModule(t *testing.T, fsys fs.FS) {
+	t.Helper()
+	old := bundledModule
+	bundledModule = fsys
+	t.Cleanup(func() { bundledModule = old })
+}
+
+// useBundledVersion bundles a bare module manifest with the given version
+// for the test's duration.
+func useBundledVersion(t *testing.T, version string) {
+	t.Helper()
+	manifest := `{"id":"arcane-grimoire-vtt-remote","version":"` + version + `"}`
+	useBundledModule(t, fstest.MapFS{"module.json": {Data: []byte(manifest)}})
+}
+
+func TestGetModuleStatusVersion(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "module.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataPath := installManifest(t, fixture)
+
+	tests := []struct {
+		bundled string
+		update  bool
+	}{
+		{"0.1.3", true},
+		{"0.1.10", true},
+		{"0.1.2", false},
+		{"0.1.1", false},
+	}
+	for _, tt := range tests {
+		useBundledVersion(t, tt.bundled)
+		status := NewApp(false).GetModuleStatus(dataPath)
+		if !status.Installed || status.Version != "0.1.2" {
+			t.Fatalf("GetModuleStatus() = %+v, want installed version 0.1.2", status)
+		}
+		if status.BundledVersion != tt.bundled || status.UpdateAvailable != tt.update {
+			t.Errorf("Bundled %s: got bundledVersion=%q updateAvailable=%v, want %v",
+				tt.bundled, status.BundledVersion, status.UpdateAvailable, tt.update)
+		}
+	}
+}
+
+func TestGetModuleStatusMalformedManifest(t *testing.T) {
+	useBundledVersion(t, "0.1.3")
+	dataPath := installManifest(t, []byte(`{"version": `))
+
+	a := NewApp(false)
+	status := a.GetModuleStatus(dataPath)
+	if !status.Installed {
+		t.Error("Module with a malformed manifest should still be installed")
+	}
+	if status.Version != "" || status.UpdateAvailable {
+		t.Errorf("GetModuleStatus() = %+v, want no version", status)
+	}
+
+	warned := false
+	for _, entry := range a.GetLogs() {
+		if entry.Level == "warn" && strings.Contains(entry.Message, "module version") {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Error("Expected a warning for the malformed manifest")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"0.1.3", "0.1.3", 0},
+		{"0.1.10", "0.1.9", 1},
+		{"0.2", "0.1.9", 1},
+		{"1.0", "1.0.0", 0},
+		{"v1.2.0", "1.2.1", -1},
+		{"1.0.0-beta", "1.0.0-alpha", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestUninstallModule(t *testing.T) {
+	dataPath := installManifest(t, []byte(`{"version":"0.1.2"}`))
+	moduleDir := filepath.Join(dataPath, "modules", foundryModuleID)
+	sibling := filepath.Join(dataPath, "modules", "other-module")
+	if err := os.MkdirAll(sibling, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewApp(false)
+	if err := a.UninstallModule(dataPath); err != nil {
+		t.Fatalf("UninstallModule: %v", err)
+	}
+	if _, err := os.Stat(moduleDir); !os.IsNotExist(err) {
+		t.Errorf("Module directory still exists: %v", err)
+	}
+	if _, err := os.Stat(sibling); err != nil {
+		t.Errorf("Other module was removed: %v", err)
+	}
+
+	err := a.UninstallModule(dataPath)
+	if err == nil || !strings.Contains(err.Error(), "not installed") {
+		t.Errorf("Second UninstallModule = %v, want not installed", err)
+	}
+}
+
+func TestUninstallModuleRefusesTraversal(t *testing.T) {
+	dataPath := installManifest(t, []byte(`{"version":"0.1.2"}`))
+	moduleDir := filepath.Join(dataPath, "modules", foundryModuleID)
+
+	a := NewApp(false)
+	traversal := dataPath + string(filepath.Separator) + "elsewhere" + string(filepath.Separator) + ".."
+	if err := a.UninstallModule(traversal); err == nil {
+		t.Error("UninstallModule accepted a data path containing ..")
+	}
+	if _, err := os.Stat(moduleDir); err != nil {
+		t.Errorf("Module directory was removed: %v", err)
+	}
+}
+
+func TestInstallModule(t *testing.T) {
+	manifest, err := os.ReadFile(filepath.Join("testdata", "module.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	useBundledModule(t, fstest.MapFS{
+		".gitkeep":          {},
+		"module.json":       {Data: manifest, Mode: 0444},
+		"scripts/main.js":   {Data: []byte("// module"), Mode: 0444},
+		"styles/remote.css": {Data: []byte("/* styles */"), Mode: 0444},
+	})
+	dataPath := t.TempDir()
+
+	// Installing twice replaces the read-only files from the first install
+	a := NewApp(false)
+	for range 2 {
+		if err := a.InstallModule(dataPath); err != nil {
+			t.Fatalf("InstallModule: %v", err)
+		}
+	}
+
+	moduleDir := filepath.Join(dataPath, "modules", foundryModuleID)
+	for _, name := range []string{"module.json", "scripts/main.js", "styles/remote.css"} {
+		if _, err := os.Stat(filepath.Join(moduleDir, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s not installed: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(moduleDir, ".gitkeep")); !os.IsNotExist(err) {
+		t.Error(".gitkeep should not be installed")
+	}
+	if status := a.GetModuleStatus(dataPath); !status.Installed || status.Version != "0.1.2" {
+		t.Errorf("GetModuleStatus() = %+v, want installed version 0.1.2", status)
+	}
+}
+
+func TestInstallModuleNotBundled(t *testing.T) {
+	useBundledModule(t, fstest.MapFS{".gitkeep": {}})
+
+	err := NewApp(false).InstallModule(t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "does not include") {
+		t.Errorf("InstallModule() = %v, want a not-bundled error", err)
+	}
+}
+
+func TestInstallEmbeddedModule(t *testing.T) {
+	if _, err := fs.Stat(bundledModule, "module.json"); err != nil {
+		t.Skip("Foundry module not bundled; run task build:module and copy dist/foundry-module")
+	}
+	dataPath := t.TempDir()
+
+	if err := NewApp(false).InstallModule(dataPath); err != nil {
+		t.Fatalf("InstallModule: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataPath, "modules", foundryModuleID, "module.json")); err != nil {
+		t.Errorf("module.json not installed: %v", err)
+	}
+}
+
+func TestRoomHint(t *testing.T) {
+	tests := []struct {
+		rooms []relay.RoomInfo
+		want  string
+	}{
+		{nil, ""},
+		{[]relay.RoomInfo{{Room: "ABCD", PhoneCount: 2}}, ""},
+		{[]relay.RoomInfo{{Room: "ABCD", FoundryConnected: true}, {Room: "EFGH"}}, "ABCD"},
+		{[]relay.RoomInfo{{Room: "ABCD", FoundryConnected: true}, {Room: "EFGH", FoundryConnected: true}}, ""},
+	}
+	for _, tt := range tests {
+		if got := roomHint(tt.rooms); got != tt.want {
+			t.Errorf("roomHint(%+v) = %q, want %q", tt.rooms, got, tt.want)
+		}
+	}
+}
+
+// fakeInterfaces replaces interfaceAddrs with the given CIDRs for the
+// test's duration.
+func fakeInterfaces(t *testing.T, cidrs ...string) {
+	t.Helper()
+	var addrs []net.Addr
+	for _, cidr := range cidrs {
+		ip, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipNet.IP = ip
+		addrs = append(addrs, ipNet)
+	}
+	old := interfaceAddrs
+	interfaceAddrs = func() ([]net.Addr, error) { return addrs, nil }
+	t.Cleanup(func() { interfaceAddrs = old })
+}
+
+func TestListLocalIPs(t *testing.T) {
+	fakeInterfaces(t,
+		"127.0.0.1/8",
+		"::1/128",
+		"fe80::1/64",
+		"169.254.10.1/16",
+		"fd00::2/64",
+		"192.168.1.20/24",
+		"2001:db8::20/64",
+		"10.0.0.5/8",
+	)
+
+	got := localIPStrings()
+	want := []string{"192.168.1.20", "10.0.0.5", "fd00::2", "2001:db8::20"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("localIPStrings() = %v, want %v", got, want)
+	}
+}
+
+func TestSetAdvertiseIP(t *testing.T) {
+	fakeInterfaces(t, "192.168.1.20/24", "fd00::2/64")
+	a := NewApp(false)
+
+	if err := a.SetAdvertiseIP("fd00::2"); err != nil {
+		t.Fatalf("SetAdvertiseIP: %v", err)
+	}
+	if got, want := a.GetServerURL(), "http://[fd00::2]:8080"; got != want {
+		t.Errorf("GetServerURL() = %s, want %s", got, want)
+	}
+	status := a.GetStatus()
+	if status.LocalIP != "fd00::2" || !reflect.DeepEqual(status.LocalIPs, []string{"192.168.1.20", "fd00::2"}) {
+		t.Errorf("GetStatus() = %+v", status)
+	}
+
+	if err := a.SetAdvertiseIP("203.0.113.9"); err == nil {
+		t.Error("SetAdvertiseIP accepted an address of another machine")
+	}
+	if err := a.SetAdvertiseIP("not-an-ip"); err == nil {
+		t.Error("SetAdvertiseIP accepted an invalid address")
+	}
+	if got := a.GetStatus().LocalIP; got != "fd00::2" {
+		t.Errorf("Rejected address changed LocalIP to %s", got)
+	}
+}
+
+func TestGetServerURLScheme(t *testing.T) {
+	fakeInterfaces(t, "192.168.1.20/24")
+	for _, tt := range []struct {
+		tls  bool
+		want string
+	}{
+		{tls: false, want: "http://192.168.1.20:8080"},
+		{tls: true, want: "https://192.168.1.20:8080"},
+	} {
+		a := NewApp(tt.tls)
+		if err := a.SetAdvertiseIP("192.168.1.20"); err != nil {
+			t.Fatalf("SetAdvertiseIP: %v", err)
+		}
+		if got := a.GetServerURL(); got != tt.want {
+			t.Errorf("GetServerURL() with TLS %v = %s, want %s", tt.tls, got, tt.want)
+		}
+	}
+}
+
+func TestSetLogCapacity(t *testing.T) {
+	a := NewApp(false)
+	a.settingsFile = filepath.Join(t.TempDir(), "vtt-remote", "settings.json")
+
+	if err := a.SetLogCapacity(10); err != nil {
+		t.Fatalf("SetLogCapacity: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		a.addLog("info", strconv.Itoa(i))
+	}
+	logs := a.GetLogs()
+	if len(logs) != 10 || logs[0].Message != "90" || logs[9].Message != "99" {
+		t.Errorf("GetLogs() kept %d entries from %q to %q, want 90 to 99", len(logs), logs[0].Message, logs[len(logs)-1].Message)
+	}
+
+	for _, n := range []int{0, -5, maxLogCapacity + 1} {
+		if err := a.SetLogCapacity(n); err == nil {
+			t.Errorf("SetLogCapacity(%d) succeeded", n)
+		}
+	}
+
+	// The capacity survives a restart
+	b := NewApp(false)
+	b.settingsFile = a.settingsFile
+	b.loadSettings()
+	if b.logCapacity != 10 {
+		t.Errorf("Reloaded logCapacity = %d, want 10", b.logCapacity)
+	}
+}
+
+func TestLoadSettingsInvalid(t *testing.T) {
+	a := NewApp(false)
+	a.settingsFile = filepath.Join(t.TempDir(), "settings.json")
+	if err := os.WriteFile(a.settingsFile, []byte(`{"logCapacity":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a.loadSettings()
+	if a.logCapacity != defaultLogCapacity {
+		t.Errorf("logCapacity = %d after invalid settings, want default %d", a.logCapacity, defaultLogCapacity)
+	}
+	if logs := a.GetLogs(); len(logs) != 1 || logs[0].Level != "warn" {
+		t.Errorf("GetLogs() = %+v, want one warning", logs)
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	a := NewApp(false)
+	a.settingsFile = filepath.Join(t.TempDir(), "settings.json")
+
+	if err := a.SetLogLevel("warn"); err != nil {
+		t.Fatalf("SetLogLevel: %v", err)
+	}
+	a.addLog("info", "joined")
+	a.addLog("warn", "slow client")
+	a.addLog("error", "publish failed")
+	a.addLog("info", "left")
+
+	logs := a.GetLogs()
+	if len(logs) != 2 || logs[0].Message != "slow client" || logs[1].Message != "publish failed" {
+		t.Errorf("GetLogs() = %+v, want only the warn and error entries", logs)
+	}
+	if got, want := a.GetLogCounts(), map[string]int{"info": 2, "warn": 1, "error": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetLogCounts() = %v, want %v", got, want)
+	}
+
+	if err := a.SetLogLevel("loud"); err == nil {
+		t.Error("SetLogLevel accepted an unknown level")
+	}
+
+	// The level survives a restart
+	b := NewApp(false)
+	b.settingsFile = a.settingsFile
+	b.loadSettings()
+	if b.minLevel != relay.LogWarn {
+		t.Errorf("Reloaded minLevel = %q, want warn", b.minLevel)
+	}
+}
+
+// useTempConfigDir points os.UserConfigDir at a fresh directory.
+func useTempConfigDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir) // Linux and other Unix
+	t.Setenv("HOME", dir)            // macOS
+	t.Setenv("AppData", dir)         // Windows
+}
+
+func TestSettingsRoundTrip(t *testing.T) {
+	useTempConfigDir(t)
+	useBundledModule(t, fstest.MapFS{"module.json": {Data: []byte(`{"version":"1.0.0"}`)}})
+	dataPath := t.TempDir()
+
+	a := NewApp(false)
+	a.settingsFile = defaultSettingsFile()
+	if err := a.SetPort(9191); err != nil {
+		t.Fatalf("SetPort: %v", err)
+	}
+	if err := a.InstallModule(dataPath); err != nil {
+		t.Fatalf("InstallModule: %v", err)
+	}
+
+	b := NewApp(false)
+	b.settingsFile = defaultSettingsFile()
+	b.loadSettings()
+	got := b.GetSettings()
+	if got.Port != 9191 || got.FoundryPath != dataPath {
+		t.Errorf("Reloaded settings = %+v, want port 9191 and path %s", got, dataPath)
+	}
+
+	// SaveSettings applies and persists every field
+	got.Port, got.LogLevel = 9292, "error"
+	if err := b.SaveSettings(got); err != nil {
+		t.Fatalf("SaveSettings: %v", err)
+	}
+	c := NewApp(false)
+	c.settingsFile = defaultSettingsFile()
+	c.loadSettings()
+	if reloaded := c.GetSettings(); reloaded != got {
+		t.Errorf("Reloaded settings = %+v, want %+v", reloaded, got)
+	}
+
+	got.Port = 0
+	if err := b.SaveSettings(got); err == nil {
+		t.Error("SaveSettings accepted port 0")
+	}
+}
+
+func TestLoadSettingsMissing(t *testing.T) {
+	useTempConfigDir(t)
+	a := NewApp(false)
+	a.settingsFile = defaultSettingsFile()
+	a.loadSettings()
+	want := Settings{Port: 8080, LogCapacity: defaultLogCapacity, LogLevel: "debug"}
+	if got := a.GetSettings(); got != want {
+		t.Errorf("GetSettings() = %+v, want defaults %+v", got, want)
+	}
+	if logs := a.GetLogs(); len(logs) != 0 {
+		t.Errorf("Missing settings file logged %+v", logs)
+	}
+}
+
+func TestExportLogs(t *testing.T) {
+	a := NewApp(false)
+	a.addLog("info", "Server started")
+	a.addLog("warn", `Slow client in room "ABC123"`)
+	logs := a.GetLogs()
+	dir := t.TempDir()
+
+	jsonPath := filepath.Join(dir, "logs.jsonl")
+	if err := a.ExportLogs(jsonPath); err != nil {
+		t.Fatalf("ExportLogs(jsonl): %v", err)
+	}
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exported []LogEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry LogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", line, err)
+		}
+		exported = append(exported, entry)
+	}
+	if !reflect.DeepEqual(exported, logs) {
+		t.Errorf("Exported %+v, want %+v", exported, logs)
+	}
+
+	textPath := filepath.Join(dir, "logs.txt")
+	if err := a.ExportLogs(textPath); err != nil {
+		t.Fatalf("ExportLogs(txt): %v", err)
+	}
+	data, err = os.ReadFile(textPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := logs[0].Timestamp + " [info] Server started\n" + logs[1].Timestamp + ` [warn] Slow client in room "ABC123"` + "\n"
+	if !strings.HasPrefix(string(data), want) {
+		t.Errorf("Exported text %q, want it to start with %q", data, want)
+	}
+
+	if err := a.ExportLogs(filepath.Join(dir, "missing", "logs.txt")); err == nil {
+		t.Error("ExportLogs into a missing directory succeeded")
+	}
+}
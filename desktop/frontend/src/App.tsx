@@ -1,15 +1,21 @@
 import { useState, useEffect, useCallback } from 'react';
-import { QRCodeSVG } from 'qrcode.react';
 import './App.css';
 import {
   StartServer,
   StopServer,
+  RestartServer,
+  RunSelfCheck,
   GetStatus,
   GetStats,
   GetServerURL,
+  GetServerQR,
+  GetVersion,
   GetLogs,
   ClearLogs,
+  ChooseLogExportPath,
+  ExportLogs,
   SetPort,
+  SetAdvertiseIP,
 } from '../wailsjs/go/main/App';
 import { EventsOn, EventsOff } from '../wailsjs/runtime/runtime';
 
@@ -18,15 +24,26 @@ interface ServerStatus {
   state: string;
   port: number;
   localIP: string;
+  localIPs?: string[];
   localHostname: string;
+  tls: boolean;
+  fingerprint?: string;
   error?: string;
 }
 
+interface RoomStats {
+  room: string;
+  foundryCount: number;
+  phoneCount: number;
+  lastActivity: string;
+}
+
 interface ClientStats {
   roomCount: number;
   foundryCount: number;
   phoneCount: number;
   totalClients: number;
+  rooms: RoomStats[];
 }
 
 interface LogEntry {
@@ -41,24 +58,41 @@ function App() {
     port: 8080,
     localIP: '',
     localHostname: '',
+    tls: false,
   });
   const [stats, setStats] = useState<ClientStats>({
     roomCount: 0,
     foundryCount: 0,
     phoneCount: 0,
     totalClients: 0,
+    rooms: [],
   });
   const [logs, setLogs] = useState<LogEntry[]>([]);
   const [serverURL, setServerURL] = useState('');
+  const [serverQR, setServerQR] = useState('');
   const [portInput, setPortInput] = useState('8080');
+  const [version, setVersion] = useState('');
 
   // Fetch initial status
   useEffect(() => {
-    GetStatus().then(setStatus);
+    GetStatus().then((s) => {
+      setStatus(s);
+      setPortInput(String(s.port)); // may be a saved port rather than the default
+    });
     GetServerURL().then(setServerURL);
     GetLogs().then(setLogs);
+    GetVersion().then((v) => setVersion(`${v.version} (${v.commit.slice(0, 7)})`));
   }, []);
 
+  // Render the QR code for the current URL (Wails sends []byte as base64)
+  useEffect(() => {
+    if (status.state !== 'running' || !serverURL) {
+      setServerQR('');
+      return;
+    }
+    GetServerQR().then((png) => setServerQR((png as unknown as string) ?? ''));
+  }, [status.state, serverURL]);
+
   // Subscribe to events
   useEffect(() => {
     const handleStatus = (newStatus: ServerStatus) => {
@@ -79,15 +113,15 @@ function App() {
     };
   }, []);
 
-  // Poll stats when running
+  // Fetch stats when the server starts; the relay pushes updates as
+  // clients join, identify, and leave
   useEffect(() => {
     if (status.state !== 'running') return;
 
-    const interval = setInterval(() => {
-      GetStats().then(setStats);
-    }, 2000);
+    GetStats().then(setStats);
+    EventsOn('stats', setStats);
 
-    return () => clearInterval(interval);
+    return () => EventsOff('stats');
   }, [status.state]);
 
   const handleStart = useCallback(async () => {
@@ -114,6 +148,26 @@ function App() {
     }
   }, []);
 
+  const handleRestart = useCallback(async () => {
+    try {
+      await RestartServer();
+      setStatus(await GetStatus());
+      GetServerURL().then(setServerURL);
+    } catch (err) {
+      console.error('Failed to restart server:', err);
+      alert(`Failed to restart server: ${err}`);
+    }
+  }, []);
+
+  const handleSelfCheck = useCallback(async () => {
+    try {
+      await RunSelfCheck();
+    } catch (err) {
+      console.error('Self-check failed:', err);
+    }
+    setStatus(await GetStatus());
+  }, []);
+
   const handleSetPort = useCallback(async () => {
     const port = parseInt(portInput, 10);
     if (isNaN(port) || port < 1 || port > 65535) {
@@ -129,11 +183,33 @@ function App() {
     }
   }, [portInput]);
 
+  const handleSelectIP = useCallback(async (ip: string) => {
+    try {
+      await SetAdvertiseIP(ip);
+      GetStatus().then(setStatus);
+      GetServerURL().then(setServerURL);
+    } catch (err) {
+      console.error('Failed to set IP address:', err);
+    }
+  }, []);
+
   const handleClearLogs = useCallback(() => {
     ClearLogs();
     setLogs([]);
   }, []);
 
+  const handleExportLogs = useCallback(async () => {
+    try {
+      const path = await ChooseLogExportPath();
+      if (path) {
+        await ExportLogs(path);
+      }
+    } catch (err) {
+      console.error('Failed to export logs:', err);
+      alert(`Failed to export logs: ${err}`);
+    }
+  }, []);
+
   const isRunning = status.state === 'running';
   const isStarting = status.state === 'starting';
 
@@ -156,10 +232,31 @@ function App() {
                 {isRunning ? 'Running' : isStarting ? 'Starting...' : 'Stopped'}
               </span>
             </div>
+            {status.error && (
+              <div className="status-error">
+                <span>{status.error}</span>
+                <button onClick={handleSelfCheck} className="btn-small">
+                  Retry Check
+                </button>
+              </div>
+            )}
 
             <div className="info-row">
               <label>IP Address:</label>
-              <span>{status.localIP || 'N/A'}</span>
+              {status.localIPs && status.localIPs.length > 1 ? (
+                <select value={status.localIP} onChange={(e) => handleSelectIP(e.target.value)}>
+                  {!status.localIPs.includes(status.localIP) && (
+                    <option value={status.localIP}>{status.localIP}</option>
+                  )}
+                  {status.localIPs.map((ip) => (
+                    <option key={ip} value={ip}>
+                      {ip}
+                    </option>
+                  ))}
+                </select>
+              ) : (
+                <span>{status.localIP || 'N/A'}</span>
+              )}
             </div>
 
             <div className="info-row">
@@ -194,6 +291,13 @@ function App() {
               >
                 Stop Server
               </button>
+              <button
+                onClick={handleRestart}
+                disabled={!isRunning && status.state !== 'error'}
+                className="btn btn-restart"
+              >
+                Restart
+              </button>
             </div>
           </section>
 
@@ -203,7 +307,9 @@ function App() {
             {isRunning && serverURL ? (
               <>
                 <div className="qr-container">
-                  <QRCodeSVG value={serverURL} size={150} bgColor="#18181b" fgColor="#ffffff" />
+                  {serverQR && (
+                    <img src={`data:image/png;base64,${serverQR}`} width={150} height={150} alt="QR code for phone access" />
+                  )}
                 </div>
                 <div className="url-display">{serverURL}</div>
               </>
@@ -237,6 +343,28 @@ function App() {
                 <span className="stat-label">Total</span>
               </div>
             </div>
+            {stats.rooms?.length > 0 && (
+              <table className="room-table">
+                <thead>
+                  <tr>
+                    <th>Room</th>
+                    <th>Foundry</th>
+                    <th>Phones</th>
+                    <th>Last Activity</th>
+                  </tr>
+                </thead>
+                <tbody>
+                  {stats.rooms.map((room) => (
+                    <tr key={room.room}>
+                      <td className="room-code">{room.room}</td>
+                      <td>{room.foundryCount}</td>
+                      <td>{room.phoneCount}</td>
+                      <td>{room.lastActivity}</td>
+                    </tr>
+                  ))}
+                </tbody>
+              </table>
+            )}
           </section>
 
           {/* Foundry Connection Panel */}
@@ -251,9 +379,15 @@ function App() {
                 <div className="info-row">
                   <label>WebSocket:</label>
                   <span className="url-display" style={{ flex: 1, textAlign: 'left' }}>
-                    ws://{status.localHostname}:{status.port}/ws
+                    {status.tls ? 'wss' : 'ws'}://{status.localHostname}:{status.port}/ws
                   </span>
                 </div>
+                {status.fingerprint && (
+                  <div className="info-row" style={{ opacity: 0.7, fontSize: '0.85em' }}>
+                    <label>Cert SHA-256:</label>
+                    <span className="url-display" style={{ wordBreak: 'break-all' }}>{status.fingerprint}</span>
+                  </div>
+                )}
                 <div className="info-row" style={{ opacity: 0.7, fontSize: '0.85em' }}>
                   <label>Fallback IP:</label>
                   <span>{status.localIP}:{status.port}</span>
@@ -269,9 +403,14 @@ function App() {
         <section className="panel logs-panel">
           <div className="logs-header">
             <h2>Server Logs</h2>
-            <button onClick={handleClearLogs} className="btn-small">
-              Clear
-            </button>
+            <div className="logs-actions">
+              <button onClick={handleExportLogs} className="btn-small">
+                Export
+              </button>
+              <button onClick={handleClearLogs} className="btn-small">
+                Clear
+              </button>
+            </div>
           </div>
           <div className="logs-container">
             {logs.length === 0 ? (
@@ -288,6 +427,8 @@ function App() {
           </div>
         </section>
       </main>
+
+      <footer className="footer">VTT Remote {version}</footer>
     </div>
   );
 }
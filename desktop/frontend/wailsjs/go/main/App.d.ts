@@ -2,24 +2,58 @@
 // This file is automatically generated. DO NOT EDIT
 import {main} from '../models';
 
+export function Announce(arg1:string,arg2:string):Promise<void>;
+
+export function ChooseLogExportPath():Promise<string>;
+
 export function ClearLogs():Promise<void>;
 
+export function CloseRoom(arg1:string):Promise<void>;
+
 export function DetectFoundryPath():Promise<string>;
 
+export function ExportLogs(arg1:string):Promise<void>;
+
+export function GetLogCounts():Promise<Record<string, number>>;
+
 export function GetLogs():Promise<Array<main.LogEntry>>;
 
 export function GetModuleStatus(arg1:string):Promise<main.FoundryModuleStatus>;
 
+export function GetRooms():Promise<Array<main.RoomDetails>>;
+
+export function GetServerQR():Promise<Array<number>>;
+
 export function GetServerURL():Promise<string>;
 
+export function GetSettings():Promise<main.Settings>;
+
 export function GetStats():Promise<main.ClientStats>;
 
 export function GetStatus():Promise<main.ServerStatus>;
 
+export function GetVersion():Promise<main.VersionInfo>;
+
 export function InstallModule(arg1:string):Promise<void>;
 
+export function KickClient(arg1:string,arg2:string):Promise<void>;
+
+export function RestartServer():Promise<void>;
+
+export function RunSelfCheck():Promise<void>;
+
+export function SaveSettings(arg1:main.Settings):Promise<void>;
+
+export function SetAdvertiseIP(arg1:string):Promise<void>;
+
+export function SetLogCapacity(arg1:number):Promise<void>;
+
+export function SetLogLevel(arg1:string):Promise<void>;
+
 export function SetPort(arg1:number):Promise<void>;
 
 export function StartServer():Promise<void>;
 
 export function StopServer():Promise<void>;
+
+export function UninstallModule(arg1:string):Promise<void>;
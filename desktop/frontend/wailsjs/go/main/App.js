@@ -2,14 +2,34 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function Announce(arg1, arg2) {
+  return window['go']['main']['App']['Announce'](arg1, arg2);
+}
+
+export function ChooseLogExportPath() {
+  return window['go']['main']['App']['ChooseLogExportPath']();
+}
+
 export function ClearLogs() {
   return window['go']['main']['App']['ClearLogs']();
 }
 
+export function CloseRoom(arg1) {
+  return window['go']['main']['App']['CloseRoom'](arg1);
+}
+
 export function DetectFoundryPath() {
   return window['go']['main']['App']['DetectFoundryPath']();
 }
 
+export function ExportLogs(arg1) {
+  return window['go']['main']['App']['ExportLogs'](arg1);
+}
+
+export function GetLogCounts() {
+  return window['go']['main']['App']['GetLogCounts']();
+}
+
 export function GetLogs() {
   return window['go']['main']['App']['GetLogs']();
 }
@@ -18,10 +38,22 @@ export function GetModuleStatus(arg1) {
   return window['go']['main']['App']['GetModuleStatus'](arg1);
 }
 
+export function GetRooms() {
+  return window['go']['main']['App']['GetRooms']();
+}
+
+export function GetServerQR() {
+  return window['go']['main']['App']['GetServerQR']();
+}
+
 export function GetServerURL() {
   return window['go']['main']['App']['GetServerURL']();
 }
 
+export function GetSettings() {
+  return window['go']['main']['App']['GetSettings']();
+}
+
 export function GetStats() {
   return window['go']['main']['App']['GetStats']();
 }
@@ -30,10 +62,42 @@ export function GetStatus() {
   return window['go']['main']['App']['GetStatus']();
 }
 
+export function GetVersion() {
+  return window['go']['main']['App']['GetVersion']();
+}
+
 export function InstallModule(arg1) {
   return window['go']['main']['App']['InstallModule'](arg1);
 }
 
+export function KickClient(arg1, arg2) {
+  return window['go']['main']['App']['KickClient'](arg1, arg2);
+}
+
+export function RestartServer() {
+  return window['go']['main']['App']['RestartServer']();
+}
+
+export function RunSelfCheck() {
+  return window['go']['main']['App']['RunSelfCheck']();
+}
+
+export function SaveSettings(arg1) {
+  return window['go']['main']['App']['SaveSettings'](arg1);
+}
+
+export function SetAdvertiseIP(arg1) {
+  return window['go']['main']['App']['SetAdvertiseIP'](arg1);
+}
+
+export function SetLogCapacity(arg1) {
+  return window['go']['main']['App']['SetLogCapacity'](arg1);
+}
+
+export function SetLogLevel(arg1) {
+  return window['go']['main']['App']['SetLogLevel'](arg1);
+}
+
 export function SetPort(arg1) {
   return window['go']['main']['App']['SetPort'](arg1);
 }
@@ -45,3 +109,7 @@ export function StartServer() {
 export function StopServer() {
   return window['go']['main']['App']['StopServer']();
 }
+
+export function UninstallModule(arg1) {
+  return window['go']['main']['App']['UninstallModule'](arg1);
+}
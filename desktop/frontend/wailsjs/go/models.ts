@@ -1,10 +1,48 @@
 export namespace main {
 	
+	export class ClientDetails {
+	    id: string;
+	    type: string;
+	    connectedAt: string;
+	    durationSeconds: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ClientDetails(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.type = source["type"];
+	        this.connectedAt = source["connectedAt"];
+	        this.durationSeconds = source["durationSeconds"];
+	    }
+	}
+	export class RoomStats {
+	    room: string;
+	    foundryCount: number;
+	    phoneCount: number;
+	    lastActivity: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new RoomStats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.room = source["room"];
+	        this.foundryCount = source["foundryCount"];
+	        this.phoneCount = source["phoneCount"];
+	        this.lastActivity = source["lastActivity"];
+	    }
+	}
 	export class ClientStats {
 	    roomCount: number;
 	    foundryCount: number;
 	    phoneCount: number;
 	    totalClients: number;
+	    averageSessionSeconds: number;
+	    rooms: RoomStats[];
 	
 	    static createFrom(source: any = {}) {
 	        return new ClientStats(source);
@@ -16,11 +54,33 @@ export namespace main {
 	        this.foundryCount = source["foundryCount"];
 	        this.phoneCount = source["phoneCount"];
 	        this.totalClients = source["totalClients"];
+	        this.averageSessionSeconds = source["averageSessionSeconds"];
+	        this.rooms = this.convertValues(source["rooms"], RoomStats);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 	export class FoundryModuleStatus {
 	    installed: boolean;
 	    version?: string;
+	    bundledVersion?: string;
+	    updateAvailable: boolean;
 	    dataPath: string;
 	    pathExists: boolean;
 	
@@ -32,6 +92,8 @@ export namespace main {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.installed = source["installed"];
 	        this.version = source["version"];
+	        this.bundledVersion = source["bundledVersion"];
+	        this.updateAvailable = source["updateAvailable"];
 	        this.dataPath = source["dataPath"];
 	        this.pathExists = source["pathExists"];
 	    }
@@ -52,11 +114,51 @@ export namespace main {
 	        this.message = source["message"];
 	    }
 	}
+	export class RoomDetails {
+	    room: string;
+	    foundryConnected: boolean;
+	    phoneCount: number;
+	    clients: ClientDetails[];
+	
+	    static createFrom(source: any = {}) {
+	        return new RoomDetails(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.room = source["room"];
+	        this.foundryConnected = source["foundryConnected"];
+	        this.phoneCount = source["phoneCount"];
+	        this.clients = this.convertValues(source["clients"], ClientDetails);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
 	export class ServerStatus {
 	    state: string;
 	    port: number;
 	    localIP: string;
+	    localIPs: string[];
 	    localHostname: string;
+	    tls: boolean;
+	    fingerprint?: string;
 	    error?: string;
 	
 	    static createFrom(source: any = {}) {
@@ -68,10 +170,47 @@ export namespace main {
 	        this.state = source["state"];
 	        this.port = source["port"];
 	        this.localIP = source["localIP"];
+	        this.localIPs = source["localIPs"];
 	        this.localHostname = source["localHostname"];
+	        this.tls = source["tls"];
+	        this.fingerprint = source["fingerprint"];
 	        this.error = source["error"];
 	    }
 	}
+	export class Settings {
+	    port?: number;
+	    foundryPath?: string;
+	    logCapacity?: number;
+	    logLevel?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Settings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.port = source["port"];
+	        this.foundryPath = source["foundryPath"];
+	        this.logCapacity = source["logCapacity"];
+	        this.logLevel = source["logLevel"];
+	    }
+	}
+	export class VersionInfo {
+	    version: string;
+	    commit: string;
+	    buildDate: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new VersionInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.version = source["version"];
+	        this.commit = source["commit"];
+	        this.buildDate = source["buildDate"];
+	    }
+	}
 
 }
 
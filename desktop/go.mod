@@ -39,6 +39,8 @@ require (
 	github.com/tkrajina/go-reflector v0.5.8 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasttemplate v1.2.2 // indirect
+	github.com/vmihailenco/msgpack/v5 v5.4.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	github.com/wailsapp/go-webview2 v1.0.22 // indirect
 	github.com/wailsapp/mimetype v1.4.1 // indirect
 	golang.org/x/crypto v0.43.0 // indirect
@@ -50,11 +52,18 @@ require (
 
 require (
 	github.com/grandcat/zeroconf v1.0.0
+	github.com/sam-phinizy/vtt-remote/pkg/certgen v0.0.0
+	github.com/sam-phinizy/vtt-remote/pkg/discovery v0.0.0
 	github.com/sam-phinizy/vtt-remote/pkg/natsutil v0.0.0
 	github.com/sam-phinizy/vtt-remote/pkg/relay v0.0.0
+	github.com/sam-phinizy/vtt-remote/pkg/roomcode v0.0.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 )
 
 replace (
+	github.com/sam-phinizy/vtt-remote/pkg/certgen => ../pkg/certgen
+	github.com/sam-phinizy/vtt-remote/pkg/discovery => ../pkg/discovery
 	github.com/sam-phinizy/vtt-remote/pkg/natsutil => ../pkg/natsutil
 	github.com/sam-phinizy/vtt-remote/pkg/relay => ../pkg/relay
+	github.com/sam-phinizy/vtt-remote/pkg/roomcode => ../pkg/roomcode
 )
@@ -2,6 +2,7 @@ package main
 
 import (
 	"embed"
+	"flag"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -12,8 +13,20 @@ import (
 var assets embed.FS
 
 func main() {
+	tlsSelfSigned := flag.Bool("tls-selfsigned", false, "Serve HTTPS/WSS with a self-signed certificate generated on each start")
+	portAttempts := flag.Int("port-attempts", defaultPortAttempts, "Consecutive ports to try when the configured port is in use (1 disables fallback)")
+	mdnsLegacy := flag.Bool("mdns-legacy", true, "Also advertise over mDNS as a generic _http._tcp service for older clients")
+	maxConns := flag.Int("max-connections", defaultMaxConnections, "Maximum concurrent WebSocket connections (0 for no limit)")
+	connectRate := flag.Int("max-connect-rate", defaultConnectRate, "New WebSocket connections allowed per client IP per minute (0 for no limit)")
+	flag.Parse()
+
 	// Create an instance of the app structure
-	app := NewApp()
+	app := NewApp(*tlsSelfSigned)
+	app.portAttempts = *portAttempts
+	app.mdnsLegacy = *mdnsLegacy
+	app.maxConns = *maxConns
+	app.connectRate = *connectRate
+	app.settingsFile = defaultSettingsFile() // loaded in startup
 
 	// Create application with options
 	err := wails.Run(&options.App{
@@ -0,0 +1,116 @@
+// Package certgen generates self-signed TLS certificates for serving
+// HTTPS/WSS on a LAN, where a publicly trusted certificate for names like
+// vtt-remote.local is not available.
+package certgen
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// validity is how long generated certificates remain valid. Certificates
+// are regenerated on every start, so this only needs to outlast a session.
+const validity = 365 * 24 * time.Hour
+
+// Certificate is an in-memory self-signed certificate and its key.
+type Certificate struct {
+	TLS  tls.Certificate   // Certificate chain and private key
+	Leaf *x509.Certificate // Parsed certificate
+}
+
+// Generate creates a self-signed certificate valid for the given hostnames
+// and IPs. "localhost" and the loopback addresses are always included so
+// the server is reachable from the machine it runs on.
+func Generate(hostnames []string, ips []net.IP) (*Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	dnsNames := []string{"localhost"}
+	for _, h := range hostnames {
+		if h != "" && h != "localhost" {
+			dnsNames = append(dnsNames, h)
+		}
+	}
+	ipAddrs := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	for _, ip := range ips {
+		if ip != nil && !ip.IsLoopback() {
+			ipAddrs = append(ipAddrs, ip)
+		}
+	}
+
+	commonName := dnsNames[0]
+	if len(dnsNames) > 1 {
+		commonName = dnsNames[1]
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{"VTT Remote (self-signed)"},
+		},
+		NotBefore:             now.Add(-time.Hour), // Tolerate clock skew on phones
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true, // Lets the certificate be trusted as its own root
+		DNSNames:              dnsNames,
+		IPAddresses:           ipAddrs,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return &Certificate{
+		TLS: tls.Certificate{
+			Certificate: [][]byte{der},
+			PrivateKey:  key,
+			Leaf:        leaf,
+		},
+		Leaf: leaf,
+	}, nil
+}
+
+// TLSConfig returns a server TLS config that presents this certificate.
+func (c *Certificate) TLSConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{c.TLS},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// Fingerprint returns the certificate's SHA-256 fingerprint as
+// colon-separated uppercase hex, the form browsers display.
+func (c *Certificate) Fingerprint() string {
+	sum := sha256.Sum256(c.Leaf.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,78 @@
+package certgen
+
+import (
+	"crypto/x509"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	lanIP := net.ParseIP("192.168.1.42")
+	cert, err := Generate([]string{"vtt-remote.local"}, []net.IP{lanIP})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if !slices.Contains(cert.Leaf.DNSNames, "vtt-remote.local") {
+		t.Errorf("DNSNames = %v, missing vtt-remote.local", cert.Leaf.DNSNames)
+	}
+	if !slices.Contains(cert.Leaf.DNSNames, "localhost") {
+		t.Errorf("DNSNames = %v, missing localhost", cert.Leaf.DNSNames)
+	}
+	if !slices.ContainsFunc(cert.Leaf.IPAddresses, lanIP.Equal) {
+		t.Errorf("IPAddresses = %v, missing %s", cert.Leaf.IPAddresses, lanIP)
+	}
+
+	// The certificate validates for each SAN against a pool containing it
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	for _, name := range []string{"vtt-remote.local", "localhost", "192.168.1.42", "127.0.0.1"} {
+		opts := x509.VerifyOptions{
+			DNSName:   name,
+			Roots:     pool,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		if _, err := cert.Leaf.Verify(opts); err != nil {
+			t.Errorf("Verify(%s) failed: %v", name, err)
+		}
+	}
+
+	// But not for names it wasn't issued for, or without the custom pool
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "evil.example.com", Roots: pool}); err == nil {
+		t.Error("Expected verification to fail for an unlisted hostname")
+	}
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "vtt-remote.local", Roots: x509.NewCertPool()}); err == nil {
+		t.Error("Expected verification to fail against an empty pool")
+	}
+}
+
+func TestGenerateUnique(t *testing.T) {
+	a, err := Generate([]string{"vtt-remote.local"}, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	b, err := Generate([]string{"vtt-remote.local"}, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Error("Expected each generated certificate to have a unique fingerprint")
+	}
+}
+
+func TestFingerprintFormat(t *testing.T) {
+	cert, err := Generate(nil, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	fp := cert.Fingerprint()
+	parts := strings.Split(fp, ":")
+	if len(parts) != 32 {
+		t.Fatalf("Fingerprint %q has %d parts, want 32", fp, len(parts))
+	}
+	if fp != strings.ToUpper(fp) {
+		t.Errorf("Fingerprint %q is not uppercase", fp)
+	}
+}
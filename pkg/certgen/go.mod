@@ -0,0 +1,3 @@
+module github.com/sam-phinizy/vtt-remote/pkg/certgen
+
+go 1.24.0
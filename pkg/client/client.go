@@ -0,0 +1,333 @@
+// Package client is a Go client for the VTT Remote relay, for bots and
+// other headless tools. It joins a room, identifies, and reconnects with
+// exponential backoff whenever the connection drops.
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sam-phinizy/vtt-remote/pkg/relay"
+)
+
+// Defaults for Options fields left zero.
+const (
+	defaultMinBackoff       = 500 * time.Millisecond
+	defaultMaxBackoff       = 30 * time.Second
+	defaultHandshakeTimeout = 10 * time.Second
+	defaultBufferSize       = 64
+)
+
+// ErrNotConnected is returned by Send while the client is reconnecting.
+var ErrNotConnected = errors.New("client: not connected")
+
+// ErrClosed is returned by Send after Close.
+var ErrClosed = errors.New("client: closed")
+
+// Options configures a Client.
+type Options struct {
+	// ClientType is sent in IDENTIFY. Defaults to relay.ClientTypePhone.
+	ClientType relay.ClientType
+	// DisplayName, if set, is sent in IDENTIFY and shown to the room.
+	DisplayName string
+	// Password is the room password sent in JOIN, if any.
+	Password string
+	// AuthToken is sent as a bearer token when the relay requires one.
+	AuthToken string
+
+	// MinBackoff is the wait before the first reconnect attempt; each
+	// failure doubles it up to MaxBackoff. Default to 500ms and 30s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// HandshakeTimeout bounds dialing plus the JOIN handshake. Defaults
+	// to 10s.
+	HandshakeTimeout time.Duration
+	// BufferSize is how many received messages queue before the client
+	// stops reading. Defaults to 64.
+	BufferSize int
+
+	// OnLog, if set, receives connection and reconnect events.
+	OnLog func(level relay.LogLevel, message string)
+}
+
+// withDefaults returns a copy of opts with defaults filled in.
+func (opts Options) withDefaults() Options {
+	if opts.ClientType == relay.ClientTypeUnknown {
+		opts.ClientType = relay.ClientTypePhone
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = opts.MinBackoff
+	}
+	if opts.HandshakeTimeout <= 0 {
+		opts.HandshakeTimeout = defaultHandshakeTimeout
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultBufferSize
+	}
+	return opts
+}
+
+// Client is a connection to one relay room that survives drops. Its
+// methods are safe for concurrent use.
+type Client struct {
+	url      string
+	room     string
+	opts     Options
+	messages chan *relay.Envelope
+	done     chan struct{} // closed by Close
+	stopped  chan struct{} // closed when run returns
+
+	mu     sync.Mutex // guards conn and serializes writes
+	conn   *websocket.Conn
+	closed bool
+}
+
+// Connect dials the relay's WebSocket URL (e.g. "ws://host:8080/ws"),
+// joins room, and identifies. It returns an error if this first attempt
+// fails; after that, dropped connections are retried until Close.
+func Connect(url, room string, opts Options) (*Client, error) {
+	opts = opts.withDefaults()
+	c := &Client{
+		url:      url,
+		room:     room,
+		opts:     opts,
+		messages: make(chan *relay.Envelope, opts.BufferSize),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	conn, status, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	go c.run(conn, status)
+	return c, nil
+}
+
+// Messages returns the channel of envelopes received from the room,
+// including the ROOM_STATUS sent on each (re)join. It is closed after
+// Close.
+func (c *Client) Messages() <-chan *relay.Envelope {
+	return c.messages
+}
+
+// Send relays a message of msgType with payload to the room. It returns
+// ErrNotConnected while reconnecting; the message is not queued.
+func (c *Client) Send(msgType relay.MessageType, payload any) error {
+	data, err := relay.MakeEnvelope(msgType, payload)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.closed:
+		return ErrClosed
+	case c.conn == nil:
+		return ErrNotConnected
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.opts.HandshakeTimeout))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Close disconnects and stops reconnecting. Messages is closed once the
+// receive loop has exited.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	conn := c.conn
+	c.conn = nil
+	if conn != nil {
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		conn.Close()
+	}
+	c.mu.Unlock()
+
+	<-c.stopped
+	return nil
+}
+
+// run reads from conn until it fails, then reconnects, until Close.
+func (c *Client) run(conn *websocket.Conn, status *relay.Envelope) {
+	defer close(c.stopped)
+	defer close(c.messages)
+
+	for {
+		if !c.deliver(status) {
+			return
+		}
+		c.readLoop(conn)
+		conn.Close()
+
+		c.mu.Lock()
+		if c.conn == conn {
+			c.conn = nil
+		}
+		c.mu.Unlock()
+
+		var ok bool
+		if conn, status, ok = c.reconnect(); !ok {
+			return
+		}
+	}
+}
+
+// readLoop forwards messages from conn until the connection fails or the
+// client is closed.
+func (c *Client) readLoop(conn *websocket.Conn) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case <-c.done:
+			default:
+				c.log(relay.LogWarn, "Connection to room %s lost: %v", c.room, err)
+			}
+			return
+		}
+		env, err := relay.ParseEnvelope(data)
+		if err != nil {
+			c.log(relay.LogWarn, "Ignoring invalid message: %v", err)
+			continue
+		}
+		if !c.deliver(env) {
+			return
+		}
+	}
+}
+
+// deliver queues env on Messages, waiting for room unless the client is
+// closed first. It reports false once closed.
+func (c *Client) deliver(env *relay.Envelope) bool {
+	select {
+	case c.messages <- env:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// reconnect retries dial with exponential backoff until it succeeds or
+// the client is closed. ok is false if the client was closed.
+func (c *Client) reconnect() (conn *websocket.Conn, status *relay.Envelope, ok bool) {
+	backoff := c.opts.MinBackoff
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-c.done:
+			timer.Stop()
+			return nil, nil, false
+		case <-timer.C:
+		}
+
+		conn, status, err := c.dial()
+		if err == nil {
+			c.mu.Lock()
+			if c.closed {
+				c.mu.Unlock()
+				conn.Close()
+				return nil, nil, false
+			}
+			c.conn = conn
+			c.mu.Unlock()
+			c.log(relay.LogInfo, "Reconnected to room %s after %d attempts", c.room, attempt)
+			return conn, status, true
+		}
+		c.log(relay.LogWarn, "Reconnect attempt %d to room %s failed: %v", attempt, c.room, err)
+		backoff = min(backoff*2, c.opts.MaxBackoff)
+	}
+}
+
+// dial connects, sends JOIN, waits for the room's ROOM_STATUS, and sends
+// IDENTIFY. It returns the ROOM_STATUS for delivery.
+func (c *Client) dial() (*websocket.Conn, *relay.Envelope, error) {
+	dialer := websocket.Dialer{HandshakeTimeout: c.opts.HandshakeTimeout}
+	header := http.Header{}
+	if c.opts.AuthToken != "" {
+		header.Set("Authorization", "Bearer "+c.opts.AuthToken)
+	}
+	conn, _, err := dialer.Dial(c.url, header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dial %s: %w", c.url, err)
+	}
+
+	status, err := c.handshake(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, status, nil
+}
+
+// handshake joins and identifies on a fresh connection.
+func (c *Client) handshake(conn *websocket.Conn) (*relay.Envelope, error) {
+	deadline := time.Now().Add(c.opts.HandshakeTimeout)
+	conn.SetWriteDeadline(deadline)
+	conn.SetReadDeadline(deadline)
+	defer conn.SetReadDeadline(time.Time{})
+
+	if err := writeEnvelope(conn, relay.TypeJoin, relay.JoinPayload{
+		Room:     c.room,
+		Password: c.opts.Password,
+	}); err != nil {
+		return nil, fmt.Errorf("send JOIN: %w", err)
+	}
+
+	// The relay answers a successful JOIN with ROOM_STATUS and closes
+	// the connection otherwise
+	var status *relay.Envelope
+	for status == nil {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return nil, fmt.Errorf("join room %s: %w", c.room, err)
+		}
+		if env, err := relay.ParseEnvelope(data); err == nil && env.Type == relay.TypeRoomStatus {
+			status = env
+		}
+	}
+
+	if err := writeEnvelope(conn, relay.TypeIdentify, relay.IdentifyPayload{
+		ClientType:  string(c.opts.ClientType),
+		DisplayName: c.opts.DisplayName,
+	}); err != nil {
+		return nil, fmt.Errorf("send IDENTIFY: %w", err)
+	}
+	return status, nil
+}
+
+// writeEnvelope sends one envelope as a text frame.
+func writeEnvelope(conn *websocket.Conn, msgType relay.MessageType, payload any) error {
+	data, err := relay.MakeEnvelope(msgType, payload)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// log sends a formatted event to Options.OnLog, if set.
+func (c *Client) log(level relay.LogLevel, format string, args ...any) {
+	if c.opts.OnLog != nil {
+		c.opts.OnLog(level, fmt.Sprintf(format, args...))
+	}
+}
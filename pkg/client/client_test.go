@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sam-phinizy/vtt-remote/pkg/natsutil"
+	"github.com/sam-phinizy/vtt-remote/pkg/relay"
+)
+
+// startTestNATS starts an embedded NATS server for the test's duration.
+func startTestNATS(t *testing.T) *natsutil.EmbeddedNATS {
+	t.Helper()
+	ns, err := natsutil.Start()
+	if err != nil {
+		t.Fatalf("Failed to start NATS: %v", err)
+	}
+	t.Cleanup(ns.Shutdown)
+	return ns
+}
+
+// startTestRelay serves a relay over ns on addr ("127.0.0.1:0" for any
+// port). It returns the WebSocket URL and a func that stops the server,
+// dropping every client.
+func startTestRelay(t *testing.T, ns *natsutil.EmbeddedNATS, addr string) (string, func()) {
+	t.Helper()
+	r, err := relay.NewRelay(relay.Config{NatsURL: ns.ClientURL()})
+	if err != nil {
+		t.Fatalf("Failed to create relay: %v", err)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		r.Close()
+		t.Fatalf("Failed to listen on %s: %v", addr, err)
+	}
+
+	upgrader := websocket.Upgrader{}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		r.HandleClient(conn)
+	})}
+	go server.Serve(ln)
+
+	stopped := false
+	stop := func() {
+		if stopped {
+			return
+		}
+		stopped = true
+		server.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		r.Shutdown(ctx)
+		r.Close()
+	}
+	t.Cleanup(stop)
+	return "ws://" + ln.Addr().String() + "/ws", stop
+}
+
+// connect connects a client for the test's duration.
+func connect(t *testing.T, url, room string, opts Options) *Client {
+	t.Helper()
+	c, err := Connect(url, room, opts)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// nextOfType reads c's messages until one of msgType arrives.
+func nextOfType(t *testing.T, c *Client, msgType relay.MessageType) *relay.Envelope {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case env, ok := <-c.Messages():
+			if !ok {
+				t.Fatalf("Messages closed waiting for %s", msgType)
+			}
+			if env.Type == msgType {
+				return env
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %s", msgType)
+		}
+	}
+}
+
+func TestConnect(t *testing.T) {
+	ns := startTestNATS(t)
+	url, _ := startTestRelay(t, ns, "127.0.0.1:0")
+
+	c := connect(t, url, "BOT001", Options{DisplayName: "Bot"})
+	if env := nextOfType(t, c, relay.TypeRoomStatus); env == nil {
+		t.Fatal("No ROOM_STATUS")
+	}
+
+	c.Close()
+	for range c.Messages() {
+		// Messages is closed once the client stops
+	}
+	if err := c.Send(relay.TypeMove, relay.MovePayload{TokenID: "tok1", Direction: "up"}); err != ErrClosed {
+		t.Errorf("Send after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestConnectFails(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	if _, err := Connect("ws://"+addr+"/ws", "BOT001", Options{}); err == nil {
+		t.Error("Connect to a closed port succeeded")
+	}
+
+	ns := startTestNATS(t)
+	url, _ := startTestRelay(t, ns, "127.0.0.1:0")
+	if _, err := Connect(url, "no room!", Options{}); err == nil {
+		t.Error("Connect with an invalid room code succeeded")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	ns := startTestNATS(t)
+	url, _ := startTestRelay(t, ns, "127.0.0.1:0")
+
+	foundry := connect(t, url, "BOT002", Options{ClientType: relay.ClientTypeFoundry})
+	phone := connect(t, url, "BOT002", Options{})
+
+	if err := phone.Send(relay.TypeMove, relay.MovePayload{TokenID: "tok1", Direction: "up"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	env := nextOfType(t, foundry, relay.TypeMove)
+	if want := `{"direction":"up","tokenId":"tok1"}`; string(env.Payload) != want {
+		t.Errorf("MOVE payload = %s, want %s", env.Payload, want)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	ns := startTestNATS(t)
+	url, stop := startTestRelay(t, ns, "127.0.0.1:0")
+
+	bot := connect(t, url, "BOT003", Options{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+	})
+	nextOfType(t, bot, relay.TypeRoomStatus)
+
+	// Bounce the server on the same address
+	stop()
+	url, _ = startTestRelay(t, ns, url[len("ws://"):len(url)-len("/ws")])
+
+	// Rejoining delivers a fresh ROOM_STATUS
+	nextOfType(t, bot, relay.TypeRoomStatus)
+
+	foundry := connect(t, url, "BOT003", Options{ClientType: relay.ClientTypeFoundry})
+	nextOfType(t, foundry, relay.TypeRoomStatus)
+	if err := bot.Send(relay.TypeActorUpdate, map[string]string{"tokenId": "tok1"}); err != nil {
+		t.Fatalf("Send after reconnect: %v", err)
+	}
+	nextOfType(t, foundry, relay.TypeActorUpdate)
+}
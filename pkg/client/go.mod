@@ -0,0 +1,33 @@
+module github.com/sam-phinizy/vtt-remote/pkg/client
+
+go 1.24.0
+
+require (
+	github.com/gorilla/websocket v1.5.3
+	github.com/sam-phinizy/vtt-remote/pkg/natsutil v0.0.0
+	github.com/sam-phinizy/vtt-remote/pkg/relay v0.0.0
+)
+
+require (
+	github.com/antithesishq/antithesis-sdk-go v0.4.3-default-no-op // indirect
+	github.com/google/go-tpm v0.9.6 // indirect
+	github.com/klauspost/compress v1.18.1 // indirect
+	github.com/minio/highwayhash v1.0.4-0.20251030100505-070ab1a87a76 // indirect
+	github.com/nats-io/jwt/v2 v2.8.0 // indirect
+	github.com/nats-io/nats-server/v2 v2.12.2 // indirect
+	github.com/nats-io/nats.go v1.47.0 // indirect
+	github.com/nats-io/nkeys v0.4.11 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	github.com/sam-phinizy/vtt-remote/pkg/roomcode v0.0.0 // indirect
+	github.com/vmihailenco/msgpack/v5 v5.4.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	golang.org/x/crypto v0.43.0 // indirect
+	golang.org/x/sys v0.38.0 // indirect
+	golang.org/x/time v0.14.0 // indirect
+)
+
+replace (
+	github.com/sam-phinizy/vtt-remote/pkg/natsutil => ../natsutil
+	github.com/sam-phinizy/vtt-remote/pkg/relay => ../relay
+	github.com/sam-phinizy/vtt-remote/pkg/roomcode => ../roomcode
+)
@@ -0,0 +1,122 @@
+// Package discovery finds VTT Remote relays advertised over mDNS.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+)
+
+// Service types and domain the desktop app registers under. Relays
+// advertise ServiceType; LegacyServiceType is a generic HTTP registration
+// kept for clients that predate it.
+const (
+	ServiceType       = "_vttremote._tcp"
+	LegacyServiceType = "_http._tcp"
+	Domain            = "local."
+)
+
+// TXT record keys, each sent as "key=value".
+const (
+	TXTPath    = "path"    // WebSocket path
+	TXTVersion = "version" // relay build version
+	TXTRoom    = "room"    // room hint: the only room with Foundry connected
+)
+
+// WSPath is the WebSocket path relays serve.
+const WSPath = "/ws"
+
+// Text returns the TXT records for a relay. An empty room is omitted.
+func Text(version, room string) []string {
+	text := []string{TXTPath + "=" + WSPath, TXTVersion + "=" + version}
+	if room != "" {
+		text = append(text, TXTRoom+"="+room)
+	}
+	return text
+}
+
+// Service is a relay found on the local network.
+type Service struct {
+	Instance string   // mDNS instance name, e.g. "vtt-remote"
+	Host     string   // advertised host name, e.g. "vtt-remote.local."
+	Port     int      // HTTP(S) port
+	IP       net.IP   // preferred address: the first IPv4, else IPv6
+	Path     string   // WebSocket path
+	Version  string   // relay version, if advertised
+	Room     string   // room hint, if advertised
+	TXT      []string // all TXT records
+}
+
+// Browse looks for relays for up to timeout, or until ctx is done, and
+// returns every instance of ServiceType advertising a WebSocket path.
+// Instances seen more than once are reported once.
+func Browse(ctx context.Context, timeout time.Duration) ([]Service, error) {
+	return BrowseType(ctx, ServiceType, timeout)
+}
+
+// BrowseType is Browse for another service type, e.g. LegacyServiceType.
+func BrowseType(ctx context.Context, serviceType string, timeout time.Duration) ([]Service, error) {
+	resolver, err := zeroconf.NewResolver(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mDNS resolver: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	entries := make(chan *zeroconf.ServiceEntry)
+	if err := resolver.Browse(ctx, serviceType, Domain, entries); err != nil {
+		return nil, fmt.Errorf("failed to browse %s: %w", serviceType, err)
+	}
+
+	// The resolver closes entries once ctx is done
+	var services []Service
+	seen := make(map[string]bool)
+	for entry := range entries {
+		svc, ok := serviceFromEntry(entry)
+		if !ok || seen[svc.Instance] {
+			continue
+		}
+		seen[svc.Instance] = true
+		services = append(services, svc)
+	}
+	return services, nil
+}
+
+// serviceFromEntry converts a resolved entry, reporting false if it is not
+// a relay or has no address yet.
+func serviceFromEntry(entry *zeroconf.ServiceEntry) (Service, bool) {
+	svc := Service{
+		Instance: entry.Instance,
+		Host:     entry.HostName,
+		Port:     entry.Port,
+		TXT:      entry.Text,
+	}
+	for _, record := range entry.Text {
+		key, value, _ := strings.Cut(record, "=")
+		switch key {
+		case TXTPath:
+			svc.Path = value
+		case TXTVersion:
+			svc.Version = value
+		case TXTRoom:
+			svc.Room = value
+		}
+	}
+	if svc.Path != WSPath {
+		return Service{}, false
+	}
+	switch {
+	case len(entry.AddrIPv4) > 0:
+		svc.IP = entry.AddrIPv4[0]
+	case len(entry.AddrIPv6) > 0:
+		svc.IP = entry.AddrIPv6[0]
+	default:
+		return Service{}, false
+	}
+	return svc, true
+}
@@ -0,0 +1,92 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+)
+
+func TestText(t *testing.T) {
+	if got, want := Text("1.2.0", ""), []string{"path=/ws", "version=1.2.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Text() = %v, want %v", got, want)
+	}
+	if got, want := Text("dev", "BRAVE-OTTER"), []string{"path=/ws", "version=dev", "room=BRAVE-OTTER"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Text() = %v, want %v", got, want)
+	}
+}
+
+func TestServiceFromEntry(t *testing.T) {
+	entry := zeroconf.NewServiceEntry("vtt-remote", ServiceType, Domain)
+	entry.HostName = "vtt-remote.local."
+	entry.Port = 8080
+	entry.Text = Text("1.2.0", "BRAVE-OTTER")
+	entry.AddrIPv6 = []net.IP{net.ParseIP("fd00::2")}
+	entry.AddrIPv4 = []net.IP{net.ParseIP("192.168.1.20")}
+
+	svc, ok := serviceFromEntry(entry)
+	if !ok {
+		t.Fatal("Relay entry was rejected")
+	}
+	if svc.Instance != "vtt-remote" || svc.Host != "vtt-remote.local." || svc.Port != 8080 {
+		t.Errorf("serviceFromEntry() = %+v", svc)
+	}
+	if svc.Path != WSPath || svc.Version != "1.2.0" || svc.Room != "BRAVE-OTTER" {
+		t.Errorf("TXT fields = %q %q %q", svc.Path, svc.Version, svc.Room)
+	}
+	if !svc.IP.Equal(net.ParseIP("192.168.1.20")) {
+		t.Errorf("IP = %s, want the IPv4 address", svc.IP)
+	}
+
+	entry.AddrIPv4 = nil
+	if svc, _ := serviceFromEntry(entry); !svc.IP.Equal(net.ParseIP("fd00::2")) {
+		t.Errorf("IP = %s, want the IPv6 address", svc.IP)
+	}
+
+	entry.Text = []string{"path=/"}
+	if _, ok := serviceFromEntry(entry); ok {
+		t.Error("Entry without the WebSocket path was accepted")
+	}
+}
+
+func TestBrowseFindsRegisteredService(t *testing.T) {
+	prefix := fmt.Sprintf("vtt-remote-test-%d", time.Now().UnixNano())
+	server, err := zeroconf.Register(prefix, ServiceType, Domain, 48080, Text("1.2.0", "BRAVE-OTTER"), nil)
+	if err != nil {
+		t.Skipf("mDNS unavailable: %v", err)
+	}
+	defer server.Shutdown()
+
+	// A generic HTTP service must not show up under the dedicated type
+	legacy, err := zeroconf.Register(prefix+"-http", LegacyServiceType, Domain, 48081, Text("1.2.0", ""), nil)
+	if err != nil {
+		t.Skipf("mDNS unavailable: %v", err)
+	}
+	defer legacy.Shutdown()
+
+	services, err := Browse(context.Background(), 3*time.Second)
+	if err != nil {
+		t.Fatalf("Browse: %v", err)
+	}
+	var found []Service
+	for _, svc := range services {
+		if strings.HasPrefix(svc.Instance, prefix) {
+			found = append(found, svc)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("Found %+v, want only %s", found, prefix)
+	}
+	svc := found[0]
+	if svc.Instance != prefix || svc.Port != 48080 || svc.IP == nil {
+		t.Errorf("Found %+v, want %s on port 48080 with an address", svc, prefix)
+	}
+	if svc.Version != "1.2.0" || svc.Room != "BRAVE-OTTER" {
+		t.Errorf("Version, room = %q, %q", svc.Version, svc.Room)
+	}
+}
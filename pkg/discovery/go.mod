@@ -0,0 +1,14 @@
+module github.com/sam-phinizy/vtt-remote/pkg/discovery
+
+go 1.24.0
+
+require github.com/grandcat/zeroconf v1.0.0
+
+require (
+	github.com/cenkalti/backoff v2.2.1+incompatible // indirect
+	github.com/miekg/dns v1.1.27 // indirect
+	golang.org/x/crypto v0.43.0 // indirect
+	golang.org/x/net v0.45.0 // indirect
+	golang.org/x/sync v0.17.0 // indirect
+	golang.org/x/sys v0.38.0 // indirect
+)
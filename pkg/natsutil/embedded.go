@@ -3,6 +3,9 @@ package natsutil
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/nats-io/nats-server/v2/server"
@@ -11,16 +14,78 @@ import (
 // EmbeddedNATS wraps an embedded NATS server for in-process messaging.
 type EmbeddedNATS struct {
 	server *server.Server
+	user   *url.Userinfo // credentials added to ClientURL (nil when open)
+}
+
+// Options configures an embedded NATS server. The zero value is an open
+// server on 127.0.0.1, as used by Start.
+type Options struct {
+	// Host is the interface to bind. Defaults to 127.0.0.1.
+	Host string
+	// Port is the client port. Zero (the default) picks a random free port.
+	Port int
+
+	// Username and Password, if set, are required from every client.
+	Username string
+	Password string
+	// Token, if set, is required from every client. It cannot be
+	// combined with Username.
+	Token string
+
+	// EnableJetStream turns on JetStream persistence; see AddGameStream.
+	EnableJetStream bool
+	// StoreDir is where JetStream keeps file-backed streams. Reuse the
+	// same directory across restarts to replay stored messages. Empty
+	// uses a new temporary directory.
+	StoreDir string
 }
 
 // Start creates and starts an embedded NATS server on a random port.
 // The server binds to localhost only and is suitable for in-process use.
 func Start() (*EmbeddedNATS, error) {
+	return StartWithOptions(Options{})
+}
+
+// StartOnPort creates and starts an embedded NATS server on localhost at
+// the given port. It returns an error if the port is already in use.
+func StartOnPort(port int) (*EmbeddedNATS, error) {
+	return StartWithOptions(Options{Port: port})
+}
+
+// StartWithOptions creates and starts an embedded NATS server with the
+// given bind host, port, and credentials.
+func StartWithOptions(o Options) (*EmbeddedNATS, error) {
+	if o.Token != "" && o.Username != "" {
+		return nil, fmt.Errorf("NATS token and username are mutually exclusive")
+	}
+	if o.Password != "" && o.Username == "" {
+		return nil, fmt.Errorf("NATS password requires a username")
+	}
+	if o.Host == "" {
+		o.Host = "127.0.0.1"
+	}
+	port := -1 // Random available port
+	if o.Port != 0 {
+		// The server binds asynchronously, so check the port up front
+		// rather than waiting out ReadyForConnections.
+		l, err := net.Listen("tcp", net.JoinHostPort(o.Host, strconv.Itoa(o.Port)))
+		if err != nil {
+			return nil, fmt.Errorf("NATS port %d unavailable: %w", o.Port, err)
+		}
+		l.Close()
+		port = o.Port
+	}
+
 	opts := &server.Options{
-		Host:   "127.0.0.1",
-		Port:   -1, // Random available port
-		NoLog:  true,
-		NoSigs: true,
+		Host:          o.Host,
+		Port:          port,
+		NoLog:         true,
+		NoSigs:        true,
+		Username:      o.Username,
+		Password:      o.Password,
+		Authorization: o.Token,
+		JetStream:     o.EnableJetStream,
+		StoreDir:      o.StoreDir,
 	}
 
 	ns, err := server.NewServer(opts)
@@ -34,12 +99,38 @@ func Start() (*EmbeddedNATS, error) {
 		return nil, fmt.Errorf("NATS server not ready after 5 seconds")
 	}
 
-	return &EmbeddedNATS{server: ns}, nil
+	e := &EmbeddedNATS{server: ns}
+	switch {
+	case o.Token != "":
+		e.user = url.User(o.Token)
+	case o.Username != "":
+		e.user = url.UserPassword(o.Username, o.Password)
+	}
+	return e, nil
 }
 
-// ClientURL returns the URL for connecting to this NATS server.
+// ClientURL returns the URL for connecting to this NATS server, including
+// any configured credentials.
 func (e *EmbeddedNATS) ClientURL() string {
-	return e.server.ClientURL()
+	raw := e.server.ClientURL()
+	if e.user == nil {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.User = e.user
+	return u.String()
+}
+
+// Port returns the port the server is listening on, including when it
+// was chosen at random.
+func (e *EmbeddedNATS) Port() int {
+	if addr, ok := e.server.Addr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
 }
 
 // Shutdown stops the embedded NATS server.
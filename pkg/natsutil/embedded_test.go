@@ -1,6 +1,8 @@
 package natsutil
 
 import (
+	"fmt"
+	"net"
 	"strings"
 	"testing"
 
@@ -87,3 +89,100 @@ func TestEmbeddedNATSShutdown(t *testing.T) {
 		t.Error("Server should not be running after Shutdown()")
 	}
 }
+
+func TestEmbeddedNATSCredentials(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		wrong string // ClientURL with bad credentials
+	}{
+		{name: "token", opts: Options{Token: "s3cret"}, wrong: "nats://wrong@"},
+		{name: "user/password", opts: Options{Username: "vtt", Password: "s3cret"}, wrong: "nats://vtt:wrong@"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns, err := StartWithOptions(tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to start embedded NATS: %v", err)
+			}
+			defer ns.Shutdown()
+
+			// ClientURL carries the credentials
+			nc, err := nats.Connect(ns.ClientURL())
+			if err != nil {
+				t.Fatalf("Connect with ClientURL failed: %v", err)
+			}
+			nc.Close()
+
+			hostPort := ns.server.Addr().String()
+			if nc, err := nats.Connect("nats://" + hostPort); err == nil {
+				nc.Close()
+				t.Error("Expected connect without credentials to fail")
+			}
+			if nc, err := nats.Connect(tt.wrong + hostPort); err == nil {
+				nc.Close()
+				t.Error("Expected connect with wrong credentials to fail")
+			}
+		})
+	}
+}
+
+func TestEmbeddedNATSInvalidOptions(t *testing.T) {
+	for _, opts := range []Options{
+		{Token: "t", Username: "u"},
+		{Password: "p"},
+	} {
+		if ns, err := StartWithOptions(opts); err == nil {
+			ns.Shutdown()
+			t.Errorf("StartWithOptions(%+v) succeeded, want error", opts)
+		}
+	}
+}
+
+func TestEmbeddedNATSRandomPort(t *testing.T) {
+	ns, err := Start()
+	if err != nil {
+		t.Fatalf("Failed to start embedded NATS: %v", err)
+	}
+	defer ns.Shutdown()
+
+	port := ns.Port()
+	if port <= 0 {
+		t.Fatalf("Port() = %d, want a bound port", port)
+	}
+	if want := fmt.Sprintf("nats://127.0.0.1:%d", port); ns.ClientURL() != want {
+		t.Errorf("ClientURL = %q, want %q", ns.ClientURL(), want)
+	}
+}
+
+func TestEmbeddedNATSStartOnPort(t *testing.T) {
+	// Find a free port, then release it for the server
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find free port: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	ns, err := StartOnPort(port)
+	if err != nil {
+		t.Fatalf("StartOnPort(%d) failed: %v", port, err)
+	}
+	defer ns.Shutdown()
+
+	if ns.Port() != port {
+		t.Errorf("Port() = %d, want %d", ns.Port(), port)
+	}
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	nc.Close()
+
+	// The port is now taken
+	if dup, err := StartOnPort(port); err == nil {
+		dup.Shutdown()
+		t.Error("Expected StartOnPort on a taken port to fail")
+	}
+}
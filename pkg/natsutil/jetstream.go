@@ -0,0 +1,81 @@
+package natsutil
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// GameStreamName is the JetStream stream that captures game traffic.
+const GameStreamName = "GAME"
+
+// GameSubjects is the subject space bound to the game stream. It matches
+// the relay's per-room "game.<ROOM>" subjects, so messages published with
+// core NATS are stored without any change to the publisher. Relays with a
+// custom relay.Config.SubjectPrefix are not captured.
+const GameSubjects = "game.*"
+
+// Default retention limits for the game stream.
+const (
+	defaultStreamMaxAge   = time.Hour
+	defaultStreamMaxBytes = 64 << 20 // 64MB
+)
+
+// StreamOptions configures the game stream.
+//
+// Storage footprint: the stream holds every relayed message until it is
+// older than MaxAge or the stream exceeds MaxBytes, whichever comes first.
+// File storage uses up to MaxBytes on disk in Options.StoreDir (plus small
+// index files); memory storage uses up to MaxBytes of RAM and does not
+// survive a server restart.
+type StreamOptions struct {
+	// Memory selects memory storage instead of file storage.
+	Memory bool
+	// MaxAge discards messages older than this. Defaults to 1h.
+	MaxAge time.Duration
+	// MaxBytes caps the stream size. Defaults to 64MB.
+	MaxBytes int64
+}
+
+// AddGameStream creates the game stream on a JetStream-enabled server, or
+// updates its limits if it already exists.
+func AddGameStream(nc *nats.Conn, o StreamOptions) (*nats.StreamInfo, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get JetStream context: %w", err)
+	}
+
+	if o.MaxAge == 0 {
+		o.MaxAge = defaultStreamMaxAge
+	}
+	if o.MaxBytes == 0 {
+		o.MaxBytes = defaultStreamMaxBytes
+	}
+	storage := nats.FileStorage
+	if o.Memory {
+		storage = nats.MemoryStorage
+	}
+
+	cfg := &nats.StreamConfig{
+		Name:     GameStreamName,
+		Subjects: []string{GameSubjects},
+		Storage:  storage,
+		MaxAge:   o.MaxAge,
+		MaxBytes: o.MaxBytes,
+	}
+
+	info, err := js.AddStream(cfg)
+	if err == nil {
+		return info, nil
+	}
+	if !errors.Is(err, nats.ErrStreamNameAlreadyInUse) {
+		return nil, fmt.Errorf("failed to create game stream: %w", err)
+	}
+	info, err = js.UpdateStream(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update game stream: %w", err)
+	}
+	return info, nil
+}
@@ -0,0 +1,104 @@
+package natsutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestGameStreamReplayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{EnableJetStream: true, StoreDir: dir}
+
+	ns, err := StartWithOptions(opts)
+	if err != nil {
+		t.Fatalf("Failed to start embedded NATS: %v", err)
+	}
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	if _, err := AddGameStream(nc, StreamOptions{}); err != nil {
+		t.Fatalf("AddGameStream failed: %v", err)
+	}
+	// Adding again updates the existing stream
+	if _, err := AddGameStream(nc, StreamOptions{MaxAge: 2 * time.Hour}); err != nil {
+		t.Fatalf("AddGameStream on existing stream failed: %v", err)
+	}
+
+	// Core NATS publishes to game.* are captured by the stream
+	nc.Publish("game.ROOM1", []byte(`{"type":"MOVE"}`))
+	js, _ := nc.JetStream()
+	if _, err := js.Publish("game.ROOM1", []byte(`{"type":"PAIR_SUCCESS"}`)); err != nil {
+		t.Fatalf("JetStream publish failed: %v", err)
+	}
+	nc.Close()
+	ns.Shutdown()
+	ns.server.WaitForShutdown()
+
+	// Restart on the same store directory
+	ns, err = StartWithOptions(opts)
+	if err != nil {
+		t.Fatalf("Failed to restart embedded NATS: %v", err)
+	}
+	defer ns.Shutdown()
+	nc, err = nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to reconnect to NATS: %v", err)
+	}
+	defer nc.Close()
+	js, _ = nc.JetStream()
+
+	sub, err := js.SubscribeSync("game.ROOM1", nats.DeliverAll())
+	if err != nil {
+		t.Fatalf("Failed to subscribe to stream: %v", err)
+	}
+	for _, want := range []string{`{"type":"MOVE"}`, `{"type":"PAIR_SUCCESS"}`} {
+		msg, err := sub.NextMsg(2 * time.Second)
+		if err != nil {
+			t.Fatalf("Expected replayed %s: %v", want, err)
+		}
+		if string(msg.Data) != want {
+			t.Errorf("Replayed %s, want %s", msg.Data, want)
+		}
+	}
+}
+
+func TestGameStreamMemoryStorage(t *testing.T) {
+	ns, err := StartWithOptions(Options{EnableJetStream: true, StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to start embedded NATS: %v", err)
+	}
+	defer ns.Shutdown()
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	info, err := AddGameStream(nc, StreamOptions{Memory: true})
+	if err != nil {
+		t.Fatalf("AddGameStream failed: %v", err)
+	}
+	if info.Config.Storage != nats.MemoryStorage {
+		t.Errorf("Storage = %v, want memory", info.Config.Storage)
+	}
+}
+
+func TestGameStreamWithoutJetStream(t *testing.T) {
+	ns, err := Start()
+	if err != nil {
+		t.Fatalf("Failed to start embedded NATS: %v", err)
+	}
+	defer ns.Shutdown()
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	if _, err := AddGameStream(nc, StreamOptions{}); err == nil {
+		t.Error("Expected AddGameStream to fail when JetStream is disabled")
+	}
+}
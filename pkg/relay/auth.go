@@ -0,0 +1,31 @@
+package relay
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Authorize reports whether an upgrade request carries the configured
+// AuthToken, either as an "Authorization: Bearer <token>" header or a
+// "token" query parameter. It always returns true when no token is set.
+// Call it before upgrading and reply 401 when it returns false.
+func (r *Relay) Authorize(req *http.Request) bool {
+	if r.config.AuthToken == "" {
+		return true
+	}
+
+	token := req.URL.Query().Get("token")
+	if scheme, value, ok := strings.Cut(req.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		token = strings.TrimSpace(value)
+	}
+	if token == "" {
+		return false
+	}
+
+	// Hashing first keeps the comparison constant-time regardless of length
+	want := sha256.Sum256([]byte(r.config.AuthToken))
+	got := sha256.Sum256([]byte(token))
+	return subtle.ConstantTimeCompare(want[:], got[:]) == 1
+}
@@ -0,0 +1,45 @@
+package relay
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRelayAuthorize(t *testing.T) {
+	r := &Relay{config: Config{AuthToken: "s3cret"}}
+
+	tests := []struct {
+		name   string
+		target string
+		header string
+		want   bool
+	}{
+		{name: "bearer header", target: "/ws", header: "Bearer s3cret", want: true},
+		{name: "lowercase scheme", target: "/ws", header: "bearer s3cret", want: true},
+		{name: "query param", target: "/ws?token=s3cret", want: true},
+		{name: "header overrides query", target: "/ws?token=s3cret", header: "Bearer nope", want: false},
+		{name: "wrong token", target: "/ws", header: "Bearer nope", want: false},
+		{name: "prefix of token", target: "/ws?token=s3c", want: false},
+		{name: "basic auth", target: "/ws", header: "Basic czNjcmV0", want: false},
+		{name: "missing token", target: "/ws", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if got := r.Authorize(req); got != tt.want {
+				t.Errorf("Authorize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelayAuthorizeDisabled(t *testing.T) {
+	r := &Relay{}
+	if !r.Authorize(httptest.NewRequest("GET", "/ws", nil)) {
+		t.Error("Expected requests to be allowed when no token is configured")
+	}
+}
@@ -0,0 +1,56 @@
+package relay
+
+import (
+	"bytes"
+	"time"
+)
+
+// Write batching defaults.
+const (
+	defaultMaxBatchSize = 32
+	defaultBatchWindow  = 2 * time.Millisecond
+)
+
+// nextBatch collects messages queued behind first, for up to BatchWindow
+// or MaxBatchSize messages, and returns them as one BATCH frame. A lone
+// message is returned unchanged. closed reports that sendChan was closed
+// while collecting, so the caller should finish with the close frame.
+func (c *Client) nextBatch(first []byte) (frame []byte, closed bool) {
+	msgs := [][]byte{first}
+	timer := time.NewTimer(c.relay.config.BatchWindow)
+	defer timer.Stop()
+
+collect:
+	for len(msgs) < c.relay.config.MaxBatchSize {
+		select {
+		case data, ok := <-c.sendChan:
+			if !ok {
+				closed = true
+				break collect
+			}
+			msgs = append(msgs, data)
+		case <-timer.C:
+			break collect
+		}
+	}
+
+	if len(msgs) == 1 {
+		return first, closed
+	}
+	return makeBatch(msgs), closed
+}
+
+// makeBatch wraps JSON envelopes in a BATCH envelope whose payload is the
+// array of them, in order.
+func makeBatch(msgs [][]byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"type":"` + string(TypeBatch) + `","payload":[`)
+	for i, msg := range msgs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(msg)
+	}
+	buf.WriteString(`]}`)
+	return buf.Bytes()
+}
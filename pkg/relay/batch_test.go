@@ -0,0 +1,80 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMakeBatch(t *testing.T) {
+	got := makeBatch([][]byte{[]byte(`{"type":"A"}`), []byte(`{"type":"B"}`)})
+	want := `{"type":"BATCH","payload":[{"type":"A"},{"type":"B"}]}`
+	if string(got) != want {
+		t.Errorf("makeBatch = %s, want %s", got, want)
+	}
+}
+
+func TestRelayBatchWrites(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{
+		BatchWrites: true,
+		BatchWindow: 200 * time.Millisecond,
+	})
+	defer cleanup()
+
+	batching := dialWS(t, server.URL)
+	defer batching.Close()
+	batching.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"BATCH1","batch":true}}`))
+	consumeRoomStatus(t, batching)
+
+	plain := dialWS(t, server.URL)
+	defer plain.Close()
+	plain.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"BATCH2"}}`))
+	consumeRoomStatus(t, plain)
+
+	var burst []string
+	for i := 0; i < 5; i++ {
+		msg := fmt.Sprintf(`{"type":"MOVE","payload":{"tokenId":"tok%d","direction":"up"}}`, i)
+		burst = append(burst, msg)
+		r.nc.Publish(r.roomSubject("BATCH1"), []byte(msg))
+		r.nc.Publish(r.roomSubject("BATCH2"), []byte(msg))
+	}
+	r.nc.Flush()
+
+	// The batching client gets the whole burst in one frame
+	batching.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := batching.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read batch: %v", err)
+	}
+	env, err := ParseEnvelope(data)
+	if err != nil || env.Type != TypeBatch {
+		t.Fatalf("Expected BATCH, got %s (%v)", data, err)
+	}
+	var msgs []json.RawMessage
+	if err := json.Unmarshal(env.Payload, &msgs); err != nil {
+		t.Fatalf("Invalid BATCH payload: %v", err)
+	}
+	if len(msgs) != len(burst) {
+		t.Fatalf("BATCH has %d messages, want %d", len(msgs), len(burst))
+	}
+	for i, msg := range msgs {
+		if string(msg) != burst[i] {
+			t.Errorf("BATCH message %d = %s, want %s", i, msg, burst[i])
+		}
+	}
+
+	// A client that didn't ask for batching gets one frame per message
+	plain.SetReadDeadline(time.Now().Add(time.Second))
+	for i, want := range burst {
+		_, data, err := plain.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read message %d: %v", i, err)
+		}
+		if string(data) != want {
+			t.Errorf("Message %d = %s, want %s", i, data, want)
+		}
+	}
+}
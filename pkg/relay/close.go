@@ -0,0 +1,150 @@
+package relay
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket close codes for protocol errors. Several close reasons may
+// share a code; the close frame's reason text tells them apart.
+const (
+	CloseProtocolError      = 4001 // malformed, late, or oversized messages
+	CloseInvalidRoom        = 4002 // JOIN room code failed validation
+	CloseSubscribeFailed    = 4003 // relay could not subscribe to the room
+	CloseRateLimited        = 4004 // client exceeded MaxMessagesPerSecond
+	CloseUnsupportedVersion = 4005 // JOIN protoVersion or subprotocol outside the supported range
+	CloseRoomFull           = 4006 // room already has MaxClientsPerRoom clients
+	CloseServerFull         = 4007 // MaxRooms reached; new rooms cannot be created
+	CloseKicked             = 4008 // disconnected by the host
+	CloseAuthFailed         = 4009 // room password did not match
+	CloseSlowClient         = 4010 // send buffer overflowed under DisconnectClient
+	CloseIdle               = 4011 // room closed after IdleRoomTimeout
+	CloseDuplicateFoundry   = 4012 // room already has a Foundry
+	CloseRoomReserved       = 4013 // room requires its reservation key
+)
+
+// CloseReason identifies why the relay closed a connection. Each reason
+// has a fixed close code and is sent as a JSON CloseReasonPayload in the
+// close frame's reason text, so clients can branch on it.
+type CloseReason int
+
+// Close reasons. The zero value means no close frame is sent.
+const (
+	_ CloseReason = iota
+	CloseReasonJoinTimeout
+	CloseReasonInvalidJSON
+	CloseReasonExpectedJoin
+	CloseReasonInvalidJoin
+	CloseReasonUnsupportedEncoding
+	CloseReasonMessageTooLarge
+	CloseReasonInvalidRoom
+	CloseReasonSubscribeFailed
+	CloseReasonRateLimited
+	CloseReasonUnsupportedVersion
+	CloseReasonRoomFull
+	CloseReasonServerFull
+	CloseReasonKicked
+	CloseReasonRoomClosed
+	CloseReasonAuthFailed
+	CloseReasonSlowClient
+	CloseReasonRoomIdle
+	CloseReasonDuplicateFoundry
+	CloseReasonRoomReserved
+	CloseReasonShuttingDown
+	CloseReasonCancelled
+)
+
+// closeReasonInfo is a reason's code, machine-readable name, and default
+// human-readable message.
+type closeReasonInfo struct {
+	code    int
+	name    string
+	message string
+}
+
+var closeReasons = map[CloseReason]closeReasonInfo{
+	CloseReasonJoinTimeout:         {CloseProtocolError, "join_timeout", "No JOIN received in time"},
+	CloseReasonInvalidJSON:         {CloseProtocolError, "invalid_json", "Invalid JSON"},
+	CloseReasonExpectedJoin:        {CloseProtocolError, "expected_join", "Expected JOIN message"},
+	CloseReasonInvalidJoin:         {CloseProtocolError, "invalid_join", "Invalid JOIN payload"},
+	CloseReasonUnsupportedEncoding: {CloseProtocolError, "unsupported_encoding", "Unsupported encoding"},
+	CloseReasonMessageTooLarge:     {CloseProtocolError, "message_too_large", "Message too large"},
+	CloseReasonInvalidRoom:         {CloseInvalidRoom, "invalid_room", "Invalid room code format"},
+	CloseReasonSubscribeFailed:     {CloseSubscribeFailed, "subscribe_failed", "Failed to subscribe"},
+	CloseReasonRateLimited:         {CloseRateLimited, "rate_limited", "Rate limit exceeded"},
+	CloseReasonUnsupportedVersion:  {CloseUnsupportedVersion, "unsupported_version", "Unsupported protocol version"},
+	CloseReasonRoomFull:            {CloseRoomFull, "room_full", "Room is full"},
+	CloseReasonServerFull:          {CloseServerFull, "server_full", "Server room limit reached"},
+	CloseReasonKicked:              {CloseKicked, "kicked", "Kicked by host"},
+	CloseReasonRoomClosed:          {CloseKicked, "room_closed", "Room closed by host"},
+	CloseReasonAuthFailed:          {CloseAuthFailed, "auth_failed", "Invalid room password"},
+	CloseReasonSlowClient:          {CloseSlowClient, "slow_client", "Client too slow"},
+	CloseReasonRoomIdle:            {CloseIdle, "room_idle", "Room idle"},
+	CloseReasonDuplicateFoundry:    {CloseDuplicateFoundry, "duplicate_foundry", "Duplicate Foundry"},
+	CloseReasonRoomReserved:        {CloseRoomReserved, "room_reserved", "Room is reserved"},
+	CloseReasonShuttingDown:        {websocket.CloseGoingAway, "shutting_down", "Server shutting down"},
+	CloseReasonCancelled:           {websocket.CloseGoingAway, "cancelled", "Connection cancelled"},
+}
+
+// String returns the reason's machine-readable name, such as
+// "join_timeout".
+func (r CloseReason) String() string {
+	if info, ok := closeReasons[r]; ok {
+		return info.name
+	}
+	return "unknown"
+}
+
+// Code returns the WebSocket close code sent with the reason.
+func (r CloseReason) Code() int {
+	if info, ok := closeReasons[r]; ok {
+		return info.code
+	}
+	return websocket.CloseInternalServerErr
+}
+
+// CloseReasonPayload is the JSON reason text of a relay close frame.
+type CloseReasonPayload struct {
+	Reason  string `json:"reason"`  // CloseReason name, e.g. "room_full"
+	Message string `json:"message"` // human-readable explanation
+}
+
+// ParseCloseReason decodes the reason text of a relay close frame.
+func ParseCloseReason(text string) (CloseReasonPayload, error) {
+	var p CloseReasonPayload
+	err := json.Unmarshal([]byte(text), &p)
+	return p, err
+}
+
+// maxCloseReasonBytes is the most reason text a close frame can carry.
+const maxCloseReasonBytes = 123
+
+// closeMessage formats the close frame for reason. An empty message uses
+// the reason's default; long messages are shortened to fit the frame.
+func closeMessage(reason CloseReason, message string) []byte {
+	if message == "" {
+		message = closeReasons[reason].message
+	}
+	for {
+		text, _ := json.Marshal(CloseReasonPayload{Reason: reason.String(), Message: message})
+		if len(text) <= maxCloseReasonBytes || message == "" {
+			return websocket.FormatCloseMessage(reason.Code(), string(text))
+		}
+		message = message[:len(message)-1]
+	}
+}
+
+// closeClient closes the client's WebSocket with reason. It uses
+// WriteControl, so it is safe to call while writePump is running.
+func closeClient(c *Client, reason CloseReason) {
+	closeClientMessage(c, reason, "")
+}
+
+// closeClientMessage is closeClient with a message in place of the
+// reason's default.
+func closeClientMessage(c *Client, reason CloseReason, message string) {
+	c.conn.WriteControl(websocket.CloseMessage, closeMessage(reason, message), time.Now().Add(time.Second))
+	c.conn.Close()
+}
@@ -0,0 +1,80 @@
+package relay
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCloseReasons(t *testing.T) {
+	names := make(map[string]bool)
+	for reason := CloseReasonJoinTimeout; reason <= CloseReasonCancelled; reason++ {
+		info, ok := closeReasons[reason]
+		if !ok {
+			t.Errorf("CloseReason %d has no entry", reason)
+			continue
+		}
+		if names[info.name] {
+			t.Errorf("Duplicate close reason name %q", info.name)
+		}
+		names[info.name] = true
+		if reason.String() != info.name || reason.Code() != info.code {
+			t.Errorf("CloseReason %d = %s/%d, want %s/%d", reason, reason, reason.Code(), info.name, info.code)
+		}
+	}
+	if got := CloseReason(0).String(); got != "unknown" {
+		t.Errorf("Zero CloseReason = %q, want unknown", got)
+	}
+}
+
+func TestCloseMessageFitsFrame(t *testing.T) {
+	frame := closeMessage(CloseReasonUnsupportedVersion, strings.Repeat("x", 200))
+	if len(frame) > 125 {
+		t.Fatalf("Close frame is %d bytes, over the 125-byte control frame limit", len(frame))
+	}
+	if code := binary.BigEndian.Uint16(frame); code != CloseUnsupportedVersion {
+		t.Errorf("Code = %d, want %d", code, CloseUnsupportedVersion)
+	}
+	p, err := ParseCloseReason(string(frame[2:]))
+	if err != nil {
+		t.Fatalf("ParseCloseReason: %v", err)
+	}
+	if p.Reason != "unsupported_version" || !strings.HasPrefix(p.Message, "xxx") {
+		t.Errorf("Payload = %+v", p)
+	}
+}
+
+func TestRelayRejectedJoinCloseReason(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{MaxClientsPerRoom: 1})
+	defer cleanup()
+
+	first := dialWS(t, server.URL)
+	defer first.Close()
+	first.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"FULL2"}}`))
+	consumeRoomStatus(t, first)
+
+	extra := dialWS(t, server.URL)
+	defer extra.Close()
+	extra.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"FULL2"}}`))
+	extra.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := extra.ReadMessage()
+
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("Expected close error, got %v", err)
+	}
+	if closeErr.Code != CloseRoomFull {
+		t.Errorf("Close code = %d, want %d", closeErr.Code, CloseRoomFull)
+	}
+	p, err := ParseCloseReason(closeErr.Text)
+	if err != nil {
+		t.Fatalf("Close reason %q is not JSON: %v", closeErr.Text, err)
+	}
+	if p != (CloseReasonPayload{Reason: "room_full", Message: "Room is full"}) {
+		t.Errorf("Close reason = %+v", p)
+	}
+}
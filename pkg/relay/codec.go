@@ -0,0 +1,82 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Encoding is the wire format a client uses after JOIN.
+type Encoding string
+
+const (
+	// EncodingJSON sends envelopes as JSON text frames (the default).
+	EncodingJSON Encoding = "json"
+	// EncodingMsgPack sends envelopes as MessagePack binary frames.
+	EncodingMsgPack Encoding = "msgpack"
+)
+
+// parseEncoding maps a JoinPayload.Encoding value to an Encoding.
+// An empty value means JSON.
+func parseEncoding(s string) (Encoding, error) {
+	switch Encoding(s) {
+	case "", EncodingJSON:
+		return EncodingJSON, nil
+	case EncodingMsgPack:
+		return EncodingMsgPack, nil
+	default:
+		return "", fmt.Errorf("unsupported encoding %q", s)
+	}
+}
+
+// Messages travel through NATS as JSON, so every room member sees the
+// same bytes regardless of codec. MessagePack clients are transcoded at
+// the edge: on ingress in readPump and on egress in writePump. JSON peers
+// receive relayed bytes unchanged.
+
+// msgpackToJSON converts a MessagePack-encoded envelope to JSON.
+func msgpackToJSON(data []byte) ([]byte, error) {
+	var v any
+	if err := msgpack.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("invalid msgpack: %w", err)
+	}
+	if _, ok := v.(map[string]any); !ok {
+		return nil, fmt.Errorf("msgpack envelope must be a map, got %T", v)
+	}
+	return json.Marshal(v)
+}
+
+// jsonToMsgpack converts a JSON-encoded envelope to MessagePack.
+// Integral numbers are encoded as integers rather than floats.
+func jsonToMsgpack(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(normalizeNumbers(v))
+}
+
+// normalizeNumbers replaces json.Number values with int64 or float64.
+func normalizeNumbers(v any) any {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]any:
+		for k, elem := range t {
+			t[k] = normalizeNumbers(elem)
+		}
+	case []any:
+		for i, elem := range t {
+			t[i] = normalizeNumbers(elem)
+		}
+	}
+	return v
+}
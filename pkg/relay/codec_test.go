@@ -0,0 +1,155 @@
+package relay
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestParseEncoding(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Encoding
+		wantErr bool
+	}{
+		{in: "", want: EncodingJSON},
+		{in: "json", want: EncodingJSON},
+		{in: "msgpack", want: EncodingMsgPack},
+		{in: "cbor", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseEncoding(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseEncoding(%q) = (%q, %v), want (%q, err=%v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	original := `{"payload":{"clientTime":1760400000000,"ratio":0.5,"tags":["a","b"],"tokenId":"tok1"},"seq":7,"type":"PING"}`
+
+	packed, err := jsonToMsgpack([]byte(original))
+	if err != nil {
+		t.Fatalf("jsonToMsgpack failed: %v", err)
+	}
+
+	// Integers stay integers on the msgpack side
+	var decoded map[string]any
+	if err := msgpack.Unmarshal(packed, &decoded); err != nil {
+		t.Fatalf("Invalid msgpack: %v", err)
+	}
+	switch decoded["seq"].(type) {
+	case float32, float64:
+		t.Errorf("seq decoded as %T, want a msgpack integer", decoded["seq"])
+	}
+
+	back, err := msgpackToJSON(packed)
+	if err != nil {
+		t.Fatalf("msgpackToJSON failed: %v", err)
+	}
+	if string(back) != original {
+		t.Errorf("Round trip = %s, want %s", back, original)
+	}
+
+	if _, err := msgpackToJSON([]byte{0xc1}); err == nil {
+		t.Error("Expected error for invalid msgpack")
+	}
+	if _, err := msgpackToJSON([]byte{0x01}); err == nil {
+		t.Error("Expected error for non-map msgpack envelope")
+	}
+}
+
+func TestRelayMixedEncodings(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	jsonClient := dialWS(t, server.URL)
+	defer jsonClient.Close()
+	jsonClient.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"MIX1"}}`))
+	consumeRoomStatus(t, jsonClient)
+
+	packClient := dialWS(t, server.URL)
+	defer packClient.Close()
+	packClient.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"MIX1","encoding":"msgpack"}}`))
+
+	// readPacked reads one binary frame and decodes its envelope
+	readPacked := func() map[string]any {
+		t.Helper()
+		packClient.SetReadDeadline(time.Now().Add(time.Second))
+		frameType, data, err := packClient.ReadMessage()
+		if err != nil {
+			t.Fatalf("msgpack client read error: %v", err)
+		}
+		if frameType != websocket.BinaryMessage {
+			t.Fatalf("Expected binary frame, got type %d: %s", frameType, data)
+		}
+		var env map[string]any
+		if err := msgpack.Unmarshal(data, &env); err != nil {
+			t.Fatalf("Invalid msgpack from relay: %v", err)
+		}
+		return env
+	}
+
+	// Relay-originated messages are encoded too
+	if env := readPacked(); env["type"] != string(TypeRoomStatus) {
+		t.Fatalf("Expected ROOM_STATUS, got %v", env)
+	}
+
+	// JSON -> msgpack
+	jsonMove := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`
+	jsonClient.WriteMessage(websocket.TextMessage, []byte(jsonMove))
+	env := readPacked()
+	payload, _ := env["payload"].(map[string]any)
+	if env["type"] != string(TypeMove) || payload["direction"] != "up" || payload["tokenId"] != "tok1" {
+		t.Errorf("msgpack client got %v", env)
+	}
+	jsonClient.SetReadDeadline(time.Now().Add(time.Second))
+	if _, data, err := jsonClient.ReadMessage(); err != nil || string(data) != jsonMove {
+		t.Fatalf("JSON client echo = %s, %v", data, err)
+	}
+
+	// msgpack -> JSON
+	packed, err := msgpack.Marshal(map[string]any{
+		"type":    "MOVE",
+		"payload": map[string]any{"direction": "left", "tokenId": "tok2"},
+	})
+	if err != nil {
+		t.Fatalf("msgpack marshal failed: %v", err)
+	}
+	packClient.WriteMessage(websocket.BinaryMessage, packed)
+
+	jsonClient.SetReadDeadline(time.Now().Add(time.Second))
+	frameType, data, err := jsonClient.ReadMessage()
+	if err != nil {
+		t.Fatalf("JSON client read error: %v", err)
+	}
+	if frameType != websocket.TextMessage {
+		t.Errorf("JSON client got frame type %d, want text", frameType)
+	}
+	var move struct {
+		Type    MessageType
+		Payload MovePayload
+	}
+	if err := json.Unmarshal(data, &move); err != nil {
+		t.Fatalf("Invalid JSON from relay: %v", err)
+	}
+	if move.Type != TypeMove || move.Payload.Direction != "left" || move.Payload.TokenID != "tok2" {
+		t.Errorf("JSON client got %s", data)
+	}
+}
+
+func TestRelayRejectsUnknownEncoding(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"MIX2","encoding":"cbor"}}`))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, CloseProtocolError) {
+		t.Errorf("Expected close %d, got %v", CloseProtocolError, err)
+	}
+}
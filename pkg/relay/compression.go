@@ -0,0 +1,64 @@
+package relay
+
+import (
+	"compress/flate"
+)
+
+// compressionLevel matches gorilla/websocket's default deflate level.
+const compressionLevel = flate.BestSpeed
+
+// deflateTail is the empty block every permessage-deflate message drops.
+const deflateTail = 4
+
+// CompressionEnabled reports whether Config.EnableCompression is set.
+// Set websocket.Upgrader.EnableCompression from it before upgrading.
+func (r *Relay) CompressionEnabled() bool {
+	return r.config.EnableCompression
+}
+
+// compressionStats estimates permessage-deflate savings for one client.
+// Gorilla does not expose wire sizes, so each outbound message is also
+// compressed at the same level (without context takeover) and counted.
+// It is used only from writePump.
+type compressionStats struct {
+	fw         *flate.Writer
+	counter    byteCounter
+	raw        uint64
+	compressed uint64
+}
+
+// newCompressionStats creates an empty estimator.
+func newCompressionStats() *compressionStats {
+	s := &compressionStats{}
+	s.fw, _ = flate.NewWriter(&s.counter, compressionLevel) // Only fails for invalid levels
+	return s
+}
+
+// record adds one outbound message to the totals.
+func (s *compressionStats) record(data []byte) {
+	s.counter = 0
+	s.fw.Reset(&s.counter)
+	s.fw.Write(data)
+	s.fw.Flush()
+
+	s.raw += uint64(len(data))
+	if n := uint64(s.counter); n > deflateTail {
+		s.compressed += n - deflateTail
+	}
+}
+
+// ratio returns compressed size over raw size (lower is better).
+func (s *compressionStats) ratio() float64 {
+	if s.raw == 0 {
+		return 1
+	}
+	return float64(s.compressed) / float64(s.raw)
+}
+
+// byteCounter is an io.Writer that only counts bytes.
+type byteCounter int
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,99 @@
+package relay
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCompressionStats(t *testing.T) {
+	s := newCompressionStats()
+	if s.ratio() != 1 {
+		t.Errorf("Empty ratio = %v, want 1", s.ratio())
+	}
+
+	msg := []byte(`{"type":"MOVE","payload":{"direction":"up","tokenId":"` + strings.Repeat("a", 500) + `"}}`)
+	s.record(msg)
+	s.record(msg)
+
+	if s.raw != uint64(2*len(msg)) {
+		t.Errorf("raw = %d, want %d", s.raw, 2*len(msg))
+	}
+	if s.compressed == 0 || s.ratio() >= 0.5 {
+		t.Errorf("Expected repetitive payload to compress well, got %d bytes (ratio %.2f)", s.compressed, s.ratio())
+	}
+}
+
+func TestRelayCompressedAndUncompressedClients(t *testing.T) {
+	logs := make(chan string, 64)
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{
+		EnableCompression: true,
+		OnLog: func(level LogLevel, message string) {
+			if level == LogDebug {
+				select {
+				case logs <- message:
+				default:
+				}
+			}
+		},
+	})
+	defer cleanup()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	dial := func(compress bool, join string) *websocket.Conn {
+		t.Helper()
+		dialer := websocket.Dialer{EnableCompression: compress}
+		conn, resp, err := dialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatalf("Failed to dial WebSocket: %v", err)
+		}
+		negotiated := strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+		if negotiated != compress {
+			t.Fatalf("permessage-deflate negotiated = %v, want %v", negotiated, compress)
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(join))
+		return conn
+	}
+
+	compressed := dial(true, `{"type":"JOIN","payload":{"room":"ZIP1"}}`)
+	defer compressed.Close()
+	consumeRoomStatus(t, compressed)
+
+	plain := dial(false, `{"type":"JOIN","payload":{"room":"ZIP1"}}`)
+	defer plain.Close()
+	consumeRoomStatus(t, plain)
+
+	optedOut := dial(true, `{"type":"JOIN","payload":{"room":"ZIP1","noCompression":true}}`)
+	defer optedOut.Close()
+	consumeRoomStatus(t, optedOut)
+
+	move := sizedMove(t, 512)
+	for _, sender := range []*websocket.Conn{compressed, plain, optedOut} {
+		if err := sender.WriteMessage(websocket.TextMessage, move); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+		for i, conn := range []*websocket.Conn{compressed, plain, optedOut} {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("Client %d read error: %v", i, err)
+			}
+			if string(data) != string(move) {
+				t.Errorf("Client %d got %s, want %s", i, data, move)
+			}
+		}
+	}
+
+	// The compressed client's ratio is logged at debug level on disconnect
+	compressed.Close()
+	select {
+	case msg := <-logs:
+		if !strings.Contains(msg, "Compression for client in room ZIP1") {
+			t.Errorf("Unexpected debug log: %s", msg)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected compression ratio debug log")
+	}
+}
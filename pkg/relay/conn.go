@@ -0,0 +1,84 @@
+package relay
+
+import (
+	"net"
+	"time"
+)
+
+// ClientConn is a connection served by HandleClient. *websocket.Conn
+// satisfies it. Message types are the WebSocket ones (websocket.TextMessage
+// for JSON, websocket.BinaryMessage for MessagePack).
+//
+// Other transports need only these methods. If a ClientConn also has any
+// of *websocket.Conn's SetReadDeadline, SetWriteDeadline, SetReadLimit,
+// SetPongHandler, WriteControl, EnableWriteCompression, Subprotocol, or
+// RemoteAddr methods, the relay uses them; without deadlines, timeouts
+// such as JoinTimeout and PongTimeout do not apply.
+type ClientConn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+// clientConn adapts a ClientConn to the full set of WebSocket methods the
+// relay calls, making the optional ones no-ops when unsupported.
+type clientConn struct {
+	ClientConn
+}
+
+func (c clientConn) SetReadDeadline(t time.Time) error {
+	if dc, ok := c.ClientConn.(interface{ SetReadDeadline(time.Time) error }); ok {
+		return dc.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (c clientConn) SetWriteDeadline(t time.Time) error {
+	if dc, ok := c.ClientConn.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		return dc.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+func (c clientConn) SetReadLimit(limit int64) {
+	if lc, ok := c.ClientConn.(interface{ SetReadLimit(int64) }); ok {
+		lc.SetReadLimit(limit)
+	}
+}
+
+func (c clientConn) SetPongHandler(h func(appData string) error) {
+	if pc, ok := c.ClientConn.(interface{ SetPongHandler(func(string) error) }); ok {
+		pc.SetPongHandler(h)
+	}
+}
+
+func (c clientConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	if cc, ok := c.ClientConn.(interface {
+		WriteControl(int, []byte, time.Time) error
+	}); ok {
+		return cc.WriteControl(messageType, data, deadline)
+	}
+	return nil
+}
+
+func (c clientConn) EnableWriteCompression(enable bool) {
+	if cc, ok := c.ClientConn.(interface{ EnableWriteCompression(bool) }); ok {
+		cc.EnableWriteCompression(enable)
+	}
+}
+
+func (c clientConn) Subprotocol() string {
+	if sc, ok := c.ClientConn.(interface{ Subprotocol() string }); ok {
+		return sc.Subprotocol()
+	}
+	return ""
+}
+
+// remoteAddr returns the peer's address for logs, or "pipe" if the
+// connection has none.
+func (c clientConn) remoteAddr() string {
+	if ac, ok := c.ClientConn.(interface{ RemoteAddr() net.Addr }); ok {
+		return ac.RemoteAddr().String()
+	}
+	return "pipe"
+}
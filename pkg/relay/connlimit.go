@@ -0,0 +1,48 @@
+package relay
+
+// ConnLimiter caps concurrent WebSocket connections. Call TryAcquire
+// before upgrading, reply 503 when it returns false, and Release once
+// the connection's handler returns. A nil *ConnLimiter allows every
+// connection.
+type ConnLimiter struct {
+	slots chan struct{}
+}
+
+// NewConnLimiter returns a limiter allowing max concurrent connections.
+// It returns nil (no limit) when max is zero or negative.
+func NewConnLimiter(max int) *ConnLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &ConnLimiter{slots: make(chan struct{}, max)}
+}
+
+// TryAcquire takes a connection slot without blocking, reporting whether
+// one was free.
+func (l *ConnLimiter) TryAcquire() bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release frees a slot taken by a successful TryAcquire.
+func (l *ConnLimiter) Release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
+
+// InUse reports how many slots are taken.
+func (l *ConnLimiter) InUse() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.slots)
+}
@@ -0,0 +1,29 @@
+package relay
+
+import "testing"
+
+func TestConnLimiter(t *testing.T) {
+	l := NewConnLimiter(2)
+	if !l.TryAcquire() || !l.TryAcquire() {
+		t.Fatal("TryAcquire failed below the limit")
+	}
+	if l.TryAcquire() {
+		t.Fatal("TryAcquire succeeded past the limit")
+	}
+	if got := l.InUse(); got != 2 {
+		t.Errorf("InUse = %d, want 2", got)
+	}
+	l.Release()
+	if !l.TryAcquire() {
+		t.Error("TryAcquire failed after Release")
+	}
+
+	// No limit
+	unlimited := NewConnLimiter(0)
+	for i := 0; i < 10; i++ {
+		if !unlimited.TryAcquire() {
+			t.Fatal("Unlimited TryAcquire failed")
+		}
+	}
+	unlimited.Release()
+}
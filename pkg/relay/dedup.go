@@ -0,0 +1,28 @@
+package relay
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+// isDuplicate reports whether data repeats, byte for byte, the client's
+// last relayed message within Config.DedupWindow. Only the last message's
+// hash is kept. A message that is not a duplicate becomes the new last
+// message, so a repeating stream still passes one copy per window.
+// Called from readPump only.
+func (c *Client) isDuplicate(data []byte) bool {
+	window := c.relay.config.DedupWindow
+	if window <= 0 {
+		return false
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	sum := h.Sum64()
+
+	now := time.Now()
+	if sum == c.lastHash && now.Sub(c.lastHashAt) < window {
+		return true
+	}
+	c.lastHash, c.lastHashAt = sum, now
+	return false
+}
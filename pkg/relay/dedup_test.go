@@ -0,0 +1,94 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// countMoves reads conn until last arrives, counting copies of msg.
+func countMoves(t *testing.T, conn *websocket.Conn, msg, last string) int {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	count := 0
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Waiting for %s: %v", last, err)
+		}
+		switch string(data) {
+		case msg:
+			count++
+		case last:
+			return count
+		}
+	}
+}
+
+func TestRelayDedup(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{DedupWindow: time.Second})
+	defer cleanup()
+
+	phone := dialWS(t, server.URL)
+	defer phone.Close()
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"DEDUP1"}}`))
+	consumeRoomStatus(t, phone)
+	foundry := dialWS(t, server.URL)
+	defer foundry.Close()
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"DEDUP1"}}`))
+	consumeRoomStatus(t, foundry)
+
+	move := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`
+	other := `{"type":"MOVE","payload":{"direction":"down","tokenId":"tok1"}}`
+	for range 3 {
+		phone.WriteMessage(websocket.TextMessage, []byte(move))
+	}
+	phone.WriteMessage(websocket.TextMessage, []byte(other))
+	if n := countMoves(t, foundry, move, other); n != 1 {
+		t.Errorf("Foundry got %d copies of the repeated MOVE, want 1", n)
+	}
+
+	// A repeat of an older message is not a duplicate
+	phone.WriteMessage(websocket.TextMessage, []byte(move))
+	phone.WriteMessage(websocket.TextMessage, []byte(other))
+	if n := countMoves(t, foundry, move, other); n != 1 {
+		t.Errorf("Foundry got %d copies after an interleaved MOVE, want 1", n)
+	}
+}
+
+func TestRelayDedupWindow(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{DedupWindow: 50 * time.Millisecond})
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"DEDUP2"}}`))
+	consumeRoomStatus(t, conn)
+
+	// A repeat after the window has passed is relayed
+	move := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`
+	sendAndEcho(t, conn, move)
+	time.Sleep(60 * time.Millisecond)
+	sendAndEcho(t, conn, move)
+}
+
+func TestRelayDedupDisabled(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	phone := dialWS(t, server.URL)
+	defer phone.Close()
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"DEDUP3"}}`))
+	consumeRoomStatus(t, phone)
+
+	move := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`
+	other := `{"type":"MOVE","payload":{"direction":"down","tokenId":"tok1"}}`
+	for range 3 {
+		phone.WriteMessage(websocket.TextMessage, []byte(move))
+	}
+	phone.WriteMessage(websocket.TextMessage, []byte(other))
+	if n := countMoves(t, phone, move, other); n != 3 {
+		t.Errorf("Got %d echoes of the repeated MOVE, want 3", n)
+	}
+}
@@ -0,0 +1,271 @@
+package relay
+
+import (
+	crand "crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// Limits for relay-side dice formulas.
+const (
+	maxDiceTerms = 20   // Dice groups and constants in one formula
+	maxDiceCount = 100  // Total dice rolled across all groups
+	maxDiceSides = 1000 // Faces on a single die
+
+	maxDiceNumber = 1_000_000 // Largest number accepted anywhere in a formula
+)
+
+// errEmptyFormula is returned for a formula with no terms.
+var errEmptyFormula = errors.New("empty dice formula")
+
+// diceTerm is one signed part of a formula: either a dice group such as
+// "4d6kh3" or a constant modifier.
+type diceTerm struct {
+	sign     int // +1 or -1
+	count    int // Dice rolled; 0 for a constant
+	sides    int
+	keep     int  // Dice kept after rolling; equal to count if no modifier
+	keepHigh bool // Keep the highest dice (otherwise the lowest)
+	constant int
+}
+
+// diceRoll is the outcome of one dice group.
+type diceRoll struct {
+	results []int
+	kept    []bool
+}
+
+// parseDice parses a standard dice formula: terms joined by "+" or "-",
+// where each term is a constant or NdM with an optional keep-highest
+// ("khK") or keep-lowest ("klK") modifier. N defaults to 1 and K to 1;
+// "k" alone means "kh". Whitespace and case are ignored.
+func parseDice(formula string) ([]diceTerm, error) {
+	s := strings.ToLower(strings.Join(strings.Fields(formula), ""))
+	if s == "" {
+		return nil, errEmptyFormula
+	}
+
+	var terms []diceTerm
+	total := 0
+	for s != "" {
+		sign := 1
+		switch s[0] {
+		case '+':
+			s = s[1:]
+		case '-':
+			sign = -1
+			s = s[1:]
+		default:
+			if len(terms) > 0 {
+				return nil, fmt.Errorf("expected + or - before %q", s)
+			}
+		}
+
+		end := strings.IndexAny(s, "+-")
+		if end < 0 {
+			end = len(s)
+		}
+		term, err := parseDiceTerm(s[:end])
+		if err != nil {
+			return nil, err
+		}
+		term.sign = sign
+		s = s[end:]
+
+		terms = append(terms, term)
+		if len(terms) > maxDiceTerms {
+			return nil, fmt.Errorf("too many terms (max %d)", maxDiceTerms)
+		}
+		total += term.count
+		if total > maxDiceCount {
+			return nil, fmt.Errorf("too many dice (max %d)", maxDiceCount)
+		}
+	}
+	return terms, nil
+}
+
+// parseDiceTerm parses a single unsigned term.
+func parseDiceTerm(s string) (diceTerm, error) {
+	if s == "" {
+		return diceTerm{}, errors.New("missing term after operator")
+	}
+
+	d := strings.IndexByte(s, 'd')
+	if d < 0 {
+		n, err := parseDiceNumber(s, "constant")
+		if err != nil {
+			return diceTerm{}, err
+		}
+		return diceTerm{constant: n}, nil
+	}
+
+	term := diceTerm{count: 1, keepHigh: true}
+	if d > 0 {
+		n, err := parseDiceNumber(s[:d], "dice count")
+		if err != nil {
+			return diceTerm{}, err
+		}
+		term.count = n
+	}
+	if term.count < 1 {
+		return diceTerm{}, fmt.Errorf("dice count must be at least 1 in %q", s)
+	}
+
+	rest := s[d+1:]
+	keep, hasKeep := "", false
+	if k := strings.IndexByte(rest, 'k'); k >= 0 {
+		rest, keep, hasKeep = rest[:k], rest[k+1:], true
+	}
+	sides, err := parseDiceNumber(rest, "sides")
+	if err != nil {
+		return diceTerm{}, err
+	}
+	if sides < 1 || sides > maxDiceSides {
+		return diceTerm{}, fmt.Errorf("dice sides must be between 1 and %d in %q", maxDiceSides, s)
+	}
+	term.sides = sides
+	term.keep = term.count
+
+	if hasKeep {
+		switch {
+		case strings.HasPrefix(keep, "h"):
+			keep = keep[1:]
+		case strings.HasPrefix(keep, "l"):
+			term.keepHigh = false
+			keep = keep[1:]
+		}
+		term.keep = 1
+		if keep != "" {
+			n, err := parseDiceNumber(keep, "keep count")
+			if err != nil {
+				return diceTerm{}, err
+			}
+			term.keep = n
+		}
+		if term.keep < 1 || term.keep > term.count {
+			return diceTerm{}, fmt.Errorf("keep count must be between 1 and %d in %q", term.count, s)
+		}
+	}
+	return term, nil
+}
+
+// parseDiceNumber parses a non-negative decimal number within a term.
+func parseDiceNumber(s, what string) (int, error) {
+	if s == "" {
+		return 0, fmt.Errorf("missing %s", what)
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", what, s)
+	}
+	if n > maxDiceNumber {
+		return 0, fmt.Errorf("%s %q too large", what, s)
+	}
+	return n, nil
+}
+
+// newDiceRNG returns a ChaCha8 generator seeded from crypto/rand.
+func newDiceRNG() *rand.Rand {
+	var seed [32]byte
+	crand.Read(seed[:]) // Never returns an error
+	return rand.New(rand.NewChaCha8(seed))
+}
+
+// rollDice rolls every term with rng and returns the total and a
+// breakdown in the same style as the Foundry module, e.g.
+// "[4, 2] + 3 = 9". Dropped dice are shown in parentheses.
+func rollDice(terms []diceTerm, rng *rand.Rand) (int, string) {
+	total := 0
+	var parts []string
+	for i, term := range terms {
+		if i > 0 || term.sign < 0 {
+			if term.sign < 0 {
+				parts = append(parts, "-")
+			} else {
+				parts = append(parts, "+")
+			}
+		}
+
+		if term.count == 0 {
+			total += term.sign * term.constant
+			parts = append(parts, strconv.Itoa(term.constant))
+			continue
+		}
+
+		roll := rollDiceGroup(term, rng)
+		shown := make([]string, len(roll.results))
+		for j, v := range roll.results {
+			if roll.kept[j] {
+				total += term.sign * v
+				shown[j] = strconv.Itoa(v)
+			} else {
+				shown[j] = "(" + strconv.Itoa(v) + ")"
+			}
+		}
+		parts = append(parts, "["+strings.Join(shown, ", ")+"]")
+	}
+	return total, fmt.Sprintf("%s = %d", strings.Join(parts, " "), total)
+}
+
+// rollDiceGroup rolls one dice group and marks which dice are kept.
+func rollDiceGroup(term diceTerm, rng *rand.Rand) diceRoll {
+	roll := diceRoll{
+		results: make([]int, term.count),
+		kept:    make([]bool, term.count),
+	}
+	for i := range roll.results {
+		roll.results[i] = rng.IntN(term.sides) + 1
+		roll.kept[i] = true
+	}
+
+	// Drop dice one at a time, lowest (or highest) first, earliest on ties
+	for dropped := 0; dropped < term.count-term.keep; dropped++ {
+		worst := -1
+		for i, v := range roll.results {
+			if !roll.kept[i] {
+				continue
+			}
+			if worst < 0 || (term.keepHigh && v < roll.results[worst]) || (!term.keepHigh && v > roll.results[worst]) {
+				worst = i
+			}
+		}
+		roll.kept[worst] = false
+	}
+	return roll
+}
+
+// handleRollDice answers a ROLL_DICE locally when Config.RelaySideDice
+// is set and the room has no Foundry to roll it. The result goes only
+// to the requester, carrying the request's envelope ID. It reports
+// whether the message was handled.
+func (c *Client) handleRollDice(payload json.RawMessage, requestID string) bool {
+	if !c.relay.config.RelaySideDice || c.relay.foundryConnected(c.room) {
+		return false
+	}
+
+	var p RollDicePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.log(LogWarn, "Invalid ROLL_DICE payload: %v", err)
+		return true
+	}
+	result := RollDiceResultPayload{TokenID: p.TokenID, Formula: p.Formula}
+
+	if terms, err := parseDice(p.Formula); err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Success = true
+		result.Total, result.Breakdown = rollDice(terms, newDiceRNG())
+	}
+
+	msg, err := makeResponse(TypeRollDiceResult, requestID, result)
+	if err != nil {
+		c.log(LogError, "Failed to create ROLL_DICE_RESULT message: %v", err)
+		return true
+	}
+	c.trySend(msg)
+	return true
+}
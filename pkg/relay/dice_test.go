@@ -0,0 +1,300 @@
+package relay
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestParseDice(t *testing.T) {
+	tests := []struct {
+		formula string
+		want    []diceTerm
+	}{
+		{"1d20", []diceTerm{{sign: 1, count: 1, sides: 20, keep: 1, keepHigh: true}}},
+		{"d20", []diceTerm{{sign: 1, count: 1, sides: 20, keep: 1, keepHigh: true}}},
+		{"2d6+3", []diceTerm{
+			{sign: 1, count: 2, sides: 6, keep: 2, keepHigh: true},
+			{sign: 1, constant: 3},
+		}},
+		{" 2D6 - 1 ", []diceTerm{
+			{sign: 1, count: 2, sides: 6, keep: 2, keepHigh: true},
+			{sign: -1, constant: 1},
+		}},
+		{"-1+1d4", []diceTerm{
+			{sign: -1, constant: 1},
+			{sign: 1, count: 1, sides: 4, keep: 1, keepHigh: true},
+		}},
+		{"4d6kh3", []diceTerm{{sign: 1, count: 4, sides: 6, keep: 3, keepHigh: true}}},
+		{"2d20kl", []diceTerm{{sign: 1, count: 2, sides: 20, keep: 1}}},
+		{"2d20k", []diceTerm{{sign: 1, count: 2, sides: 20, keep: 1, keepHigh: true}}},
+		{"2d20kh1+1d8-2", []diceTerm{
+			{sign: 1, count: 2, sides: 20, keep: 1, keepHigh: true},
+			{sign: 1, count: 1, sides: 8, keep: 1, keepHigh: true},
+			{sign: -1, constant: 2},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.formula, func(t *testing.T) {
+			got, err := parseDice(tt.formula)
+			if err != nil {
+				t.Fatalf("parseDice(%q): %v", tt.formula, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseDice(%q) = %+v, want %+v", tt.formula, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("term %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseDiceInvalid(t *testing.T) {
+	invalid := []string{
+		"", "   ", "abc", "2d", "d", "0d6", "1d0", "1d1001", "2d6+", "+", "2d6++3",
+		"4d6kh5", "4d6kh0", "4d6kx", "1d6*2", "2d6kh3kh1", "9999999",
+		strings.Repeat("1+", maxDiceTerms) + "1",
+		"101d6", "60d6+41d6",
+	}
+	for _, formula := range invalid {
+		if _, err := parseDice(formula); err == nil {
+			t.Errorf("parseDice(%q) succeeded, want error", formula)
+		}
+	}
+}
+
+func TestRollDiceBreakdown(t *testing.T) {
+	rng := rand.New(rand.NewChaCha8([32]byte{}))
+	terms, err := parseDice("4d6kh3+2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total, breakdown := rollDice(terms, rng)
+	if !strings.HasSuffix(breakdown, " + 2 = "+strconv.Itoa(total)) {
+		t.Errorf("breakdown = %q, want suffix with total %d", breakdown, total)
+	}
+	if strings.Count(breakdown, "(") != 1 {
+		t.Errorf("breakdown = %q, want exactly one dropped die", breakdown)
+	}
+
+	// The same seed rolls the same dice
+	again, againBreakdown := rollDice(terms, rand.New(rand.NewChaCha8([32]byte{})))
+	if again != total || againBreakdown != breakdown {
+		t.Errorf("reseeded roll = %d %q, want %d %q", again, againBreakdown, total, breakdown)
+	}
+}
+
+func TestRollDiceGroupKeep(t *testing.T) {
+	rng := rand.New(rand.NewChaCha8([32]byte{1}))
+	for i := 0; i < 1000; i++ {
+		for _, keepHigh := range []bool{true, false} {
+			roll := rollDiceGroup(diceTerm{sign: 1, count: 5, sides: 20, keep: 2, keepHigh: keepHigh}, rng)
+			kept := 0
+			for j, v := range roll.results {
+				if !roll.kept[j] {
+					continue
+				}
+				kept++
+				// No dropped die may beat a kept one
+				for k, w := range roll.results {
+					if roll.kept[k] {
+						continue
+					}
+					if (keepHigh && w > v) || (!keepHigh && w < v) {
+						t.Fatalf("keepHigh=%v kept %d but dropped %d in %v", keepHigh, v, w, roll.results)
+					}
+				}
+			}
+			if kept != 2 {
+				t.Fatalf("kept %d dice, want 2", kept)
+			}
+		}
+	}
+}
+
+func TestRollDiceDistribution(t *testing.T) {
+	rng := newDiceRNG()
+	const rolls = 60000
+
+	// Each face of a d6 within a chi-squared bound (5 degrees of
+	// freedom; 25 is far past the 0.1% critical value of 20.5)
+	counts := make([]int, 7)
+	for i := 0; i < rolls; i++ {
+		total, _ := rollDice([]diceTerm{{sign: 1, count: 1, sides: 6, keep: 1, keepHigh: true}}, rng)
+		if total < 1 || total > 6 {
+			t.Fatalf("1d6 rolled %d", total)
+		}
+		counts[total]++
+	}
+	expected := float64(rolls) / 6
+	chi2 := 0.0
+	for face := 1; face <= 6; face++ {
+		d := float64(counts[face]) - expected
+		chi2 += d * d / expected
+	}
+	if chi2 > 25 {
+		t.Errorf("1d6 chi-squared = %.1f, counts %v", chi2, counts[1:])
+	}
+
+	// 4d6kh3 averages about 12.24; 2d20kl about 7.18
+	means := []struct {
+		formula string
+		want    float64
+	}{
+		{"4d6kh3", 12.24},
+		{"2d20kl", 7.175},
+		{"2d6+3", 10},
+	}
+	for _, m := range means {
+		terms, err := parseDice(m.formula)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := 0
+		for i := 0; i < rolls; i++ {
+			total, _ := rollDice(terms, rng)
+			sum += total
+		}
+		if mean := float64(sum) / rolls; math.Abs(mean-m.want) > 0.15 {
+			t.Errorf("%s mean = %.3f, want about %.3f", m.formula, mean, m.want)
+		}
+	}
+}
+
+func TestRelaySideDice(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{RelaySideDice: true})
+	defer cleanup()
+
+	phone := dialWS(t, server.URL)
+	defer phone.Close()
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"DICE1"}}`))
+	consumeRoomStatus(t, phone)
+
+	observer := dialWS(t, server.URL)
+	defer observer.Close()
+	observer.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"DICE1"}}`))
+	consumeRoomStatus(t, observer)
+
+	readResult := func() RollDiceResultPayload {
+		t.Helper()
+		phone.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := phone.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read result: %v", err)
+		}
+		env, err := ParseEnvelope(data)
+		if err != nil || env.Type != TypeRollDiceResult {
+			t.Fatalf("Expected ROLL_DICE_RESULT, got %s", data)
+		}
+		var p RollDiceResultPayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	// No Foundry: the relay rolls and answers only the requester
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"ROLL_DICE","payload":{"tokenId":"tok1","formula":"2d6+3"}}`))
+	p := readResult()
+	if !p.Success || p.TokenID != "tok1" || p.Formula != "2d6+3" || p.Total < 5 || p.Total > 15 || p.Breakdown == "" {
+		t.Errorf("Unexpected result: %+v", p)
+	}
+
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"ROLL_DICE","payload":{"tokenId":"tok1","formula":"2d6*3"}}`))
+	if p := readResult(); p.Success || p.Error == "" {
+		t.Errorf("Expected failed result, got %+v", p)
+	}
+
+	observer.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := observer.ReadMessage(); err == nil {
+		t.Errorf("Observer received %s", data)
+	}
+
+	// With a Foundry connected, ROLL_DICE is relayed as usual
+	foundry := dialWS(t, server.URL)
+	defer foundry.Close()
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"DICE1"}}`))
+	consumeRoomStatus(t, foundry)
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry"}}`))
+	readUntilStatus(t, phone, true)
+	readUntilStatus(t, foundry, true)
+
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"ROLL_DICE","payload":{"tokenId":"tok1","formula":"1d20"}}`))
+	foundry.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := foundry.ReadMessage()
+	if err != nil {
+		t.Fatalf("Foundry did not receive ROLL_DICE: %v", err)
+	}
+	if env, err := ParseEnvelope(data); err != nil || env.Type != TypeRollDice {
+		t.Errorf("Expected ROLL_DICE, got %s", data)
+	}
+}
+
+func TestRelaySideDiceEchoesID(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{RelaySideDice: true})
+	defer cleanup()
+
+	phone := dialWS(t, server.URL)
+	defer phone.Close()
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"DICEID"}}`))
+	consumeRoomStatus(t, phone)
+
+	// Two requests in flight are told apart by their IDs
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"ROLL_DICE","id":"a","payload":{"tokenId":"tok1","formula":"1d4"}}`))
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"ROLL_DICE","id":"b","payload":{"tokenId":"tok1","formula":"1d6+100"}}`))
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"ROLL_DICE","payload":{"tokenId":"tok1","formula":"1d8"}}`))
+	for _, want := range []struct {
+		id      string
+		formula string
+	}{{"a", "1d4"}, {"b", "1d6+100"}, {"", "1d8"}} {
+		phone.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := phone.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read result: %v", err)
+		}
+		env, err := ParseEnvelope(data)
+		if err != nil || env.Type != TypeRollDiceResult {
+			t.Fatalf("Expected ROLL_DICE_RESULT, got %s", data)
+		}
+		var p RollDiceResultPayload
+		json.Unmarshal(env.Payload, &p)
+		if env.ID != want.id || p.Formula != want.formula {
+			t.Errorf("Result ID, formula = %q, %q; want %q, %q", env.ID, p.Formula, want.id, want.formula)
+		}
+		if want.id == "" && strings.Contains(string(data), `"id"`) {
+			t.Errorf("Result without request ID has an id field: %s", data)
+		}
+	}
+}
+
+func TestRelaySideDiceDisabled(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	phone := dialWS(t, server.URL)
+	defer phone.Close()
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"DICE2"}}`))
+	consumeRoomStatus(t, phone)
+
+	// The request is relayed (and echoed back), not answered
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"ROLL_DICE","payload":{"tokenId":"tok1","formula":"1d20"}}`))
+	phone.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := phone.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if env, err := ParseEnvelope(data); err != nil || env.Type != TypeRollDice {
+		t.Errorf("Expected echoed ROLL_DICE, got %s", data)
+	}
+}
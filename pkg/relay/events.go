@@ -0,0 +1,42 @@
+package relay
+
+import "time"
+
+// ClientEventType identifies what happened to a client.
+type ClientEventType string
+
+const (
+	ClientJoined     ClientEventType = "join"
+	ClientIdentified ClientEventType = "identify"
+	ClientLeft       ClientEventType = "leave"
+)
+
+// ClientEvent describes a change in a room's membership, delivered to
+// Config.OnClientEvent.
+type ClientEvent struct {
+	Type       ClientEventType `json:"type"`
+	Room       string          `json:"room"`
+	ClientID   string          `json:"clientId"`
+	ClientType ClientType      `json:"clientType"` // Empty until identified
+	Time       time.Time       `json:"time"`
+}
+
+// emitClientEvent reports an event for c to the configured callback.
+// Callers must not hold r.mu.
+func (r *Relay) emitClientEvent(eventType ClientEventType, c *Client) {
+	if r.config.OnClientEvent == nil {
+		return
+	}
+	r.config.OnClientEvent(newClientEvent(eventType, c))
+}
+
+// newClientEvent describes c's current state as an event of eventType.
+func newClientEvent(eventType ClientEventType, c *Client) ClientEvent {
+	return ClientEvent{
+		Type:       eventType,
+		Room:       c.getRoom(),
+		ClientID:   c.id,
+		ClientType: c.getClientType(),
+		Time:       time.Now(),
+	}
+}
@@ -0,0 +1,62 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRelayClientEvents(t *testing.T) {
+	events := make(chan ClientEvent, 10)
+	var r *Relay
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{
+		OnClientEvent: func(ev ClientEvent) {
+			// Calling back into the relay must not deadlock
+			r.Stats()
+			events <- ev
+		},
+	})
+	defer cleanup()
+
+	next := func(want ClientEventType) ClientEvent {
+		t.Helper()
+		select {
+		case ev := <-events:
+			if ev.Type != want {
+				t.Fatalf("Event type = %s, want %s", ev.Type, want)
+			}
+			return ev
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %s event", want)
+		}
+		return ClientEvent{}
+	}
+
+	conn := dialWS(t, server.URL)
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"evt1"}}`))
+	consumeRoomStatus(t, conn)
+
+	joined := next(ClientJoined)
+	if joined.Room != "EVT1" || joined.ClientType != ClientTypeUnknown || joined.ClientID == "" {
+		t.Errorf("Unexpected join event: %+v", joined)
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone"}}`))
+	identified := next(ClientIdentified)
+	if identified.ClientType != ClientTypePhone || identified.ClientID != joined.ClientID {
+		t.Errorf("Unexpected identify event: %+v", identified)
+	}
+
+	conn.Close()
+	left := next(ClientLeft)
+	if left.Room != "EVT1" || left.ClientType != ClientTypePhone || left.ClientID != joined.ClientID {
+		t.Errorf("Unexpected leave event: %+v", left)
+	}
+
+	select {
+	case ev := <-events:
+		t.Errorf("Unexpected extra event: %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
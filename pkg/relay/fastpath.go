@@ -0,0 +1,44 @@
+package relay
+
+// beginJoin records that a client is subscribing to room but not yet
+// registered in it, so senders there keep publishing to NATS until
+// endJoin. Each call must be paired with one endJoin.
+func (r *Relay) beginJoin(room string) {
+	r.mu.Lock()
+	r.joining[room]++
+	r.mu.Unlock()
+}
+
+// endJoin undoes beginJoin once the client is registered or has given up.
+func (r *Relay) endJoin(room string) {
+	r.mu.Lock()
+	if r.joining[room]--; r.joining[room] <= 0 {
+		delete(r.joining, room)
+	}
+	r.mu.Unlock()
+}
+
+// alone reports whether c's messages can skip NATS because no other
+// client of this relay is in, or joining, its room. It always reports
+// false when Config.AlwaysPublish or Config.OrderedRooms is set. It is
+// checked per message, so a client that joins mid-stream receives
+// everything sent after it subscribed.
+func (c *Client) alone() bool {
+	if c.relay.config.AlwaysPublish || c.relay.config.OrderedRooms {
+		return false
+	}
+	r := c.relay
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	clients := r.rooms[c.room]
+	_, member := clients[c]
+	return member && len(clients) == 1 && r.joining[c.room] == 0
+}
+
+// relayAlone handles a message from a client alone in its room without
+// publishing it: the only delivery left is the client's own echo.
+func (c *Client) relayAlone(data []byte) {
+	if *c.relay.config.EchoToSender {
+		c.queue(data)
+	}
+}
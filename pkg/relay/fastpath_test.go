@@ -0,0 +1,107 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+)
+
+// subscribeRoom counts messages published to room's NATS subject.
+func subscribeRoom(t *testing.T, r *Relay, room string) *nats.Subscription {
+	t.Helper()
+	sub, err := r.nc.SubscribeSync(r.roomSubject(room))
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	r.nc.Flush()
+	return sub
+}
+
+func TestRelayLoneClientSkipsNATS(t *testing.T) {
+	for _, always := range []bool{false, true} {
+		server, r, cleanup := setupTestRelayWithConfig(t, Config{AlwaysPublish: always})
+
+		phone := dialWS(t, server.URL)
+		phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"LONE01"}}`))
+		consumeRoomStatus(t, phone)
+		sub := subscribeRoom(t, r, "LONE01")
+
+		// The lone client still gets its own echo
+		update := `{"type":"ACTOR_UPDATE","payload":{"tokenId":"tok1"}}`
+		phone.WriteMessage(websocket.TextMessage, []byte(update))
+		readUntilMessage(t, phone, update)
+
+		_, err := sub.NextMsg(100 * time.Millisecond)
+		if published := err == nil; published != always {
+			t.Errorf("AlwaysPublish=%v: published to NATS = %v", always, published)
+		}
+		if stats := r.Stats(); stats.MessagesRelayed != 1 {
+			t.Errorf("AlwaysPublish=%v: MessagesRelayed = %d, want 1", always, stats.MessagesRelayed)
+		}
+
+		phone.Close()
+		cleanup()
+	}
+}
+
+func TestRelayLoneClientSecondJoiner(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	phone := dialWS(t, server.URL)
+	defer phone.Close()
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"LONE02"}}`))
+	consumeRoomStatus(t, phone)
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"ACTOR_UPDATE","payload":{"tokenId":"tok1"}}`))
+	readUntilMessage(t, phone, `{"type":"ACTOR_UPDATE","payload":{"tokenId":"tok1"}}`)
+
+	foundry := dialWS(t, server.URL)
+	defer foundry.Close()
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"LONE02"}}`))
+	consumeRoomStatus(t, foundry)
+
+	// Once a second client is in the room, messages go through NATS again
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"ACTOR_UPDATE","payload":{"tokenId":"tok2"}}`))
+	readUntilMessage(t, foundry, `{"type":"ACTOR_UPDATE","payload":{"tokenId":"tok2"}}`)
+}
+
+// BenchmarkRelayLoneClient measures a lone client's message round trip
+// to its own echo, with and without the fast path.
+func BenchmarkRelayLoneClient(b *testing.B) {
+	for _, bm := range []struct {
+		name   string
+		always bool
+	}{
+		{"FastPath", false},
+		{"AlwaysPublish", true},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			ns := startTestNATS(b)
+			defer ns.Shutdown()
+			r, err := NewRelay(Config{NatsURL: ns.ClientURL(), AlwaysPublish: bm.always})
+			if err != nil {
+				b.Fatalf("Failed to create relay: %v", err)
+			}
+			defer r.Close()
+
+			server, client := Pipe()
+			go r.HandleClient(server)
+			defer client.Close()
+			client.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"BENCH1"}}`))
+			client.ReadMessage() // ROOM_STATUS
+
+			msg := []byte(`{"type":"ACTOR_UPDATE","payload":{"tokenId":"tok1","hp":12}}`)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := client.WriteMessage(websocket.TextMessage, msg); err != nil {
+					b.Fatal(err)
+				}
+				if _, _, err := client.ReadMessage(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
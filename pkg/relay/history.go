@@ -0,0 +1,79 @@
+package relay
+
+// historyRing is a fixed-size ring buffer of a room's recent messages.
+// It is guarded by Relay.mu.
+type historyRing struct {
+	msgs  [][]byte
+	start int // index of the oldest message
+	count int
+}
+
+// newHistoryRing creates an empty ring holding up to size messages.
+func newHistoryRing(size int) *historyRing {
+	return &historyRing{msgs: make([][]byte, size)}
+}
+
+// push appends a message, evicting the oldest when full.
+func (h *historyRing) push(msg []byte) {
+	if h.count < len(h.msgs) {
+		h.msgs[(h.start+h.count)%len(h.msgs)] = msg
+		h.count++
+		return
+	}
+	h.msgs[h.start] = msg
+	h.start = (h.start + 1) % len(h.msgs)
+}
+
+// snapshot returns the buffered messages, oldest first.
+func (h *historyRing) snapshot() [][]byte {
+	out := make([][]byte, h.count)
+	for i := range out {
+		out[i] = h.msgs[(h.start+i)%len(h.msgs)]
+	}
+	return out
+}
+
+// defaultHistoryTypes are replayed when Config.HistoryTypes is empty.
+// Only idempotent messages are safe to deliver twice.
+var defaultHistoryTypes = []MessageType{TypeRoomStatus, TypePairSuccess}
+
+// recordHistory stores a relayed message for later replay if history is
+// enabled and its type is replayable.
+func (r *Relay) recordHistory(room string, msgType MessageType, data []byte) {
+	if r.config.HistorySize <= 0 {
+		return
+	}
+	if _, ok := r.historyTypes[msgType]; !ok {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.rooms[room]; !ok {
+		return
+	}
+	h, ok := r.history[room]
+	if !ok {
+		h = newHistoryRing(r.config.HistorySize)
+		r.history[room] = h
+	}
+	h.push(data)
+}
+
+// replayHistory sends the room's buffered messages to this client in order.
+func (c *Client) replayHistory() {
+	c.relay.mu.RLock()
+	var msgs [][]byte
+	if h, ok := c.relay.history[c.room]; ok {
+		msgs = h.snapshot()
+	}
+	c.relay.mu.RUnlock()
+
+	if len(msgs) == 0 {
+		return
+	}
+	c.log(LogInfo, "Replaying %d buffered messages in room %s", len(msgs), c.room)
+	for _, msg := range msgs {
+		c.trySend(msg)
+	}
+}
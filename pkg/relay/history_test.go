@@ -0,0 +1,94 @@
+package relay
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHistoryRing(t *testing.T) {
+	h := newHistoryRing(3)
+	if got := h.snapshot(); len(got) != 0 {
+		t.Fatalf("Empty ring snapshot = %q", got)
+	}
+
+	for _, m := range []string{"a", "b", "c", "d", "e"} {
+		h.push([]byte(m))
+	}
+
+	var got []string
+	for _, m := range h.snapshot() {
+		got = append(got, string(m))
+	}
+	if want := []string{"c", "d", "e"}; !slices.Equal(got, want) {
+		t.Errorf("snapshot = %v, want %v", got, want)
+	}
+}
+
+func TestRelayHistoryReplay(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{HistorySize: 2})
+	defer cleanup()
+
+	foundry := dialWS(t, server.URL)
+	defer foundry.Close()
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"HIST1"}}`))
+	consumeRoomStatus(t, foundry)
+
+	// Three PAIR_SUCCESS messages (only the last two fit) and a MOVE,
+	// which is not a replayable type
+	pairs := make([]string, 3)
+	for i := range pairs {
+		pairs[i] = fmt.Sprintf(`{"type":"PAIR_SUCCESS","payload":{"tokenId":"tok%d","tokenName":"Hero %d","actorName":"Hero %d"}}`, i, i, i)
+		foundry.WriteMessage(websocket.TextMessage, []byte(pairs[i]))
+	}
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`))
+
+	// Wait until the foundry's own copies have been relayed back
+	foundry.SetReadDeadline(time.Now().Add(time.Second))
+	for i := 0; i < 4; i++ {
+		if _, _, err := foundry.ReadMessage(); err != nil {
+			t.Fatalf("Foundry read error: %v", err)
+		}
+	}
+
+	late := dialWS(t, server.URL)
+	defer late.Close()
+	late.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"HIST1"}}`))
+	consumeRoomStatus(t, late)
+
+	// Nothing is replayed until the client identifies
+	late.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone"}}`))
+
+	late.SetReadDeadline(time.Now().Add(time.Second))
+	var got []string
+	for len(got) < 2 {
+		_, data, err := late.ReadMessage()
+		if err != nil {
+			t.Fatalf("Late joiner read error: %v (got %v)", err, got)
+		}
+		if env, err := ParseEnvelope(data); err == nil && env.Type == TypeRoomStatus {
+			continue
+		}
+		got = append(got, string(data))
+	}
+	if want := pairs[1:]; !slices.Equal(got, want) {
+		t.Errorf("Replayed %v, want %v", got, want)
+	}
+
+	// History is freed once the room empties
+	foundry.Close()
+	late.Close()
+	deadline := time.Now().Add(time.Second)
+	for r.RoomCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.mu.RLock()
+	_, ok := r.history["HIST1"]
+	r.mu.RUnlock()
+	if ok {
+		t.Error("Expected history to be freed when the room empties")
+	}
+}
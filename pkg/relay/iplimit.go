@@ -0,0 +1,108 @@
+package relay
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ipRateWindow is the period an IPRateLimiter's limit covers. An IP idle
+// this long has its full allowance back, so its entry can be evicted.
+const ipRateWindow = time.Minute
+
+// IPRateLimiter caps how many new connections each source IP may open per
+// minute, so scripted connect/JOIN/disconnect cycles cannot thrash room
+// creation. Call Allow with the request's ClientIP before upgrading and
+// reply 429 when it returns false. A nil *IPRateLimiter allows everything.
+type IPRateLimiter struct {
+	mu        sync.Mutex
+	perMinute int
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewIPRateLimiter returns a limiter allowing perMinute new connections
+// per IP per minute, in bursts of up to perMinute. It returns nil (no
+// limit) when perMinute is zero or negative.
+func NewIPRateLimiter(perMinute int) *IPRateLimiter {
+	return newIPRateLimiter(perMinute, time.Now)
+}
+
+// newIPRateLimiter is NewIPRateLimiter with an injectable clock.
+func newIPRateLimiter(perMinute int, now func() time.Time) *IPRateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &IPRateLimiter{
+		perMinute: perMinute,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: now(),
+		now:       now,
+	}
+}
+
+// Allow counts a new connection from ip, reporting whether it is within
+// the limit. Once per window it also evicts IPs idle for a full window.
+func (l *IPRateLimiter) Allow(ip string) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	now := l.now()
+	if now.Sub(l.lastSweep) >= ipRateWindow {
+		l.sweepLocked(now)
+	}
+	b, ok := l.buckets[ip]
+	if !ok {
+		rate := float64(l.perMinute) / ipRateWindow.Seconds()
+		b = newTokenBucket(rate, float64(l.perMinute), l.now)
+		l.buckets[ip] = b
+	}
+	l.mu.Unlock()
+	return b.allow()
+}
+
+// sweepLocked drops buckets idle for a full window, which have refilled
+// and so behave like new ones. Callers must hold l.mu.
+func (l *IPRateLimiter) sweepLocked(now time.Time) {
+	for ip, b := range l.buckets {
+		if now.Sub(b.lastUsed()) >= ipRateWindow {
+			delete(l.buckets, ip)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Tracked reports how many IPs the limiter currently holds state for.
+func (l *IPRateLimiter) Tracked() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// ClientIP returns the source IP of req. With trustProxy set, it uses the
+// last X-Forwarded-For entry, the one appended by the reverse proxy in
+// front of the server; only set it behind such a proxy, since clients can
+// forge the header. Otherwise, or when the header is absent, it uses
+// req.RemoteAddr.
+func ClientIP(req *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if xff := req.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			entries := strings.Split(xff[len(xff)-1], ",")
+			if ip := strings.TrimSpace(entries[len(entries)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,94 @@
+package relay
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIPRateLimiter(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	l := newIPRateLimiter(3, clock.now)
+
+	for i := range 3 {
+		if !l.Allow("192.0.2.1") {
+			t.Fatalf("Connection %d rejected within the limit", i+1)
+		}
+	}
+	if l.Allow("192.0.2.1") {
+		t.Error("Fourth connection in a minute was allowed")
+	}
+	if !l.Allow("192.0.2.2") {
+		t.Error("Another IP was rejected")
+	}
+
+	// 3 per minute refills one connection every 20s
+	clock.advance(20 * time.Second)
+	if !l.Allow("192.0.2.1") {
+		t.Error("Connection after refill was rejected")
+	}
+	if l.Allow("192.0.2.1") {
+		t.Error("Second connection after a single refill was allowed")
+	}
+}
+
+func TestIPRateLimiterEviction(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	l := newIPRateLimiter(3, clock.now)
+	l.Allow("192.0.2.1")
+	clock.advance(30 * time.Second)
+	l.Allow("192.0.2.2")
+	if l.Tracked() != 2 {
+		t.Fatalf("Tracked = %d, want 2", l.Tracked())
+	}
+
+	// The next Allow a window after the last sweep evicts idle IPs only
+	clock.advance(40 * time.Second)
+	l.Allow("192.0.2.3")
+	if l.Tracked() != 2 {
+		t.Errorf("Tracked after sweep = %d, want 2 (192.0.2.2 and .3)", l.Tracked())
+	}
+}
+
+func TestIPRateLimiterDisabled(t *testing.T) {
+	l := NewIPRateLimiter(0)
+	if l != nil {
+		t.Fatal("NewIPRateLimiter(0) returned a limiter")
+	}
+	for range 100 {
+		if !l.Allow("192.0.2.1") {
+			t.Fatal("Nil limiter rejected a connection")
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		trustProxy bool
+		want       string
+	}{
+		{"remote addr", "192.0.2.1:5000", nil, false, "192.0.2.1"},
+		{"ipv6 remote addr", "[2001:db8::1]:5000", nil, false, "2001:db8::1"},
+		{"header ignored without trust", "192.0.2.1:5000", []string{"203.0.113.9"}, false, "192.0.2.1"},
+		{"trusted header", "10.0.0.2:5000", []string{"203.0.113.9"}, true, "203.0.113.9"},
+		{"last entry wins", "10.0.0.2:5000", []string{"198.51.100.7, 203.0.113.9"}, true, "203.0.113.9"},
+		{"last header wins", "10.0.0.2:5000", []string{"198.51.100.7", "203.0.113.9"}, true, "203.0.113.9"},
+		{"trusted without header", "10.0.0.2:5000", nil, true, "10.0.0.2"},
+		{"empty header", "10.0.0.2:5000", []string{""}, true, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ws", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := ClientIP(req, tt.trustProxy); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package relay
+
+import "encoding/json"
+
+// setLastWill applies a lastWill field from JOIN or IDENTIFY: a JSON
+// null clears the client's last will and an absent field keeps it. A will
+// whose LAST_WILL message would exceed MaxMessageBytes is refused, keeping
+// the previous one, so a client can't park a message the relay would
+// never accept from it directly.
+func (c *Client) setLastWill(will json.RawMessage) {
+	switch {
+	case will == nil:
+	case string(will) == "null":
+		c.lastWill = nil
+	default:
+		msg, err := json.Marshal(Envelope{Type: TypeLastWill, Payload: will})
+		if err != nil {
+			c.log(LogWarn, "Ignoring invalid last will: %v", err)
+			return
+		}
+		if len(msg) > c.relay.config.MaxMessageBytes {
+			c.log(LogWarn, "Ignoring %d-byte last will (limit %d)", len(msg), c.relay.config.MaxMessageBytes)
+			return
+		}
+		c.lastWill = will
+	}
+}
+
+// publishLastWill relays the client's LAST_WILL, if it registered one, to
+// the room it was in. It runs once the client has left the room, so the
+// client itself never receives it.
+func (c *Client) publishLastWill() {
+	if c.lastWill == nil {
+		return
+	}
+	msg, err := json.Marshal(Envelope{Type: TypeLastWill, Payload: c.lastWill})
+	if err != nil {
+		c.log(LogError, "Failed to create LAST_WILL message: %v", err)
+		return
+	}
+	room := c.getRoom()
+	if err := c.relay.nc.Publish(c.relay.roomSubject(room), msg); err != nil {
+		c.log(LogError, "NATS publish error: %v", err)
+		return
+	}
+	c.relay.metrics.recordRelayed(room, len(msg))
+	c.log(LogInfo, "Relayed last will in room %s", room)
+}
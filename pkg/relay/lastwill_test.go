@@ -0,0 +1,95 @@
+package relay
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRelayLastWill(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	foundry := dialWS(t, server.URL)
+	defer foundry.Close()
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"WILL1"}}`))
+	consumeRoomStatus(t, foundry)
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry"}}`))
+
+	// Registered in JOIN
+	joined := dialWS(t, server.URL)
+	joined.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"WILL1","lastWill":{"tokenId":"tok1"}}}`))
+	consumeRoomStatus(t, joined)
+	joined.Close()
+	readUntilMessage(t, foundry, `{"type":"LAST_WILL","payload":{"tokenId":"tok1"}}`)
+
+	// Replaced in IDENTIFY, and kept by a later IDENTIFY without one
+	identified := dialWS(t, server.URL)
+	identified.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"WILL1","lastWill":{"tokenId":"old"}}}`))
+	consumeRoomStatus(t, identified)
+	identified.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone","lastWill":{"tokenId":"tok2"}}}`))
+	identified.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone","displayName":"Bo"}}`))
+	readUntilParticipants(t, identified, []Participant{{Name: "Bo", ClientType: "phone"}})
+	identified.Close()
+	readUntilMessage(t, foundry, `{"type":"LAST_WILL","payload":{"tokenId":"tok2"}}`)
+
+	// Cleared with null
+	cleared := dialWS(t, server.URL)
+	cleared.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"WILL1","lastWill":{"tokenId":"tok3"}}}`))
+	consumeRoomStatus(t, cleared)
+	cleared.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone","displayName":"Cy","lastWill":null}}`))
+	readUntilParticipants(t, cleared, []Participant{{Name: "Cy", ClientType: "phone"}})
+	cleared.Close()
+
+	foundry.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	for {
+		_, data, err := foundry.ReadMessage()
+		if err != nil {
+			break
+		}
+		if env, _ := ParseEnvelope(data); env != nil && env.Type == TypeLastWill {
+			t.Fatalf("Unexpected LAST_WILL after clearing: %s", data)
+		}
+	}
+}
+
+func TestRelayLastWillTooLarge(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{MaxMessageBytes: 128})
+	defer cleanup()
+
+	foundry := dialWS(t, server.URL)
+	defer foundry.Close()
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"WILL2"}}`))
+	consumeRoomStatus(t, foundry)
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry"}}`))
+
+	// A will over the limit in JOIN is refused; a later one that fits is kept
+	big := `{"note":"` + strings.Repeat("x", 200) + `"}`
+	phone := dialWS(t, server.URL)
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"WILL2","lastWill":`+big+`}}`))
+	consumeRoomStatus(t, phone)
+	phone.Close()
+
+	phone = dialWS(t, server.URL)
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"WILL2","lastWill":{"tokenId":"tok1"}}}`))
+	consumeRoomStatus(t, phone)
+	phone.Close()
+
+	foundry.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, data, err := foundry.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected the small last will: %v", err)
+		}
+		env, _ := ParseEnvelope(data)
+		if env == nil || env.Type != TypeLastWill {
+			continue
+		}
+		if string(data) != `{"type":"LAST_WILL","payload":{"tokenId":"tok1"}}` {
+			t.Fatalf("Oversized last will was relayed: %d bytes", len(data))
+		}
+		break
+	}
+}
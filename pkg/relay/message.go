@@ -1,43 +1,156 @@
 // Package relay provides the WebSocket/NATS relay for VTT Remote.
 package relay
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Protocol versions supported by this relay. Clients that omit
+// protoVersion in JOIN are treated as version 1.
+const (
+	MinProtocolVersion = 1
+	MaxProtocolVersion = 1
+)
 
 // MessageType identifies the kind of message.
 type MessageType string
 
 const (
-	TypeJoin           MessageType = "JOIN"
-	TypeIdentify       MessageType = "IDENTIFY"
-	TypeRoomStatus     MessageType = "ROOM_STATUS"
-	TypePair           MessageType = "PAIR"
-	TypePairSuccess    MessageType = "PAIR_SUCCESS"
-	TypePairFailed     MessageType = "PAIR_FAILED"
-	TypeMove           MessageType = "MOVE"
-	TypeMoveAck        MessageType = "MOVE_ACK"
-	TypeRollDice       MessageType = "ROLL_DICE"
-	TypeRollDiceResult MessageType = "ROLL_DICE_RESULT"
+	TypeJoin               MessageType = "JOIN"
+	TypeIdentify           MessageType = "IDENTIFY"
+	TypeRoomStatus         MessageType = "ROOM_STATUS"
+	TypePair               MessageType = "PAIR"
+	TypePairSuccess        MessageType = "PAIR_SUCCESS"
+	TypePairFailed         MessageType = "PAIR_FAILED"
+	TypeLogin              MessageType = "LOGIN"
+	TypeLoginWithToken     MessageType = "LOGIN_WITH_TOKEN"
+	TypeLoginSuccess       MessageType = "LOGIN_SUCCESS"
+	TypeLoginFailed        MessageType = "LOGIN_FAILED"
+	TypeSelectToken        MessageType = "SELECT_TOKEN"
+	TypeSelectTokenSuccess MessageType = "SELECT_TOKEN_SUCCESS"
+	TypeMove               MessageType = "MOVE"
+	TypeMoveAck            MessageType = "MOVE_ACK"
+	TypeActorInfo          MessageType = "ACTOR_INFO"
+	TypeActorUpdate        MessageType = "ACTOR_UPDATE"
+	TypeUseAbility         MessageType = "USE_ABILITY"
+	TypeUseAbilityResult   MessageType = "USE_ABILITY_RESULT"
+	TypeRollDice           MessageType = "ROLL_DICE"
+	TypeRollDiceResult     MessageType = "ROLL_DICE_RESULT"
+	TypeServerShutdown     MessageType = "SERVER_SHUTDOWN"
+	TypeResumeToken        MessageType = "RESUME_TOKEN"
+	TypeAnnouncement       MessageType = "ANNOUNCEMENT"
+	TypePing               MessageType = "PING"
+	TypePong               MessageType = "PONG"
+	TypeIdentifyFailed     MessageType = "IDENTIFY_FAILED"
+	TypePairCodes          MessageType = "PAIR_CODES"
+	TypeLastWill           MessageType = "LAST_WILL"
+	TypeBatch              MessageType = "BATCH"
+	TypePresence           MessageType = "PRESENCE"
 )
 
+// knownMessageTypes is the set of message types defined by the protocol.
+var knownMessageTypes = map[MessageType]struct{}{
+	TypeJoin:               {},
+	TypeIdentify:           {},
+	TypeRoomStatus:         {},
+	TypePair:               {},
+	TypePairSuccess:        {},
+	TypePairFailed:         {},
+	TypeLogin:              {},
+	TypeLoginWithToken:     {},
+	TypeLoginSuccess:       {},
+	TypeLoginFailed:        {},
+	TypeSelectToken:        {},
+	TypeSelectTokenSuccess: {},
+	TypeMove:               {},
+	TypeMoveAck:            {},
+	TypeActorInfo:          {},
+	TypeActorUpdate:        {},
+	TypeUseAbility:         {},
+	TypeUseAbilityResult:   {},
+	TypeRollDice:           {},
+	TypeRollDiceResult:     {},
+	TypeServerShutdown:     {},
+	TypeResumeToken:        {},
+	TypeAnnouncement:       {},
+	TypePing:               {},
+	TypePong:               {},
+	TypeIdentifyFailed:     {},
+	TypePairCodes:          {},
+	TypeLastWill:           {},
+	TypeBatch:              {},
+	TypePresence:           {},
+}
+
+// IsKnownMessageType reports whether t is a message type defined by the protocol.
+func IsKnownMessageType(t MessageType) bool {
+	_, ok := knownMessageTypes[t]
+	return ok
+}
+
 // Envelope is the outer wrapper for all messages.
 type Envelope struct {
 	Type    MessageType     `json:"type"`
 	Payload json.RawMessage `json:"payload"`
+	Seq     uint64          `json:"seq,omitempty"` // Relay-assigned MOVE sequence (optional)
+	ID      string          `json:"id,omitempty"`  // Sender-chosen correlation ID, echoed in responses (optional)
+
+	ServerTime int64 `json:"serverTime,omitempty"` // Relay clock in Unix ms when relayed (optional)
 }
 
 // JoinPayload contains the room code for joining.
 type JoinPayload struct {
-	Room string `json:"room"`
+	Room           string `json:"room"`
+	ProtoVersion   int    `json:"protoVersion,omitempty"`   // Defaults to 1
+	Password       string `json:"password,omitempty"`       // Optional room password
+	ResumeToken    string `json:"resumeToken,omitempty"`    // From a previous RESUME_TOKEN
+	Encoding       string `json:"encoding,omitempty"`       // "json" (default) or "msgpack"
+	NoCompression  bool   `json:"noCompression,omitempty"`  // Don't compress messages to this client
+	Batch          bool   `json:"batch,omitempty"`          // Accept BATCH frames
+	ReservationKey string `json:"reservationKey,omitempty"` // From Relay.ReserveRoom
+
+	// LastWill, if set, is relayed to the room as a LAST_WILL payload
+	// when this client disconnects
+	LastWill json.RawMessage `json:"lastWill,omitempty"`
 }
 
 // IdentifyPayload identifies the client type.
 type IdentifyPayload struct {
-	ClientType string `json:"clientType"` // "foundry" or "phone"
+	ClientType  string `json:"clientType"`            // "foundry" or "phone"
+	DisplayName string `json:"displayName,omitempty"` // Shown to others in ROOM_STATUS
+
+	// LastWill replaces the client's LAST_WILL payload; null clears it
+	// and omitting it keeps the current one
+	LastWill json.RawMessage `json:"lastWill,omitempty"`
 }
 
 // RoomStatusPayload contains room connection status.
 type RoomStatusPayload struct {
-	FoundryConnected bool `json:"foundryConnected"`
+	FoundryConnected bool          `json:"foundryConnected"`
+	Participants     []Participant `json:"participants,omitempty"` // Clients that identified with a display name
+	ServerVersion    string        `json:"serverVersion,omitempty"`
+}
+
+// Participant is a named client listed in ROOM_STATUS.
+type Participant struct {
+	Name       string `json:"name"`
+	ClientType string `json:"clientType"`
+}
+
+// PresencePayload is the room roster the relay broadcasts as PRESENCE
+// when Config.PresenceEnabled is set.
+type PresencePayload struct {
+	Participants []PresenceEntry `json:"participants"` // Every client in the room, oldest connection first
+}
+
+// PresenceEntry describes one client in a PRESENCE roster.
+type PresenceEntry struct {
+	ID          string     `json:"id"`
+	Type        ClientType `json:"type"`
+	DisplayName string     `json:"displayName,omitempty"`
+	ConnectedAt time.Time  `json:"connectedAt"`
 }
 
 // PairPayload contains the pairing code.
@@ -57,10 +170,25 @@ type PairFailedPayload struct {
 	Reason string `json:"reason"`
 }
 
+// PairCodesPayload lists a room's active pairing codes, for relay-side
+// pairing. Each PAIR_CODES replaces the previous list.
+type PairCodesPayload struct {
+	Codes []PairCode `json:"codes"`
+}
+
+// PairCode maps a pairing code to the token a matching PAIR receives.
+type PairCode struct {
+	Code      string `json:"code"`
+	TokenID   string `json:"tokenId"`
+	TokenName string `json:"tokenName"`
+	ActorName string `json:"actorName,omitempty"`
+}
+
 // MovePayload contains movement direction.
 type MovePayload struct {
 	Direction string `json:"direction"`
 	TokenID   string `json:"tokenId"`
+	Distance  int    `json:"distance,omitempty"` // Grid squares to move; defaults to 1
 }
 
 // MoveAckPayload confirms movement with new position.
@@ -70,24 +198,117 @@ type MoveAckPayload struct {
 	Y       float64 `json:"y"`
 }
 
-// ParseEnvelope extracts the message type and raw payload.
+// RollDicePayload requests a dice roll for a token's actor.
+type RollDicePayload struct {
+	TokenID    string `json:"tokenId"`
+	Formula    string `json:"formula"` // Foundry roll formula, e.g. "2d6+3"
+	PostToChat bool   `json:"postToChat,omitempty"`
+}
+
+// RollDiceResultPayload reports the outcome of a ROLL_DICE.
+type RollDiceResultPayload struct {
+	TokenID      string `json:"tokenId"`
+	Formula      string `json:"formula"`
+	Success      bool   `json:"success"`
+	Total        int    `json:"total"`
+	Breakdown    string `json:"breakdown,omitempty"` // e.g. "[4, 2] + 3 = 9"
+	ActorName    string `json:"actorName,omitempty"`
+	PostedToChat bool   `json:"postedToChat,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// ServerShutdownPayload tells clients the relay is going away.
+type ServerShutdownPayload struct {
+	Reason string `json:"reason"`
+}
+
+// ResumeTokenPayload gives a client the token to present in a later JOIN
+// to restore its session after a dropped connection.
+type ResumeTokenPayload struct {
+	Token      string `json:"token"`
+	TTLSeconds int    `json:"ttlSeconds"` // How long the token stays valid after disconnect
+}
+
+// AnnouncementPayload is a host-originated notice shown to players.
+type AnnouncementPayload struct {
+	Message string `json:"message"`
+}
+
+// PingPayload carries the client's send time for latency measurement.
+type PingPayload struct {
+	ClientTime int64 `json:"clientTime"` // Client clock, opaque to the relay (typically Unix ms)
+}
+
+// PongPayload answers a PING, echoing its timestamp.
+type PongPayload struct {
+	ClientTime int64 `json:"clientTime"` // Echoed from PING
+	ServerTime int64 `json:"serverTime"` // Relay clock in Unix milliseconds
+}
+
+// IdentifyFailedPayload explains why the relay rejected an IDENTIFY.
+type IdentifyFailedPayload struct {
+	Reason string `json:"reason"`
+}
+
+// EncodeError reports a message whose payload could not be encoded.
+type EncodeError struct {
+	Type MessageType
+	Err  error // from encoding/json
+}
+
+// Error names the message type and the encoding failure.
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("cannot encode %s message: %v", e.Type, e.Err)
+}
+
+// Unwrap returns the underlying encoding/json error.
+func (e *EncodeError) Unwrap() error { return e.Err }
+
+// DecodeError reports data that is not a valid message envelope.
+type DecodeError struct {
+	Err error // from encoding/json
+}
+
+// Error describes the decoding failure.
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("invalid envelope: %v", e.Err)
+}
+
+// Unwrap returns the underlying encoding/json error.
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// ParseEnvelope extracts the message type and raw payload. Malformed
+// data yields a *DecodeError.
 func ParseEnvelope(data []byte) (*Envelope, error) {
 	var env Envelope
 	if err := json.Unmarshal(data, &env); err != nil {
-		return nil, err
+		return nil, &DecodeError{Err: err}
 	}
 	return &env, nil
 }
 
 // MakeEnvelope creates a JSON message with the given type and payload.
+// A payload that cannot be encoded yields an *EncodeError.
 func MakeEnvelope(msgType MessageType, payload any) ([]byte, error) {
+	return makeResponse(msgType, "", payload)
+}
+
+// makeResponse is MakeEnvelope for an answer to the request whose
+// envelope ID was requestID, which the answer carries so the requester
+// can match the two.
+func makeResponse(msgType MessageType, requestID string, payload any) ([]byte, error) {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
-		return nil, err
+		return nil, &EncodeError{Type: msgType, Err: err}
 	}
 	env := Envelope{
 		Type:    msgType,
 		Payload: payloadBytes,
+		ID:      requestID,
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		return nil, &EncodeError{Type: msgType, Err: err}
 	}
-	return json.Marshal(env)
+	return data, nil
 }
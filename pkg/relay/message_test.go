@@ -2,6 +2,8 @@ package relay
 
 import (
 	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -88,3 +90,202 @@ func TestMakeEnvelope(t *testing.T) {
 		t.Errorf("Room = %v, want TEST1", parsed.Room)
 	}
 }
+
+func TestEnvelopeID(t *testing.T) {
+	data, err := MakeEnvelope(TypeAnnouncement, AnnouncementPayload{Message: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"id"`) {
+		t.Errorf("MakeEnvelope without an ID = %s, want no id field", data)
+	}
+
+	data, err = makeResponse(TypePong, "req-7", PongPayload{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := ParseEnvelope(data)
+	if err != nil || env.ID != "req-7" {
+		t.Errorf("makeResponse ID = %+v (err %v), want req-7", env, err)
+	}
+}
+
+func TestMakeEnvelopeEncodeError(t *testing.T) {
+	_, err := MakeEnvelope(TypeAnnouncement, map[string]any{"bad": make(chan int)})
+	var encErr *EncodeError
+	if !errors.As(err, &encErr) {
+		t.Fatalf("MakeEnvelope() error = %v, want *EncodeError", err)
+	}
+	if encErr.Type != TypeAnnouncement {
+		t.Errorf("EncodeError.Type = %v, want %v", encErr.Type, TypeAnnouncement)
+	}
+	var typeErr *json.UnsupportedTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("EncodeError does not unwrap to *json.UnsupportedTypeError: %v", err)
+	}
+	if !strings.Contains(err.Error(), "ANNOUNCEMENT") {
+		t.Errorf("Error() = %q, want it to name the message type", err)
+	}
+}
+
+func TestParseEnvelopeDecodeError(t *testing.T) {
+	_, err := ParseEnvelope([]byte(`{"type":`))
+	var decErr *DecodeError
+	if !errors.As(err, &decErr) {
+		t.Fatalf("ParseEnvelope() error = %v, want *DecodeError", err)
+	}
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("DecodeError does not unwrap to *json.SyntaxError: %v", err)
+	}
+	if !errors.Is(err, decErr.Err) {
+		t.Error("errors.Is(err, decErr.Err) = false")
+	}
+}
+
+func TestMakeEnvelopeRollDice(t *testing.T) {
+	data, err := MakeEnvelope(TypeRollDice, RollDicePayload{TokenID: "abc123", Formula: "2d6+3", PostToChat: true})
+	if err != nil {
+		t.Fatalf("MakeEnvelope() error = %v", err)
+	}
+	if want := `{"type":"ROLL_DICE","payload":{"tokenId":"abc123","formula":"2d6+3","postToChat":true}}`; string(data) != want {
+		t.Errorf("MakeEnvelope() = %s, want %s", data, want)
+	}
+
+	env, err := ParseEnvelope(data)
+	if err != nil {
+		t.Fatalf("ParseEnvelope() error = %v", err)
+	}
+	var roll RollDicePayload
+	if err := json.Unmarshal(env.Payload, &roll); err != nil {
+		t.Fatalf("Unmarshal payload error = %v", err)
+	}
+	if roll.TokenID != "abc123" || roll.Formula != "2d6+3" || !roll.PostToChat {
+		t.Errorf("RollDicePayload = %+v", roll)
+	}
+}
+
+func TestParseEnvelopeRollDiceResult(t *testing.T) {
+	// As sent by the Foundry module
+	env, err := ParseEnvelope([]byte(`{"type":"ROLL_DICE_RESULT","payload":{"tokenId":"abc123","formula":"2d6+3","success":true,"total":9,"breakdown":"[4, 2] + 3 = 9","actorName":"Shadowrunner","postedToChat":true}}`))
+	if err != nil {
+		t.Fatalf("ParseEnvelope() error = %v", err)
+	}
+	var result RollDiceResultPayload
+	if err := json.Unmarshal(env.Payload, &result); err != nil {
+		t.Fatalf("Unmarshal payload error = %v", err)
+	}
+	want := RollDiceResultPayload{
+		TokenID:      "abc123",
+		Formula:      "2d6+3",
+		Success:      true,
+		Total:        9,
+		Breakdown:    "[4, 2] + 3 = 9",
+		ActorName:    "Shadowrunner",
+		PostedToChat: true,
+	}
+	if result != want {
+		t.Errorf("RollDiceResultPayload = %+v, want %+v", result, want)
+	}
+
+	// Failures carry an error and omit the optional fields
+	data, err := MakeEnvelope(TypeRollDiceResult, RollDiceResultPayload{TokenID: "abc123", Formula: "2d6*3", Error: "bad formula"})
+	if err != nil {
+		t.Fatalf("MakeEnvelope() error = %v", err)
+	}
+	if want := `{"type":"ROLL_DICE_RESULT","payload":{"tokenId":"abc123","formula":"2d6*3","success":false,"total":0,"error":"bad formula"}}`; string(data) != want {
+		t.Errorf("MakeEnvelope() = %s, want %s", data, want)
+	}
+}
+
+func TestIsKnownMessageType(t *testing.T) {
+	known := []MessageType{
+		TypeJoin, TypeIdentify, TypePair, TypeMove, TypeMoveAck,
+		TypeActorInfo, TypeActorUpdate, TypeRollDice, TypeRollDiceResult,
+		TypeLogin, TypeSelectToken, TypeUseAbility,
+	}
+	for _, mt := range known {
+		if !IsKnownMessageType(mt) {
+			t.Errorf("IsKnownMessageType(%q) = false, want true", mt)
+		}
+	}
+
+	forged := []MessageType{"", "move", "MOVE ", "DROP_TABLE", "ADMIN"}
+	for _, mt := range forged {
+		if IsKnownMessageType(mt) {
+			t.Errorf("IsKnownMessageType(%q) = true, want false", mt)
+		}
+	}
+}
+
+func TestValidatePayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		msgType MessageType
+		payload string
+		wantErr bool
+	}{
+		{name: "valid MOVE", msgType: TypeMove, payload: `{"direction":"left","tokenId":"abc123"}`},
+		{name: "MOVE bad direction", msgType: TypeMove, payload: `{"direction":"diagonally-up","tokenId":"abc123"}`, wantErr: true},
+		{name: "MOVE missing direction", msgType: TypeMove, payload: `{"tokenId":"abc123"}`, wantErr: true},
+		{name: "MOVE empty tokenId", msgType: TypeMove, payload: `{"direction":"up","tokenId":""}`, wantErr: true},
+		{name: "MOVE diagonal", msgType: TypeMove, payload: `{"direction":"up-left","tokenId":"abc123"}`},
+		{name: "MOVE diagonal with distance", msgType: TypeMove, payload: `{"direction":"down-right","tokenId":"abc123","distance":3}`},
+		{name: "MOVE negative distance", msgType: TypeMove, payload: `{"direction":"up","tokenId":"abc123","distance":-1}`, wantErr: true},
+		{name: "MOVE fractional distance", msgType: TypeMove, payload: `{"direction":"up","tokenId":"abc123","distance":1.5}`, wantErr: true},
+		{name: "MOVE wrong field type", msgType: TypeMove, payload: `{"direction":1,"tokenId":"abc123"}`, wantErr: true},
+		{name: "valid MOVE_ACK", msgType: TypeMoveAck, payload: `{"tokenId":"abc123","x":1200,"y":-50.5}`},
+		{name: "MOVE_ACK out of range", msgType: TypeMoveAck, payload: `{"tokenId":"abc123","x":1e9,"y":0}`, wantErr: true},
+		{name: "valid ROLL_DICE", msgType: TypeRollDice, payload: `{"tokenId":"abc123","formula":"2d6+3","postToChat":true}`},
+		{name: "ROLL_DICE empty formula", msgType: TypeRollDice, payload: `{"tokenId":"abc123","formula":""}`, wantErr: true},
+		{name: "ROLL_DICE long formula", msgType: TypeRollDice, payload: `{"tokenId":"abc123","formula":"` + strings.Repeat("1d6+", 60) + `1"}`, wantErr: true},
+		{name: "ROLL_DICE missing tokenId", msgType: TypeRollDice, payload: `{"formula":"1d20"}`, wantErr: true},
+		{name: "ROLL_DICE not an object", msgType: TypeRollDice, payload: `"1d20"`, wantErr: true},
+		{name: "unregistered type passes", msgType: TypePair, payload: `{"anything":true}`},
+		{name: "custom type passes", msgType: "CUSTOM", payload: `null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePayload(tt.msgType, json.RawMessage(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePayload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClampMoveDistance(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		wantClamped bool
+		wantDist    int
+	}{
+		{name: "default distance", payload: `{"direction":"up","tokenId":"abc123"}`, wantDist: 0},
+		{name: "within limit", payload: `{"direction":"up","tokenId":"abc123","distance":5}`, wantDist: 5},
+		{name: "over limit", payload: `{"direction":"up-right","tokenId":"abc123","distance":99}`, wantClamped: true, wantDist: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, clamped, err := clampMoveDistance(json.RawMessage(tt.payload), 5)
+			if err != nil {
+				t.Fatalf("clampMoveDistance error: %v", err)
+			}
+			if clamped != tt.wantClamped {
+				t.Errorf("clamped = %v, want %v", clamped, tt.wantClamped)
+			}
+			if !clamped && string(got) != tt.payload {
+				t.Errorf("Unclamped payload changed: %s", got)
+			}
+			var p MovePayload
+			if err := json.Unmarshal(got, &p); err != nil {
+				t.Fatalf("Invalid result %s: %v", got, err)
+			}
+			if p.Distance != tt.wantDist || p.TokenID != "abc123" {
+				t.Errorf("Result = %+v, want distance %d", p, tt.wantDist)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package relay
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultMaxTrackedRooms caps how many rooms get their own metric labels.
+const defaultMaxTrackedRooms = 100
+
+// otherRoomLabel aggregates rooms beyond the tracking cap.
+const otherRoomLabel = "_other"
+
+// roomMetrics holds per-room counters.
+type roomMetrics struct {
+	messagesRelayed atomic.Uint64
+	bytesRelayed    atomic.Uint64
+	slowClientDrops atomic.Uint64
+}
+
+// relayMetrics holds monotonic counters for the relay.
+// Per-room counters are bounded by maxRooms to keep label cardinality
+// under control; rooms past the cap share the otherRoomLabel bucket.
+type relayMetrics struct {
+	messagesRelayed atomic.Uint64
+	bytesRelayed    atomic.Uint64
+	joinFailures    atomic.Uint64
+	slowClientDrops atomic.Uint64
+
+	mu       sync.Mutex
+	rooms    map[string]*roomMetrics
+	other    roomMetrics
+	maxRooms int
+}
+
+// newRelayMetrics creates an empty metrics set.
+func newRelayMetrics(maxRooms int) *relayMetrics {
+	return &relayMetrics{
+		rooms:    make(map[string]*roomMetrics),
+		maxRooms: maxRooms,
+	}
+}
+
+// room returns the counters for a room, tracking it if under the cap.
+func (m *relayMetrics) room(code string) *roomMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rm, ok := m.rooms[code]; ok {
+		return rm
+	}
+	if len(m.rooms) >= m.maxRooms {
+		return &m.other
+	}
+	rm := &roomMetrics{}
+	m.rooms[code] = rm
+	return rm
+}
+
+// recordRelayed counts a message of size bytes published to a room.
+func (m *relayMetrics) recordRelayed(room string, size int) {
+	m.messagesRelayed.Add(1)
+	m.bytesRelayed.Add(uint64(size))
+	rm := m.room(room)
+	rm.messagesRelayed.Add(1)
+	rm.bytesRelayed.Add(uint64(size))
+}
+
+// recordSlowClientDrop counts a message dropped for a slow client.
+func (m *relayMetrics) recordSlowClientDrop(room string) {
+	m.slowClientDrops.Add(1)
+	m.room(room).slowClientDrops.Add(1)
+}
+
+// roomSnapshot is a point-in-time copy of one room's counters.
+type roomSnapshot struct {
+	room            string
+	messagesRelayed uint64
+	bytesRelayed    uint64
+	slowClientDrops uint64
+}
+
+// snapshot copies rm's counters.
+func (rm *roomMetrics) snapshot(room string) roomSnapshot {
+	return roomSnapshot{
+		room:            room,
+		messagesRelayed: rm.messagesRelayed.Load(),
+		bytesRelayed:    rm.bytesRelayed.Load(),
+		slowClientDrops: rm.slowClientDrops.Load(),
+	}
+}
+
+// lookupRoom copies a tracked room's counters without starting to track
+// it. Untracked rooms, including those over the cap, report zeros.
+func (m *relayMetrics) lookupRoom(code string) roomSnapshot {
+	m.mu.Lock()
+	rm, ok := m.rooms[code]
+	m.mu.Unlock()
+	if !ok {
+		return roomSnapshot{room: code}
+	}
+	return rm.snapshot(code)
+}
+
+// snapshotRooms copies per-room counters sorted by room code.
+func (m *relayMetrics) snapshotRooms() []roomSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snaps := make([]roomSnapshot, 0, len(m.rooms)+1)
+	for code, rm := range m.rooms {
+		snaps = append(snaps, rm.snapshot(code))
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].room < snaps[j].room })
+
+	if other := m.other.snapshot(otherRoomLabel); other.messagesRelayed > 0 || other.slowClientDrops > 0 {
+		snaps = append(snaps, other)
+	}
+	return snaps
+}
+
+// WritePrometheus writes relay statistics and counters to w in the
+// Prometheus text exposition format.
+func (r *Relay) WritePrometheus(w io.Writer) error {
+	stats := r.Stats()
+	rooms := r.metrics.snapshotRooms()
+
+	bw := bufio.NewWriter(w)
+	gauge := func(name, help string, value int) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, value)
+	}
+
+	gauge("vtt_remote_rooms", "Number of active rooms.", stats.RoomCount)
+	gauge("vtt_remote_clients", "Number of connected clients.", stats.ClientCount)
+	gauge("vtt_remote_foundry_clients", "Number of connected Foundry clients.", stats.FoundryCount)
+	gauge("vtt_remote_phone_clients", "Number of connected phone clients.", stats.PhoneCount)
+
+	counter := func(name, help string, value uint64) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+
+	counter("vtt_remote_join_failures_total", "Connections that failed the JOIN handshake.", r.metrics.joinFailures.Load())
+	counter("vtt_remote_messages_relayed_total", "Messages published to NATS.", r.metrics.messagesRelayed.Load())
+	counter("vtt_remote_bytes_relayed_total", "Bytes of messages published to NATS.", r.metrics.bytesRelayed.Load())
+	counter("vtt_remote_slow_client_drops_total", "Messages dropped because a client's send buffer was full.", r.metrics.slowClientDrops.Load())
+
+	// Per-room breakdown (bounded by MaxTrackedRooms)
+	fmt.Fprintf(bw, "# HELP vtt_remote_room_messages_relayed_total Messages published to NATS, by room.\n")
+	fmt.Fprintf(bw, "# TYPE vtt_remote_room_messages_relayed_total counter\n")
+	for _, rs := range rooms {
+		fmt.Fprintf(bw, "vtt_remote_room_messages_relayed_total{room=%q} %d\n", rs.room, rs.messagesRelayed)
+	}
+	fmt.Fprintf(bw, "# HELP vtt_remote_room_bytes_relayed_total Bytes of messages published to NATS, by room.\n")
+	fmt.Fprintf(bw, "# TYPE vtt_remote_room_bytes_relayed_total counter\n")
+	for _, rs := range rooms {
+		fmt.Fprintf(bw, "vtt_remote_room_bytes_relayed_total{room=%q} %d\n", rs.room, rs.bytesRelayed)
+	}
+	fmt.Fprintf(bw, "# HELP vtt_remote_room_slow_client_drops_total Messages dropped for slow clients, by room.\n")
+	fmt.Fprintf(bw, "# TYPE vtt_remote_room_slow_client_drops_total counter\n")
+	for _, rs := range rooms {
+		fmt.Fprintf(bw, "vtt_remote_room_slow_client_drops_total{room=%q} %d\n", rs.room, rs.slowClientDrops)
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,141 @@
+package relay
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRelayMetricsRoomCap(t *testing.T) {
+	m := newRelayMetrics(2)
+
+	m.recordRelayed("ROOM1", 10)
+	m.recordRelayed("ROOM2", 10)
+	m.recordRelayed("ROOM3", 10) // over the cap
+	m.recordRelayed("ROOM4", 10) // over the cap
+	m.recordSlowClientDrop("ROOM1")
+
+	if got := m.messagesRelayed.Load(); got != 4 {
+		t.Errorf("messagesRelayed = %d, want 4", got)
+	}
+
+	snaps := m.snapshotRooms()
+	if len(snaps) != 3 {
+		t.Fatalf("len(snapshots) = %d, want 3: %+v", len(snaps), snaps)
+	}
+	if snaps[0].room != "ROOM1" || snaps[0].messagesRelayed != 1 || snaps[0].slowClientDrops != 1 {
+		t.Errorf("ROOM1 snapshot = %+v", snaps[0])
+	}
+	if snaps[2].room != otherRoomLabel || snaps[2].messagesRelayed != 2 {
+		t.Errorf("overflow snapshot = %+v", snaps[2])
+	}
+}
+
+func TestRelayWritePrometheus(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"PROM1"}}`))
+	consumeRoomStatus(t, conn)
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`))
+
+	// Wait for the relayed message to come back
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatalf("Failed to read relayed message: %v", err)
+	}
+
+	// A connection that sends garbage counts as a join failure
+	bad := dialWS(t, server.URL)
+	bad.WriteMessage(websocket.TextMessage, []byte(`not json`))
+	bad.SetReadDeadline(time.Now().Add(time.Second))
+	bad.ReadMessage()
+	bad.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := r.WritePrometheus(&buf); err != nil {
+		t.Fatalf("WritePrometheus() error = %v", err)
+	}
+	out := buf.String()
+
+	want := []string{
+		"# TYPE vtt_remote_rooms gauge\nvtt_remote_rooms 1\n",
+		"vtt_remote_clients 1\n",
+		"vtt_remote_join_failures_total 1\n",
+		"vtt_remote_messages_relayed_total 1\n",
+		`vtt_remote_room_messages_relayed_total{room="PROM1"} 1` + "\n",
+		"vtt_remote_slow_client_drops_total 0\n",
+		"# TYPE vtt_remote_bytes_relayed_total counter\n",
+		`vtt_remote_room_bytes_relayed_total{room="PROM1"} `,
+	}
+	for _, w := range want {
+		if !strings.Contains(out, w) {
+			t.Errorf("Output missing %q\n%s", w, out)
+		}
+	}
+}
+
+func TestRelayTrafficCounters(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"BYTES1"}}`))
+	consumeRoomStatus(t, conn)
+	move := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`
+	for range 3 {
+		conn.WriteMessage(websocket.TextMessage, []byte(move))
+		readUntilMessage(t, conn, move)
+	}
+
+	stats := r.Stats()
+	room := stats.Rooms["BYTES1"]
+	if room.MessagesRelayed != 3 || room.BytesRelayed != uint64(3*len(move)) {
+		t.Errorf("RoomStats messages, bytes = %d, %d; want 3, %d", room.MessagesRelayed, room.BytesRelayed, 3*len(move))
+	}
+	if stats.MessagesRelayed != 3 || stats.BytesRelayed != room.BytesRelayed {
+		t.Errorf("Stats messages, bytes = %d, %d; want the room's", stats.MessagesRelayed, stats.BytesRelayed)
+	}
+
+	rooms := r.ListRooms()
+	if len(rooms) != 1 || rooms[0].MessagesRelayed != 3 || rooms[0].BytesRelayed != room.BytesRelayed {
+		t.Errorf("ListRooms = %+v, want the room's counters", rooms)
+	}
+}
+
+func TestRelaySlowClientDroppedCount(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{SendBufferSize: 4})
+	defer cleanup()
+
+	dropped := func() uint64 {
+		rooms := r.ListRooms()
+		if len(rooms) != 1 || len(rooms[0].Clients) != 1 {
+			return 0
+		}
+		return rooms[0].Clients[0].DroppedCount
+	}
+	wedged := floodWedgedClient(t, r, server.URL, "STALLED1", func() bool { return dropped() > 0 })
+	defer wedged.Close()
+
+	rooms := r.ListRooms()
+	if len(rooms) != 1 || len(rooms[0].Clients) != 1 {
+		t.Fatalf("ListRooms = %+v, want one room with the wedged client", rooms)
+	}
+	clientDrops := rooms[0].Clients[0].DroppedCount
+	if clientDrops == 0 {
+		t.Fatal("DroppedCount = 0 after flooding a stalled client")
+	}
+	if rooms[0].SlowClientDrops < clientDrops {
+		t.Errorf("Room SlowClientDrops = %d, want at least the client's %d", rooms[0].SlowClientDrops, clientDrops)
+	}
+	if drops := r.Stats().Rooms["STALLED1"].SlowClientDrops; drops < clientDrops {
+		t.Errorf("RoomStats.SlowClientDrops = %d, want at least %d", drops, clientDrops)
+	}
+}
@@ -0,0 +1,30 @@
+package relay
+
+import "encoding/json"
+
+// Middleware inspects a client message before it is relayed. It returns
+// the envelope to relay, which may be env itself after modification or a
+// replacement, and false to drop the message. Returning true with a nil
+// envelope relays env unchanged.
+type Middleware func(room string, env *Envelope) (*Envelope, bool)
+
+// applyMiddleware runs Config.Middleware over env in order, stopping at
+// the first that drops it. Unless dropped, the result is re-encoded so
+// changes made by any middleware reach the room.
+func (r *Relay) applyMiddleware(room string, env *Envelope) (*Envelope, []byte, bool) {
+	for _, mw := range r.config.Middleware {
+		next, ok := mw(room, env)
+		if !ok {
+			return nil, nil, false
+		}
+		if next != nil {
+			env = next
+		}
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		r.log(LogError, "Failed to encode %s after middleware in room %s: %v", env.Type, room, err)
+		return nil, nil, false
+	}
+	return env, data, true
+}
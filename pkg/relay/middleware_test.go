@@ -0,0 +1,102 @@
+package relay
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// joinPair joins two clients to room and returns them.
+func joinPair(t *testing.T, url, room string) (sender, receiver *websocket.Conn) {
+	t.Helper()
+	sender, receiver = dialWS(t, url), dialWS(t, url)
+	for _, conn := range []*websocket.Conn{sender, receiver} {
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+room+`"}}`))
+		consumeRoomStatus(t, conn)
+	}
+	return sender, receiver
+}
+
+func TestRelayMiddlewareDrop(t *testing.T) {
+	// Block MOVE in one room only
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{
+		Middleware: []Middleware{func(room string, env *Envelope) (*Envelope, bool) {
+			return env, !(room == "QUIET1" && env.Type == TypeMove)
+		}},
+	})
+	defer cleanup()
+
+	move := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`
+	login := `{"type":"LOGIN","payload":{"username":"gm","password":"pw"}}`
+
+	sender, receiver := joinPair(t, server.URL, "QUIET1")
+	defer sender.Close()
+	defer receiver.Close()
+	sender.WriteMessage(websocket.TextMessage, []byte(move))
+	sender.WriteMessage(websocket.TextMessage, []byte(login))
+	receiver.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, data, err := receiver.ReadMessage()
+		if err != nil {
+			t.Fatalf("Waiting for LOGIN: %v", err)
+		}
+		env, _ := ParseEnvelope(data)
+		if env == nil || env.Type == TypeRoomStatus {
+			continue
+		}
+		if env.Type == TypeMove {
+			t.Fatal("Dropped MOVE was relayed")
+		}
+		if env.Type == TypeLogin {
+			break
+		}
+	}
+
+	// Other rooms are unaffected
+	other, otherReceiver := joinPair(t, server.URL, "LOUD1")
+	defer other.Close()
+	defer otherReceiver.Close()
+	other.WriteMessage(websocket.TextMessage, []byte(move))
+	readUntilMessage(t, otherReceiver, move)
+}
+
+func TestRelayMiddlewareRewrite(t *testing.T) {
+	var order []string
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{
+		Middleware: []Middleware{
+			func(room string, env *Envelope) (*Envelope, bool) {
+				order = append(order, "redact")
+				if env.Type != TypeMove {
+					return env, true
+				}
+				var move MovePayload
+				if err := json.Unmarshal(env.Payload, &move); err != nil {
+					return env, false
+				}
+				move.TokenID = "redacted"
+				env.Payload, _ = json.Marshal(move)
+				return env, true
+			},
+			func(room string, env *Envelope) (*Envelope, bool) {
+				// Sees the first middleware's change
+				order = append(order, "check")
+				var move MovePayload
+				json.Unmarshal(env.Payload, &move)
+				return nil, move.TokenID == "redacted"
+			},
+		},
+	})
+	defer cleanup()
+
+	sender, receiver := joinPair(t, server.URL, "REDACT1")
+	defer sender.Close()
+	defer receiver.Close()
+	sender.WriteMessage(websocket.TextMessage, []byte(`{"type":"MOVE","payload":{"direction":"up","tokenId":"secret-token"}}`))
+	readUntilMessage(t, receiver, `{"type":"MOVE","payload":{"direction":"up","tokenId":"redacted"}}`)
+
+	if len(order) != 2 || order[0] != "redact" || order[1] != "check" {
+		t.Errorf("Middleware ran in order %v, want [redact check]", order)
+	}
+}
@@ -0,0 +1,66 @@
+package relay
+
+import (
+	"github.com/nats-io/nats.go"
+)
+
+// connectNATS connects to Config.NatsURL, reconnecting after outages as
+// configured and logging connection changes. nats.go replays live
+// subscriptions once it reconnects; any it could not restore are
+// replaced by resubscribeAll.
+func (r *Relay) connectNATS() (*nats.Conn, error) {
+	nc, err := nats.Connect(r.config.NatsURL,
+		nats.MaxReconnects(r.config.NatsMaxReconnects),
+		nats.ReconnectWait(r.config.NatsReconnectWait),
+		nats.ReconnectBufSize(r.config.NatsReconnectBufSize),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				r.log(LogWarn, "Disconnected from NATS: %v", err)
+			} else {
+				r.log(LogInfo, "Disconnected from NATS")
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			r.log(LogInfo, "Reconnected to NATS at %s", nc.ConnectedUrlRedacted())
+			r.resubscribeAll()
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			if err := nc.LastError(); err != nil {
+				r.log(LogError, "NATS connection closed: %v", err)
+			}
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	r.log(LogInfo, "Connected to NATS at %s", nc.ConnectedUrlRedacted())
+	return nc, nil
+}
+
+// resubscribeAll walks every room and replaces client subscriptions the
+// reconnect left invalid.
+func (r *Relay) resubscribeAll() {
+	r.mu.RLock()
+	var clients []*Client
+	for _, members := range r.rooms {
+		for c := range members {
+			clients = append(clients, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	renewed := 0
+	for _, c := range clients {
+		ok, err := c.resubscribe()
+		if err != nil {
+			c.log(LogError, "Failed to re-subscribe to room %s: %v", c.getRoom(), err)
+			continue
+		}
+		if ok {
+			renewed++
+		}
+	}
+	if renewed > 0 {
+		r.log(LogInfo, "Re-subscribed %d clients after NATS reconnect", renewed)
+	}
+}
@@ -0,0 +1,186 @@
+package relay
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+)
+
+// waitFor polls cond until it holds or timeout passes.
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+func TestRelayNATSReconnect(t *testing.T) {
+	ns := startTestNATS(t)
+	port := ns.Addr().(*net.TCPAddr).Port
+
+	var mu sync.Mutex
+	var logs []string
+	r, err := NewRelay(Config{
+		NatsURL:           ns.ClientURL(),
+		NatsReconnectWait: 50 * time.Millisecond,
+		OnLog: func(level LogLevel, message string) {
+			mu.Lock()
+			logs = append(logs, message)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		ns.Shutdown()
+		t.Fatalf("NewRelay: %v", err)
+	}
+	defer r.Close()
+	server := serveRelay(t, r)
+	defer server.Close()
+
+	sender := dialWS(t, server.URL)
+	defer sender.Close()
+	sender.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"BLIP1"}}`))
+	consumeRoomStatus(t, sender)
+	receiver := dialWS(t, server.URL)
+	defer receiver.Close()
+	receiver.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"BLIP1"}}`))
+	consumeRoomStatus(t, receiver)
+
+	// Take NATS down and bring a fresh server up on the same port
+	ns.Shutdown()
+	if !waitFor(2*time.Second, func() bool { return !r.nc.IsConnected() }) {
+		t.Fatal("Relay never noticed NATS going down")
+	}
+	ns = startTestNATSOnPort(t, port)
+	defer ns.Shutdown()
+	if !waitFor(5*time.Second, r.nc.IsConnected) {
+		t.Fatal("Relay did not reconnect to NATS")
+	}
+
+	move := `{"type":"MOVE","payload":{"tokenId":"tok1","direction":"up"}}`
+	sender.WriteMessage(websocket.TextMessage, []byte(move))
+	receiver.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := receiver.ReadMessage()
+		if err != nil {
+			t.Fatalf("No MOVE after reconnect: %v", err)
+		}
+		if string(data) == move {
+			break
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	joined := strings.Join(logs, "\n")
+	for _, want := range []string{"Disconnected from NATS", "Reconnected to NATS"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("No %q log in:\n%s", want, joined)
+		}
+	}
+}
+
+// roomClient returns the only client in room.
+func roomClient(t *testing.T, r *Relay, room string) *Client {
+	t.Helper()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.rooms[room]) != 1 {
+		t.Fatalf("Room %s has %d clients, want 1", room, len(r.rooms[room]))
+	}
+	for c := range r.rooms[room] {
+		return c
+	}
+	return nil
+}
+
+// readUntilMessage reads until msg arrives, failing after a second.
+func readUntilMessage(t *testing.T, conn *websocket.Conn, msg string) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Waiting for %s: %v", msg, err)
+		}
+		if string(data) == msg {
+			return
+		}
+	}
+}
+
+func TestRelayResubscribeAfterReconnect(t *testing.T) {
+	ns := startTestNATS(t)
+	port := ns.Addr().(*net.TCPAddr).Port
+	r, err := NewRelay(Config{NatsURL: ns.ClientURL(), NatsReconnectWait: 50 * time.Millisecond})
+	if err != nil {
+		ns.Shutdown()
+		t.Fatalf("NewRelay: %v", err)
+	}
+	defer r.Close()
+	server := serveRelay(t, r)
+	defer server.Close()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"RESUB1"}}`))
+	consumeRoomStatus(t, conn)
+	c := roomClient(t, r, "RESUB1")
+
+	ns.Shutdown()
+	if !waitFor(2*time.Second, func() bool { return !r.nc.IsConnected() }) {
+		t.Fatal("Relay never noticed NATS going down")
+	}
+	ns = startTestNATSOnPort(t, port)
+	defer ns.Shutdown()
+	if !waitFor(5*time.Second, r.nc.IsConnected) {
+		t.Fatal("Relay did not reconnect to NATS")
+	}
+
+	// A message published by another NATS client after the restart
+	// reaches the existing WebSocket client
+	pub, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Connect publisher: %v", err)
+	}
+	defer pub.Close()
+	fresh := `{"type":"MOVE","payload":{"tokenId":"tok1","direction":"left"}}`
+	if !waitFor(time.Second, func() bool { return ns.NumSubscriptions() > 0 }) {
+		t.Fatal("Room subscription was not restored")
+	}
+	pub.Publish(r.roomSubject("RESUB1"), []byte(fresh))
+	readUntilMessage(t, conn, fresh)
+
+	// An invalidated subscription is replaced exactly once
+	c.subMu.Lock()
+	stale := c.sub
+	c.subMu.Unlock()
+	stale.Unsubscribe()
+	r.resubscribeAll()
+	r.resubscribeAll()
+	if got := r.nc.NumSubscriptions(); got != 1 {
+		t.Errorf("NumSubscriptions = %d after re-subscribing, want 1", got)
+	}
+	again := `{"type":"MOVE","payload":{"tokenId":"tok1","direction":"right"}}`
+	r.nc.Publish(r.roomSubject("RESUB1"), []byte(again))
+	readUntilMessage(t, conn, again)
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := conn.ReadMessage(); err == nil {
+		t.Errorf("Unexpected second delivery %s", data)
+	}
+
+	// Teardown unsubscribes the replacement
+	conn.Close()
+	if !waitFor(time.Second, func() bool { return r.nc.NumSubscriptions() == 0 }) {
+		t.Errorf("NumSubscriptions = %d after client left, want 0", r.nc.NumSubscriptions())
+	}
+}
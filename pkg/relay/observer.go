@@ -0,0 +1,38 @@
+package relay
+
+// defaultObserverQueueSize is how many relayed messages may wait for
+// Config.OnMessage before new ones are dropped.
+const defaultObserverQueueSize = 256
+
+// observedMessage is a relayed envelope queued for Config.OnMessage.
+type observedMessage struct {
+	room string
+	env  *Envelope
+}
+
+// observe queues env for Config.OnMessage. It never blocks: if the
+// handler has fallen behind, the message is skipped for observation but
+// still relayed.
+func (r *Relay) observe(room string, env *Envelope) {
+	if r.observed == nil {
+		return
+	}
+	select {
+	case r.observed <- observedMessage{room: room, env: env}:
+	default:
+		r.log(LogWarn, "OnMessage is behind; not observing %s in room %s", env.Type, room)
+	}
+}
+
+// observeLoop feeds queued messages to Config.OnMessage, one at a time,
+// until the relay is closed.
+func (r *Relay) observeLoop() {
+	for {
+		select {
+		case m := <-r.observed:
+			r.config.OnMessage(m.room, m.env)
+		case <-r.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRelayOnMessage(t *testing.T) {
+	type seen struct {
+		room      string
+		msgType   MessageType
+		direction string
+	}
+	observed := make(chan seen, 10)
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{
+		OnMessage: func(room string, env *Envelope) {
+			var move MovePayload
+			json.Unmarshal(env.Payload, &move)
+			observed <- seen{room, env.Type, move.Direction}
+		},
+	})
+	defer cleanup()
+
+	a := dialWS(t, server.URL)
+	defer a.Close()
+	a.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"OBS1"}}`))
+	consumeRoomStatus(t, a)
+	b := dialWS(t, server.URL)
+	defer b.Close()
+	b.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"OBS2"}}`))
+	consumeRoomStatus(t, b)
+
+	// Locally handled and invalid messages are not observed
+	a.WriteMessage(websocket.TextMessage, []byte(`{"type":"PING","payload":{}}`))
+	a.WriteMessage(websocket.TextMessage, []byte(`{"type":"MOVE","payload":{"direction":"sideways","tokenId":"tok1"}}`))
+
+	want := []seen{
+		{"OBS1", TypeMove, "up"},
+		{"OBS2", TypeMove, "left"},
+		{"OBS1", TypeMove, "down"},
+	}
+	for _, w := range want {
+		conn := a
+		if w.room == "OBS2" {
+			conn = b
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"type":"MOVE","payload":{"direction":%q,"tokenId":"tok1"}}`, w.direction)))
+		select {
+		case got := <-observed:
+			if got != w {
+				t.Errorf("Observed %+v, want %+v", got, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %+v", w)
+		}
+	}
+	select {
+	case got := <-observed:
+		t.Errorf("Unexpected observed message: %+v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRelayOnMessageSlowHandler(t *testing.T) {
+	release := make(chan struct{})
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{
+		OnMessage: func(string, *Envelope) { <-release },
+	})
+	defer cleanup()
+	defer close(release)
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"SLOWOBS"}}`))
+	consumeRoomStatus(t, conn)
+
+	// Overflow the queue; every message must still be relayed
+	msg := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`
+	for range defaultObserverQueueSize + 10 {
+		conn.WriteMessage(websocket.TextMessage, []byte(msg))
+		readUntilMessage(t, conn, msg)
+	}
+}
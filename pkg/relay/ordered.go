@@ -0,0 +1,56 @@
+package relay
+
+// defaultOrderedQueueSize is how many messages may wait for a room's
+// sequencer before senders block.
+const defaultOrderedQueueSize = 64
+
+// roomSequencer runs one room's queued messages in order on a single
+// goroutine. Its pending count is guarded by Relay.mu.
+type roomSequencer struct {
+	queue   chan func()
+	pending int // queued or running; the goroutine exits at zero
+}
+
+// sequence queues fn to run on room's sequencer, after every message
+// queued before it, starting the sequencer if the room has none. It blocks
+// while the queue is full and reports false if the relay closes first.
+func (r *Relay) sequence(room string, fn func()) bool {
+	r.mu.Lock()
+	s, ok := r.sequencers[room]
+	if !ok {
+		s = &roomSequencer{queue: make(chan func(), defaultOrderedQueueSize)}
+		r.sequencers[room] = s
+		go r.runSequencer(room, s)
+	}
+	s.pending++
+	r.mu.Unlock()
+
+	select {
+	case s.queue <- fn:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// runSequencer runs s's queued messages until none are pending, then
+// removes s so idle rooms hold no goroutine. A later message starts a new
+// sequencer; it cannot overtake this one, which has already finished.
+func (r *Relay) runSequencer(room string, s *roomSequencer) {
+	for {
+		select {
+		case fn := <-s.queue:
+			fn()
+		case <-r.done:
+			return
+		}
+
+		r.mu.Lock()
+		if s.pending--; s.pending == 0 {
+			delete(r.sequencers, room)
+			r.mu.Unlock()
+			return
+		}
+		r.mu.Unlock()
+	}
+}
@@ -0,0 +1,123 @@
+package relay
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRelayOrderedRooms(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{
+		OrderedRooms:   true,
+		StampSequence:  true,
+		SendBufferSize: 256,
+	})
+	defer cleanup()
+
+	const perSender = 50
+	conns := make([]*websocket.Conn, 4) // two senders, then two watchers
+	for i := range conns {
+		conns[i] = dialWS(t, server.URL)
+		defer conns[i].Close()
+		conns[i].WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"ORDER1"}}`))
+		consumeRoomStatus(t, conns[i])
+	}
+
+	// Every connection records the order MOVEs reach it
+	orders := make([][]string, len(conns))
+	var readers sync.WaitGroup
+	for i, conn := range conns {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for len(orders[i]) < 2*perSender {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				env, err := ParseEnvelope(data)
+				if err != nil || env.Type != TypeMove {
+					continue
+				}
+				orders[i] = append(orders[i], fmt.Sprintf("%d %s", env.Seq, env.Payload))
+			}
+		}()
+	}
+
+	var senders sync.WaitGroup
+	for s, conn := range conns[:2] {
+		senders.Add(1)
+		go func() {
+			defer senders.Done()
+			for n := range perSender {
+				conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"type":"MOVE","payload":{"direction":"up","tokenId":"tok%d","distance":%d}}`, s, n+1)))
+			}
+		}()
+	}
+	senders.Wait()
+	readers.Wait()
+
+	for i, order := range orders {
+		if len(order) != 2*perSender {
+			t.Fatalf("Connection %d got %d MOVEs, want %d", i, len(order), 2*perSender)
+		}
+		if i > 0 && !reflect.DeepEqual(order, orders[0]) {
+			t.Errorf("Connection %d saw a different order than connection 0", i)
+		}
+	}
+	// Sequence numbers follow delivery order
+	for n, msg := range orders[0] {
+		if !strings.HasPrefix(msg, fmt.Sprintf("%d ", n+1)) {
+			t.Errorf("Message %d = %s, want seq %d", n, msg, n+1)
+			break
+		}
+	}
+
+	// The idle room's sequencer exits
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.mu.RLock()
+		n := len(r.sequencers)
+		r.mu.RUnlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d sequencers still running", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRelayOrderedPublishFailure(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{OrderedRooms: true})
+	defer cleanup()
+
+	sender := dialWS(t, server.URL)
+	defer sender.Close()
+	sender.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"ORDER2"}}`))
+	consumeRoomStatus(t, sender)
+
+	// Every publish fails once the NATS connection is gone
+	r.nc.Close()
+	sender.WriteMessage(websocket.TextMessage, []byte(`{"type":"MOVE","payload":{"tokenId":"tok1","direction":"up"}}`))
+
+	sender.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, _, err := sender.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			t.Fatal("Sender stayed connected after its message failed to publish")
+		}
+		break
+	}
+}
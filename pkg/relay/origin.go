@@ -0,0 +1,81 @@
+package relay
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OriginChecker validates the Origin header of WebSocket upgrade requests.
+// Use its Check method as a websocket.Upgrader CheckOrigin function.
+type OriginChecker struct {
+	allowAll bool
+	origins  map[string]struct{} // normalized scheme://host[:port]
+	hosts    map[string]struct{} // hostnames allowed on any scheme/port
+}
+
+// NewOriginChecker builds a checker from an allowlist.
+//
+// Entries containing "://" are matched as full origins (scheme, host, and
+// port); bare entries are matched as hostnames on any scheme or port.
+// The entry "*" allows every origin. Matching is case-insensitive.
+// Requests whose Origin host matches the request's own Host are always
+// allowed, as are requests without an Origin header (non-browser clients).
+func NewOriginChecker(allowed []string) *OriginChecker {
+	oc := &OriginChecker{
+		origins: make(map[string]struct{}),
+		hosts:   make(map[string]struct{}),
+	}
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		entry = strings.TrimSuffix(entry, "/")
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			oc.allowAll = true
+		case strings.Contains(entry, "://"):
+			oc.origins[entry] = struct{}{}
+		default:
+			oc.hosts[entry] = struct{}{}
+		}
+	}
+	return oc
+}
+
+// Check reports whether the request's Origin is allowed.
+func (oc *OriginChecker) Check(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if oc.allowAll {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	if _, ok := oc.origins[strings.ToLower(u.Scheme+"://"+u.Host)]; ok {
+		return true
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if _, ok := oc.hosts[host]; ok {
+		return true
+	}
+
+	// Same-host origin (page served by this server)
+	return host == strings.ToLower(hostOnly(r.Host))
+}
+
+// hostOnly strips an optional port from a host[:port] string.
+func hostOnly(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return strings.Trim(hostport, "[]")
+}
@@ -0,0 +1,55 @@
+package relay
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginChecker(t *testing.T) {
+	oc := NewOriginChecker([]string{
+		"localhost",
+		"192.168.1.10",
+		"https://Foundry.Example.com:30000",
+	})
+
+	tests := []struct {
+		name   string
+		host   string
+		origin string
+		want   bool
+	}{
+		{name: "missing origin", host: "relay.local:8080", origin: "", want: true},
+		{name: "same host", host: "relay.local:8080", origin: "http://relay.local:8080", want: true},
+		{name: "same host different case", host: "relay.local:8080", origin: "HTTP://RELAY.LOCAL:8080", want: true},
+		{name: "localhost any port", host: "relay.local:8080", origin: "http://localhost:30000", want: true},
+		{name: "LAN IP", host: "relay.local:8080", origin: "http://192.168.1.10:5173", want: true},
+		{name: "full origin match", host: "relay.local:8080", origin: "https://foundry.example.com:30000", want: true},
+		{name: "full origin wrong scheme", host: "relay.local:8080", origin: "http://foundry.example.com:30000", want: false},
+		{name: "full origin wrong port", host: "relay.local:8080", origin: "https://foundry.example.com", want: false},
+		{name: "disallowed host", host: "relay.local:8080", origin: "https://evil.example.com", want: false},
+		{name: "malformed origin", host: "relay.local:8080", origin: "not a url", want: false},
+		{name: "null origin", host: "relay.local:8080", origin: "null", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ws", nil)
+			req.Host = tt.host
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if got := oc.Check(req); got != tt.want {
+				t.Errorf("Check(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOriginCheckerWildcard(t *testing.T) {
+	oc := NewOriginChecker([]string{"*"})
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Origin", "https://anywhere.example.com")
+	if !oc.Check(req) {
+		t.Error("Expected wildcard to allow any origin")
+	}
+}
@@ -0,0 +1,191 @@
+package relay
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// defaultPairRequestTTL is how long a PAIR waits for the room's codes.
+const defaultPairRequestTTL = 30 * time.Second
+
+// Reasons sent in relay-side PAIR_FAILED messages. The first matches the
+// Foundry module's own wording.
+const (
+	pairInvalidReason = "Invalid or expired pairing code"
+	pairExpiredReason = "Pairing request expired"
+)
+
+// pairingRoom is a room's relay-side pairing state. It is guarded by
+// Relay.mu.
+type pairingRoom struct {
+	codes   map[string]PairCode      // nil until a Foundry sends PAIR_CODES
+	pending map[*Client]*pendingPair // PAIRs waiting for codes
+}
+
+// pendingPair is a PAIR held until the room's codes arrive or ttl passes.
+type pendingPair struct {
+	code  string
+	id    string // the PAIR's envelope ID, echoed in the answer
+	timer *time.Timer
+}
+
+// pairingRoomLocked returns the room's pairing state, creating it if
+// needed. Callers must hold r.mu exclusively.
+func (r *Relay) pairingRoomLocked(room string) *pairingRoom {
+	pr, ok := r.pairing[room]
+	if !ok {
+		pr = &pairingRoom{pending: make(map[*Client]*pendingPair)}
+		r.pairing[room] = pr
+	}
+	return pr
+}
+
+// dropPendingPairLocked cancels a leaving client's pending PAIR.
+// Callers must hold r.mu exclusively.
+func (r *Relay) dropPendingPairLocked(c *Client) {
+	pr, ok := r.pairing[c.room]
+	if !ok {
+		return
+	}
+	if pp, ok := pr.pending[c]; ok {
+		pp.timer.Stop()
+		delete(pr.pending, c)
+	}
+}
+
+// handlePair matches a PAIR against the codes the room's Foundry sent
+// with PAIR_CODES when Config.RelaySidePairing is set. If no codes have
+// arrived yet the request is held for PairRequestTTL. It reports whether
+// the message was handled; unhandled PAIRs are relayed to Foundry.
+func (c *Client) handlePair(payload json.RawMessage, requestID string) bool {
+	if !c.relay.config.RelaySidePairing {
+		return false
+	}
+
+	var p PairPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.log(LogWarn, "Invalid PAIR payload: %v", err)
+		return true
+	}
+	code := strings.TrimSpace(p.Code)
+
+	r := c.relay
+	r.mu.Lock()
+	pr := r.pairingRoomLocked(c.room)
+	if pr.codes == nil {
+		if old, ok := pr.pending[c]; ok {
+			old.timer.Stop()
+		}
+		pp := &pendingPair{code: code, id: requestID}
+		pp.timer = time.AfterFunc(r.config.PairRequestTTL, func() { c.expirePair(pp) })
+		pr.pending[c] = pp
+		r.mu.Unlock()
+		c.log(LogInfo, "Holding PAIR in room %s until Foundry sends pairing codes", c.room)
+		return true
+	}
+	match, ok := pr.codes[code]
+	r.mu.Unlock()
+
+	c.finishPair(match, ok, pairInvalidReason, requestID)
+	return true
+}
+
+// expirePair fails a PAIR that is still waiting when its TTL passes.
+func (c *Client) expirePair(pp *pendingPair) {
+	r := c.relay
+	r.mu.Lock()
+	pr, ok := r.pairing[c.room]
+	if !ok || pr.pending[c] != pp {
+		r.mu.Unlock()
+		return
+	}
+	delete(pr.pending, c)
+	r.mu.Unlock()
+
+	c.finishPair(PairCode{}, false, pairExpiredReason, pp.id)
+}
+
+// handlePairCodes replaces the room's pairing codes with those from a
+// PAIR_CODES and matches any waiting PAIRs. Only Foundry clients may set
+// codes. PAIR_CODES is never relayed, so codes are not exposed to phones.
+func (c *Client) handlePairCodes(payload json.RawMessage) {
+	if !c.relay.config.RelaySidePairing {
+		c.log(LogWarn, "Dropping PAIR_CODES in room %s: relay-side pairing is disabled", c.room)
+		return
+	}
+	if c.getClientType() != ClientTypeFoundry {
+		c.log(LogWarn, "Dropping PAIR_CODES in room %s from non-Foundry client", c.room)
+		return
+	}
+
+	var p PairCodesPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.log(LogWarn, "Invalid PAIR_CODES payload: %v", err)
+		return
+	}
+	codes := make(map[string]PairCode, len(p.Codes))
+	for _, pc := range p.Codes {
+		if pc.Code = strings.TrimSpace(pc.Code); pc.Code == "" || validateTokenID(pc.TokenID) != nil {
+			continue
+		}
+		codes[pc.Code] = pc
+	}
+
+	type pairResult struct {
+		client *Client
+		match  PairCode
+		ok     bool
+		id     string
+	}
+	r := c.relay
+	r.mu.Lock()
+	pr := r.pairingRoomLocked(c.room)
+	pr.codes = codes
+	results := make([]pairResult, 0, len(pr.pending))
+	for client, pp := range pr.pending {
+		pp.timer.Stop()
+		match, ok := codes[pp.code]
+		results = append(results, pairResult{client, match, ok, pp.id})
+	}
+	clear(pr.pending)
+	r.mu.Unlock()
+
+	c.log(LogInfo, "Room %s has %d pairing codes", c.room, len(codes))
+	for _, res := range results {
+		res.client.finishPair(res.match, res.ok, pairInvalidReason, res.id)
+	}
+}
+
+// finishPair answers a PAIR, carrying its envelope ID requestID. A match
+// is published to the room as PAIR_SUCCESS, as the Foundry module would,
+// so Foundry learns of it too; a failure goes to the requester only.
+func (c *Client) finishPair(match PairCode, ok bool, reason, requestID string) {
+	if !ok {
+		msg, err := makeResponse(TypePairFailed, requestID, PairFailedPayload{Reason: reason})
+		if err != nil {
+			c.log(LogError, "Failed to create PAIR_FAILED message: %v", err)
+			return
+		}
+		c.trySend(msg)
+		return
+	}
+
+	msg, err := makeResponse(TypePairSuccess, requestID, PairSuccessPayload{
+		TokenID:   match.TokenID,
+		TokenName: match.TokenName,
+		ActorName: match.ActorName,
+	})
+	if err != nil {
+		c.log(LogError, "Failed to create PAIR_SUCCESS message: %v", err)
+		return
+	}
+	room := c.getRoom()
+	if err := c.relay.nc.Publish(c.relay.roomSubject(room), msg); err != nil {
+		c.log(LogError, "NATS publish error: %v", err)
+		return
+	}
+	c.relay.metrics.recordRelayed(room, len(msg))
+	c.relay.recordHistory(room, TypePairSuccess, msg)
+	c.log(LogInfo, "Paired client in room %s with token %s", room, match.TokenID)
+}
@@ -0,0 +1,196 @@
+package relay
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const testPairCodes = `{"type":"PAIR_CODES","payload":{"codes":[{"code":"1234","tokenId":"tok1","tokenName":"Hero","actorName":"Aria"}]}}`
+
+// joinPairingRoom connects a Foundry and a phone to room. The Foundry has
+// identified and both connections have seen foundryConnected=true.
+func joinPairingRoom(t *testing.T, serverURL, room string) (foundry, phone *websocket.Conn) {
+	t.Helper()
+	foundry = dialWS(t, serverURL)
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+room+`"}}`))
+	consumeRoomStatus(t, foundry)
+
+	phone = dialWS(t, serverURL)
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+room+`"}}`))
+	consumeRoomStatus(t, phone)
+
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry"}}`))
+	readUntilStatus(t, foundry, true)
+	readUntilStatus(t, phone, true)
+	return foundry, phone
+}
+
+// readPairReply reads until a PAIR_SUCCESS or PAIR_FAILED and returns it.
+// Any PAIR or PAIR_CODES seen first fails the test.
+func readPairReply(t *testing.T, conn *websocket.Conn) Envelope {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Waiting for pairing reply: %v", err)
+		}
+		env, err := ParseEnvelope(data)
+		if err != nil {
+			continue
+		}
+		switch env.Type {
+		case TypePairSuccess, TypePairFailed:
+			return *env
+		case TypePair, TypePairCodes:
+			t.Fatalf("Unexpected relayed %s", env.Type)
+		}
+	}
+}
+
+func TestRelaySidePairingSuccess(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{RelaySidePairing: true})
+	defer cleanup()
+
+	foundry, phone := joinPairingRoom(t, server.URL, "PAIR1")
+	defer foundry.Close()
+	defer phone.Close()
+
+	// A PAIR sent before any codes waits for them
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"PAIR","payload":{"code":"1234"}}`))
+	time.Sleep(50 * time.Millisecond)
+	foundry.WriteMessage(websocket.TextMessage, []byte(testPairCodes))
+
+	// Both the phone and Foundry see the PAIR_SUCCESS; neither sees the
+	// PAIR or the codes
+	for _, conn := range []*websocket.Conn{phone, foundry} {
+		env := readPairReply(t, conn)
+		if env.Type != TypePairSuccess {
+			t.Fatalf("Expected PAIR_SUCCESS, got %s", env.Type)
+		}
+		var p PairSuccessPayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.TokenID != "tok1" || p.TokenName != "Hero" || p.ActorName != "Aria" {
+			t.Errorf("PAIR_SUCCESS payload = %+v", p)
+		}
+	}
+
+	// Once codes are known, a PAIR is answered immediately
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"PAIR","payload":{"code":" 1234 "}}`))
+	if env := readPairReply(t, phone); env.Type != TypePairSuccess {
+		t.Errorf("Expected PAIR_SUCCESS, got %s", env.Type)
+	}
+}
+
+func TestRelaySidePairingWrongCode(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{RelaySidePairing: true})
+	defer cleanup()
+
+	foundry, phone := joinPairingRoom(t, server.URL, "PAIR2")
+	defer foundry.Close()
+	defer phone.Close()
+
+	// Codes from a phone are ignored
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"PAIR_CODES","payload":{"codes":[{"code":"9999","tokenId":"evil","tokenName":"Evil"}]}}`))
+	foundry.WriteMessage(websocket.TextMessage, []byte(testPairCodes))
+	time.Sleep(50 * time.Millisecond)
+
+	for _, code := range []string{"0000", "9999"} {
+		phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"PAIR","payload":{"code":"`+code+`"}}`))
+		env := readPairReply(t, phone)
+		if env.Type != TypePairFailed {
+			t.Fatalf("Code %s: expected PAIR_FAILED, got %s", code, env.Type)
+		}
+		var p PairFailedPayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Reason != pairInvalidReason {
+			t.Errorf("Reason = %q, want %q", p.Reason, pairInvalidReason)
+		}
+	}
+
+	// Failures go to the requester only
+	foundry.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := foundry.ReadMessage(); err == nil {
+		t.Errorf("Foundry received %s", data)
+	}
+}
+
+func TestRelaySidePairingExpired(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{
+		RelaySidePairing: true,
+		PairRequestTTL:   100 * time.Millisecond,
+	})
+	defer cleanup()
+
+	foundry, phone := joinPairingRoom(t, server.URL, "PAIR3")
+	defer foundry.Close()
+	defer phone.Close()
+
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"PAIR","payload":{"code":"1234"}}`))
+	start := time.Now()
+	env := readPairReply(t, phone)
+	if env.Type != TypePairFailed {
+		t.Fatalf("Expected PAIR_FAILED, got %s", env.Type)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("PAIR failed after %v, before its TTL", elapsed)
+	}
+	var p PairFailedPayload
+	if err := json.Unmarshal(env.Payload, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Reason != pairExpiredReason {
+		t.Errorf("Reason = %q, want %q", p.Reason, pairExpiredReason)
+	}
+
+	// Codes arriving afterwards do not revive the expired request
+	foundry.WriteMessage(websocket.TextMessage, []byte(testPairCodes))
+	phone.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := phone.ReadMessage(); err == nil {
+		t.Errorf("Phone received %s", data)
+	}
+
+	r.mu.RLock()
+	pending := len(r.pairing["PAIR3"].pending)
+	r.mu.RUnlock()
+	if pending != 0 {
+		t.Errorf("%d pending PAIRs remain", pending)
+	}
+}
+
+func TestRelaySidePairingEchoesID(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{RelaySidePairing: true, PairRequestTTL: 100 * time.Millisecond})
+	defer cleanup()
+
+	foundry, phone := joinPairingRoom(t, server.URL, "PAIRID")
+	defer foundry.Close()
+	defer phone.Close()
+
+	// A held PAIR keeps its ID until the codes arrive
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"PAIR","id":"req-1","payload":{"code":"1234"}}`))
+	time.Sleep(20 * time.Millisecond)
+	foundry.WriteMessage(websocket.TextMessage, []byte(testPairCodes))
+	for _, conn := range []*websocket.Conn{phone, foundry} {
+		if env := readPairReply(t, conn); env.Type != TypePairSuccess || env.ID != "req-1" {
+			t.Errorf("Reply = %s with ID %q, want PAIR_SUCCESS with req-1", env.Type, env.ID)
+		}
+	}
+
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"PAIR","id":"req-2","payload":{"code":"0000"}}`))
+	if env := readPairReply(t, phone); env.Type != TypePairFailed || env.ID != "req-2" {
+		t.Errorf("Reply = %s with ID %q, want PAIR_FAILED with req-2", env.Type, env.ID)
+	}
+
+	// Without an ID the reply has none
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"PAIR","payload":{"code":"0000"}}`))
+	if env := readPairReply(t, phone); env.ID != "" {
+		t.Errorf("Reply ID = %q, want none", env.ID)
+	}
+}
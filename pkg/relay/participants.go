@@ -0,0 +1,52 @@
+package relay
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxDisplayNameLength caps display names, in characters.
+const maxDisplayNameLength = 32
+
+// sanitizeDisplayName drops non-printable characters, collapses runs of
+// whitespace, and truncates the result to maxDisplayNameLength.
+func sanitizeDisplayName(name string) string {
+	printable := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Join(strings.Fields(printable), " ")
+
+	if runes := []rune(name); len(runes) > maxDisplayNameLength {
+		name = strings.TrimSpace(string(runes[:maxDisplayNameLength]))
+	}
+	return name
+}
+
+// participantsLocked lists the named clients in a room, sorted by name.
+// Callers must hold r.mu.
+func participantsLocked(clients map[*Client]struct{}) []Participant {
+	var list []Participant
+	for c := range clients {
+		c.mu.RLock()
+		name, clientType := c.displayName, c.clientType
+		c.mu.RUnlock()
+		if name == "" {
+			continue
+		}
+		list = append(list, Participant{Name: name, ClientType: string(clientType)})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ClientType < list[j].ClientType
+	})
+	return list
+}
@@ -0,0 +1,94 @@
+package relay
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSanitizeDisplayName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Alice", "Alice"},
+		{"  Alice  ", "Alice"},
+		{"Alice\t\nthe  Bold", "Alice the Bold"},
+		{"Al\x00ice​", "Alice"},
+		{"Zoë 🎲", "Zoë 🎲"},
+		{strings.Repeat("é", 40), strings.Repeat("é", maxDisplayNameLength)},
+		{strings.Repeat("a", 31) + " b", strings.Repeat("a", 31)},
+		{"\x1b[31m", "[31m"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := sanitizeDisplayName(tt.in); got != tt.want {
+			t.Errorf("sanitizeDisplayName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// readUntilParticipants reads messages until a ROOM_STATUS listing
+// exactly want arrives.
+func readUntilParticipants(t *testing.T, conn *websocket.Conn, want []Participant) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var last []Participant
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Waiting for participants %+v (last %+v): %v", want, last, err)
+		}
+		env, err := ParseEnvelope(data)
+		if err != nil || env.Type != TypeRoomStatus {
+			continue
+		}
+		var status RoomStatusPayload
+		if err := json.Unmarshal(env.Payload, &status); err != nil {
+			continue
+		}
+		if last = status.Participants; reflect.DeepEqual(last, want) {
+			return
+		}
+	}
+}
+
+func TestRelayRoomStatusParticipants(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	alice := dialWS(t, server.URL)
+	defer alice.Close()
+	alice.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"NAMES1"}}`))
+	consumeRoomStatus(t, alice)
+	alice.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone","displayName":"Alice"}}`))
+	readUntilParticipants(t, alice, []Participant{{Name: "Alice", ClientType: "phone"}})
+
+	bob := dialWS(t, server.URL)
+	defer bob.Close()
+	bob.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"NAMES1"}}`))
+	readUntilParticipants(t, bob, []Participant{{Name: "Alice", ClientType: "phone"}})
+	bob.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone","displayName":"  Bob\u0007 "}}`))
+
+	both := []Participant{
+		{Name: "Alice", ClientType: "phone"},
+		{Name: "Bob", ClientType: "phone"},
+	}
+	readUntilParticipants(t, alice, both)
+	readUntilParticipants(t, bob, both)
+
+	// Renaming alone updates the list
+	bob.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone","displayName":"Robert"}}`))
+	renamed := []Participant{
+		{Name: "Alice", ClientType: "phone"},
+		{Name: "Robert", ClientType: "phone"},
+	}
+	readUntilParticipants(t, alice, renamed)
+
+	// Leaving removes the name
+	bob.Close()
+	readUntilParticipants(t, alice, []Participant{{Name: "Alice", ClientType: "phone"}})
+}
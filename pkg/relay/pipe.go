@@ -0,0 +1,65 @@
+package relay
+
+import (
+	"io"
+	"sync"
+)
+
+// Pipe returns the two ends of an in-memory ClientConn, for serving a
+// client inside the same program, such as a bot or a test. Pass one end
+// to HandleClient and use the other as the client. Writes block until the
+// other end reads them. Closing either end closes both, and later reads
+// and writes fail with io.ErrClosedPipe.
+func Pipe() (ClientConn, ClientConn) {
+	p := &pipe{done: make(chan struct{})}
+	a, b := make(chan pipeFrame), make(chan pipeFrame)
+	return &pipeConn{p: p, in: a, out: b}, &pipeConn{p: p, in: b, out: a}
+}
+
+// pipe is the state shared by both ends of a Pipe.
+type pipe struct {
+	once sync.Once
+	done chan struct{}
+}
+
+// pipeFrame is one message in flight through a Pipe.
+type pipeFrame struct {
+	messageType int
+	data        []byte
+}
+
+// pipeConn is one end of a Pipe.
+type pipeConn struct {
+	p   *pipe
+	in  <-chan pipeFrame
+	out chan<- pipeFrame
+}
+
+func (pc *pipeConn) ReadMessage() (int, []byte, error) {
+	select {
+	case f := <-pc.in:
+		return f.messageType, f.data, nil
+	case <-pc.p.done:
+		return 0, nil, io.ErrClosedPipe
+	}
+}
+
+func (pc *pipeConn) WriteMessage(messageType int, data []byte) error {
+	// Check first so a write after Close never races a waiting reader
+	select {
+	case <-pc.p.done:
+		return io.ErrClosedPipe
+	default:
+	}
+	select {
+	case pc.out <- pipeFrame{messageType, append([]byte(nil), data...)}:
+		return nil
+	case <-pc.p.done:
+		return io.ErrClosedPipe
+	}
+}
+
+func (pc *pipeConn) Close() error {
+	pc.p.once.Do(func() { close(pc.p.done) })
+	return nil
+}
@@ -0,0 +1,124 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readPipe reads one message from a Pipe end, failing after a second.
+func readPipe(t *testing.T, conn ClientConn) *Envelope {
+	t.Helper()
+	type result struct {
+		data []byte
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		_, data, err := conn.ReadMessage()
+		ch <- result{data, err}
+	}()
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			t.Fatalf("Pipe read failed: %v", res.err)
+		}
+		env, err := ParseEnvelope(res.data)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", res.data, err)
+		}
+		return env
+	case <-time.After(time.Second):
+		t.Fatal("Timed out reading from pipe")
+		return nil
+	}
+}
+
+// servePipe runs HandleClient on one end of a new Pipe and returns the
+// other end, plus a channel closed when HandleClient returns.
+func servePipe(r *Relay) (ClientConn, <-chan struct{}) {
+	server, client := Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.HandleClient(server)
+	}()
+	return client, done
+}
+
+func TestPipe(t *testing.T) {
+	a, b := Pipe()
+	go a.WriteMessage(websocket.BinaryMessage, []byte("hello"))
+	frameType, data, err := b.ReadMessage()
+	if err != nil || frameType != websocket.BinaryMessage || string(data) != "hello" {
+		t.Fatalf("ReadMessage = %d, %q, %v", frameType, data, err)
+	}
+
+	b.Close()
+	if _, _, err := a.ReadMessage(); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("ReadMessage after Close = %v, want io.ErrClosedPipe", err)
+	}
+	if err := a.WriteMessage(websocket.TextMessage, nil); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("WriteMessage after Close = %v, want io.ErrClosedPipe", err)
+	}
+}
+
+func TestRelayPipeLifecycle(t *testing.T) {
+	_, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	foundry, foundryDone := servePipe(r)
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"PIPE01"}}`))
+	if env := readPipe(t, foundry); env.Type != TypeRoomStatus {
+		t.Fatalf("Expected ROOM_STATUS, got %s", env.Type)
+	}
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry"}}`))
+
+	phone, phoneDone := servePipe(r)
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"PIPE01"}}`))
+	for {
+		env := readPipe(t, phone)
+		var status RoomStatusPayload
+		if env.Type == TypeRoomStatus && json.Unmarshal(env.Payload, &status) == nil && status.FoundryConnected {
+			break
+		}
+	}
+
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"MOVE","payload":{"tokenId":"tok1","direction":"up"}}`))
+	for {
+		env := readPipe(t, foundry)
+		if env.Type != TypeMove {
+			continue
+		}
+		var move MovePayload
+		if err := json.Unmarshal(env.Payload, &move); err != nil || move.TokenID != "tok1" {
+			t.Fatalf("Unexpected MOVE payload %s", env.Payload)
+		}
+		break
+	}
+
+	// Leaving: the phone sees Foundry go, then both handlers return
+	foundry.Close()
+	for {
+		env := readPipe(t, phone)
+		var status RoomStatusPayload
+		if env.Type == TypeRoomStatus && json.Unmarshal(env.Payload, &status) == nil && !status.FoundryConnected {
+			break
+		}
+	}
+	phone.Close()
+	for _, done := range []<-chan struct{}{foundryDone, phoneDone} {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("HandleClient did not return after its pipe closed")
+		}
+	}
+	if n := r.ClientCount(); n != 0 {
+		t.Errorf("ClientCount = %d after both left, want 0", n)
+	}
+}
@@ -0,0 +1,43 @@
+package relay
+
+import "sort"
+
+// sendPresenceLocked broadcasts the room's roster to every client in it
+// when Config.PresenceEnabled is set. Clients whose send buffer is full
+// miss it, as with ROOM_STATUS. Callers must hold r.mu.
+func (r *Relay) sendPresenceLocked(room string) {
+	if !r.config.PresenceEnabled {
+		return
+	}
+	clients, ok := r.rooms[room]
+	if !ok {
+		return
+	}
+
+	roster := make([]PresenceEntry, 0, len(clients))
+	for c := range clients {
+		c.mu.RLock()
+		roster = append(roster, PresenceEntry{
+			ID:          c.id,
+			Type:        c.clientType,
+			DisplayName: c.displayName,
+			ConnectedAt: c.connectedAt,
+		})
+		c.mu.RUnlock()
+	}
+	sort.Slice(roster, func(i, j int) bool {
+		if !roster[i].ConnectedAt.Equal(roster[j].ConnectedAt) {
+			return roster[i].ConnectedAt.Before(roster[j].ConnectedAt)
+		}
+		return roster[i].ID < roster[j].ID
+	})
+
+	msg, err := MakeEnvelope(TypePresence, PresencePayload{Participants: roster})
+	if err != nil {
+		r.log(LogError, "Failed to send room %s presence: %v", room, err)
+		return
+	}
+	for c := range clients {
+		c.trySend(msg)
+	}
+}
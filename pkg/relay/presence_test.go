@@ -0,0 +1,111 @@
+package relay
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readUntilPresence reads messages until a PRESENCE listing n clients
+// arrives and returns its roster.
+func readUntilPresence(t *testing.T, conn *websocket.Conn, n int) []PresenceEntry {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Waiting for PRESENCE of %d clients: %v", n, err)
+		}
+		env, err := ParseEnvelope(data)
+		if err != nil || env.Type != TypePresence {
+			continue
+		}
+		var p PresencePayload
+		if err := json.Unmarshal(env.Payload, &p); err != nil {
+			t.Fatalf("Invalid PRESENCE payload: %v", err)
+		}
+		if len(p.Participants) == n {
+			return p.Participants
+		}
+	}
+}
+
+func TestRelayPresence(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{PresenceEnabled: true})
+	defer cleanup()
+
+	alice := dialWS(t, server.URL)
+	defer alice.Close()
+	alice.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"PRES1"}}`))
+	readUntilPresence(t, alice, 1)
+	alice.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry","displayName":"Alice"}}`))
+
+	bob := dialWS(t, server.URL)
+	defer bob.Close()
+	bob.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"PRES1"}}`))
+	readUntilPresence(t, bob, 2)
+	bob.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone","displayName":"Bob"}}`))
+	readUntilPresence(t, alice, 2)
+
+	// A third client joining sends every existing client the full roster
+	carol := dialWS(t, server.URL)
+	defer carol.Close()
+	carol.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"PRES1"}}`))
+
+	for _, conn := range []*websocket.Conn{alice, bob, carol} {
+		roster := readUntilPresence(t, conn, 3)
+		want := []struct {
+			clientType ClientType
+			name       string
+		}{
+			{ClientTypeFoundry, "Alice"},
+			{ClientTypePhone, "Bob"},
+			{ClientTypeUnknown, ""},
+		}
+		for i, w := range want {
+			p := roster[i]
+			if p.Type != w.clientType || p.DisplayName != w.name || p.ID == "" || p.ConnectedAt.IsZero() {
+				t.Errorf("Roster[%d] = %+v, want %s %q with an ID and connection time", i, p, w.clientType, w.name)
+			}
+		}
+	}
+
+	// Identifying and leaving update the roster too
+	carol.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone","displayName":"Carol"}}`))
+	for {
+		if roster := readUntilPresence(t, alice, 3); roster[2].DisplayName == "Carol" {
+			break
+		}
+	}
+	carol.Close()
+	if roster := readUntilPresence(t, alice, 2); roster[1].DisplayName != "Bob" {
+		t.Errorf("Roster after leave = %+v, want Alice and Bob", roster)
+	}
+}
+
+func TestRelayPresenceDisabled(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	a := dialWS(t, server.URL)
+	defer a.Close()
+	a.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"PRES2"}}`))
+	consumeRoomStatus(t, a)
+	b := dialWS(t, server.URL)
+	defer b.Close()
+	b.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"PRES2"}}`))
+	b.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone","displayName":"Bob"}}`))
+
+	a.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	for {
+		_, data, err := a.ReadMessage()
+		if err != nil {
+			break
+		}
+		if env, err := ParseEnvelope(data); err == nil && env.Type == TypePresence {
+			t.Fatalf("Got PRESENCE with presence disabled: %s", data)
+		}
+	}
+}
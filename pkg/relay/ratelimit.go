@@ -0,0 +1,68 @@
+package relay
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultMaxRateViolations is how many consecutive rate-limited messages a
+// client may send before it is disconnected.
+const defaultMaxRateViolations = 10
+
+// tokenBucket is a simple token-bucket rate limiter.
+// Tokens refill continuously at rate per second up to burst.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time // Injectable clock for tests
+}
+
+// newTokenBucket creates a full bucket allowing rate messages per second.
+// Burst is the bucket capacity; values below 1 are raised to 1.
+func newTokenBucket(rate, burst float64, now func() time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   now(),
+		now:    now,
+	}
+}
+
+// allow consumes a token if one is available.
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// lastUsed returns the time of the bucket's last allow call, or its
+// creation.
+func (b *tokenBucket) lastUsed() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last
+}
@@ -0,0 +1,114 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeClock is a manually advanced clock for deterministic tests.
+type fakeClock struct {
+	t time.Time
+}
+
+func (f *fakeClock) now() time.Time { return f.t }
+
+func (f *fakeClock) advance(d time.Duration) { f.t = f.t.Add(d) }
+
+func TestTokenBucketRefill(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := newTokenBucket(2, 2, clock.now)
+
+	// Full bucket allows burst
+	if !b.allow() || !b.allow() {
+		t.Fatal("Expected burst of 2 to be allowed")
+	}
+	if b.allow() {
+		t.Fatal("Expected empty bucket to reject")
+	}
+
+	// Half a second at 2/s refills exactly one token
+	clock.advance(500 * time.Millisecond)
+	if !b.allow() {
+		t.Error("Expected one token after 500ms")
+	}
+	if b.allow() {
+		t.Error("Expected bucket empty again")
+	}
+
+	// Partial refill is not enough
+	clock.advance(250 * time.Millisecond)
+	if b.allow() {
+		t.Error("Expected half a token to be insufficient")
+	}
+	clock.advance(250 * time.Millisecond)
+	if !b.allow() {
+		t.Error("Expected accumulated partial tokens to allow")
+	}
+
+	// Long idle caps at burst
+	clock.advance(time.Hour)
+	for i := 0; i < 2; i++ {
+		if !b.allow() {
+			t.Errorf("Expected token %d after idle", i)
+		}
+	}
+	if b.allow() {
+		t.Error("Expected refill to be capped at burst")
+	}
+}
+
+func TestTokenBucketMinimumBurst(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := newTokenBucket(0.5, 0, clock.now)
+
+	if !b.allow() {
+		t.Fatal("Expected burst to be raised to 1")
+	}
+	clock.advance(time.Second)
+	if b.allow() {
+		t.Error("Expected half a token after 1s at 0.5/s")
+	}
+	clock.advance(time.Second)
+	if !b.allow() {
+		t.Error("Expected token after 2s at 0.5/s")
+	}
+}
+
+func TestRelayRateLimitDisconnect(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{
+		MaxMessagesPerSecond: 1,
+		MaxRateViolations:    3,
+	})
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"RATE1"}}`))
+	consumeRoomStatus(t, conn)
+
+	// First message uses the burst, next three are violations
+	moveMsg := []byte(`{"type":"MOVE","payload":{"direction":"up"}}`)
+	for i := 0; i < 4; i++ {
+		conn.WriteMessage(websocket.TextMessage, moveMsg)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, CloseRateLimited) {
+			t.Errorf("Expected close code %d, got %v", CloseRateLimited, err)
+		}
+		break
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if r.ClientCount() != 0 {
+		t.Errorf("ClientCount after rate limit = %d, want 0", r.ClientCount())
+	}
+}
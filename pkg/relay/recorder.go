@@ -0,0 +1,88 @@
+package relay
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// RecordedMessage is one line of a recording written by StartRecording.
+// Recordings are newline-delimited JSON, one message per line.
+type RecordedMessage struct {
+	// Delta is the time since the previous message, or since recording
+	// started for the first, encoded in nanoseconds.
+	Delta    time.Duration   `json:"delta"`
+	Envelope json.RawMessage `json:"envelope"` // as relayed to the room
+}
+
+// recorder writes one room's relayed messages to a writer.
+type recorder struct {
+	mu   sync.Mutex // serializes writes and guards last
+	enc  *json.Encoder
+	last time.Time
+}
+
+// StartRecording writes each message relayed in room to w, as a
+// RecordedMessage per line, until the returned stop func is called or a
+// write fails. It sees the same messages as Config.OnMessage. Writes
+// happen on the sending client's goroutine, so w should be fast, such as
+// a buffered file. The room need not exist yet.
+func (r *Relay) StartRecording(room string, w io.Writer) (stop func()) {
+	room = NormalizeRoomCode(room)
+	rec := &recorder{enc: json.NewEncoder(w), last: time.Now()}
+
+	r.mu.Lock()
+	if r.recordings[room] == nil {
+		r.recordings[room] = make(map[*recorder]struct{})
+	}
+	r.recordings[room][rec] = struct{}{}
+	r.mu.Unlock()
+	r.log(LogInfo, "Recording room %s", room)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.stopRecording(room, rec)
+			r.log(LogInfo, "Stopped recording room %s", room)
+		})
+	}
+}
+
+// stopRecording removes rec from room's recorders.
+func (r *Relay) stopRecording(room string, rec *recorder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.recordings[room], rec)
+	if len(r.recordings[room]) == 0 {
+		delete(r.recordings, room)
+	}
+}
+
+// record writes data, a relayed envelope, to room's recorders. A
+// recorder whose writer fails is stopped.
+func (r *Relay) record(room string, data []byte) {
+	r.mu.RLock()
+	recs := make([]*recorder, 0, len(r.recordings[room]))
+	for rec := range r.recordings[room] {
+		recs = append(recs, rec)
+	}
+	r.mu.RUnlock()
+
+	for _, rec := range recs {
+		if err := rec.write(data); err != nil {
+			r.log(LogError, "Stopping recording of room %s: %v", room, err)
+			r.stopRecording(room, rec)
+		}
+	}
+}
+
+// write appends one message to the recording.
+func (rec *recorder) write(data []byte) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	now := time.Now()
+	delta := now.Sub(rec.last)
+	rec.last = now
+	return rec.enc.Encode(RecordedMessage{Delta: delta, Envelope: data})
+}
@@ -0,0 +1,122 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// messages decodes the recording written so far.
+func (b *lockedBuffer) messages(t *testing.T) []RecordedMessage {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var msgs []RecordedMessage
+	scanner := bufio.NewScanner(bytes.NewReader(b.buf.Bytes()))
+	for scanner.Scan() {
+		var m RecordedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			t.Fatalf("Invalid recording line %q: %v", scanner.Bytes(), err)
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs
+}
+
+// sendAndEcho sends msg and waits for the relay to echo it back.
+func sendAndEcho(t *testing.T, conn *websocket.Conn, msg string) {
+	t.Helper()
+	conn.WriteMessage(websocket.TextMessage, []byte(msg))
+	readUntilMessage(t, conn, msg)
+}
+
+func TestRelayStartRecording(t *testing.T) {
+	server, relay, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	var rec lockedBuffer
+	stop := relay.StartRecording("rec1", &rec)
+
+	a := dialWS(t, server.URL)
+	defer a.Close()
+	a.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"REC1"}}`))
+	consumeRoomStatus(t, a)
+	b := dialWS(t, server.URL)
+	defer b.Close()
+	b.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"REC2"}}`))
+	consumeRoomStatus(t, b)
+
+	sendAndEcho(t, a, `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`)
+	sendAndEcho(t, b, `{"type":"MOVE","payload":{"direction":"left","tokenId":"tok1"}}`)
+	time.Sleep(20 * time.Millisecond)
+	sendAndEcho(t, a, `{"type":"MOVE","payload":{"direction":"down","tokenId":"tok1"}}`)
+
+	stop()
+	sendAndEcho(t, a, `{"type":"MOVE","payload":{"direction":"right","tokenId":"tok1"}}`)
+
+	msgs := rec.messages(t)
+	if len(msgs) != 2 {
+		t.Fatalf("Recorded %d messages, want 2: %+v", len(msgs), msgs)
+	}
+	for i, want := range []string{"up", "down"} {
+		env, err := ParseEnvelope(msgs[i].Envelope)
+		if err != nil {
+			t.Fatalf("Recorded envelope %d: %v", i, err)
+		}
+		var move MovePayload
+		json.Unmarshal(env.Payload, &move)
+		if env.Type != TypeMove || move.Direction != want {
+			t.Errorf("Recorded %d = %s %+v, want MOVE %s", i, env.Type, move, want)
+		}
+	}
+	if msgs[1].Delta < 20*time.Millisecond {
+		t.Errorf("Second delta = %v, want at least 20ms", msgs[1].Delta)
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{ writes int }
+
+func (w *failingWriter) Write([]byte) (int, error) {
+	w.writes++
+	return 0, errors.New("disk full")
+}
+
+func TestRelayRecordingWriteError(t *testing.T) {
+	server, relay, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	w := &failingWriter{}
+	defer relay.StartRecording("REC3", w)()
+
+	a := dialWS(t, server.URL)
+	defer a.Close()
+	a.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"REC3"}}`))
+	consumeRoomStatus(t, a)
+	for range 2 {
+		sendAndEcho(t, a, `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`)
+	}
+
+	// The failed recording is dropped after its first write
+	if w.writes != 1 {
+		t.Errorf("Writer got %d writes, want 1", w.writes)
+	}
+}
@@ -1,30 +1,50 @@
 package relay
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"regexp"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/nats-io/nats.go"
-)
 
-// WebSocket close codes for protocol errors.
-const (
-	CloseProtocolError   = 4001
-	CloseInvalidRoom     = 4002
-	CloseSubscribeFailed = 4003
+	"github.com/sam-phinizy/vtt-remote/pkg/roomcode"
 )
 
 // roomCodeRegex validates room codes: 4-8 alphanumeric characters.
 var roomCodeRegex = regexp.MustCompile(`^[a-zA-Z0-9]{4,8}$`)
 
+// newID returns a random 128-bit hex identifier, used for client IDs and
+// resume tokens.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
 // ValidateRoomCode checks if a room code is valid.
 func ValidateRoomCode(code string) bool {
 	return roomCodeRegex.MatchString(code)
 }
 
+// NormalizeRoomCode returns the canonical (uppercase) form of a room code.
+// Room codes are case-insensitive, so "game1" and "GAME1" are the same room.
+func NormalizeRoomCode(code string) string {
+	return strings.ToUpper(code)
+}
+
 // ClientType identifies whether a client is Foundry or a phone.
 type ClientType string
 
@@ -38,15 +58,394 @@ const (
 type LogLevel string
 
 const (
+	LogDebug LogLevel = "debug"
 	LogInfo  LogLevel = "info"
 	LogWarn  LogLevel = "warn"
 	LogError LogLevel = "error"
 )
 
+// ParseLogLevel returns the LogLevel named by s, ignoring case.
+func ParseLogLevel(s string) (LogLevel, error) {
+	level := LogLevel(strings.ToLower(strings.TrimSpace(s)))
+	switch level {
+	case LogDebug, LogInfo, LogWarn, LogError:
+		return level, nil
+	}
+	return "", fmt.Errorf("unknown log level %q (want debug, info, warn, or error)", s)
+}
+
+// AtLeast reports whether l is as severe as min or more. Levels order
+// debug < info < warn < error; an unknown level ranks as info, and an
+// empty min allows everything.
+func (l LogLevel) AtLeast(min LogLevel) bool {
+	return min == "" || l.rank() >= min.rank()
+}
+
+// rank orders levels for AtLeast.
+func (l LogLevel) rank() int {
+	switch l {
+	case LogDebug:
+		return 0
+	case LogWarn:
+		return 2
+	case LogError:
+		return 3
+	}
+	return 1
+}
+
+// OverflowPolicy decides what happens when a client's send buffer is full.
+type OverflowPolicy string
+
+const (
+	// DropMessage discards the message and keeps the client connected.
+	DropMessage OverflowPolicy = "drop"
+	// DisconnectClient closes the client with CloseSlowClient so it can
+	// reconnect with a clean state instead of silently missing messages.
+	DisconnectClient OverflowPolicy = "disconnect"
+)
+
 // Config holds relay configuration.
 type Config struct {
 	NatsURL string
 	OnLog   func(level LogLevel, message string) // Optional log callback
+
+	// NatsMaxReconnects caps reconnect attempts after the NATS connection
+	// drops. Zero (the default) retries forever.
+	NatsMaxReconnects int
+	// NatsReconnectWait is the pause between reconnect attempts.
+	// Defaults to 2s.
+	NatsReconnectWait time.Duration
+	// NatsReconnectBufSize is how many bytes of publishes are buffered
+	// while disconnected. Defaults to 8MB.
+	NatsReconnectBufSize int
+
+	// OnLogStructured, if set, receives each log event with context fields
+	// such as "room", "clientType", and "remoteAddr". It is called in
+	// addition to OnLog.
+	OnLogStructured func(level LogLevel, message string, fields map[string]any)
+	// MinLogLevel drops log events less severe than it before they reach
+	// OnLog or OnLogStructured. Empty (the default) passes everything.
+	MinLogLevel LogLevel
+
+	// MaxMessagesPerSecond limits how fast each client may publish.
+	// Zero (the default) means unlimited.
+	MaxMessagesPerSecond float64
+	// MaxRateViolations is how many consecutive rate-limited messages are
+	// dropped before the client is disconnected. Defaults to 10.
+	MaxRateViolations int
+	// DedupWindow, if set, drops a client message that is byte-identical
+	// to the client's previous one within this long of it, such as
+	// repeats from a sticky d-pad. A steady stream of repeats still passes
+	// one copy per window. Zero (the default) relays every message.
+	DedupWindow time.Duration
+
+	// PingInterval is how often a WebSocket ping is sent to each client.
+	// Defaults to 30s.
+	PingInterval time.Duration
+	// PongTimeout is how long to wait for any message or pong before the
+	// connection is considered dead. Defaults to twice PingInterval.
+	PongTimeout time.Duration
+	// WriteTimeout bounds each WebSocket write. A client whose connection
+	// stops draining for this long is disconnected. Defaults to 30s.
+	WriteTimeout time.Duration
+	// ReadTimeout, if set, disconnects clients that send no messages for
+	// this long, even if they still answer pings. Zero (the default)
+	// leaves idle but live clients connected.
+	ReadTimeout time.Duration
+	// JoinTimeout is how long a new connection has to send its JOIN
+	// before it is closed. Defaults to 10s.
+	JoinTimeout time.Duration
+
+	// MaxTrackedRooms caps how many rooms get per-room metric labels.
+	// Defaults to 100.
+	MaxTrackedRooms int
+
+	// StampSequence adds a per-room monotonic Seq to relayed MOVE
+	// envelopes so receivers can discard stale moves.
+	StampSequence bool
+	// StampServerTime adds the relay's clock, in Unix milliseconds, to
+	// every relayed envelope as ServerTime. Off by default, so messages
+	// are relayed byte for byte unless another option rewrites them.
+	StampServerTime bool
+
+	// SubjectPrefix namespaces the relay's NATS subjects, which are
+	// "<prefix>.<ROOM>". Relays sharing a NATS server with different
+	// prefixes never see each other's rooms. It must be one or more
+	// dot-separated NATS tokens without wildcards. Defaults to "game".
+	SubjectPrefix string
+
+	// EchoToSender controls whether clients receive their own relayed
+	// messages, as NATS fans each message out to every client in the room,
+	// sender included. Nil means true. When false, published messages carry
+	// the sender's ID in a NATS header, which each subscription checks.
+	EchoToSender *bool
+
+	// AlwaysPublish publishes every client message to NATS, even when its
+	// sender is alone in the room. By default such messages skip NATS,
+	// since no other client of this relay could receive them. Set it when
+	// other relays or subscribers share the NATS server's room subjects.
+	AlwaysPublish bool
+
+	// OrderedRooms funnels each room's client messages through a single
+	// goroutine that stamps, observes, and publishes them one at a time,
+	// so every subscriber sees the room's messages in the same total
+	// order, including across senders. Each message waits for those ahead
+	// of it, adding a goroutine handoff of latency and letting one slow
+	// publish delay the whole room; clients alone in a room publish to
+	// NATS rather than taking the fast path.
+	OrderedRooms bool
+
+	// MinProtoVersion and MaxProtoVersion bound the protocol versions
+	// accepted in JOIN. Default to MinProtocolVersion/MaxProtocolVersion.
+	MinProtoVersion int
+	MaxProtoVersion int
+
+	// MaxClientsPerRoom caps how many clients may join one room.
+	// Zero (the default) means unlimited.
+	MaxClientsPerRoom int
+	// MaxRooms caps how many rooms may exist at once. Joining an existing
+	// room is always allowed. Zero (the default) means unlimited.
+	MaxRooms int
+
+	// MaxMessageBytes is the largest message relayed. Larger messages are
+	// dropped; frames over 4x this size are rejected by the WebSocket
+	// layer. Defaults to 64KB.
+	MaxMessageBytes int
+
+	// EnableCompression allows permessage-deflate on client connections.
+	// The WebSocket upgrader must also have EnableCompression set; see
+	// Relay.CompressionEnabled. Clients may opt out in JOIN.
+	EnableCompression bool
+
+	// AllowedMessageTypes is the set of types clients may relay. Other
+	// types are dropped. Defaults to every known protocol type; to extend
+	// it, list the known types plus any custom ones.
+	AllowedMessageTypes []MessageType
+
+	// AuthToken, if set, is the shared secret WebSocket clients must
+	// present; see Relay.Authorize. Empty (the default) disables auth.
+	AuthToken string
+
+	// ResumeTTL, if set, enables resume tokens: each client receives a
+	// RESUME_TOKEN on join which it may present in a later JOIN, up to
+	// ResumeTTL after disconnecting, to restore its client type. Zero
+	// (the default) disables resumption.
+	ResumeTTL time.Duration
+
+	// SendBufferSize is how many outbound messages are queued per client.
+	// Defaults to 64.
+	SendBufferSize int
+
+	// BatchWrites lets clients that ask for it in JOIN receive bursts of
+	// queued messages as one BATCH frame instead of one frame each.
+	BatchWrites bool
+	// MaxBatchSize caps the messages in one BATCH. Defaults to 32.
+	MaxBatchSize int
+	// BatchWindow is how long the writer waits for more messages after
+	// the first before sending a batch. Defaults to 2ms.
+	BatchWindow time.Duration
+	// OverflowPolicy applies when a client's send buffer is full.
+	// Defaults to DropMessage.
+	OverflowPolicy OverflowPolicy
+
+	// IdleRoomTimeout, if set, closes every client in a room (with
+	// CloseIdle) once no message has been relayed in it for this long.
+	// Zero (the default) disables idle reaping.
+	IdleRoomTimeout time.Duration
+
+	// HistorySize, if set, keeps the last HistorySize relayed messages of
+	// the HistoryTypes per room and replays them to each client once it
+	// has joined and identified. Zero (the default) disables history.
+	HistorySize int
+	// HistoryTypes are the message types recorded for replay. They should
+	// be idempotent. Defaults to ROOM_STATUS and PAIR_SUCCESS.
+	HistoryTypes []MessageType
+
+	// MaxMoveDistance caps MovePayload.Distance; larger values are
+	// clamped before relaying. Defaults to 10.
+	MaxMoveDistance int
+
+	// SingleFoundryPerRoom rejects an IDENTIFY as Foundry while another
+	// client in the room already holds that role; the rejected client
+	// gets an IDENTIFY_FAILED and keeps its previous type.
+	SingleFoundryPerRoom bool
+
+	// PresenceEnabled broadcasts a PRESENCE roster of every client in a
+	// room, with IDs, types, display names, and connection times,
+	// whenever a client joins, leaves, or changes its identity. It is off
+	// by default because each change sends the whole roster to the room.
+	PresenceEnabled bool
+	// DisconnectDuplicateFoundry also closes rejected clients with
+	// CloseDuplicateFoundry. It only applies with SingleFoundryPerRoom.
+	DisconnectDuplicateFoundry bool
+
+	// AllowRoomSwitch lets a JOIN sent after the handshake move the
+	// client to another room on the same connection. When false (the
+	// default) such JOINs are ignored.
+	AllowRoomSwitch bool
+
+	// ReservationTTL is how long a code from ReserveRoom stays reserved
+	// if nobody joins it. Defaults to 2m.
+	ReservationTTL time.Duration
+	// RoomCodeMode is the style of codes ReserveRoom generates.
+	// Defaults to roomcode.Alphanumeric.
+	RoomCodeMode roomcode.Mode
+	// RequireReservationKey limits a reserved code to the JOIN carrying
+	// its reservation key. Otherwise anyone may claim it by joining.
+	RequireReservationKey bool
+
+	// RelaySideDice makes the relay roll ROLL_DICE formulas itself when
+	// the room has no Foundry, replying with ROLL_DICE_RESULT to the
+	// requester only. Foundry-specific formula syntax is not supported.
+	RelaySideDice bool
+
+	// RelaySidePairing makes the relay answer PAIR itself, matching codes
+	// against the list the room's Foundry sends with PAIR_CODES, instead
+	// of relaying PAIR to Foundry.
+	RelaySidePairing bool
+	// PairRequestTTL is how long a PAIR waits for the room's first
+	// PAIR_CODES before failing. Defaults to 30s.
+	PairRequestTTL time.Duration
+
+	// ServerVersion, if set, is included in every ROOM_STATUS so clients
+	// can warn about a version mismatch.
+	ServerVersion string
+
+	// OnClientEvent, if set, is called when a client joins, identifies,
+	// or leaves a room. It runs on the client's goroutine without relay
+	// locks held, so it may call back into the Relay.
+	OnClientEvent func(ClientEvent)
+
+	// OnMessage, if set, is called with each client message the relay
+	// publishes, after validation and any relay-side rewriting. Calls run
+	// one at a time on a separate goroutine fed by a bounded queue, so a
+	// slow handler never delays relaying; messages arriving while the
+	// queue is full are not observed. The envelope is shared and must not
+	// be modified.
+	OnMessage func(room string, env *Envelope)
+
+	// Middleware, if set, runs in order on each validated client message
+	// before the relay handles or publishes it. Any middleware may rewrite
+	// the envelope or drop the message; see Middleware. It runs on the
+	// sender's read goroutine, so it should be fast.
+	Middleware []Middleware
+}
+
+// closeDrainTimeout is how long Close waits for client goroutines.
+const closeDrainTimeout = 5 * time.Second
+
+// Default keepalive settings.
+const (
+	defaultPingInterval = 30 * time.Second
+	defaultWriteTimeout = 30 * time.Second
+	defaultJoinTimeout  = 10 * time.Second
+)
+
+// defaultSendBufferSize is the per-client outbound queue length.
+const defaultSendBufferSize = 64
+
+// defaultMaxMoveDistance is the default cap on squares moved per MOVE.
+const defaultMaxMoveDistance = 10
+
+// minIdentifyInterval is how often a client may change its type.
+const minIdentifyInterval = time.Second
+
+// senderHeader is the NATS header holding the publishing client's ID
+// when Config.EchoToSender is false.
+const senderHeader = "Vtt-Sender"
+
+// Message size limits.
+const (
+	defaultMaxMessageBytes = 64 * 1024
+	readLimitMultiplier    = 4 // transport limit relative to MaxMessageBytes
+	maxSizeViolations      = 3 // consecutive oversized messages before disconnect
+)
+
+// withDefaults returns a copy of the config with zero values filled in.
+func (cfg Config) withDefaults() Config {
+	if cfg.EchoToSender == nil {
+		echo := true
+		cfg.EchoToSender = &echo
+	}
+	if cfg.MaxRateViolations <= 0 {
+		cfg.MaxRateViolations = defaultMaxRateViolations
+	}
+	if cfg.PingInterval <= 0 {
+		cfg.PingInterval = defaultPingInterval
+	}
+	if cfg.PongTimeout <= 0 {
+		cfg.PongTimeout = 2 * cfg.PingInterval
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = defaultWriteTimeout
+	}
+	if cfg.JoinTimeout <= 0 {
+		cfg.JoinTimeout = defaultJoinTimeout
+	}
+	if cfg.MaxTrackedRooms <= 0 {
+		cfg.MaxTrackedRooms = defaultMaxTrackedRooms
+	}
+	if cfg.MinProtoVersion <= 0 {
+		cfg.MinProtoVersion = MinProtocolVersion
+	}
+	if cfg.MaxProtoVersion <= 0 {
+		cfg.MaxProtoVersion = MaxProtocolVersion
+	}
+	if cfg.MaxMessageBytes <= 0 {
+		cfg.MaxMessageBytes = defaultMaxMessageBytes
+	}
+	if cfg.SendBufferSize <= 0 {
+		cfg.SendBufferSize = defaultSendBufferSize
+	}
+	if cfg.MaxBatchSize <= 0 {
+		cfg.MaxBatchSize = defaultMaxBatchSize
+	}
+	if cfg.BatchWindow <= 0 {
+		cfg.BatchWindow = defaultBatchWindow
+	}
+	if cfg.OverflowPolicy == "" {
+		cfg.OverflowPolicy = DropMessage
+	}
+	if cfg.MaxMoveDistance <= 0 {
+		cfg.MaxMoveDistance = defaultMaxMoveDistance
+	}
+	if len(cfg.HistoryTypes) == 0 {
+		cfg.HistoryTypes = defaultHistoryTypes
+	}
+	if cfg.ReservationTTL <= 0 {
+		cfg.ReservationTTL = defaultReservationTTL
+	}
+	if cfg.PairRequestTTL <= 0 {
+		cfg.PairRequestTTL = defaultPairRequestTTL
+	}
+	if cfg.SubjectPrefix == "" {
+		cfg.SubjectPrefix = defaultSubjectPrefix
+	}
+	if cfg.NatsMaxReconnects == 0 {
+		cfg.NatsMaxReconnects = -1
+	}
+	if cfg.NatsReconnectWait <= 0 {
+		cfg.NatsReconnectWait = nats.DefaultReconnectWait
+	}
+	if cfg.NatsReconnectBufSize <= 0 {
+		cfg.NatsReconnectBufSize = nats.DefaultReconnectBufSize
+	}
+	return cfg
+}
+
+// defaultSubjectPrefix is the NATS subject prefix for room traffic.
+const defaultSubjectPrefix = "game"
+
+// validateSubjectPrefix checks that prefix is one or more dot-separated
+// NATS tokens, none empty or containing whitespace or wildcards.
+func validateSubjectPrefix(prefix string) error {
+	for _, token := range strings.Split(prefix, ".") {
+		if token == "" || strings.ContainsAny(token, "*> \t\r\n") {
+			return fmt.Errorf("invalid NATS subject prefix %q", prefix)
+		}
+	}
+	return nil
 }
 
 // Stats contains relay statistics.
@@ -55,151 +454,591 @@ type Stats struct {
 	ClientCount  int
 	FoundryCount int
 	PhoneCount   int
+
+	// AverageSessionDuration is the mean time currently connected
+	// clients have been connected (zero when there are none).
+	AverageSessionDuration time.Duration
+
+	// MessagesRelayed, BytesRelayed, and SlowClientDrops count relayed
+	// traffic since the relay started.
+	MessagesRelayed uint64
+	BytesRelayed    uint64
+	SlowClientDrops uint64
+
+	// Rooms breaks the counts down by room code.
+	Rooms map[string]RoomStats
+}
+
+// RoomStats contains statistics for one room.
+type RoomStats struct {
+	ClientCount  int
+	FoundryCount int
+	PhoneCount   int
+
+	// LastActivity is when a message was last relayed in the room, or
+	// when the room was created if none has been.
+	LastActivity time.Time
+
+	// MessagesRelayed, BytesRelayed, and SlowClientDrops count the room's
+	// traffic. They are zero for rooms beyond MaxTrackedRooms.
+	MessagesRelayed uint64
+	BytesRelayed    uint64
+	SlowClientDrops uint64
+}
+
+// RoomInfo is a point-in-time summary of one room.
+type RoomInfo struct {
+	Room             string       `json:"room"`
+	FoundryConnected bool         `json:"foundryConnected"`
+	PhoneCount       int          `json:"phoneCount"`
+	Clients          []ClientInfo `json:"clients"`
+
+	// Traffic counters, as in RoomStats
+	MessagesRelayed uint64 `json:"messagesRelayed"`
+	BytesRelayed    uint64 `json:"bytesRelayed"`
+	SlowClientDrops uint64 `json:"slowClientDrops"`
+}
+
+// ClientInfo summarizes a connected client.
+type ClientInfo struct {
+	ID           string        `json:"id"`
+	Type         ClientType    `json:"type"`
+	ConnectedAt  time.Time     `json:"connectedAt"`
+	Duration     time.Duration `json:"duration"`     // Time connected as of the snapshot
+	DroppedCount uint64        `json:"droppedCount"` // Messages dropped because its send buffer was full
 }
 
 // Client represents a connected WebSocket client.
 type Client struct {
-	conn       *websocket.Conn
-	room       string
-	sub        *nats.Subscription
-	sendChan   chan []byte
-	relay      *Relay
-
-	mu         sync.RWMutex
-	clientType ClientType
-	closed     bool // true when sendChan is closed
+	id          string          // stable random ID for admin APIs
+	ctx         context.Context // from HandleClientContext; cancelling it closes the client
+	conn        clientConn
+	room        string    // set in JOIN; switchRoom changes it holding r.mu and mu
+	connectedAt time.Time // set once in HandleClient
+	sendChan    chan []byte
+	relay       *Relay
+
+	protoVersion   int          // negotiated in JOIN or pinned by subprotocol, immutable afterwards
+	encoding       Encoding     // negotiated in JOIN, immutable afterwards
+	compress       bool         // write compression requested, fixed in JOIN
+	batch          bool         // BATCH frames allowed, fixed in JOIN
+	password       string       // from JOIN, cleared once registered; never logged
+	reservationKey string       // from JOIN, cleared once registered
+	resumeToken    string       // issued or redeemed at join (empty if resume is disabled)
+	limiter        *tokenBucket // nil when rate limiting is disabled
+	rateViolations int          // consecutive dropped messages (readPump only)
+	sizeViolations int          // consecutive oversized messages (readPump only)
+	typeChangedAt  time.Time    // last IDENTIFY that changed clientType (readPump only)
+	lastHash       uint64       // hash of the last message passed for relaying (readPump only)
+	lastHashAt     time.Time    // when lastHash was set (readPump only)
+
+	lastWill json.RawMessage // LAST_WILL payload from JOIN or IDENTIFY (HandleClient goroutine only)
+
+	mu          sync.RWMutex
+	clientType  ClientType
+	displayName string      // from IDENTIFY, sanitized
+	closed      bool        // true when sendChan is closed
+	closeReason CloseReason // close frame writePump sends after draining (0 = none)
+
+	pumps sync.WaitGroup // writePump; HandleClient waits for it before returning
+
+	subMu sync.Mutex
+	sub   *nats.Subscription // room subscription; nil once torn down
+
+	dropped atomic.Uint64 // relayed messages dropped for a full send buffer
 }
 
 // Relay manages the NATS connection and room subscriptions.
 type Relay struct {
-	nc     *nats.Conn
-	mu     sync.RWMutex
-	rooms  map[string]map[*Client]struct{} // room -> set of clients
-	config Config
+	nc       *nats.Conn
+	mu       sync.RWMutex
+	rooms    map[string]map[*Client]struct{} // room -> set of clients
+	seqs     map[string]uint64               // room -> last MOVE sequence number
+	activity map[string]time.Time            // room -> last relayed message (or creation)
+	secrets  map[string][sha256.Size]byte    // room -> password hash (password-protected rooms only)
+	history  map[string]*historyRing         // room -> recent replayable messages
+	joining  map[string]int                  // room -> clients subscribed but not yet registered
+	config   Config
+	metrics  *relayMetrics
+	allowed  map[MessageType]struct{} // built from Config.AllowedMessageTypes
+	resume   *resumeStore             // nil unless Config.ResumeTTL is set
+
+	historyTypes map[MessageType]struct{} // built from Config.HistoryTypes
+	reservations map[string]Reservation   // unclaimed codes from ReserveRoom
+	pairing      map[string]*pairingRoom  // room -> relay-side pairing state
+	observed     chan observedMessage     // nil unless Config.OnMessage is set
+
+	recordings map[string]map[*recorder]struct{} // room -> active StartRecording writers
+	sequencers map[string]*roomSequencer         // room -> Config.OrderedRooms message queue
+
+	done      chan struct{} // closed by Close to stop background goroutines
+	closeOnce sync.Once
+
+	active       sync.WaitGroup // registered clients still running
+	shuttingDown bool           // set by Shutdown; rejects new clients
+}
+
+// Errors returned by the admin APIs.
+var (
+	ErrRoomNotFound   = errors.New("room not found")
+	ErrClientNotFound = errors.New("client not found")
+)
+
+// Errors returned by addToRoom when a client cannot be registered.
+var (
+	errShuttingDown = errors.New("relay is shutting down")
+	errRoomFull     = errors.New("room is full")
+	errServerFull   = errors.New("room limit reached")
+	errAuthFailed   = errors.New("room password mismatch")
+	errRoomReserved = errors.New("room is reserved")
+)
+
+// joinRejection maps an addToRoom error to a close reason.
+func joinRejection(err error) CloseReason {
+	switch {
+	case errors.Is(err, errRoomFull):
+		return CloseReasonRoomFull
+	case errors.Is(err, errServerFull):
+		return CloseReasonServerFull
+	case errors.Is(err, errAuthFailed):
+		return CloseReasonAuthFailed
+	case errors.Is(err, errRoomReserved):
+		return CloseReasonRoomReserved
+	case errors.Is(err, errFoundryPresent):
+		return CloseReasonDuplicateFoundry
+	default:
+		return CloseReasonShuttingDown
+	}
 }
 
 // NewRelay creates a relay connected to the given NATS URL.
 func NewRelay(cfg Config) (*Relay, error) {
-	nc, err := nats.Connect(cfg.NatsURL)
+	cfg = cfg.withDefaults()
+	if err := validateSubjectPrefix(cfg.SubjectPrefix); err != nil {
+		return nil, err
+	}
+
+	allowed := knownMessageTypes
+	if len(cfg.AllowedMessageTypes) > 0 {
+		allowed = make(map[MessageType]struct{}, len(cfg.AllowedMessageTypes))
+		for _, t := range cfg.AllowedMessageTypes {
+			allowed[t] = struct{}{}
+		}
+	}
+
+	r := &Relay{
+		rooms:    make(map[string]map[*Client]struct{}),
+		seqs:     make(map[string]uint64),
+		activity: make(map[string]time.Time),
+		secrets:  make(map[string][sha256.Size]byte),
+		joining:  make(map[string]int),
+		history:  make(map[string]*historyRing),
+		config:   cfg,
+		metrics:  newRelayMetrics(cfg.MaxTrackedRooms),
+		allowed:  allowed,
+		done:     make(chan struct{}),
+
+		historyTypes: make(map[MessageType]struct{}, len(cfg.HistoryTypes)),
+		reservations: make(map[string]Reservation),
+		pairing:      make(map[string]*pairingRoom),
+		recordings:   make(map[string]map[*recorder]struct{}),
+		sequencers:   make(map[string]*roomSequencer),
+	}
+	for _, t := range cfg.HistoryTypes {
+		r.historyTypes[t] = struct{}{}
+	}
+
+	nc, err := r.connectNATS()
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
+	r.nc = nc
 
-	return &Relay{
-		nc:     nc,
-		rooms:  make(map[string]map[*Client]struct{}),
-		config: cfg,
-	}, nil
+	if cfg.ResumeTTL > 0 {
+		r.resume = newResumeStore(cfg.ResumeTTL)
+	}
+	if cfg.IdleRoomTimeout > 0 {
+		go r.idleReapLoop()
+	}
+	if cfg.OnMessage != nil {
+		r.observed = make(chan observedMessage, defaultObserverQueueSize)
+		go r.observeLoop()
+	}
+	return r, nil
 }
 
-// Close shuts down the NATS connection.
+// Close disconnects every client without a close frame, waits up to
+// closeDrainTimeout for their goroutines to exit, then stops background
+// work and closes the NATS connection. Use Shutdown first for a graceful
+// drain. Safe to call more than once.
 func (r *Relay) Close() {
-	r.nc.Close()
+	r.closeOnce.Do(func() {
+		close(r.done)
+
+		r.mu.Lock()
+		r.shuttingDown = true
+		clientList := make([]*Client, 0)
+		for _, clients := range r.rooms {
+			for client := range clients {
+				clientList = append(clientList, client)
+			}
+		}
+		r.mu.Unlock()
+
+		// Closing the connection fails both pumps, which unregisters
+		// the client
+		for _, client := range clientList {
+			client.conn.Close()
+		}
+		done := make(chan struct{})
+		go func() {
+			r.active.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(closeDrainTimeout):
+			r.log(LogWarn, "Timed out waiting for %d clients to exit", r.ClientCount())
+		}
+
+		if r.resume != nil {
+			r.resume.close()
+		}
+		r.nc.Close()
+	})
+}
+
+// Shutdown notifies every client with SERVER_SHUTDOWN, sends each a
+// going-away close frame once its queued messages are flushed, and waits
+// for all client handlers to exit. If ctx expires first, remaining
+// connections are closed abruptly and ctx.Err() is returned.
+// New connections are rejected once Shutdown has been called.
+func (r *Relay) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	r.shuttingDown = true
+	clientList := make([]*Client, 0)
+	for _, clients := range r.rooms {
+		for client := range clients {
+			clientList = append(clientList, client)
+		}
+	}
+	r.mu.Unlock()
+
+	msg, err := MakeEnvelope(TypeServerShutdown, ServerShutdownPayload{
+		Reason: "Server shutting down",
+	})
+	if err != nil {
+		r.log(LogError, "Failed to create SERVER_SHUTDOWN message: %v", err)
+	}
+
+	r.log(LogInfo, "Draining %d clients", len(clientList))
+	for _, client := range clientList {
+		if msg != nil {
+			client.trySend(msg)
+		}
+		client.beginClose(CloseReasonShuttingDown)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, client := range clientList {
+			client.conn.Close()
+		}
+		return ctx.Err()
+	}
 }
 
 // log sends a log message to the configured callback (if any).
 func (r *Relay) log(level LogLevel, format string, args ...any) {
+	r.logFields(level, nil, format, args...)
+}
+
+// logFields sends a log message with structured context to the
+// configured callbacks (if any).
+func (r *Relay) logFields(level LogLevel, fields map[string]any, format string, args ...any) {
+	if r.config.OnLog == nil && r.config.OnLogStructured == nil || !level.AtLeast(r.config.MinLogLevel) {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
 	if r.config.OnLog != nil {
-		r.config.OnLog(level, fmt.Sprintf(format, args...))
+		r.config.OnLog(level, message)
+	}
+	if r.config.OnLogStructured != nil {
+		if fields == nil {
+			fields = map[string]any{}
+		}
+		r.config.OnLogStructured(level, message, fields)
 	}
 }
 
-// HandleClient processes a new WebSocket connection through its lifecycle.
-func (r *Relay) HandleClient(conn *websocket.Conn) {
+// HandleClient processes a new connection through its lifecycle. conn is
+// usually a *websocket.Conn; see ClientConn and Pipe for others.
+func (r *Relay) HandleClient(conn ClientConn) {
+	r.HandleClientContext(context.Background(), conn)
+}
+
+// HandleClientContext is like HandleClient, but closes the connection
+// with a going-away close frame when ctx is cancelled.
+func (r *Relay) HandleClientContext(ctx context.Context, conn ClientConn) {
 	client := &Client{
-		conn:       conn,
-		clientType: ClientTypeUnknown,
-		sendChan:   make(chan []byte, 64),
-		relay:      r,
+		id:          newID(),
+		ctx:         ctx,
+		conn:        clientConn{conn},
+		connectedAt: time.Now(),
+		clientType:  ClientTypeUnknown,
+		sendChan:    make(chan []byte, r.config.SendBufferSize),
+		relay:       r,
 	}
-
-	// Wait for JOIN message first
-	if err := client.waitForJoin(); err != nil {
-		r.log(LogWarn, "Client failed to join: %v", err)
+	if r.config.MaxMessagesPerSecond > 0 {
+		client.limiter = newTokenBucket(r.config.MaxMessagesPerSecond, r.config.MaxMessagesPerSecond, nil)
+	}
+	client.conn.SetReadLimit(int64(r.config.MaxMessageBytes) * readLimitMultiplier)
+
+	// Wait for JOIN message first. Until writePump runs, cancellation
+	// can only drop the connection.
+	stopJoinWatch := context.AfterFunc(ctx, func() { conn.Close() })
+	err := client.waitForJoin()
+	if !stopJoinWatch() {
+		if err == nil {
+			client.unsubscribe()
+			r.endJoin(client.room)
+		}
+		client.log(LogInfo, "Connection cancelled before joining")
+		return
+	}
+	if err != nil {
+		client.log(LogWarn, "Client failed to join: %v", err)
 		return
 	}
 
 	// Register client in room
-	r.addToRoom(client)
+	err = r.addToRoom(client)
+	r.endJoin(client.room)
+	if err != nil {
+		if client.resumeToken != "" {
+			// Give the redeemed session back so a later attempt can use it
+			r.resume.release(client.resumeToken, client.getClientType())
+		}
+		client.unsubscribe()
+		closeClient(client, joinRejection(err))
+		r.metrics.joinFailures.Add(1)
+		client.log(LogWarn, "Rejected client for room %s: %v", client.room, err)
+		return
+	}
 	defer func() {
 		r.removeFromRoom(client)
 		// Broadcast status change when client leaves
 		r.broadcastRoomStatus(client.room)
+		client.publishLastWill()
+		client.pumps.Wait()
+		r.active.Done()
 	}()
 
-	r.log(LogInfo, "Client joined room %s", client.room)
+	resumed := client.resumeToken != ""
+	if r.resume != nil && !resumed {
+		client.resumeToken = r.resume.issue(client.room)
+	}
 
-	// Start writer goroutine
-	go client.writePump()
+	if resumed {
+		client.log(LogInfo, "Client resumed session in room %s", client.room)
+	} else {
+		client.log(LogInfo, "Client joined room %s", client.room)
+	}
 
-	// Send initial room status to this client
-	client.sendRoomStatus()
+	// Start writer goroutine (addToRoom already queued the initial ROOM_STATUS)
+	client.pumps.Add(1)
+	go func() {
+		defer client.pumps.Done()
+		client.writePump()
+	}()
+
+	if client.resumeToken != "" {
+		client.sendResumeToken()
+	}
+	if resumed && client.getClientType() != ClientTypeUnknown {
+		// Resumed clients skip IDENTIFY, so replay history now
+		client.replayHistory()
+	}
 
 	// Read messages and relay to NATS
 	client.readPump()
 }
 
 // waitForJoin reads the first message and expects a JOIN.
-func (c *Client) waitForJoin() error {
+func (c *Client) waitForJoin() (err error) {
+	defer func() {
+		if err != nil {
+			c.relay.metrics.joinFailures.Add(1)
+		}
+	}()
+
+	// A client that never sends JOIN must not hold its goroutine forever
+	c.conn.SetReadDeadline(time.Now().Add(c.relay.config.JoinTimeout))
 	_, data, err := c.conn.ReadMessage()
 	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			closeClient(c, CloseReasonJoinTimeout)
+			return fmt.Errorf("no JOIN within %v", c.relay.config.JoinTimeout)
+		}
 		return fmt.Errorf("read error: %w", err)
 	}
+	c.conn.SetReadDeadline(time.Time{})
 
 	env, err := ParseEnvelope(data)
 	if err != nil {
-		c.closeWithCode(CloseProtocolError, "Invalid JSON")
+		closeClient(c, CloseReasonInvalidJSON)
 		return fmt.Errorf("parse error: %w", err)
 	}
 
 	if env.Type != TypeJoin {
-		c.closeWithCode(CloseProtocolError, "Expected JOIN message")
+		closeClient(c, CloseReasonExpectedJoin)
 		return fmt.Errorf("expected JOIN, got %s", env.Type)
 	}
 
 	var payload JoinPayload
 	if err := json.Unmarshal(env.Payload, &payload); err != nil {
-		c.closeWithCode(CloseProtocolError, "Invalid JOIN payload")
+		closeClient(c, CloseReasonInvalidJoin)
 		return fmt.Errorf("payload parse error: %w", err)
 	}
 
-	// Validate room code
+	// Negotiate protocol version (missing means version 1, or the
+	// version pinned by the WebSocket subprotocol)
+	version := payload.ProtoVersion
+	if pinned, ok := subprotocolVersion(c.conn.Subprotocol()); ok {
+		if version != 0 && version != pinned {
+			closeClientMessage(c, CloseReasonUnsupportedVersion,
+				fmt.Sprintf("JOIN protoVersion %d does not match subprotocol %s", version, c.conn.Subprotocol()))
+			return fmt.Errorf("protocol version %d conflicts with subprotocol %s", version, c.conn.Subprotocol())
+		}
+		version = pinned
+	}
+	if version == 0 {
+		version = 1
+	}
+	minVersion, maxVersion := c.relay.config.MinProtoVersion, c.relay.config.MaxProtoVersion
+	if version < minVersion || version > maxVersion {
+		closeClientMessage(c, CloseReasonUnsupportedVersion,
+			fmt.Sprintf("Unsupported protocol version %d (supported %d-%d)", version, minVersion, maxVersion))
+		return fmt.Errorf("unsupported protocol version: %d", version)
+	}
+	c.protoVersion = version
+
+	encoding, err := parseEncoding(payload.Encoding)
+	if err != nil {
+		closeClient(c, CloseReasonUnsupportedEncoding)
+		return err
+	}
+	c.encoding = encoding
+	c.compress = c.relay.config.EnableCompression && !payload.NoCompression
+	c.batch = c.relay.config.BatchWrites && payload.Batch
+	c.conn.EnableWriteCompression(c.compress)
+	c.setLastWill(payload.LastWill)
+
+	// Validate room code, then store its canonical form
 	room := payload.Room
 	if !ValidateRoomCode(room) {
-		c.closeWithCode(CloseInvalidRoom, "Invalid room code format")
+		closeClient(c, CloseReasonInvalidRoom)
 		return fmt.Errorf("invalid room code: %s", room)
 	}
 
-	c.room = room
-
-	// Subscribe to NATS subject for this room
-	subject := fmt.Sprintf("game.%s", c.room)
-	sub, err := c.relay.nc.Subscribe(subject, func(msg *nats.Msg) {
-		// Queue message to be sent to this client
-		select {
-		case c.sendChan <- msg.Data:
-		default:
-			// Channel full, drop message (client too slow)
-			c.relay.log(LogWarn, "Dropping message for slow client in room %s", c.room)
+	c.room = NormalizeRoomCode(room)
+	c.password = payload.Password
+	c.reservationKey = payload.ReservationKey
+
+	// Restore a previous session's state if the token is still valid
+	if c.relay.resume != nil && payload.ResumeToken != "" {
+		if clientType, ok := c.relay.resume.redeem(payload.ResumeToken, c.room); ok {
+			c.resumeToken = payload.ResumeToken
+			c.setClientType(clientType)
+		} else {
+			c.log(LogInfo, "Ignoring invalid or expired resume token in room %s", c.room)
 		}
-	})
+	}
+
+	// Subscribe to NATS subject for this room. HandleClient ends the
+	// join once the client is registered.
+	c.relay.beginJoin(c.room)
+	sub, err := c.relay.nc.Subscribe(c.relay.roomSubject(c.room), c.deliver)
 	if err != nil {
-		c.closeWithCode(CloseSubscribeFailed, "Failed to subscribe")
+		c.relay.endJoin(c.room)
+		closeClient(c, CloseReasonSubscribeFailed)
 		return fmt.Errorf("subscribe error: %w", err)
 	}
+	c.subMu.Lock()
 	c.sub = sub
+	c.subMu.Unlock()
 
 	return nil
 }
 
-// sendRoomStatus sends current room status to this client.
-func (c *Client) sendRoomStatus() {
-	foundryConnected := c.relay.isFoundryConnected(c.room)
-	msg, err := MakeEnvelope(TypeRoomStatus, RoomStatusPayload{
-		FoundryConnected: foundryConnected,
+// deliver queues a message from the room's subject for this client.
+func (c *Client) deliver(msg *nats.Msg) {
+	if !*c.relay.config.EchoToSender && msg.Header.Get(senderHeader) == c.id {
+		return
+	}
+
+	c.queue(msg.Data)
+}
+
+// queue queues a relayed message for this client, dropping it if the
+// client is too slow.
+func (c *Client) queue(data []byte) {
+	if !c.trySend(data) {
+		// Channel full or closed, drop message (client too slow)
+		room := c.getRoom()
+		c.dropped.Add(1)
+		c.relay.metrics.recordSlowClientDrop(room)
+		c.log(LogWarn, "Dropping message for slow client in room %s", room)
+	}
+}
+
+// resubscribe replaces the client's room subscription if the NATS
+// connection has invalidated it. It does nothing once the client has
+// unsubscribed, or if the subscription is still valid, so concurrent
+// calls cannot subscribe twice. It reports whether a new subscription
+// was made.
+func (c *Client) resubscribe() (bool, error) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if c.sub == nil || c.sub.IsValid() {
+		return false, nil
+	}
+	sub, err := c.relay.nc.Subscribe(c.relay.roomSubject(c.getRoom()), c.deliver)
+	if err != nil {
+		return false, err
+	}
+	c.sub = sub
+	return true, nil
+}
+
+// unsubscribe drops the client's current room subscription, so later
+// resubscribe calls do nothing.
+func (c *Client) unsubscribe() {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if c.sub != nil {
+		c.sub.Unsubscribe()
+		c.sub = nil
+	}
+}
+
+// sendResumeToken tells this client the token it can use to resume.
+func (c *Client) sendResumeToken() {
+	msg, err := MakeEnvelope(TypeResumeToken, ResumeTokenPayload{
+		Token:      c.resumeToken,
+		TTLSeconds: int(c.relay.config.ResumeTTL.Seconds()),
 	})
 	if err != nil {
-		c.relay.log(LogError, "Failed to create ROOM_STATUS message: %v", err)
+		c.log(LogError, "Failed to create RESUME_TOKEN message: %v", err)
 		return
 	}
 
@@ -209,55 +1048,240 @@ func (c *Client) sendRoomStatus() {
 // readPump reads messages from WebSocket and publishes to NATS.
 func (c *Client) readPump() {
 	defer func() {
-		if c.sub != nil {
-			c.sub.Unsubscribe()
-		}
+		c.unsubscribe()
 		c.markClosed()
-		close(c.sendChan)
 		c.conn.Close()
 	}()
 
-	subject := fmt.Sprintf("game.%s", c.room)
+	// Any inbound frame or pong proves the connection is alive, but
+	// only messages reset the idle ReadTimeout
+	pongTimeout, readTimeout := c.relay.config.PongTimeout, c.relay.config.ReadTimeout
+	lastMessage := time.Now()
+	readDeadline := func() time.Time {
+		deadline := time.Now().Add(pongTimeout)
+		if idle := lastMessage.Add(readTimeout); readTimeout > 0 && idle.Before(deadline) {
+			deadline = idle
+		}
+		return deadline
+	}
+	c.conn.SetReadDeadline(readDeadline())
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(readDeadline())
+	})
 
 	for {
-		_, data, err := c.conn.ReadMessage()
+		frameType, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
-				c.relay.log(LogWarn, "WebSocket error: %v", err)
+				c.log(LogWarn, "WebSocket error: %v", err)
 			}
 			return
 		}
+		lastMessage = time.Now()
+		c.conn.SetReadDeadline(readDeadline())
+
+		// MessagePack clients send binary frames; NATS traffic is JSON
+		if frameType == websocket.BinaryMessage && c.encoding == EncodingMsgPack && len(data) <= c.relay.config.MaxMessageBytes {
+			converted, err := msgpackToJSON(data)
+			if err != nil {
+				c.log(LogWarn, "Invalid message from client: %v", err)
+				continue
+			}
+			data = converted
+		}
+
+		// Drop oversized messages before parsing
+		if len(data) > c.relay.config.MaxMessageBytes {
+			c.sizeViolations++
+			if c.sizeViolations >= maxSizeViolations {
+				c.log(LogWarn, "Disconnecting client in room %s: repeated oversized messages", c.room)
+				closeClient(c, CloseReasonMessageTooLarge)
+				return
+			}
+			c.log(LogWarn, "Dropping %d-byte message in room %s (limit %d)", len(data), c.room, c.relay.config.MaxMessageBytes)
+			continue
+		}
+		c.sizeViolations = 0
 
 		// Validate it's a proper envelope before relaying
 		env, err := ParseEnvelope(data)
 		if err != nil {
-			c.relay.log(LogWarn, "Invalid message from client: %v", err)
+			c.log(LogWarn, "Invalid message from client: %v", err)
 			continue
 		}
 
-		// Handle IDENTIFY locally (don't relay to NATS)
-		if env.Type == TypeIdentify {
+		// Handle JOIN, IDENTIFY, PING, and PAIR_CODES locally (don't relay
+		// to NATS)
+		switch env.Type {
+		case TypeJoin:
+			c.handleRepeatJoin(env.Payload)
+			continue
+		case TypeIdentify:
 			c.handleIdentify(env.Payload)
 			continue
+		case TypePing:
+			c.handlePing(env.Payload)
+			continue
+		case TypePairCodes:
+			c.handlePairCodes(env.Payload)
+			continue
+		}
+
+		// Only relay allowlisted message types
+		if _, ok := c.relay.allowed[env.Type]; !ok {
+			c.log(LogWarn, "Dropping message with unknown type %q in room %s", env.Type, c.room)
+			continue
+		}
+
+		// Drop rapid exact repeats before they count against the rate limit
+		if c.isDuplicate(data) {
+			continue
+		}
+
+		// Enforce per-client rate limit
+		if allowed, disconnect := c.checkRateLimit(); !allowed {
+			if disconnect {
+				c.log(LogWarn, "Disconnecting client in room %s: rate limit exceeded", c.room)
+				closeClient(c, CloseReasonRateLimited)
+				return
+			}
+			c.log(LogWarn, "Rate limit exceeded in room %s, dropping message", c.room)
+			continue
 		}
 
-		// Publish to NATS
-		if err := c.relay.nc.Publish(subject, data); err != nil {
-			c.relay.log(LogError, "NATS publish error: %v", err)
+		// Reject payloads that fail their type's validation
+		if err := ValidatePayload(env.Type, env.Payload); err != nil {
+			c.log(LogWarn, "Dropping message in room %s: %v", c.room, err)
+			continue
+		}
+
+		if len(c.relay.config.Middleware) > 0 {
+			var ok bool
+			if env, data, ok = c.relay.applyMiddleware(c.room, env); !ok {
+				continue
+			}
+		}
+
+		if env.Type == TypeRollDice && c.handleRollDice(env.Payload, env.ID) {
+			c.relay.touch(c.room)
+			continue
+		}
+		if env.Type == TypePair && c.handlePair(env.Payload, env.ID) {
+			c.relay.touch(c.room)
+			continue
+		}
+
+		// With OrderedRooms, the room's sequencer finishes the message, so
+		// every client's messages are stamped and published in one order
+		if c.relay.config.OrderedRooms {
+			room := c.room
+			if !c.relay.sequence(room, func() {
+				if err := c.relayMessage(room, env, data); err != nil {
+					// Drop the sender as the unordered path does, ending
+					// readPump, rather than leave a gap in the room's order
+					c.log(LogError, "NATS publish error: %v", err)
+					c.conn.Close()
+				}
+			}) {
+				return
+			}
+			continue
+		}
+		if err := c.relayMessage(c.room, env, data); err != nil {
+			c.log(LogError, "NATS publish error: %v", err)
 			return
 		}
 	}
 }
 
+// relayMessage applies relay-side rewriting to a validated client message
+// (MOVE clamping, sequence and server-time stamps) and relays it to room.
+// It returns only NATS publish errors.
+func (c *Client) relayMessage(room string, env *Envelope, data []byte) error {
+	rewritten := false
+	if env.Type == TypeMove {
+		// Clamp oversized moves
+		if clamped, ok, err := clampMoveDistance(env.Payload, c.relay.config.MaxMoveDistance); err == nil && ok {
+			c.log(LogWarn, "Clamping MOVE distance in room %s to %d", room, c.relay.config.MaxMoveDistance)
+			env.Payload = clamped
+			rewritten = true
+		}
+
+		// Stamp MOVE messages with the room's next sequence number
+		if c.relay.config.StampSequence {
+			env.Seq = c.relay.nextSeq(room)
+			rewritten = true
+		}
+	}
+	if c.relay.config.StampServerTime {
+		env.ServerTime = time.Now().UnixMilli()
+		rewritten = true
+	}
+	if rewritten {
+		encoded, err := json.Marshal(env)
+		if err != nil {
+			c.log(LogError, "Failed to re-encode %s: %v", env.Type, err)
+			return nil
+		}
+		data = encoded
+	}
+
+	c.relay.observe(room, env)
+	c.relay.record(room, data)
+
+	// Publish to NATS, unless there's no one else to deliver to
+	if c.alone() {
+		c.relayAlone(data)
+	} else if err := c.publish(c.relay.roomSubject(room), data); err != nil {
+		return err
+	}
+	c.relay.metrics.recordRelayed(room, len(data))
+	c.relay.touch(room)
+	c.relay.recordHistory(room, env.Type, data)
+	return nil
+}
+
+// publish sends a client's message to the room, tagged with the
+// client's ID when EchoToSender is false so its own subscription skips it.
+func (c *Client) publish(subject string, data []byte) error {
+	if *c.relay.config.EchoToSender {
+		return c.relay.nc.Publish(subject, data)
+	}
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set(senderHeader, c.id)
+	return c.relay.nc.PublishMsg(msg)
+}
+
+// checkRateLimit applies the per-client rate limit.
+// Returns allowed=false when the message should be dropped, and
+// disconnect=true once the client has exceeded MaxRateViolations.
+func (c *Client) checkRateLimit() (allowed, disconnect bool) {
+	if c.limiter == nil {
+		return true, false
+	}
+	if c.limiter.allow() {
+		c.rateViolations = 0
+		return true, false
+	}
+
+	c.rateViolations++
+	if c.rateViolations >= c.relay.config.MaxRateViolations {
+		return false, true
+	}
+	return false, false
+}
+
 // handleIdentify processes an IDENTIFY message and updates client type.
 func (c *Client) handleIdentify(payload json.RawMessage) {
 	var p IdentifyPayload
 	if err := json.Unmarshal(payload, &p); err != nil {
-		c.relay.log(LogWarn, "Invalid IDENTIFY payload: %v", err)
+		c.log(LogWarn, "Invalid IDENTIFY payload: %v", err)
 		return
 	}
 
-	oldType := c.getClientType()
+	oldType, oldName := c.getClientType(), c.getDisplayName()
+	name := sanitizeDisplayName(p.DisplayName)
 	var newType ClientType
 
 	switch p.ClientType {
@@ -266,36 +1290,174 @@ func (c *Client) handleIdentify(payload json.RawMessage) {
 	case "phone":
 		newType = ClientTypePhone
 	default:
-		c.relay.log(LogWarn, "Unknown client type: %s", p.ClientType)
+		c.log(LogWarn, "Unknown client type: %s", p.ClientType)
+		return
+	}
+	c.setLastWill(p.LastWill)
+
+	if newType == oldType && name == oldName {
+		return // Redundant IDENTIFY
+	}
+	if newType != oldType {
+		now := time.Now()
+		if oldType != ClientTypeUnknown && now.Sub(c.typeChangedAt) < minIdentifyInterval {
+			c.log(LogWarn, "Ignoring IDENTIFY as %s in room %s: type changed too recently", newType, c.room)
+			return
+		}
+		c.typeChangedAt = now
+	}
+
+	if !c.relay.setIdentity(c, newType, name) {
+		c.rejectDuplicateFoundry()
 		return
 	}
+	c.log(LogInfo, "Client identified as %s in room %s", newType, c.room)
+	c.relay.emitClientEvent(ClientIdentified, c)
+
+	// Catch up a newly identified client on recent room state
+	if oldType == ClientTypeUnknown {
+		c.replayHistory()
+	}
+}
 
-	c.setClientType(newType)
-	c.relay.log(LogInfo, "Client identified as %s in room %s", newType, c.room)
+// rejectDuplicateFoundry tells a client its Foundry identify was refused
+// and, if configured, disconnects it once the message is flushed.
+func (c *Client) rejectDuplicateFoundry() {
+	c.log(LogWarn, "Rejected second Foundry in room %s", c.room)
 
-	// If client type changed, broadcast new room status
-	if oldType != newType {
-		c.relay.broadcastRoomStatus(c.room)
+	msg, err := MakeEnvelope(TypeIdentifyFailed, IdentifyFailedPayload{
+		Reason: "Room already has a Foundry connected",
+	})
+	if err != nil {
+		c.log(LogError, "Failed to create IDENTIFY_FAILED message: %v", err)
+		return
+	}
+	c.trySend(msg)
+
+	if c.relay.config.DisconnectDuplicateFoundry {
+		c.beginClose(CloseReasonDuplicateFoundry)
 	}
 }
 
-// writePump sends messages from the sendChan to the WebSocket.
+// handlePing answers a PING with a PONG carrying both timestamps.
+func (c *Client) handlePing(payload json.RawMessage) {
+	var p PingPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.log(LogWarn, "Invalid PING payload: %v", err)
+		return
+	}
+
+	msg, err := MakeEnvelope(TypePong, PongPayload{
+		ClientTime: p.ClientTime,
+		ServerTime: time.Now().UnixMilli(),
+	})
+	if err != nil {
+		c.log(LogError, "Failed to create PONG message: %v", err)
+		return
+	}
+	c.trySend(msg)
+}
+
+// writePump sends messages from the sendChan to the WebSocket and
+// keeps the connection alive with periodic pings.
 func (c *Client) writePump() {
-	for data := range c.sendChan {
-		if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
-			c.relay.log(LogWarn, "WebSocket write error: %v", err)
+	ticker := time.NewTicker(c.relay.config.PingInterval)
+	var stats *compressionStats
+	if c.compress {
+		stats = newCompressionStats()
+	}
+	defer func() {
+		ticker.Stop()
+		if stats != nil && stats.raw > 0 {
+			c.log(LogDebug, "Compression for client in room %s: %d bytes -> ~%d bytes (ratio %.2f)",
+				c.getRoom(), stats.raw, stats.compressed, stats.ratio())
+		}
+		// Unblock readPump if we exited on a write error
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.sendChan:
+			if !ok {
+				c.writeCloseFrame()
+				return
+			}
+			closed := false
+			if c.batch {
+				data, closed = c.nextBatch(data)
+			}
+			if !c.writeData(data, stats) {
+				return
+			}
+			if closed {
+				c.writeCloseFrame()
+				return
+			}
+		case <-c.ctx.Done():
+			closeClient(c, CloseReasonCancelled)
 			return
+		case <-ticker.C:
+			deadline := time.Now().Add(c.relay.config.PingInterval)
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				c.log(LogWarn, "WebSocket ping error in room %s: %v", c.getRoom(), err)
+				return
+			}
+		}
+	}
+}
+
+// writeData writes one outbound JSON message in the client's encoding.
+// It returns false if the connection failed.
+func (c *Client) writeData(data []byte, stats *compressionStats) bool {
+	frameType := websocket.TextMessage
+	if c.encoding == EncodingMsgPack {
+		converted, err := jsonToMsgpack(data)
+		if err != nil {
+			c.log(LogWarn, "Failed to encode msgpack message: %v", err)
+			return true
 		}
+		data, frameType = converted, websocket.BinaryMessage
+	}
+	if stats != nil {
+		stats.record(data)
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.relay.config.WriteTimeout))
+	if err := c.conn.WriteMessage(frameType, data); err != nil {
+		c.log(LogWarn, "WebSocket write error in room %s: %v", c.getRoom(), err)
+		return false
+	}
+	return true
+}
+
+// writeCloseFrame sends the close frame requested by beginClose, if any.
+func (c *Client) writeCloseFrame() {
+	c.mu.RLock()
+	reason := c.closeReason
+	c.mu.RUnlock()
+
+	if reason == 0 {
+		return
 	}
+	c.conn.WriteControl(websocket.CloseMessage, closeMessage(reason, ""), time.Now().Add(time.Second))
 }
 
-// closeWithCode closes the WebSocket with an error code and message.
-func (c *Client) closeWithCode(code int, message string) {
-	c.conn.WriteMessage(
-		websocket.CloseMessage,
-		websocket.FormatCloseMessage(code, message),
-	)
-	c.conn.Close()
+// log emits a relay log event tagged with this client's context.
+func (c *Client) log(level LogLevel, format string, args ...any) {
+	if c.relay.config.OnLogStructured == nil {
+		c.relay.log(level, format, args...)
+		return
+	}
+	fields := map[string]any{
+		"remoteAddr": c.conn.remoteAddr(),
+	}
+	if room := c.getRoom(); room != "" {
+		fields["room"] = room
+	}
+	if t := c.getClientType(); t != ClientTypeUnknown {
+		fields["clientType"] = string(t)
+	}
+	c.relay.logFields(level, fields, format, args...)
 }
 
 // getClientType returns the client type (thread-safe).
@@ -305,6 +1467,21 @@ func (c *Client) getClientType() ClientType {
 	return c.clientType
 }
 
+// getRoom returns the client's current room (thread-safe). The client's
+// own readPump, and code holding r.mu, may read c.room directly.
+func (c *Client) getRoom() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.room
+}
+
+// getDisplayName returns the client's display name (thread-safe).
+func (c *Client) getDisplayName() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.displayName
+}
+
 // setClientType sets the client type (thread-safe).
 func (c *Client) setClientType(t ClientType) {
 	c.mu.Lock()
@@ -313,53 +1490,226 @@ func (c *Client) setClientType(t ClientType) {
 }
 
 // trySend attempts to send a message to the client's send channel.
-// Returns false if the channel is closed or full.
+// Returns false if the channel is closed or full. A full channel is
+// handled according to the relay's OverflowPolicy.
 func (c *Client) trySend(msg []byte) bool {
+	sent, full := c.enqueue(msg)
+	if full && c.relay.config.OverflowPolicy == DisconnectClient && c.beginClose(CloseReasonSlowClient) {
+		c.log(LogWarn, "Disconnecting slow client in room %s: send buffer full", c.getRoom())
+		// writePump may be stuck writing to this client; closing the
+		// connection unblocks it. Done asynchronously since trySend can
+		// be called with the relay lock held.
+		go closeClient(c, CloseReasonSlowClient)
+	}
+	return sent
+}
+
+// enqueue performs the non-blocking send for trySend, reporting whether
+// the message was queued and whether it failed because the buffer was full.
+// The read lock is held across the send so markClosed cannot close the
+// channel underneath it.
+func (c *Client) enqueue(msg []byte) (sent, full bool) {
 	c.mu.RLock()
+	defer c.mu.RUnlock()
 	if c.closed {
-		c.mu.RUnlock()
-		return false
+		return false, false
 	}
-	c.mu.RUnlock()
 
 	select {
 	case c.sendChan <- msg:
-		return true
+		return true, false
 	default:
-		return false
+		return false, true
 	}
 }
 
-// markClosed marks the client as closed (should be called before closing sendChan).
+// markClosed marks the client as closed and closes sendChan, which
+// stops writePump. Safe to call more than once.
 func (c *Client) markClosed() {
+	c.beginClose(0)
+}
+
+// beginClose closes sendChan so writePump drains queued messages and then
+// sends a close frame with reason (if non-zero). Safe to call more than
+// once; only the first call takes effect, and it alone returns true.
+func (c *Client) beginClose(reason CloseReason) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
 	c.closed = true
+	c.closeReason = reason
+	close(c.sendChan)
+	return true
+}
+
+// addToRoom registers a client in a room, then reports the join to
+// OnClientEvent once the lock is released.
+func (r *Relay) addToRoom(c *Client) error {
+	if err := r.registerClient(c); err != nil {
+		return err
+	}
+	r.emitClientEvent(ClientJoined, c)
+	return nil
 }
 
-// addToRoom registers a client in a room.
-func (r *Relay) addToRoom(c *Client) {
+// registerClient adds a client to its room and queues its initial
+// ROOM_STATUS; a client that already has a type (a resumed session) changes
+// the status, so the whole room is updated instead. A resumed Foundry is
+// refused with errFoundryPresent if SingleFoundryPerRoom is set and the
+// room already has one. On success the client is counted in r.active
+// until removed.
+func (r *Relay) registerClient(c *Client) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if r.rooms[c.room] == nil {
-		r.rooms[c.room] = make(map[*Client]struct{})
+	password, reservationKey := c.password, c.reservationKey
+	c.password, c.reservationKey = "", ""
+
+	if r.shuttingDown {
+		return errShuttingDown
+	}
+	if c.getClientType() == ClientTypeFoundry && r.config.SingleFoundryPerRoom && r.foundryConnectedLocked(c.room) {
+		return errFoundryPresent
+	}
+	if err := r.admitLocked(c.room, password, reservationKey); err != nil {
+		return err
 	}
 	r.rooms[c.room][c] = struct{}{}
+	r.active.Add(1)
+
+	if c.getClientType() == ClientTypeUnknown {
+		r.sendRoomStatusLocked(c.room, []*Client{c})
+	} else {
+		r.sendRoomStatusLocked(c.room, nil)
+	}
+	r.sendPresenceLocked(c.room)
+	return nil
+}
+
+// admitLocked checks that one more client may join room with password
+// and reservationKey, creating the room if needed. The first client into
+// a room sets its password; later joiners must match. Callers must hold
+// r.mu exclusively.
+func (r *Relay) admitLocked(room, password, reservationKey string) error {
+	if secret, ok := r.secrets[room]; ok {
+		// Hashing first keeps the comparison constant-time regardless of length
+		given := sha256.Sum256([]byte(password))
+		if subtle.ConstantTimeCompare(secret[:], given[:]) != 1 {
+			return errAuthFailed
+		}
+	}
+	if limit := r.config.MaxClientsPerRoom; limit > 0 && len(r.rooms[room]) >= limit {
+		return errRoomFull
+	}
+
+	if r.rooms[room] == nil {
+		// Creating a new room; checked under the same lock as the insert
+		if limit := r.config.MaxRooms; limit > 0 && len(r.rooms) >= limit {
+			return errServerFull
+		}
+		if err := r.claimReservationLocked(room, reservationKey); err != nil {
+			return err
+		}
+		r.rooms[room] = make(map[*Client]struct{})
+		r.activity[room] = time.Now()
+		if password != "" {
+			r.secrets[room] = sha256.Sum256([]byte(password))
+		}
+	}
+	return nil
+}
+
+// leaveRoomLocked removes a client from its room's set and cancels its
+// pending PAIR, dropping the room's state once it is empty. Callers must
+// hold r.mu exclusively.
+func (r *Relay) leaveRoomLocked(c *Client) {
+	clients, ok := r.rooms[c.room]
+	if !ok {
+		return
+	}
+	delete(clients, c)
+	r.dropPendingPairLocked(c)
+	if len(clients) == 0 {
+		delete(r.rooms, c.room)
+		delete(r.seqs, c.room)
+		delete(r.activity, c.room)
+		delete(r.history, c.room)
+		delete(r.secrets, c.room)
+		delete(r.pairing, c.room)
+	}
 }
 
 // removeFromRoom unregisters a client from a room.
 func (r *Relay) removeFromRoom(c *Client) {
+	r.mu.Lock()
+	r.leaveRoomLocked(c)
+	if c.resumeToken != "" {
+		r.resume.release(c.resumeToken, c.getClientType())
+	}
+	r.sendPresenceLocked(c.room)
+	r.mu.Unlock()
+
+	c.log(LogInfo, "Client left room %s", c.room)
+	r.emitClientEvent(ClientLeft, c)
+}
+
+// nextSeq returns the next MOVE sequence number for a room.
+// Sequences start at 1 and reset when the room empties.
+func (r *Relay) nextSeq(room string) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seqs[room]++
+	return r.seqs[room]
+}
+
+// touch records message activity in a room for idle detection and Stats.
+func (r *Relay) touch(room string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	if _, ok := r.rooms[room]; ok {
+		r.activity[room] = time.Now()
+	}
+}
+
+// idleReapLoop periodically closes rooms that have been idle for
+// IdleRoomTimeout, until Close is called.
+func (r *Relay) idleReapLoop() {
+	ticker := time.NewTicker(r.config.IdleRoomTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.reapIdleRooms()
+		case <-r.done:
+			return
+		}
+	}
+}
 
-	if clients, ok := r.rooms[c.room]; ok {
-		delete(clients, c)
-		if len(clients) == 0 {
-			delete(r.rooms, c.room)
+// reapIdleRooms closes every client in rooms idle past IdleRoomTimeout.
+// Clients leave through their normal cleanup, which deletes the room.
+func (r *Relay) reapIdleRooms() {
+	now := time.Now()
+	idle := make(map[string][]*Client)
+	r.mu.RLock()
+	for room, last := range r.activity {
+		if now.Sub(last) < r.config.IdleRoomTimeout {
+			continue
+		}
+		for c := range r.rooms[room] {
+			idle[room] = append(idle[room], c)
+		}
+	}
+	r.mu.RUnlock()
+
+	for room, clients := range idle {
+		r.log(LogInfo, "Closing idle room %s (%d clients)", room, len(clients))
+		for _, c := range clients {
+			c.beginClose(CloseReasonRoomIdle)
 		}
 	}
-	r.log(LogInfo, "Client left room %s", c.room)
 }
 
 // RoomCount returns the number of active rooms.
@@ -380,77 +1730,281 @@ func (r *Relay) ClientCount() int {
 	return count
 }
 
-// Stats returns current relay statistics.
+// Stats returns current relay statistics, including a per-room breakdown,
+// taken under a single lock. The result is a copy and safe to modify.
 func (r *Relay) Stats() Stats {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	stats := Stats{RoomCount: len(r.rooms)}
-	for _, clients := range r.rooms {
+	now := time.Now()
+	var total time.Duration
+	stats := Stats{
+		RoomCount:       len(r.rooms),
+		MessagesRelayed: r.metrics.messagesRelayed.Load(),
+		BytesRelayed:    r.metrics.bytesRelayed.Load(),
+		SlowClientDrops: r.metrics.slowClientDrops.Load(),
+		Rooms:           make(map[string]RoomStats, len(r.rooms)),
+	}
+	for code, clients := range r.rooms {
+		counters := r.metrics.lookupRoom(code)
+		room := RoomStats{
+			LastActivity:    r.activity[code],
+			MessagesRelayed: counters.messagesRelayed,
+			BytesRelayed:    counters.bytesRelayed,
+			SlowClientDrops: counters.slowClientDrops,
+		}
 		for c := range clients {
-			stats.ClientCount++
+			room.ClientCount++
+			total += now.Sub(c.connectedAt)
 			switch c.getClientType() {
 			case ClientTypeFoundry:
-				stats.FoundryCount++
+				room.FoundryCount++
 			case ClientTypePhone:
-				stats.PhoneCount++
+				room.PhoneCount++
 			}
 		}
+		stats.Rooms[code] = room
+		stats.ClientCount += room.ClientCount
+		stats.FoundryCount += room.FoundryCount
+		stats.PhoneCount += room.PhoneCount
+	}
+	if stats.ClientCount > 0 {
+		stats.AverageSessionDuration = total / time.Duration(stats.ClientCount)
 	}
 	return stats
 }
 
-// isFoundryConnected checks if a Foundry client is connected to a room.
-func (r *Relay) isFoundryConnected(room string) bool {
+// ListRooms returns a snapshot of every room and its clients, sorted by
+// room code. The result is a copy and safe for callers to modify.
+func (r *Relay) ListRooms() []RoomInfo {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	clients, ok := r.rooms[room]
-	if !ok {
-		return false
+	now := time.Now()
+	rooms := make([]RoomInfo, 0, len(r.rooms))
+	for room := range r.rooms {
+		rooms = append(rooms, r.roomInfoLocked(room, now))
 	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Room < rooms[j].Room })
+	return rooms
+}
 
-	for client := range clients {
-		if client.getClientType() == ClientTypeFoundry {
-			return true
+// Room returns a snapshot of one room and its clients, or
+// ErrRoomNotFound if nobody is in it.
+func (r *Relay) Room(room string) (RoomInfo, error) {
+	room = NormalizeRoomCode(room)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.rooms[room]; !ok {
+		return RoomInfo{}, ErrRoomNotFound
+	}
+	return r.roomInfoLocked(room, time.Now()), nil
+}
+
+// roomInfoLocked summarizes an existing room as of now, with clients in
+// connection order. Callers must hold r.mu.
+func (r *Relay) roomInfoLocked(room string, now time.Time) RoomInfo {
+	clients := r.rooms[room]
+	counters := r.metrics.lookupRoom(room)
+	info := RoomInfo{
+		Room:            room,
+		Clients:         make([]ClientInfo, 0, len(clients)),
+		MessagesRelayed: counters.messagesRelayed,
+		BytesRelayed:    counters.bytesRelayed,
+		SlowClientDrops: counters.slowClientDrops,
+	}
+	for c := range clients {
+		clientType := c.getClientType()
+		switch clientType {
+		case ClientTypeFoundry:
+			info.FoundryConnected = true
+		case ClientTypePhone:
+			info.PhoneCount++
 		}
+		info.Clients = append(info.Clients, ClientInfo{
+			ID:           c.id,
+			Type:         clientType,
+			ConnectedAt:  c.connectedAt,
+			Duration:     now.Sub(c.connectedAt),
+			DroppedCount: c.dropped.Load(),
+		})
 	}
-	return false
+	sort.Slice(info.Clients, func(i, j int) bool {
+		return info.Clients[i].ConnectedAt.Before(info.Clients[j].ConnectedAt)
+	})
+	return info
 }
 
-// broadcastRoomStatus sends ROOM_STATUS to all clients in a room.
-func (r *Relay) broadcastRoomStatus(room string) {
+// KickClient disconnects one client with CloseKicked. The client's normal
+// cleanup runs, so the rest of the room receives an updated ROOM_STATUS.
+func (r *Relay) KickClient(room, clientID string) error {
+	room = NormalizeRoomCode(room)
 	r.mu.RLock()
 	clients, ok := r.rooms[room]
 	if !ok {
 		r.mu.RUnlock()
-		return
+		return ErrRoomNotFound
 	}
-
-	foundryConnected := false
-	for client := range clients {
-		if client.getClientType() == ClientTypeFoundry {
-			foundryConnected = true
+	var target *Client
+	for c := range clients {
+		if c.id == clientID {
+			target = c
 			break
 		}
 	}
+	r.mu.RUnlock()
+
+	if target == nil {
+		return ErrClientNotFound
+	}
+	target.log(LogInfo, "Kicking client %s from room %s", clientID, room)
+	target.beginClose(CloseReasonKicked)
+	return nil
+}
 
-	// Copy clients to send to (avoid holding lock during send)
+// CloseRoom disconnects every client in a room with CloseKicked.
+func (r *Relay) CloseRoom(room string) error {
+	room = NormalizeRoomCode(room)
+	r.mu.RLock()
+	clients, ok := r.rooms[room]
+	if !ok {
+		r.mu.RUnlock()
+		return ErrRoomNotFound
+	}
 	clientList := make([]*Client, 0, len(clients))
-	for client := range clients {
-		clientList = append(clientList, client)
+	for c := range clients {
+		clientList = append(clientList, c)
 	}
 	r.mu.RUnlock()
 
+	r.log(LogInfo, "Closing room %s (%d clients)", room, len(clientList))
+	for _, c := range clientList {
+		c.beginClose(CloseReasonRoomClosed)
+	}
+	return nil
+}
+
+// Broadcast sends a server-originated message to every client in a room.
+// Clients whose send buffer is full miss the message, as with relayed
+// traffic.
+func (r *Relay) Broadcast(room string, msgType MessageType, payload any) error {
+	room = NormalizeRoomCode(room)
+	msg, err := MakeEnvelope(msgType, payload)
+	if err != nil {
+		return fmt.Errorf("failed to create %s message: %w", msgType, err)
+	}
+
+	r.mu.RLock()
+	clients, ok := r.rooms[room]
+	if !ok {
+		r.mu.RUnlock()
+		return ErrRoomNotFound
+	}
+	clientList := make([]*Client, 0, len(clients))
+	for c := range clients {
+		clientList = append(clientList, c)
+	}
+	r.mu.RUnlock()
+
+	r.log(LogInfo, "Broadcasting %s to room %s (%d clients)", msgType, room, len(clientList))
+	for _, c := range clientList {
+		if !c.trySend(msg) {
+			r.metrics.recordSlowClientDrop(room)
+		}
+	}
+	return nil
+}
+
+// roomSubject returns the NATS subject carrying a room's messages.
+func (r *Relay) roomSubject(room string) string {
+	return r.config.SubjectPrefix + "." + room
+}
+
+// broadcastRoomStatus sends ROOM_STATUS to all clients in a room.
+func (r *Relay) broadcastRoomStatus(room string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sendRoomStatusLocked(room, nil)
+}
+
+// setIdentity changes a client's type and display name and broadcasts
+// ROOM_STATUS, under the same lock, only if that changes whether the room
+// has a Foundry or who is listed as a participant. It returns false,
+// leaving the client unchanged, if SingleFoundryPerRoom is set and
+// another client already identified as Foundry.
+func (r *Relay) setIdentity(c *Client, clientType ClientType, name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before := r.foundryConnectedLocked(c.room)
+	if clientType == ClientTypeFoundry && clientType != c.getClientType() && before && r.config.SingleFoundryPerRoom {
+		return false
+	}
+
+	c.mu.Lock()
+	oldType, oldName := c.clientType, c.displayName
+	c.clientType, c.displayName = clientType, name
+	c.mu.Unlock()
+
+	listed := oldName != "" || name != ""
+	participantsChanged := listed && (oldName != name || oldType != clientType)
+	if r.foundryConnectedLocked(c.room) != before || participantsChanged {
+		r.sendRoomStatusLocked(c.room, nil)
+	}
+	if oldType != clientType || oldName != name {
+		r.sendPresenceLocked(c.room)
+	}
+	return true
+}
+
+// foundryConnected reports whether any client in the room has
+// identified as Foundry.
+func (r *Relay) foundryConnected(room string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.foundryConnectedLocked(room)
+}
+
+// foundryConnectedLocked reports whether any client in the room has
+// identified as Foundry. Callers must hold r.mu.
+func (r *Relay) foundryConnectedLocked(room string) bool {
+	for client := range r.rooms[room] {
+		if client.getClientType() == ClientTypeFoundry {
+			return true
+		}
+	}
+	return false
+}
+
+// sendRoomStatusLocked queues the room's current ROOM_STATUS for targets,
+// or for every client in the room if targets is nil. Callers must hold
+// r.mu exclusively: computing and queueing under one lock means status
+// messages reach each client in the same order as the membership and
+// identity changes they describe, so a stale status can never arrive last.
+// Sends never block, so holding the lock here is cheap.
+func (r *Relay) sendRoomStatusLocked(room string, targets []*Client) {
+	clients, ok := r.rooms[room]
+	if !ok {
+		return
+	}
+
 	msg, err := MakeEnvelope(TypeRoomStatus, RoomStatusPayload{
-		FoundryConnected: foundryConnected,
+		FoundryConnected: r.foundryConnectedLocked(room),
+		Participants:     participantsLocked(clients),
+		ServerVersion:    r.config.ServerVersion,
 	})
 	if err != nil {
-		r.log(LogError, "Failed to create ROOM_STATUS message: %v", err)
+		r.log(LogError, "Failed to send room %s status: %v", room, err)
 		return
 	}
 
-	for _, client := range clientList {
+	if targets == nil {
+		for client := range clients {
+			client.trySend(msg)
+		}
+		return
+	}
+	for _, client := range targets {
 		client.trySend(msg)
 	}
 }
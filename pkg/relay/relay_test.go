@@ -1,9 +1,17 @@
 package relay
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -12,11 +20,17 @@ import (
 )
 
 // startTestNATS starts an ephemeral NATS server for testing.
-func startTestNATS(t *testing.T) *natsserver.Server {
+func startTestNATS(t testing.TB) *natsserver.Server {
+	t.Helper()
+	return startTestNATSOnPort(t, -1) // Random available port
+}
+
+// startTestNATSOnPort starts an embedded NATS server on port.
+func startTestNATSOnPort(t testing.TB, port int) *natsserver.Server {
 	t.Helper()
 	opts := &natsserver.Options{
 		Host:   "127.0.0.1",
-		Port:   -1, // Random available port
+		Port:   port,
 		NoLog:  true,
 		NoSigs: true,
 	}
@@ -33,35 +47,53 @@ func startTestNATS(t *testing.T) *natsserver.Server {
 
 // setupTestRelay creates a test server with WebSocket endpoint.
 func setupTestRelay(t *testing.T) (*httptest.Server, *Relay, func()) {
+	t.Helper()
+	return setupTestRelayWithConfig(t, Config{})
+}
+
+// setupTestRelayWithConfig creates a test server using the given relay config.
+// NatsURL is filled in from the ephemeral test NATS server.
+func setupTestRelayWithConfig(t *testing.T, cfg Config) (*httptest.Server, *Relay, func()) {
 	t.Helper()
 	ns := startTestNATS(t)
 
-	r, err := NewRelay(Config{NatsURL: ns.ClientURL()})
+	cfg.NatsURL = ns.ClientURL()
+	r, err := NewRelay(cfg)
 	if err != nil {
 		ns.Shutdown()
 		t.Fatalf("Failed to create relay: %v", err)
 	}
+	server := serveRelay(t, r)
+
+	cleanup := func() {
+		server.Close()
+		r.Close()
+		ns.Shutdown()
+	}
 
+	return server, r, cleanup
+}
+
+// serveRelay starts a test server passing every WebSocket to r.
+func serveRelay(t *testing.T, r *Relay) *httptest.Server {
+	t.Helper()
 	upgrader := websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool { return true },
+		CheckOrigin:       func(r *http.Request) bool { return true },
+		EnableCompression: r.CompressionEnabled(),
+		Subprotocols:      r.Subprotocols(),
 	}
 
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		conn, err := upgrader.Upgrade(w, req, nil)
 		if err != nil {
 			t.Logf("Upgrade failed: %v", err)
 			return
 		}
+		if !r.CheckSubprotocol(req, conn) {
+			return
+		}
 		r.HandleClient(conn)
 	}))
-
-	cleanup := func() {
-		server.Close()
-		r.Close()
-		ns.Shutdown()
-	}
-
-	return server, r, cleanup
 }
 
 // dialWS connects to the test server's WebSocket endpoint.
@@ -185,6 +217,83 @@ func TestRelayMessageBroadcast(t *testing.T) {
 	}
 }
 
+func TestRelayRoomStatusServerVersion(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{ServerVersion: "1.2.3"})
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"VERS1"}}`))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read ROOM_STATUS: %v", err)
+	}
+	env, err := ParseEnvelope(data)
+	if err != nil || env.Type != TypeRoomStatus {
+		t.Fatalf("Expected ROOM_STATUS, got %s", data)
+	}
+	var status RoomStatusPayload
+	if err := json.Unmarshal(env.Payload, &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.ServerVersion != "1.2.3" {
+		t.Errorf("ServerVersion = %q, want 1.2.3", status.ServerVersion)
+	}
+}
+
+func TestRelayEchoToSender(t *testing.T) {
+	echo, noEcho := true, false
+	tests := []struct {
+		name string
+		echo *bool
+		want bool
+	}{
+		{name: "default", echo: nil, want: true},
+		{name: "echo", echo: &echo, want: true},
+		{name: "no echo", echo: &noEcho, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _, cleanup := setupTestRelayWithConfig(t, Config{EchoToSender: tt.echo})
+			defer cleanup()
+
+			conn1 := dialWS(t, server.URL)
+			defer conn1.Close()
+			conn2 := dialWS(t, server.URL)
+			defer conn2.Close()
+
+			joinMsg := `{"type":"JOIN","payload":{"room":"ECHO1"}}`
+			conn1.WriteMessage(websocket.TextMessage, []byte(joinMsg))
+			consumeRoomStatus(t, conn1)
+			conn2.WriteMessage(websocket.TextMessage, []byte(joinMsg))
+			consumeRoomStatus(t, conn2)
+
+			moveMsg := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`
+			conn1.WriteMessage(websocket.TextMessage, []byte(moveMsg))
+
+			// The other client receives the message unchanged
+			conn2.SetReadDeadline(time.Now().Add(time.Second))
+			if _, msg, err := conn2.ReadMessage(); err != nil {
+				t.Fatalf("Client 2 read error: %v", err)
+			} else if string(msg) != moveMsg {
+				t.Errorf("Client 2 got %s, want %s", msg, moveMsg)
+			}
+
+			// The sender gets its own message back only with echo on
+			conn1.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			_, msg, err := conn1.ReadMessage()
+			if tt.want && (err != nil || string(msg) != moveMsg) {
+				t.Errorf("Sender echo = %s, %v; want %s", msg, err, moveMsg)
+			} else if !tt.want && err == nil {
+				t.Errorf("Sender received its own message: %s", msg)
+			}
+		})
+	}
+}
+
 func TestRelayDisconnectCleanup(t *testing.T) {
 	server, r, cleanup := setupTestRelay(t)
 	defer cleanup()
@@ -237,7 +346,7 @@ func TestRelayMultipleRooms(t *testing.T) {
 	}
 
 	// Message in ROOM1 should not reach ROOM2
-	conn1.WriteMessage(websocket.TextMessage, []byte(`{"type":"MOVE","payload":{"direction":"up"}}`))
+	conn1.WriteMessage(websocket.TextMessage, []byte(`{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`))
 
 	conn1.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
 	_, _, err1 := conn1.ReadMessage()
@@ -296,6 +405,125 @@ func TestRelayStats(t *testing.T) {
 	}
 }
 
+func TestRelayStatsPerRoom(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	join := func(room, clientType string) {
+		t.Helper()
+		conn := dialWS(t, server.URL)
+		t.Cleanup(func() { conn.Close() })
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+room+`"}}`))
+		consumeRoomStatus(t, conn)
+		if clientType != "" {
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"`+clientType+`"}}`))
+		}
+	}
+
+	before := time.Now()
+	join("ROOMA", "foundry")
+	join("ROOMA", "phone")
+	join("ROOMA", "phone")
+	join("ROOMB", "phone")
+	join("ROOMB", "")
+	time.Sleep(50 * time.Millisecond)
+
+	stats := r.Stats()
+	want := map[string]RoomStats{
+		"ROOMA": {ClientCount: 3, FoundryCount: 1, PhoneCount: 2},
+		"ROOMB": {ClientCount: 2, PhoneCount: 1},
+	}
+	if len(stats.Rooms) != len(want) {
+		t.Fatalf("Rooms = %+v, want %d rooms", stats.Rooms, len(want))
+	}
+	for code, w := range want {
+		got, ok := stats.Rooms[code]
+		if !ok {
+			t.Errorf("Missing room %s", code)
+			continue
+		}
+		if got.LastActivity.Before(before) || got.LastActivity.After(time.Now()) {
+			t.Errorf("Room %s LastActivity = %v, want since %v", code, got.LastActivity, before)
+		}
+		got.LastActivity = time.Time{}
+		if got != w {
+			t.Errorf("Room %s = %+v, want %+v", code, got, w)
+		}
+	}
+
+	// Global totals still cover every room
+	if stats.RoomCount != 2 || stats.ClientCount != 5 || stats.FoundryCount != 1 || stats.PhoneCount != 3 {
+		t.Errorf("Global stats = %+v", stats)
+	}
+
+	// The map is a copy
+	delete(stats.Rooms, "ROOMA")
+	if _, ok := r.Stats().Rooms["ROOMA"]; !ok {
+		t.Error("Modifying the snapshot changed relay state")
+	}
+}
+
+func TestRelayDuplicateIdentify(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	observer := dialWS(t, server.URL)
+	defer observer.Close()
+	observer.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"DUPID"}}`))
+	consumeRoomStatus(t, observer)
+
+	foundry := dialWS(t, server.URL)
+	defer foundry.Close()
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"DUPID"}}`))
+	consumeRoomStatus(t, foundry)
+
+	for i := 0; i < 5; i++ {
+		foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry"}}`))
+	}
+	// A type change right after the first identify is rate-limited
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone"}}`))
+
+	statuses := 0
+	observer.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	for {
+		_, data, err := observer.ReadMessage()
+		if err != nil {
+			break
+		}
+		if env, err := ParseEnvelope(data); err == nil && env.Type == TypeRoomStatus {
+			statuses++
+		}
+	}
+	if statuses != 1 {
+		t.Errorf("Observer got %d ROOM_STATUS broadcasts, want 1", statuses)
+	}
+	if stats := r.Stats(); stats.FoundryCount != 1 || stats.PhoneCount != 0 {
+		t.Errorf("Stats after rapid type change = %+v, want foundry kept", stats)
+	}
+}
+
+func TestRelayPhoneIdentifyNoBroadcast(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	observer := dialWS(t, server.URL)
+	defer observer.Close()
+	observer.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"PHID1"}}`))
+	consumeRoomStatus(t, observer)
+
+	phone := dialWS(t, server.URL)
+	defer phone.Close()
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"PHID1"}}`))
+	consumeRoomStatus(t, phone)
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone"}}`))
+
+	// Foundry presence did not change, so no ROOM_STATUS is sent
+	observer.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := observer.ReadMessage(); err == nil {
+		t.Errorf("Observer received %s", data)
+	}
+}
+
 func TestValidateRoomCode(t *testing.T) {
 	valid := []string{"GAME", "game1", "ABC123", "test", "ABCD1234"}
 	invalid := []string{"AB", "ABC", "ABCDEFGHI", "game-1", "game_1", "game 1", ""}
@@ -312,3 +540,1586 @@ func TestValidateRoomCode(t *testing.T) {
 		}
 	}
 }
+
+func TestRelayKeepaliveDropsDeadClient(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{
+		PingInterval: 20 * time.Millisecond,
+		PongTimeout:  100 * time.Millisecond,
+	})
+	defer cleanup()
+
+	// Responsive client: reading processes pings and replies with pongs
+	alive := dialWS(t, server.URL)
+	defer alive.Close()
+	alive.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"PING1"}}`))
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Dead client: never reads, so it never answers pings
+	dead := dialWS(t, server.URL)
+	defer dead.Close()
+	dead.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"PING1"}}`))
+
+	time.Sleep(50 * time.Millisecond)
+	if r.ClientCount() != 2 {
+		t.Fatalf("ClientCount = %d, want 2", r.ClientCount())
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if r.ClientCount() != 1 {
+		t.Errorf("ClientCount after pong timeout = %d, want 1", r.ClientCount())
+	}
+}
+
+func TestRelayConcurrentJoinLeaveBroadcast(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	// Long-lived client receives every ROOM_STATUS broadcast
+	anchor := dialWS(t, server.URL)
+	defer anchor.Close()
+	anchor.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"RACE1"}}`))
+	go func() {
+		for {
+			if _, _, err := anchor.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Churn: each client joins, identifies (broadcast), and leaves (broadcast)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn := dialWS(t, server.URL)
+			defer conn.Close()
+			clientType := "phone"
+			if i%2 == 0 {
+				clientType = "foundry"
+			}
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"RACE1"}}`))
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"`+clientType+`"}}`))
+			time.Sleep(10 * time.Millisecond)
+		}(i)
+	}
+	wg.Wait()
+
+	time.Sleep(100 * time.Millisecond)
+	if r.ClientCount() != 1 {
+		t.Errorf("ClientCount after churn = %d, want 1", r.ClientCount())
+	}
+}
+
+func TestRelayMoveSequence(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{StampSequence: true})
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"SEQ1"}}`))
+	consumeRoomStatus(t, conn)
+
+	// The envelope ID survives re-encoding
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"MOVE","id":"m1","payload":{"direction":"up","tokenId":"tok1"}}`))
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`))
+
+	var last uint64
+	for i, wantID := range []string{"m1", ""} {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Read %d error: %v", i, err)
+		}
+		env, err := ParseEnvelope(data)
+		if err != nil {
+			t.Fatalf("Parse %d error: %v", i, err)
+		}
+		if env.Type != TypeMove {
+			t.Fatalf("Message %d type = %s, want MOVE", i, env.Type)
+		}
+		if env.Seq <= last {
+			t.Errorf("Seq = %d, want > %d", env.Seq, last)
+		}
+		last = env.Seq
+		if env.ID != wantID {
+			t.Errorf("Message %d ID = %q, want %q", i, env.ID, wantID)
+		}
+	}
+}
+
+func TestRelayMoveSequenceDisabled(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"SEQ2"}}`))
+	consumeRoomStatus(t, conn)
+
+	moveMsg := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`
+	conn.WriteMessage(websocket.TextMessage, []byte(moveMsg))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if string(data) != moveMsg {
+		t.Errorf("Got %s, want unmodified %s", data, moveMsg)
+	}
+}
+
+func TestRelayStampServerTime(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("enabled=%v", enabled), func(t *testing.T) {
+			server, _, cleanup := setupTestRelayWithConfig(t, Config{StampServerTime: enabled})
+			defer cleanup()
+
+			conn := dialWS(t, server.URL)
+			defer conn.Close()
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"TIME1"}}`))
+			consumeRoomStatus(t, conn)
+
+			before := time.Now().UnixMilli()
+			var last int64
+			for i, msg := range []string{
+				`{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`,
+				`{"type":"ACTOR_UPDATE","payload":{"tokenId":"tok1"}}`,
+			} {
+				conn.WriteMessage(websocket.TextMessage, []byte(msg))
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					t.Fatalf("Read %d error: %v", i, err)
+				}
+				if !enabled {
+					if string(data) != msg {
+						t.Errorf("Got %s, want unmodified %s", data, msg)
+					}
+					continue
+				}
+				env, err := ParseEnvelope(data)
+				if err != nil {
+					t.Fatalf("Parse %d error: %v", i, err)
+				}
+				if env.ServerTime < before || env.ServerTime < last || env.ServerTime > time.Now().UnixMilli() {
+					t.Errorf("Message %d ServerTime = %d, want between %d and now, not before %d", i, env.ServerTime, before, last)
+				}
+				last = env.ServerTime
+			}
+		})
+	}
+}
+
+func TestRelayShutdownDrainsClients(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	conns := make([]*websocket.Conn, 2)
+	for i := range conns {
+		conns[i] = dialWS(t, server.URL)
+		defer conns[i].Close()
+		conns[i].WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"DRAIN1"}}`))
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Each client drains its reads so it answers the close handshake
+	results := make(chan []MessageType, len(conns))
+	errs := make(chan error, len(conns))
+	for _, conn := range conns {
+		go func(conn *websocket.Conn) {
+			var types []MessageType
+			for {
+				conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					results <- types
+					errs <- err
+					return
+				}
+				if env, err := ParseEnvelope(data); err == nil {
+					types = append(types, env.Type)
+				}
+			}
+		}(conn)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := r.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	for range conns {
+		types := <-results
+		err := <-errs
+		if len(types) == 0 || types[len(types)-1] != TypeServerShutdown {
+			t.Errorf("Last message types = %v, want SERVER_SHUTDOWN last", types)
+		}
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("Expected going-away close, got %v", err)
+		}
+	}
+
+	if r.ClientCount() != 0 {
+		t.Errorf("ClientCount after Shutdown = %d, want 0", r.ClientCount())
+	}
+
+	// New joins are rejected after shutdown
+	late := dialWS(t, server.URL)
+	defer late.Close()
+	late.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"DRAIN1"}}`))
+	late.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := late.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Expected late join to be closed with going-away, got %v", err)
+	}
+}
+
+func TestRelayCloseDisconnectsClients(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+	before := runtime.NumGoroutine()
+
+	conns := make([]*websocket.Conn, 5)
+	for i := range conns {
+		conns[i] = dialWS(t, server.URL)
+		defer conns[i].Close()
+		conns[i].WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"CLOSE`+strconv.Itoa(i%2)+`"}}`))
+	}
+	deadline := time.Now().Add(time.Second)
+	for r.ClientCount() != len(conns) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r.ClientCount() != len(conns) {
+		t.Fatalf("ClientCount = %d, want %d", r.ClientCount(), len(conns))
+	}
+
+	start := time.Now()
+	r.Close()
+	if elapsed := time.Since(start); elapsed >= closeDrainTimeout {
+		t.Errorf("Close took %v, hitting the drain timeout", elapsed)
+	}
+	if r.ClientCount() != 0 {
+		t.Errorf("ClientCount after Close = %d, want 0", r.ClientCount())
+	}
+	for _, conn := range conns {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				break
+			}
+		}
+	}
+
+	// Pumps and per-connection handler goroutines are all gone
+	deadline = time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("%d goroutines after Close, %d before clients joined", after, before)
+	}
+}
+
+func TestRelayHandleClientContext(t *testing.T) {
+	_, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		r.HandleClientContext(ctx, conn)
+	}))
+	defer server.Close()
+
+	idle := dialWS(t, server.URL)
+	defer idle.Close()
+	idle.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"CTX1"}}`))
+	consumeRoomStatus(t, idle)
+
+	// A second connection never sends JOIN
+	pending := dialWS(t, server.URL)
+	defer pending.Close()
+
+	start := time.Now()
+	cancel()
+
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := idle.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Expected going-away close, got %v", err)
+	}
+	pending.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := pending.ReadMessage(); err == nil {
+		t.Error("Connection waiting for JOIN stayed open after cancel")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Cancellation took %v", elapsed)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for r.ClientCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r.ClientCount() != 0 {
+		t.Errorf("ClientCount = %d, want 0 after cancel", r.ClientCount())
+	}
+}
+
+func TestRelaySubjectPrefix(t *testing.T) {
+	ns := startTestNATS(t)
+	defer ns.Shutdown()
+
+	// Two relays share one NATS server under different prefixes
+	var servers []*httptest.Server
+	for _, prefix := range []string{"tenant-a.game", "tenant-b"} {
+		r, err := NewRelay(Config{NatsURL: ns.ClientURL(), SubjectPrefix: prefix})
+		if err != nil {
+			t.Fatalf("NewRelay(%q): %v", prefix, err)
+		}
+		defer r.Close()
+		server := serveRelay(t, r)
+		defer server.Close()
+		servers = append(servers, server)
+	}
+
+	join := []byte(`{"type":"JOIN","payload":{"room":"SHARE1"}}`)
+	sender := dialWS(t, servers[0].URL)
+	defer sender.Close()
+	sender.WriteMessage(websocket.TextMessage, join)
+	consumeRoomStatus(t, sender)
+	other := dialWS(t, servers[1].URL)
+	defer other.Close()
+	other.WriteMessage(websocket.TextMessage, join)
+	consumeRoomStatus(t, other)
+
+	move := `{"type":"MOVE","payload":{"tokenId":"tok1","direction":"up"}}`
+	sender.WriteMessage(websocket.TextMessage, []byte(move))
+
+	// The sender's relay delivers it (echo included); the other does not
+	sender.SetReadDeadline(time.Now().Add(time.Second))
+	if _, data, err := sender.ReadMessage(); err != nil || string(data) != move {
+		t.Errorf("Sender's relay: got %s, %v; want %s", data, err, move)
+	}
+	other.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, data, err := other.ReadMessage(); err == nil {
+		t.Errorf("Relay with another prefix received %s", data)
+	}
+}
+
+func TestNewRelayInvalidSubjectPrefix(t *testing.T) {
+	for _, prefix := range []string{"game.*", "game.>", "a..b", ".game", "my game"} {
+		if r, err := NewRelay(Config{NatsURL: "nats://127.0.0.1:1", SubjectPrefix: prefix}); err == nil {
+			r.Close()
+			t.Errorf("NewRelay accepted subject prefix %q", prefix)
+		}
+	}
+}
+
+func TestRelayProtocolVersion(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		join      string
+		wantClose bool
+	}{
+		{
+			name: "missing version defaults to 1",
+			join: `{"type":"JOIN","payload":{"room":"VER1"}}`,
+		},
+		{
+			name: "explicit supported version",
+			join: `{"type":"JOIN","payload":{"room":"VER1","protoVersion":1}}`,
+		},
+		{
+			name:      "too new",
+			join:      `{"type":"JOIN","payload":{"room":"VER1","protoVersion":99}}`,
+			wantClose: true,
+		},
+		{
+			name:      "too old",
+			cfg:       Config{MinProtoVersion: 2, MaxProtoVersion: 3},
+			join:      `{"type":"JOIN","payload":{"room":"VER1"}}`,
+			wantClose: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _, cleanup := setupTestRelayWithConfig(t, tt.cfg)
+			defer cleanup()
+
+			conn := dialWS(t, server.URL)
+			defer conn.Close()
+			conn.WriteMessage(websocket.TextMessage, []byte(tt.join))
+
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, data, err := conn.ReadMessage()
+			if tt.wantClose {
+				if !websocket.IsCloseError(err, CloseUnsupportedVersion) {
+					t.Errorf("Expected close %d, got %v", CloseUnsupportedVersion, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected ROOM_STATUS, got error %v", err)
+			}
+			if env, _ := ParseEnvelope(data); env == nil || env.Type != TypeRoomStatus {
+				t.Errorf("Expected ROOM_STATUS, got %s", data)
+			}
+		})
+	}
+}
+
+func TestRelayRoomCapacity(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{MaxClientsPerRoom: 2})
+	defer cleanup()
+
+	// Fill the room
+	for i := 0; i < 2; i++ {
+		conn := dialWS(t, server.URL)
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"FULL1"}}`))
+		consumeRoomStatus(t, conn)
+	}
+
+	// Next join is rejected
+	extra := dialWS(t, server.URL)
+	defer extra.Close()
+	extra.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"FULL1"}}`))
+	extra.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := extra.ReadMessage(); !websocket.IsCloseError(err, CloseRoomFull) {
+		t.Errorf("Expected close %d, got %v", CloseRoomFull, err)
+	}
+
+	// Existing clients are unaffected; other rooms still accept joins
+	if r.ClientCount() != 2 {
+		t.Errorf("ClientCount = %d, want 2", r.ClientCount())
+	}
+	other := dialWS(t, server.URL)
+	defer other.Close()
+	other.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"FULL2"}}`))
+	consumeRoomStatus(t, other)
+}
+
+func TestRelayMaxRoomsConcurrent(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{MaxRooms: 3})
+	defer cleanup()
+
+	const attempts = 8
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted, rejected := 0, 0
+	conns := make([]*websocket.Conn, attempts)
+
+	for i := 0; i < attempts; i++ {
+		conns[i] = dialWS(t, server.URL)
+		defer conns[i].Close()
+	}
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn := conns[i]
+			room := fmt.Sprintf("CAP%d", i)
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+room+`"}}`))
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			_, _, err := conn.ReadMessage()
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				accepted++
+			case websocket.IsCloseError(err, CloseServerFull):
+				rejected++
+			default:
+				t.Errorf("Unexpected result for %s: %v", room, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if accepted != 3 || rejected != attempts-3 {
+		t.Errorf("accepted=%d rejected=%d, want 3 and %d", accepted, rejected, attempts-3)
+	}
+	if r.RoomCount() != 3 {
+		t.Errorf("RoomCount = %d, want 3", r.RoomCount())
+	}
+
+	// Joining an existing room still works at the cap
+	var existing string
+	r.mu.RLock()
+	for room := range r.rooms {
+		existing = room
+		break
+	}
+	r.mu.RUnlock()
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+existing+`"}}`))
+	consumeRoomStatus(t, conn)
+}
+
+// sizedMove builds a MOVE message of exactly n bytes.
+func sizedMove(t *testing.T, n int) []byte {
+	t.Helper()
+	prefix, suffix := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1","pad":"`, `"}}`
+	pad := n - len(prefix) - len(suffix)
+	if pad < 0 {
+		t.Fatalf("Size %d too small for MOVE envelope", n)
+	}
+	return []byte(prefix + strings.Repeat("x", pad) + suffix)
+}
+
+func TestRelayMessageSizeLimit(t *testing.T) {
+	const limit = 256
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{MaxMessageBytes: limit})
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"SIZE1"}}`))
+	consumeRoomStatus(t, conn)
+
+	// Just over the limit is dropped; exactly at the limit is relayed
+	conn.WriteMessage(websocket.TextMessage, sizedMove(t, limit+1))
+	atLimit := sizedMove(t, limit)
+	conn.WriteMessage(websocket.TextMessage, atLimit)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if len(data) != limit {
+		t.Errorf("Received %d-byte message, want the %d-byte one", len(data), limit)
+	}
+
+	// Repeated oversized messages close the connection
+	for i := 0; i < maxSizeViolations; i++ {
+		conn.WriteMessage(websocket.TextMessage, sizedMove(t, limit+1))
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, CloseProtocolError) {
+		t.Errorf("Expected close %d, got %v", CloseProtocolError, err)
+	}
+}
+
+func TestRelayTransportReadLimit(t *testing.T) {
+	const limit = 256
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{MaxMessageBytes: limit})
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"SIZE2"}}`))
+	consumeRoomStatus(t, conn)
+
+	conn.WriteMessage(websocket.TextMessage, sizedMove(t, limit*readLimitMultiplier+1))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("Expected close %d, got %v", websocket.CloseMessageTooBig, err)
+	}
+}
+
+func TestRelayDropsUnknownMessageTypes(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"TYPE1"}}`))
+	consumeRoomStatus(t, conn)
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"FORGED","payload":{}}`))
+	moveMsg := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`
+	conn.WriteMessage(websocket.TextMessage, []byte(moveMsg))
+
+	// Only the MOVE comes back
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if string(data) != moveMsg {
+		t.Errorf("Got %s, want %s", data, moveMsg)
+	}
+}
+
+func TestRelayIgnoresRepeatJoin(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	sender := dialWS(t, server.URL)
+	defer sender.Close()
+	sender.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"AGAIN1"}}`))
+	consumeRoomStatus(t, sender)
+	peer := dialWS(t, server.URL)
+	defer peer.Close()
+	peer.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"AGAIN1"}}`))
+	consumeRoomStatus(t, peer)
+
+	sender.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"OTHER1"}}`))
+	moveMsg := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`
+	sender.WriteMessage(websocket.TextMessage, []byte(moveMsg))
+
+	// The peer sees only the MOVE, and the sender stays in its room
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := peer.ReadMessage()
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if string(data) != moveMsg {
+		t.Errorf("Got %s, want %s", data, moveMsg)
+	}
+	if n := len(r.ListRooms()); n != 1 {
+		t.Errorf("%d rooms, want 1", n)
+	}
+}
+
+func TestRelayCustomAllowedMessageTypes(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{
+		AllowedMessageTypes: []MessageType{TypeMove, "CUSTOM"},
+	})
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"TYPE2"}}`))
+	consumeRoomStatus(t, conn)
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"PAIR","payload":{"code":"1234"}}`))
+	customMsg := `{"type":"CUSTOM","payload":{}}`
+	conn.WriteMessage(websocket.TextMessage, []byte(customMsg))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if string(data) != customMsg {
+		t.Errorf("Got %s, want %s", data, customMsg)
+	}
+}
+
+// logEvent is a captured structured log event.
+type logEvent struct {
+	level   LogLevel
+	message string
+	fields  map[string]any
+}
+
+func TestRelayStructuredLogging(t *testing.T) {
+	var mu sync.Mutex
+	var events []logEvent
+	var plain []string
+
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{
+		OnLog: func(level LogLevel, message string) {
+			mu.Lock()
+			defer mu.Unlock()
+			plain = append(plain, message)
+		},
+		OnLogStructured: func(level LogLevel, message string, fields map[string]any) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, logEvent{level, message, fields})
+		},
+	})
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"LOG1"}}`))
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone"}}`))
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	find := func(prefix string) *logEvent {
+		for i := range events {
+			if strings.HasPrefix(events[i].message, prefix) {
+				return &events[i]
+			}
+		}
+		return nil
+	}
+
+	join := find("Client joined room")
+	if join == nil {
+		t.Fatalf("No join event in %+v", events)
+	}
+	if join.fields["room"] != "LOG1" {
+		t.Errorf("join room = %v, want LOG1", join.fields["room"])
+	}
+	if addr, _ := join.fields["remoteAddr"].(string); !strings.HasPrefix(addr, "127.0.0.1:") {
+		t.Errorf("join remoteAddr = %v, want 127.0.0.1:*", join.fields["remoteAddr"])
+	}
+
+	identify := find("Client identified")
+	if identify == nil {
+		t.Fatalf("No identify event in %+v", events)
+	}
+	if identify.fields["clientType"] != "phone" {
+		t.Errorf("identify clientType = %v, want phone", identify.fields["clientType"])
+	}
+
+	// Plain callback still receives the same messages
+	if len(plain) != len(events) {
+		t.Errorf("OnLog got %d messages, OnLogStructured got %d", len(plain), len(events))
+	}
+}
+
+func TestLogLevelAtLeast(t *testing.T) {
+	tests := []struct {
+		level, min LogLevel
+		want       bool
+	}{
+		{LogDebug, "", true},
+		{LogDebug, LogInfo, false},
+		{LogInfo, LogInfo, true},
+		{LogInfo, LogWarn, false},
+		{LogWarn, LogWarn, true},
+		{LogError, LogWarn, true},
+		{"notice", LogInfo, true},
+		{"notice", LogWarn, false},
+	}
+	for _, tt := range tests {
+		if got := tt.level.AtLeast(tt.min); got != tt.want {
+			t.Errorf("%q.AtLeast(%q) = %v, want %v", tt.level, tt.min, got, tt.want)
+		}
+	}
+
+	if level, err := ParseLogLevel(" WARN "); err != nil || level != LogWarn {
+		t.Errorf("ParseLogLevel(WARN) = %q, %v", level, err)
+	}
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Error("ParseLogLevel(verbose) succeeded")
+	}
+}
+
+func TestRelayMinLogLevel(t *testing.T) {
+	var plain, structured []LogLevel
+	r := &Relay{config: Config{
+		MinLogLevel: LogWarn,
+		OnLog:       func(level LogLevel, message string) { plain = append(plain, level) },
+		OnLogStructured: func(level LogLevel, message string, fields map[string]any) {
+			structured = append(structured, level)
+		},
+	}}
+	r.log(LogDebug, "debug")
+	r.log(LogInfo, "info")
+	r.log(LogWarn, "warn")
+	r.log(LogError, "error")
+
+	want := []LogLevel{LogWarn, LogError}
+	if !reflect.DeepEqual(plain, want) || !reflect.DeepEqual(structured, want) {
+		t.Errorf("Logged %v and %v, want %v", plain, structured, want)
+	}
+}
+
+func TestRelayListRooms(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	join := func(room, clientType string) *websocket.Conn {
+		conn := dialWS(t, server.URL)
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+room+`"}}`))
+		if clientType != "" {
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"`+clientType+`"}}`))
+		}
+		time.Sleep(20 * time.Millisecond)
+		return conn
+	}
+
+	for _, conn := range []*websocket.Conn{
+		join("LIST1", "foundry"),
+		join("LIST1", "phone"),
+		join("LIST1", "phone"),
+		join("LIST2", ""),
+	} {
+		defer conn.Close()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	rooms := r.ListRooms()
+	if len(rooms) != 2 {
+		t.Fatalf("len(ListRooms) = %d, want 2", len(rooms))
+	}
+
+	mixed := rooms[0]
+	if mixed.Room != "LIST1" || !mixed.FoundryConnected || mixed.PhoneCount != 2 || len(mixed.Clients) != 3 {
+		t.Errorf("LIST1 = %+v", mixed)
+	}
+	if mixed.Clients[0].Type != ClientTypeFoundry {
+		t.Errorf("First client type = %q, want foundry (oldest first)", mixed.Clients[0].Type)
+	}
+	for _, c := range mixed.Clients {
+		if c.ConnectedAt.IsZero() {
+			t.Error("ConnectedAt should be set")
+		}
+	}
+
+	other := rooms[1]
+	if other.Room != "LIST2" || other.FoundryConnected || other.PhoneCount != 0 || len(other.Clients) != 1 {
+		t.Errorf("LIST2 = %+v", other)
+	}
+
+	// Mutating the snapshot does not affect the relay
+	rooms[0].Clients[0].Type = ClientTypePhone
+	if r.ListRooms()[0].Clients[0].Type != ClientTypeFoundry {
+		t.Error("ListRooms returned shared state")
+	}
+}
+
+func TestRelayRoom(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	foundry := dialWS(t, server.URL)
+	defer foundry.Close()
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"ONE1"}}`))
+	consumeRoomStatus(t, foundry)
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry"}}`))
+	readUntilStatus(t, foundry, true)
+
+	info, err := r.Room("one1")
+	if err != nil {
+		t.Fatalf("Room(one1) error = %v", err)
+	}
+	if info.Room != "ONE1" || !info.FoundryConnected || info.PhoneCount != 0 || len(info.Clients) != 1 {
+		t.Errorf("Room(one1) = %+v", info)
+	}
+
+	if _, err := r.Room("NOPE1"); !errors.Is(err, ErrRoomNotFound) {
+		t.Errorf("Room(NOPE1) error = %v, want ErrRoomNotFound", err)
+	}
+}
+
+func TestRelaySessionDuration(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	if d := r.Stats().AverageSessionDuration; d != 0 {
+		t.Errorf("AverageSessionDuration with no clients = %v, want 0", d)
+	}
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"TIME1"}}`))
+	time.Sleep(100 * time.Millisecond)
+
+	rooms := r.ListRooms()
+	if len(rooms) != 1 || len(rooms[0].Clients) != 1 {
+		t.Fatalf("Unexpected rooms: %+v", rooms)
+	}
+	if d := rooms[0].Clients[0].Duration; d < 50*time.Millisecond {
+		t.Errorf("Client Duration = %v, want >= 50ms", d)
+	}
+	if d := r.Stats().AverageSessionDuration; d < 50*time.Millisecond {
+		t.Errorf("AverageSessionDuration = %v, want >= 50ms", d)
+	}
+}
+
+// readUntilStatus reads messages until a ROOM_STATUS with the given
+// foundryConnected value arrives.
+func readUntilStatus(t *testing.T, conn *websocket.Conn, foundryConnected bool) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Waiting for ROOM_STATUS foundryConnected=%v: %v", foundryConnected, err)
+		}
+		env, err := ParseEnvelope(data)
+		if err != nil || env.Type != TypeRoomStatus {
+			continue
+		}
+		var status RoomStatusPayload
+		if err := json.Unmarshal(env.Payload, &status); err == nil && status.FoundryConnected == foundryConnected {
+			return
+		}
+	}
+}
+
+func TestRelayKickClient(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	foundry := dialWS(t, server.URL)
+	defer foundry.Close()
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"KICK1"}}`))
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry"}}`))
+	time.Sleep(50 * time.Millisecond)
+
+	phone := dialWS(t, server.URL)
+	defer phone.Close()
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"KICK1"}}`))
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone"}}`))
+	time.Sleep(50 * time.Millisecond)
+
+	var foundryID string
+	for _, c := range r.ListRooms()[0].Clients {
+		if c.Type == ClientTypeFoundry {
+			foundryID = c.ID
+		}
+	}
+	if foundryID == "" {
+		t.Fatal("Foundry client has no ID")
+	}
+
+	if err := r.KickClient("KICK1", "nope"); !errors.Is(err, ErrClientNotFound) {
+		t.Errorf("KickClient(unknown) = %v, want ErrClientNotFound", err)
+	}
+	if err := r.KickClient("NOPE1", foundryID); !errors.Is(err, ErrRoomNotFound) {
+		t.Errorf("KickClient(unknown room) = %v, want ErrRoomNotFound", err)
+	}
+	if err := r.KickClient("KICK1", foundryID); err != nil {
+		t.Fatalf("KickClient() error = %v", err)
+	}
+
+	// Kicked client gets the kick close code
+	foundry.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, _, err := foundry.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, CloseKicked) {
+			t.Errorf("Expected close %d, got %v", CloseKicked, err)
+		}
+		break
+	}
+
+	// Remaining client sees Foundry disconnect
+	readUntilStatus(t, phone, false)
+
+	stats := r.Stats()
+	if stats.ClientCount != 1 || stats.FoundryCount != 0 {
+		t.Errorf("Stats after kick: %+v", stats)
+	}
+}
+
+func TestRelayCloseRoom(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	for i := 0; i < 2; i++ {
+		conn := dialWS(t, server.URL)
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"SHUT1"}}`))
+	}
+	keep := dialWS(t, server.URL)
+	defer keep.Close()
+	keep.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"KEEP1"}}`))
+	time.Sleep(50 * time.Millisecond)
+
+	if err := r.CloseRoom("NOPE1"); !errors.Is(err, ErrRoomNotFound) {
+		t.Errorf("CloseRoom(unknown) = %v, want ErrRoomNotFound", err)
+	}
+	if err := r.CloseRoom("SHUT1"); err != nil {
+		t.Fatalf("CloseRoom() error = %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if r.RoomCount() != 1 || r.ClientCount() != 1 {
+		t.Errorf("After CloseRoom: rooms=%d clients=%d, want 1/1", r.RoomCount(), r.ClientCount())
+	}
+}
+
+func TestNormalizeRoomCode(t *testing.T) {
+	tests := map[string]string{
+		"game1":  "GAME1",
+		"GAME1":  "GAME1",
+		"GaMe1":  "GAME1",
+		"abc123": "ABC123",
+	}
+	for in, want := range tests {
+		if got := NormalizeRoomCode(in); got != want {
+			t.Errorf("NormalizeRoomCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRelayRoomCodeCaseInsensitive(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	foundry := dialWS(t, server.URL)
+	defer foundry.Close()
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"GAME1"}}`))
+	consumeRoomStatus(t, foundry)
+
+	phone := dialWS(t, server.URL)
+	defer phone.Close()
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"game1"}}`))
+	consumeRoomStatus(t, phone)
+
+	if r.RoomCount() != 1 {
+		t.Fatalf("RoomCount = %d, want 1", r.RoomCount())
+	}
+	if room := r.ListRooms()[0].Room; room != "GAME1" {
+		t.Errorf("Stored room = %q, want GAME1", room)
+	}
+
+	moveMsg := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`
+	phone.WriteMessage(websocket.TextMessage, []byte(moveMsg))
+
+	foundry.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := foundry.ReadMessage()
+	if err != nil {
+		t.Fatalf("Foundry read error: %v", err)
+	}
+	if string(data) != moveMsg {
+		t.Errorf("Foundry got %s, want %s", data, moveMsg)
+	}
+}
+
+func TestRelayRoomPassword(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	join := func(password string) *websocket.Conn {
+		conn := dialWS(t, server.URL)
+		msg := fmt.Sprintf(`{"type":"JOIN","payload":{"room":"LOCK1","password":%q}}`, password)
+		conn.WriteMessage(websocket.TextMessage, []byte(msg))
+		return conn
+	}
+
+	// First joiner creates the room with a password
+	owner := join("hunter2")
+	consumeRoomStatus(t, owner)
+
+	// Correct password joins
+	guest := join("hunter2")
+	defer guest.Close()
+	consumeRoomStatus(t, guest)
+
+	// Wrong and missing passwords are rejected
+	for _, password := range []string{"wrong", ""} {
+		intruder := join(password)
+		intruder.SetReadDeadline(time.Now().Add(time.Second))
+		if _, _, err := intruder.ReadMessage(); !websocket.IsCloseError(err, CloseAuthFailed) {
+			t.Errorf("Password %q: expected close %d, got %v", password, CloseAuthFailed, err)
+		}
+		intruder.Close()
+	}
+	if r.ClientCount() != 2 {
+		t.Errorf("ClientCount = %d, want 2", r.ClientCount())
+	}
+
+	// Once the room empties its password is forgotten
+	owner.Close()
+	guest.Close()
+	deadline := time.Now().Add(time.Second)
+	for r.RoomCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r.RoomCount() != 0 {
+		t.Fatalf("RoomCount = %d, want 0", r.RoomCount())
+	}
+
+	fresh := join("different")
+	defer fresh.Close()
+	consumeRoomStatus(t, fresh)
+}
+
+func TestRelayBroadcast(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	join := func(room string) *websocket.Conn {
+		conn := dialWS(t, server.URL)
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+room+`"}}`))
+		consumeRoomStatus(t, conn)
+		return conn
+	}
+	a1, a2, other := join("CAST1"), join("CAST1"), join("CAST2")
+	defer a1.Close()
+	defer a2.Close()
+	defer other.Close()
+
+	if err := r.Broadcast("cast1", TypeAnnouncement, AnnouncementPayload{Message: "Pausing in 5"}); err != nil {
+		t.Fatalf("Broadcast failed: %v", err)
+	}
+
+	for i, conn := range []*websocket.Conn{a1, a2} {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Client %d read error: %v", i, err)
+		}
+		env, err := ParseEnvelope(data)
+		if err != nil || env.Type != TypeAnnouncement {
+			t.Fatalf("Client %d expected ANNOUNCEMENT, got %s", i, data)
+		}
+		var payload AnnouncementPayload
+		json.Unmarshal(env.Payload, &payload)
+		if payload.Message != "Pausing in 5" {
+			t.Errorf("Client %d message = %q", i, payload.Message)
+		}
+	}
+
+	// Clients in other rooms do not receive it
+	other.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := other.ReadMessage(); err == nil {
+		t.Errorf("Other room received %s", data)
+	}
+
+	if err := r.Broadcast("NOPE1", TypeAnnouncement, AnnouncementPayload{}); !errors.Is(err, ErrRoomNotFound) {
+		t.Errorf("Broadcast to missing room = %v, want ErrRoomNotFound", err)
+	}
+}
+
+func TestRelayLateFoundryFlipsPhoneStatus(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	phone := dialWS(t, server.URL)
+	defer phone.Close()
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"LATE1"}}`))
+	phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone"}}`))
+
+	// Foundry joins and identifies immediately, racing the phone's setup
+	foundry := dialWS(t, server.URL)
+	defer foundry.Close()
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"LATE1"}}`))
+	foundry.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry"}}`))
+
+	// The phone's most recent status must report Foundry present
+	readUntilStatus(t, phone, true)
+
+	// And flips back once Foundry leaves
+	foundry.Close()
+	readUntilStatus(t, phone, false)
+}
+
+// floodWedgedClient joins a client that never reads, then publishes large
+// messages straight to its room's NATS subject until stop returns true or
+// the flood ends.
+func floodWedgedClient(t *testing.T, r *Relay, serverURL, room string, stop func() bool) *websocket.Conn {
+	t.Helper()
+
+	wedged := dialWS(t, serverURL)
+	wedged.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+room+`"}}`))
+	deadline := time.Now().Add(time.Second)
+	for r.ClientCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	msg := sizedMove(t, 60*1024)
+	for i := 0; i < 2000 && !stop(); i++ {
+		if err := r.nc.Publish(r.roomSubject(room), msg); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+		if i%50 == 0 {
+			r.nc.Flush()
+		}
+	}
+	r.nc.Flush()
+	return wedged
+}
+
+func TestRelayOverflowDropMessage(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{SendBufferSize: 4})
+	defer cleanup()
+
+	wedged := floodWedgedClient(t, r, server.URL, "SLOW1", func() bool {
+		return r.metrics.slowClientDrops.Load() > 0
+	})
+	defer wedged.Close()
+
+	if r.metrics.slowClientDrops.Load() == 0 {
+		t.Fatal("Expected messages to be dropped for the wedged client")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if r.ClientCount() != 1 {
+		t.Errorf("ClientCount = %d, want 1 (drop policy keeps clients)", r.ClientCount())
+	}
+}
+
+func TestRelayOverflowDisconnectClient(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{
+		SendBufferSize: 4,
+		OverflowPolicy: DisconnectClient,
+	})
+	defer cleanup()
+
+	wedged := floodWedgedClient(t, r, server.URL, "SLOW2", func() bool {
+		return r.ClientCount() == 0
+	})
+	defer wedged.Close()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for r.ClientCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r.ClientCount() != 0 {
+		t.Fatalf("ClientCount = %d, want 0 after slow client is disconnected", r.ClientCount())
+	}
+}
+
+func TestRelayWriteTimeout(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{
+		SendBufferSize: 4,
+		WriteTimeout:   200 * time.Millisecond,
+	})
+	defer cleanup()
+
+	// The drop policy alone never disconnects, so only the write
+	// deadline can tear the wedged client down
+	start := time.Now()
+	wedged := floodWedgedClient(t, r, server.URL, "STALL1", func() bool {
+		return r.ClientCount() == 0
+	})
+	defer wedged.Close()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for r.ClientCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r.ClientCount() != 0 {
+		t.Fatalf("ClientCount = %d, want 0 after the write timeout", r.ClientCount())
+	}
+	if r.metrics.slowClientDrops.Load() == 0 {
+		t.Error("Expected the writer to stall and drop messages first")
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Client dropped after %v, before WriteTimeout", elapsed)
+	}
+}
+
+func TestRelayReadTimeout(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{
+		PingInterval: 50 * time.Millisecond,
+		ReadTimeout:  300 * time.Millisecond,
+	})
+	defer cleanup()
+
+	// The client answers pings while reading but never sends a message
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"IDLE1"}}`))
+	start := time.Now()
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for (r.ClientCount() != 0 || time.Since(start) < 100*time.Millisecond) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r.ClientCount() != 0 {
+		t.Fatalf("ClientCount = %d, want 0 after the read timeout", r.ClientCount())
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("Idle client dropped after %v, before ReadTimeout", elapsed)
+	}
+}
+
+func TestRelayJoinTimeout(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{JoinTimeout: 200 * time.Millisecond})
+	defer cleanup()
+
+	// Connect but never send JOIN
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	elapsed := time.Since(start)
+
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("Expected close error, got %v", err)
+	}
+	if closeErr.Code != CloseProtocolError {
+		t.Errorf("Close code = %d, want %d", closeErr.Code, CloseProtocolError)
+	}
+	if p, err := ParseCloseReason(closeErr.Text); err != nil || p.Reason != "join_timeout" {
+		t.Errorf("Close reason = %q, want join_timeout", closeErr.Text)
+	}
+	if elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Closed after %v, want about the 200ms JoinTimeout", elapsed)
+	}
+}
+
+func TestRelayJoinTimeoutCleared(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{JoinTimeout: 100 * time.Millisecond})
+	defer cleanup()
+
+	// A joined client outlives the join deadline
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"JOINTO"}}`))
+	consumeRoomStatus(t, conn)
+	time.Sleep(300 * time.Millisecond)
+
+	peer := dialWS(t, server.URL)
+	defer peer.Close()
+	peer.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"JOINTO"}}`))
+	consumeRoomStatus(t, peer)
+	move := `{"type":"MOVE","payload":{"tokenId":"tok1","direction":"up"}}`
+	peer.WriteMessage(websocket.TextMessage, []byte(move))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Joined client was disconnected: %v", err)
+		}
+		if string(data) == move {
+			return
+		}
+	}
+}
+
+func TestRelayIdleRoomReaper(t *testing.T) {
+	timeout := 200 * time.Millisecond
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{IdleRoomTimeout: timeout})
+	defer cleanup()
+
+	idle := dialWS(t, server.URL)
+	defer idle.Close()
+	idle.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"IDLE1"}}`))
+	consumeRoomStatus(t, idle)
+
+	busy := dialWS(t, server.URL)
+	defer busy.Close()
+	busy.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"BUSY1"}}`))
+	consumeRoomStatus(t, busy)
+
+	// Keep the busy room active while the idle one times out
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(timeout / 4)
+		defer ticker.Stop()
+		move := []byte(`{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`)
+		for {
+			select {
+			case <-ticker.C:
+				if busy.WriteMessage(websocket.TextMessage, move) != nil {
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	go func() {
+		for {
+			if _, _, err := busy.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	idle.SetReadDeadline(time.Now().Add(4 * timeout))
+	if _, _, err := idle.ReadMessage(); !websocket.IsCloseError(err, CloseIdle) {
+		t.Fatalf("Expected close %d for idle room, got %v", CloseIdle, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for r.RoomCount() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	rooms := r.ListRooms()
+	if len(rooms) != 1 || rooms[0].Room != "BUSY1" {
+		t.Errorf("Rooms after reaping = %+v, want only BUSY1", rooms)
+	}
+}
+
+func TestRelayDropsInvalidPayloads(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"VALID1"}}`))
+	consumeRoomStatus(t, conn)
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"MOVE","payload":{"direction":"diagonally-up","tokenId":"tok1"}}`))
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"ROLL_DICE","payload":{"tokenId":"tok1","formula":""}}`))
+	moveMsg := `{"type":"MOVE","payload":{"direction":"down","tokenId":"tok1"}}`
+	conn.WriteMessage(websocket.TextMessage, []byte(moveMsg))
+
+	// Only the valid MOVE comes back
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if string(data) != moveMsg {
+		t.Errorf("Got %s, want %s", data, moveMsg)
+	}
+}
+
+func TestRelayClampsMoveDistance(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{MaxMoveDistance: 5})
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"FAR1"}}`))
+	consumeRoomStatus(t, conn)
+
+	// A short diagonal move passes through untouched
+	short := `{"type":"MOVE","payload":{"direction":"up-left","tokenId":"tok1","distance":2}}`
+	conn.WriteMessage(websocket.TextMessage, []byte(short))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	if string(data) != short {
+		t.Errorf("Got %s, want %s", data, short)
+	}
+
+	// A long move is clamped to the limit
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"MOVE","payload":{"direction":"down","tokenId":"tok1","distance":40}}`))
+	_, data, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	env, err := ParseEnvelope(data)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	var move MovePayload
+	json.Unmarshal(env.Payload, &move)
+	if move.Distance != 5 || move.Direction != "down" || move.TokenID != "tok1" {
+		t.Errorf("Clamped move = %+v, want distance 5 down tok1", move)
+	}
+}
+
+func TestRelayPingPong(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"PING1"}}`))
+	consumeRoomStatus(t, conn)
+
+	other := dialWS(t, server.URL)
+	defer other.Close()
+	other.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"PING1"}}`))
+	consumeRoomStatus(t, other)
+
+	before := time.Now().UnixMilli()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"PING","payload":{"clientTime":123456789}}`))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	env, err := ParseEnvelope(data)
+	if err != nil || env.Type != TypePong {
+		t.Fatalf("Expected PONG, got %s", data)
+	}
+	var pong PongPayload
+	if err := json.Unmarshal(env.Payload, &pong); err != nil {
+		t.Fatalf("Invalid PONG payload: %v", err)
+	}
+	if pong.ClientTime != 123456789 {
+		t.Errorf("ClientTime = %d, want 123456789", pong.ClientTime)
+	}
+	if pong.ServerTime < before || pong.ServerTime > time.Now().UnixMilli() {
+		t.Errorf("ServerTime = %d, want between %d and now", pong.ServerTime, before)
+	}
+
+	// PING is answered locally, never relayed to the room
+	other.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := other.ReadMessage(); err == nil {
+		t.Errorf("Other client received %s", data)
+	}
+}
+
+func TestRelaySingleFoundryPerRoom(t *testing.T) {
+	tests := []struct {
+		name       string
+		disconnect bool
+	}{
+		{name: "reject", disconnect: false},
+		{name: "disconnect", disconnect: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, r, cleanup := setupTestRelayWithConfig(t, Config{
+				SingleFoundryPerRoom:       true,
+				DisconnectDuplicateFoundry: tt.disconnect,
+			})
+			defer cleanup()
+
+			first := dialWS(t, server.URL)
+			defer first.Close()
+			first.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"GM001"}}`))
+			consumeRoomStatus(t, first)
+			first.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry"}}`))
+			readUntilStatus(t, first, true)
+
+			second := dialWS(t, server.URL)
+			defer second.Close()
+			second.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"GM001"}}`))
+			consumeRoomStatus(t, second)
+			second.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry"}}`))
+
+			second.SetReadDeadline(time.Now().Add(time.Second))
+			_, data, err := second.ReadMessage()
+			if err != nil {
+				t.Fatalf("Read error: %v", err)
+			}
+			env, err := ParseEnvelope(data)
+			if err != nil || env.Type != TypeIdentifyFailed {
+				t.Fatalf("Expected IDENTIFY_FAILED, got %s", data)
+			}
+
+			_, _, err = second.ReadMessage()
+			if tt.disconnect {
+				if !websocket.IsCloseError(err, CloseDuplicateFoundry) {
+					t.Errorf("Expected close %d, got %v", CloseDuplicateFoundry, err)
+				}
+			} else if err == nil || websocket.IsCloseError(err, CloseDuplicateFoundry) {
+				// Only a read timeout is expected: the client stays connected
+				t.Errorf("Expected rejected client to stay connected, got %v", err)
+			}
+
+			// The first Foundry keeps its slot
+			stats := r.Stats()
+			if stats.FoundryCount != 1 {
+				t.Errorf("FoundryCount = %d, want 1", stats.FoundryCount)
+			}
+			first.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			for {
+				_, data, err := first.ReadMessage()
+				if err != nil {
+					break
+				}
+				var status RoomStatusPayload
+				if env, err := ParseEnvelope(data); err == nil && env.Type == TypeRoomStatus &&
+					json.Unmarshal(env.Payload, &status) == nil && !status.FoundryConnected {
+					t.Errorf("First Foundry saw foundryConnected=false")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package relay
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/sam-phinizy/vtt-remote/pkg/roomcode"
+)
+
+// reservedCodeLength is the length of codes generated by ReserveRoom.
+const reservedCodeLength = 6
+
+// maxReserveAttempts bounds how many random codes ReserveRoom tries.
+const maxReserveAttempts = 100
+
+// defaultReservationTTL is how long an unclaimed reservation lasts.
+const defaultReservationTTL = 2 * time.Minute
+
+// ErrNoRoomCode is returned by ReserveRoom when no free code was found.
+var ErrNoRoomCode = errors.New("no free room code available")
+
+// Reservation is a room code held for its reserver until ExpiresAt.
+type Reservation struct {
+	Code      string    `json:"code"`
+	Key       string    `json:"key"` // Present in JOIN.reservationKey to claim the code
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ReserveRoom generates a room code that is neither in use nor reserved
+// in the Config.RoomCodeMode style and holds it for Config.ReservationTTL. The first JOIN to the code
+// claims it; with Config.RequireReservationKey, that JOIN must carry the
+// reservation's Key. Unclaimed reservations expire and free the code.
+func (r *Relay) ReserveRoom() (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for code, res := range r.reservations {
+		if !now.Before(res.ExpiresAt) {
+			delete(r.reservations, code)
+		}
+	}
+
+	for i := 0; i < maxReserveAttempts; i++ {
+		code, err := roomcode.Generate(roomcode.Options{
+			Mode:   r.config.RoomCodeMode,
+			Length: reservedCodeLength,
+		})
+		if err != nil {
+			return Reservation{}, err
+		}
+		if _, ok := r.rooms[code]; ok {
+			continue
+		}
+		if _, ok := r.reservations[code]; ok {
+			continue
+		}
+		res := Reservation{
+			Code:      code,
+			Key:       newID(),
+			ExpiresAt: now.Add(r.config.ReservationTTL),
+		}
+		r.reservations[code] = res
+		return res, nil
+	}
+	return Reservation{}, ErrNoRoomCode
+}
+
+// claimReservationLocked consumes the reservation for a room being created
+// by c, if there is one. It returns errRoomReserved if the room is reserved
+// for someone else. Callers must hold r.mu exclusively.
+func (r *Relay) claimReservationLocked(room, key string) error {
+	res, ok := r.reservations[room]
+	if !ok {
+		return nil
+	}
+	if !time.Now().Before(res.ExpiresAt) {
+		delete(r.reservations, room)
+		return nil
+	}
+	if r.config.RequireReservationKey && subtle.ConstantTimeCompare([]byte(key), []byte(res.Key)) != 1 {
+		return errRoomReserved
+	}
+	delete(r.reservations, room)
+	return nil
+}
@@ -0,0 +1,149 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sam-phinizy/vtt-remote/pkg/roomcode"
+)
+
+func TestReserveRoomUnique(t *testing.T) {
+	_, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		res, err := r.ReserveRoom()
+		if err != nil {
+			t.Fatalf("ReserveRoom failed: %v", err)
+		}
+		if len(res.Code) != reservedCodeLength || !ValidateRoomCode(res.Code) {
+			t.Fatalf("Invalid code %q", res.Code)
+		}
+		if seen[res.Code] {
+			t.Fatalf("Duplicate code %q after %d reservations", res.Code, i)
+		}
+		seen[res.Code] = true
+		if res.Key == "" || !res.ExpiresAt.After(time.Now()) {
+			t.Errorf("Unexpected reservation: %+v", res)
+		}
+	}
+}
+
+func TestReserveRoomRequiresKey(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{RequireReservationKey: true})
+	defer cleanup()
+
+	res, err := r.ReserveRoom()
+	if err != nil {
+		t.Fatalf("ReserveRoom failed: %v", err)
+	}
+
+	// Without the key the reserved code is refused
+	other := dialWS(t, server.URL)
+	defer other.Close()
+	other.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+res.Code+`"}}`))
+	other.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := other.ReadMessage(); !websocket.IsCloseError(err, CloseRoomReserved) {
+		t.Fatalf("Expected close %d, got %v", CloseRoomReserved, err)
+	}
+
+	// The reserver claims it with the key
+	owner := dialWS(t, server.URL)
+	defer owner.Close()
+	owner.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+res.Code+`","reservationKey":"`+res.Key+`"}}`))
+	consumeRoomStatus(t, owner)
+
+	// Once claimed, the room is open like any other
+	guest := dialWS(t, server.URL)
+	defer guest.Close()
+	guest.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+res.Code+`"}}`))
+	consumeRoomStatus(t, guest)
+}
+
+func TestReserveRoomOpenClaim(t *testing.T) {
+	server, r, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	res, err := r.ReserveRoom()
+	if err != nil {
+		t.Fatalf("ReserveRoom failed: %v", err)
+	}
+
+	// Without RequireReservationKey anyone may claim the code
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+res.Code+`"}}`))
+	consumeRoomStatus(t, conn)
+
+	r.mu.RLock()
+	_, reserved := r.reservations[res.Code]
+	r.mu.RUnlock()
+	if reserved {
+		t.Error("Expected joining to consume the reservation")
+	}
+}
+
+func TestReserveRoomExpiry(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{
+		ReservationTTL:        50 * time.Millisecond,
+		RequireReservationKey: true,
+	})
+	defer cleanup()
+
+	res, err := r.ReserveRoom()
+	if err != nil {
+		t.Fatalf("ReserveRoom failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// An expired reservation no longer blocks other clients
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+res.Code+`"}}`))
+	consumeRoomStatus(t, conn)
+
+	// Expired, unclaimed reservations are dropped on the next ReserveRoom
+	stale, err := r.ReserveRoom()
+	if err != nil {
+		t.Fatalf("ReserveRoom failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := r.ReserveRoom(); err != nil {
+		t.Fatalf("ReserveRoom failed: %v", err)
+	}
+	r.mu.RLock()
+	_, kept := r.reservations[stale.Code]
+	count := len(r.reservations)
+	r.mu.RUnlock()
+	if kept || count != 1 {
+		t.Errorf("Expected only the newest reservation to remain, have %d (stale kept: %v)", count, kept)
+	}
+}
+
+func TestReserveRoomCodeModes(t *testing.T) {
+	for _, mode := range []roomcode.Mode{roomcode.Alphanumeric, roomcode.Digits, roomcode.Pronounceable} {
+		t.Run(string(mode), func(t *testing.T) {
+			_, r, cleanup := setupTestRelayWithConfig(t, Config{RoomCodeMode: mode})
+			defer cleanup()
+
+			for i := 0; i < 500; i++ {
+				res, err := r.ReserveRoom()
+				if err != nil {
+					t.Fatalf("ReserveRoom failed: %v", err)
+				}
+				if !ValidateRoomCode(res.Code) || NormalizeRoomCode(res.Code) != res.Code {
+					t.Fatalf("Code %q is not a valid canonical room code", res.Code)
+				}
+			}
+		})
+	}
+
+	_, r, cleanup := setupTestRelayWithConfig(t, Config{RoomCodeMode: "emoji"})
+	defer cleanup()
+	if _, err := r.ReserveRoom(); err == nil {
+		t.Error("Expected ReserveRoom to fail with an unknown mode")
+	}
+}
@@ -0,0 +1,125 @@
+package relay
+
+import (
+	"sync"
+	"time"
+)
+
+// resumeSession is the server-held state a resume token restores.
+type resumeSession struct {
+	room       string
+	clientType ClientType
+	expires    time.Time // zero while the owning client is connected
+}
+
+// resumeStore maps resume tokens to sessions. Tokens become redeemable
+// when their client disconnects and expire TTL later.
+type resumeStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*resumeSession
+	now      func() time.Time // Injectable clock for tests
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newResumeStore creates a store and starts a reaper that removes expired
+// tokens every ttl. Call close to stop the reaper.
+func newResumeStore(ttl time.Duration) *resumeStore {
+	s := &resumeStore{
+		ttl:      ttl,
+		sessions: make(map[string]*resumeSession),
+		now:      time.Now,
+		stop:     make(chan struct{}),
+	}
+	go s.reapLoop()
+	return s
+}
+
+// issue creates a token for a newly joined client in room.
+func (s *resumeStore) issue(room string) string {
+	token := newID()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[token] = &resumeSession{room: room}
+	return token
+}
+
+// redeem claims a disconnected session for a client rejoining room.
+// It returns false if the token is unknown, expired, still in use, or
+// belongs to another room. A redeemed token stays valid for the new
+// connection, so it can be redeemed again after the next drop.
+func (s *resumeStore) redeem(token, room string) (ClientType, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[token]
+	if !ok || sess.room != room || sess.expires.IsZero() {
+		return ClientTypeUnknown, false
+	}
+	if !s.now().Before(sess.expires) {
+		delete(s.sessions, token)
+		return ClientTypeUnknown, false
+	}
+	sess.expires = time.Time{}
+	return sess.clientType, true
+}
+
+// move reassigns a connected client's token to room after it switches
+// rooms, so a later resume rejoins the new room.
+func (s *resumeStore) move(token, room string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.sessions[token]; ok {
+		sess.room = room
+	}
+}
+
+// release records a client's state on disconnect and starts its TTL.
+func (s *resumeStore) release(token string, clientType ClientType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.sessions[token]; ok {
+		sess.clientType = clientType
+		sess.expires = s.now().Add(s.ttl)
+	}
+}
+
+// reap removes expired tokens.
+func (s *resumeStore) reap() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for token, sess := range s.sessions {
+		if !sess.expires.IsZero() && !now.Before(sess.expires) {
+			delete(s.sessions, token)
+		}
+	}
+}
+
+// reapLoop runs reap every ttl until close is called.
+func (s *resumeStore) reapLoop() {
+	ticker := time.NewTicker(s.ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.reap()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// close stops the reaper. Safe to call more than once.
+func (s *resumeStore) close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// len returns the number of stored tokens.
+func (s *resumeStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
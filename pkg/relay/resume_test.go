@@ -0,0 +1,216 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestResumeStoreLifecycle(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	s := newResumeStore(time.Minute)
+	defer s.close()
+	s.now = clock.now
+
+	token := s.issue("GAME1")
+
+	// Not redeemable while the original client is connected
+	if _, ok := s.redeem(token, "GAME1"); ok {
+		t.Fatal("Expected token to be unusable while its client is connected")
+	}
+
+	s.release(token, ClientTypePhone)
+	clock.advance(30 * time.Second)
+
+	// Wrong room never matches
+	if _, ok := s.redeem(token, "GAME2"); ok {
+		t.Fatal("Expected token to be rejected for another room")
+	}
+
+	clientType, ok := s.redeem(token, "GAME1")
+	if !ok || clientType != ClientTypePhone {
+		t.Fatalf("redeem = (%q, %v), want (phone, true)", clientType, ok)
+	}
+
+	// Redeemed tokens are in use again and can't be claimed twice
+	if _, ok := s.redeem(token, "GAME1"); ok {
+		t.Fatal("Expected redeemed token to be in use")
+	}
+
+	// After the next drop the TTL restarts
+	s.release(token, ClientTypePhone)
+	clock.advance(time.Minute)
+	if _, ok := s.redeem(token, "GAME1"); ok {
+		t.Fatal("Expected token to expire after TTL")
+	}
+	if s.len() != 0 {
+		t.Errorf("len = %d, want 0 after expired redeem", s.len())
+	}
+}
+
+func TestResumeStoreReap(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	s := newResumeStore(time.Minute)
+	defer s.close()
+	s.now = clock.now
+
+	connected := s.issue("GAME1")
+	dropped := s.issue("GAME1")
+	s.release(dropped, ClientTypeFoundry)
+
+	clock.advance(2 * time.Minute)
+	s.reap()
+
+	if s.len() != 1 {
+		t.Fatalf("len = %d, want 1", s.len())
+	}
+	s.release(connected, ClientTypePhone)
+	if _, ok := s.redeem(connected, "GAME1"); !ok {
+		t.Error("Expected connected client's token to survive reaping")
+	}
+}
+
+// joinWithResume joins room, optionally presenting a resume token, and
+// returns the token issued in RESUME_TOKEN.
+func joinWithResume(t *testing.T, conn *websocket.Conn, room, token string) string {
+	t.Helper()
+	join := fmt.Sprintf(`{"type":"JOIN","payload":{"room":%q,"resumeToken":%q}}`, room, token)
+	conn.WriteMessage(websocket.TextMessage, []byte(join))
+	consumeRoomStatus(t, conn)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read RESUME_TOKEN: %v", err)
+	}
+	env, err := ParseEnvelope(data)
+	if err != nil || env.Type != TypeResumeToken {
+		t.Fatalf("Expected RESUME_TOKEN, got %s", data)
+	}
+	var payload ResumeTokenPayload
+	if err := json.Unmarshal(env.Payload, &payload); err != nil {
+		t.Fatalf("Invalid RESUME_TOKEN payload: %v", err)
+	}
+	return payload.Token
+}
+
+func TestRelayResumeToken(t *testing.T) {
+	ttl := 300 * time.Millisecond
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{ResumeTTL: ttl})
+	defer cleanup()
+
+	awaitEmpty := func() {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for r.ClientCount() != 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Join and identify as Foundry, then drop
+	conn := dialWS(t, server.URL)
+	token := joinWithResume(t, conn, "RESUME1", "")
+	if token == "" {
+		t.Fatal("Expected a resume token on join")
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry"}}`))
+	readUntilStatus(t, conn, true)
+	conn.Close()
+	awaitEmpty()
+
+	// Resume within the TTL restores the client type and keeps the token
+	conn = dialWS(t, server.URL)
+	if got := joinWithResume(t, conn, "RESUME1", token); got != token {
+		t.Errorf("Resumed token = %q, want original", got)
+	}
+	if stats := r.Stats(); stats.FoundryCount != 1 {
+		t.Errorf("FoundryCount = %d, want 1 after resume", stats.FoundryCount)
+	}
+	conn.Close()
+	awaitEmpty()
+
+	// After the TTL the token is rejected and a fresh session starts
+	time.Sleep(2 * ttl)
+	conn = dialWS(t, server.URL)
+	defer conn.Close()
+	if got := joinWithResume(t, conn, "RESUME1", token); got == token {
+		t.Error("Expected a new token after the old one expired")
+	}
+	if stats := r.Stats(); stats.FoundryCount != 0 {
+		t.Errorf("FoundryCount = %d, want 0 after expired resume", stats.FoundryCount)
+	}
+}
+
+func TestRelayResumeDisabled(t *testing.T) {
+	server, _, cleanup := setupTestRelay(t)
+	defer cleanup()
+
+	conn := dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"RESUME2"}}`))
+	consumeRoomStatus(t, conn)
+
+	// No RESUME_TOKEN follows when resumption is disabled
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := conn.ReadMessage(); err == nil {
+		t.Errorf("Unexpected message %s", data)
+	}
+}
+
+func TestRelayResumeSingleFoundry(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{
+		ResumeTTL:            time.Minute,
+		SingleFoundryPerRoom: true,
+	})
+	defer cleanup()
+
+	awaitFoundries := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for r.Stats().FoundryCount != want && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// A Foundry identifies, then drops
+	conn := dialWS(t, server.URL)
+	token := joinWithResume(t, conn, "RESUME3", "")
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry"}}`))
+	readUntilStatus(t, conn, true)
+	conn.Close()
+	awaitFoundries(0)
+
+	// Another Foundry takes the room while the session is parked
+	other := dialWS(t, server.URL)
+	joinWithResume(t, other, "RESUME3", "")
+	other.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"foundry"}}`))
+	readUntilStatus(t, other, true)
+
+	// Resuming the first session would make a second Foundry
+	conn = dialWS(t, server.URL)
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"type":"JOIN","payload":{"room":"RESUME3","resumeToken":%q}}`, token)))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, CloseDuplicateFoundry) {
+		t.Fatalf("Expected close %d, got %v", CloseDuplicateFoundry, err)
+	}
+	if stats := r.Stats(); stats.FoundryCount != 1 {
+		t.Errorf("FoundryCount = %d, want 1", stats.FoundryCount)
+	}
+
+	// The refused session stays redeemable once the room is free
+	other.Close()
+	awaitFoundries(0)
+	conn = dialWS(t, server.URL)
+	defer conn.Close()
+	if got := joinWithResume(t, conn, "RESUME3", token); got != token {
+		t.Errorf("Resumed token = %q, want original", got)
+	}
+	if stats := r.Stats(); stats.FoundryCount != 1 {
+		t.Errorf("FoundryCount = %d, want 1 after resume", stats.FoundryCount)
+	}
+}
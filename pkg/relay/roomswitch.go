@@ -0,0 +1,109 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// errFoundryPresent rejects a Foundry switching or resuming into a room
+// that already has one when SingleFoundryPerRoom is set.
+var errFoundryPresent = errors.New("room already has a Foundry")
+
+// handleRepeatJoin handles a JOIN sent after the handshake. Unless
+// Config.AllowRoomSwitch is set it is ignored; relaying it would show the
+// room a stray JOIN envelope. Otherwise the client moves to the new room,
+// or stays put if the room refuses it.
+func (c *Client) handleRepeatJoin(payload json.RawMessage) {
+	if !c.relay.config.AllowRoomSwitch {
+		c.log(LogWarn, "Ignoring repeated JOIN in room %s", c.room)
+		return
+	}
+
+	var p JoinPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.log(LogWarn, "Invalid JOIN payload: %v", err)
+		return
+	}
+	if !ValidateRoomCode(p.Room) {
+		c.log(LogWarn, "Ignoring switch from room %s to invalid room code %q", c.room, p.Room)
+		return
+	}
+	room := NormalizeRoomCode(p.Room)
+	if room == c.room {
+		return
+	}
+
+	// Subscribe to the new room before leaving the old one, so a failed
+	// switch leaves the client where it was
+	oldRoom := c.room
+	c.relay.beginJoin(room)
+	defer c.relay.endJoin(room)
+	sub, err := c.relay.nc.Subscribe(c.relay.roomSubject(room), c.deliver)
+	if err != nil {
+		c.log(LogError, "Failed to subscribe to room %s: %v", room, err)
+		return
+	}
+	if err := c.relay.switchRoom(c, room, p.Password, p.ReservationKey); err != nil {
+		sub.Unsubscribe()
+		c.log(LogWarn, "Rejected switch from room %s to %s: %v", oldRoom, room, err)
+		return
+	}
+	c.subMu.Lock()
+	old := c.sub
+	c.sub = sub
+	c.subMu.Unlock()
+	if old != nil {
+		old.Unsubscribe()
+	}
+
+	c.log(LogInfo, "Client switched from room %s to %s", oldRoom, room)
+	c.relay.emitRoomSwitch(c, oldRoom)
+	if c.getClientType() != ClientTypeUnknown {
+		c.replayHistory()
+	}
+}
+
+// switchRoom moves c into room, applying the same checks as a first JOIN,
+// and sends ROOM_STATUS to both rooms. On error the client is unchanged.
+func (r *Relay) switchRoom(c *Client, room, password, reservationKey string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.shuttingDown {
+		return errShuttingDown
+	}
+	if c.getClientType() == ClientTypeFoundry && r.config.SingleFoundryPerRoom && r.foundryConnectedLocked(room) {
+		return errFoundryPresent
+	}
+	if err := r.admitLocked(room, password, reservationKey); err != nil {
+		return err
+	}
+
+	oldRoom := c.room
+	r.leaveRoomLocked(c)
+	c.mu.Lock()
+	c.room = room
+	c.mu.Unlock()
+	r.rooms[room][c] = struct{}{}
+	if c.resumeToken != "" {
+		r.resume.move(c.resumeToken, room)
+	}
+
+	r.sendRoomStatusLocked(oldRoom, nil)
+	r.sendRoomStatusLocked(room, nil)
+	r.sendPresenceLocked(oldRoom)
+	r.sendPresenceLocked(room)
+	return nil
+}
+
+// emitRoomSwitch reports a switch as leaving oldRoom and joining the
+// client's current room.
+func (r *Relay) emitRoomSwitch(c *Client, oldRoom string) {
+	if r.config.OnClientEvent == nil {
+		return
+	}
+	left := newClientEvent(ClientLeft, c)
+	left.Room = oldRoom
+	r.config.OnClientEvent(left)
+	r.emitClientEvent(ClientJoined, c)
+}
@@ -0,0 +1,111 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readUntilMove reads until want arrives, failing if forbidden is seen
+// first.
+func readUntilMove(t *testing.T, conn *websocket.Conn, want, forbidden string) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Waiting for %s: %v", want, err)
+		}
+		switch string(data) {
+		case want:
+			return
+		case forbidden:
+			t.Fatalf("Received %s from the other room", data)
+		}
+	}
+}
+
+func TestRelayRoomSwitch(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{AllowRoomSwitch: true})
+	defer cleanup()
+
+	a := dialWS(t, server.URL)
+	defer a.Close()
+	a.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"HOPA"}}`))
+	consumeRoomStatus(t, a)
+	b := dialWS(t, server.URL)
+	defer b.Close()
+	b.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"HOPB"}}`))
+	consumeRoomStatus(t, b)
+
+	hopper := dialWS(t, server.URL)
+	defer hopper.Close()
+	hopper.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"HOPA"}}`))
+	consumeRoomStatus(t, hopper)
+	hop := []Participant{{Name: "Hop", ClientType: "phone"}}
+	hopper.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"phone","displayName":"Hop"}}`))
+	readUntilParticipants(t, a, hop)
+
+	// Both rooms get ROOM_STATUS for the switch
+	hopper.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"hopb"}}`))
+	readUntilParticipants(t, a, nil)
+	readUntilParticipants(t, b, hop)
+	readUntilParticipants(t, hopper, hop)
+
+	// The hopper hears only the new room
+	moveA := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tokA"}}`
+	moveB := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tokB"}}`
+	a.WriteMessage(websocket.TextMessage, []byte(moveA))
+	b.WriteMessage(websocket.TextMessage, []byte(moveB))
+	readUntilMove(t, hopper, moveB, moveA)
+	hopper.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := hopper.ReadMessage(); err == nil {
+		t.Errorf("Hopper received %s", data)
+	}
+
+	// ...and publishes to it
+	moveHop := `{"type":"MOVE","payload":{"direction":"left","tokenId":"tokH"}}`
+	hopper.WriteMessage(websocket.TextMessage, []byte(moveHop))
+	readUntilMove(t, b, moveHop, "")
+	readUntilMove(t, a, moveA, moveHop)
+	a.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := a.ReadMessage(); err == nil {
+		t.Errorf("Old room received %s", data)
+	}
+
+	// Disconnecting leaves the current room
+	hopper.Close()
+	readUntilParticipants(t, b, nil)
+	if got := r.RoomCount(); got != 2 {
+		t.Errorf("RoomCount = %d, want 2", got)
+	}
+}
+
+func TestRelayRoomSwitchRejected(t *testing.T) {
+	server, r, cleanup := setupTestRelayWithConfig(t, Config{AllowRoomSwitch: true})
+	defer cleanup()
+
+	owner := dialWS(t, server.URL)
+	defer owner.Close()
+	owner.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"LOCKED","password":"pw"}}`))
+	consumeRoomStatus(t, owner)
+
+	hopper := dialWS(t, server.URL)
+	defer hopper.Close()
+	hopper.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"OPEN1"}}`))
+	consumeRoomStatus(t, hopper)
+
+	// A wrong password keeps the client in its room
+	hopper.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"LOCKED","password":"nope"}}`))
+	move := `{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`
+	hopper.WriteMessage(websocket.TextMessage, []byte(move))
+	readUntilMove(t, hopper, move, "")
+	owner.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := owner.ReadMessage(); err == nil {
+		t.Errorf("Locked room received %s", data)
+	}
+	if got := r.RoomCount(); got != 2 {
+		t.Errorf("RoomCount = %d, want 2", got)
+	}
+}
@@ -0,0 +1,57 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// subprotocolPrefix starts each WebSocket subprotocol name; the protocol
+// version follows, as in "vtt-remote.v1".
+const subprotocolPrefix = "vtt-remote.v"
+
+// Subprotocols lists the WebSocket subprotocols for the supported
+// protocol versions, newest first. Set websocket.Upgrader.Subprotocols
+// from it before upgrading so clients offering several get the newest.
+func (r *Relay) Subprotocols() []string {
+	protocols := make([]string, 0, r.config.MaxProtoVersion-r.config.MinProtoVersion+1)
+	for v := r.config.MaxProtoVersion; v >= r.config.MinProtoVersion; v-- {
+		protocols = append(protocols, subprotocolPrefix+strconv.Itoa(v))
+	}
+	return protocols
+}
+
+// subprotocolVersion returns the protocol version a subprotocol name
+// pins, or false if it is not one of ours.
+func subprotocolVersion(name string) (int, bool) {
+	digits, ok := strings.CutPrefix(name, subprotocolPrefix)
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.Atoi(digits)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v, true
+}
+
+// CheckSubprotocol reports whether a freshly upgraded connection may be
+// handed to HandleClient. Clients that offer no subprotocols pass and
+// negotiate their version in JOIN. A client that offered subprotocols but
+// got none of them is closed with CloseUnsupportedVersion.
+func (r *Relay) CheckSubprotocol(req *http.Request, conn *websocket.Conn) bool {
+	offered := websocket.Subprotocols(req)
+	if len(offered) == 0 || conn.Subprotocol() != "" {
+		return true
+	}
+	msg := closeMessage(CloseReasonUnsupportedVersion,
+		fmt.Sprintf("Unsupported subprotocol (supported %s)", strings.Join(r.Subprotocols(), ", ")))
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	conn.Close()
+	r.log(LogWarn, "Rejected client offering unsupported subprotocols %v", offered)
+	return false
+}
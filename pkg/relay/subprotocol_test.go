@@ -0,0 +1,75 @@
+package relay
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRelaySubprotocols(t *testing.T) {
+	r := &Relay{config: Config{MinProtoVersion: 1, MaxProtoVersion: 3}}
+	want := []string{"vtt-remote.v3", "vtt-remote.v2", "vtt-remote.v1"}
+	if got := r.Subprotocols(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Subprotocols = %v, want %v", got, want)
+	}
+
+	for name, want := range map[string]int{"vtt-remote.v2": 2, "vtt-remote.v0": 0, "vtt-remote.vx": 0, "chat": 0} {
+		if got, _ := subprotocolVersion(name); got != want {
+			t.Errorf("subprotocolVersion(%q) = %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestRelaySubprotocolNegotiation(t *testing.T) {
+	server, _, cleanup := setupTestRelayWithConfig(t, Config{MinProtoVersion: 1, MaxProtoVersion: 2})
+	defer cleanup()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	tests := []struct {
+		name      string
+		offered   []string
+		join      string
+		wantProto string
+		wantClose bool
+	}{
+		{name: "none offered", join: `{"type":"JOIN","payload":{"room":"SUB1"}}`},
+		{name: "newest chosen", offered: []string{"vtt-remote.v1", "vtt-remote.v2"}, join: `{"type":"JOIN","payload":{"room":"SUB1"}}`, wantProto: "vtt-remote.v2"},
+		{name: "matching join", offered: []string{"vtt-remote.v1"}, join: `{"type":"JOIN","payload":{"room":"SUB1","protoVersion":1}}`, wantProto: "vtt-remote.v1"},
+		{name: "conflicting join", offered: []string{"vtt-remote.v1"}, join: `{"type":"JOIN","payload":{"room":"SUB1","protoVersion":2}}`, wantProto: "vtt-remote.v1", wantClose: true},
+		{name: "unsupported", offered: []string{"vtt-remote.v9", "chat"}, wantClose: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialer := websocket.Dialer{Subprotocols: tt.offered}
+			conn, resp, err := dialer.Dial(wsURL, nil)
+			if err != nil {
+				t.Fatalf("Dial: %v", err)
+			}
+			defer conn.Close()
+			if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != tt.wantProto {
+				t.Errorf("Sec-WebSocket-Protocol = %q, want %q", got, tt.wantProto)
+			}
+			if tt.join != "" {
+				conn.WriteMessage(websocket.TextMessage, []byte(tt.join))
+			}
+
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, data, err := conn.ReadMessage()
+			if tt.wantClose {
+				if !websocket.IsCloseError(err, CloseUnsupportedVersion) {
+					t.Errorf("Expected close %d, got %v", CloseUnsupportedVersion, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected ROOM_STATUS, got error %v", err)
+			}
+			if env, _ := ParseEnvelope(data); env == nil || env.Type != TypeRoomStatus {
+				t.Errorf("Expected ROOM_STATUS, got %s", data)
+			}
+		})
+	}
+}
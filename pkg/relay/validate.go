@@ -0,0 +1,125 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Payload validation limits.
+const (
+	maxCoordinate    = 1e6 // largest |x| or |y| accepted in MOVE_ACK
+	maxFormulaLength = 200
+	maxTokenIDLength = 64
+)
+
+// validMoveDirections are the directions a MOVE may carry.
+var validMoveDirections = map[string]struct{}{
+	"up":         {},
+	"down":       {},
+	"left":       {},
+	"right":      {},
+	"up-left":    {},
+	"up-right":   {},
+	"down-left":  {},
+	"down-right": {},
+}
+
+// payloadValidators holds the registered per-type validators.
+// Types without an entry are accepted as-is.
+var payloadValidators = map[MessageType]func(json.RawMessage) error{
+	TypeMove:     validateMove,
+	TypeMoveAck:  validateMoveAck,
+	TypeRollDice: validateRollDice,
+}
+
+// ValidatePayload checks a message payload against the rules for its type.
+// It returns nil for types that have no registered validator.
+func ValidatePayload(msgType MessageType, payload json.RawMessage) error {
+	validate, ok := payloadValidators[msgType]
+	if !ok {
+		return nil
+	}
+	if err := validate(payload); err != nil {
+		return fmt.Errorf("invalid %s payload: %w", msgType, err)
+	}
+	return nil
+}
+
+// validateTokenID checks the tokenId field shared by several payloads.
+func validateTokenID(id string) error {
+	switch {
+	case id == "":
+		return errors.New("tokenId is required")
+	case len(id) > maxTokenIDLength:
+		return errors.New("tokenId is too long")
+	}
+	return nil
+}
+
+func validateMove(payload json.RawMessage) error {
+	var p MovePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	if _, ok := validMoveDirections[p.Direction]; !ok {
+		return fmt.Errorf("unknown direction %q", p.Direction)
+	}
+	if p.Distance < 0 {
+		return fmt.Errorf("negative distance %d", p.Distance)
+	}
+	return validateTokenID(p.TokenID)
+}
+
+// clampMoveDistance lowers a MOVE payload's distance to limit. It returns
+// the payload unchanged (and false) when no clamping is needed. Other
+// fields are preserved as sent.
+func clampMoveDistance(payload json.RawMessage, limit int) (json.RawMessage, bool, error) {
+	var p MovePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return payload, false, err
+	}
+	if p.Distance <= limit {
+		return payload, false, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return payload, false, err
+	}
+	distance, err := json.Marshal(limit)
+	if err != nil {
+		return payload, false, err
+	}
+	fields["distance"] = distance
+	clamped, err := json.Marshal(fields)
+	if err != nil {
+		return payload, false, err
+	}
+	return clamped, true, nil
+}
+
+func validateMoveAck(payload json.RawMessage) error {
+	var p MoveAckPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	if p.X < -maxCoordinate || p.X > maxCoordinate || p.Y < -maxCoordinate || p.Y > maxCoordinate {
+		return fmt.Errorf("coordinates (%g, %g) out of range", p.X, p.Y)
+	}
+	return validateTokenID(p.TokenID)
+}
+
+func validateRollDice(payload json.RawMessage) error {
+	var p RollDicePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	switch {
+	case p.Formula == "":
+		return errors.New("formula is required")
+	case len(p.Formula) > maxFormulaLength:
+		return errors.New("formula is too long")
+	}
+	return validateTokenID(p.TokenID)
+}
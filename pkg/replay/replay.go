@@ -0,0 +1,39 @@
+// Package replay re-emits room traffic recorded with
+// relay.Relay.StartRecording, preserving the gaps between messages, to
+// reproduce timing-sensitive bugs.
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sam-phinizy/vtt-remote/pkg/relay"
+)
+
+// Replay reads a recording from r and calls send with each envelope and
+// its recorded delta, waiting out each delta first. Waits are measured
+// from the start of the replay, so time spent in send does not push later
+// messages back. Replay returns at the end of the recording, or with the
+// first error reading or decoding it.
+func Replay(r io.Reader, send func(data []byte, delta time.Duration)) error {
+	dec := json.NewDecoder(r)
+	due := time.Now()
+	for line := 1; ; line++ {
+		var m relay.RecordedMessage
+		if err := dec.Decode(&m); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("replay: message %d: %w", line, err)
+		}
+
+		due = due.Add(m.Delta)
+		if wait := time.Until(due); wait > 0 {
+			time.Sleep(wait)
+		}
+		send(m.Envelope, m.Delta)
+	}
+}
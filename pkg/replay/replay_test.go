@@ -0,0 +1,169 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sam-phinizy/vtt-remote/pkg/natsutil"
+	"github.com/sam-phinizy/vtt-remote/pkg/relay"
+)
+
+// replayed is one send call seen by a test.
+type replayed struct {
+	data  string
+	delta time.Duration
+	at    time.Time
+}
+
+// replayAll replays rec, returning every send call and when it happened.
+func replayAll(t *testing.T, rec []byte) (time.Time, []replayed) {
+	t.Helper()
+	var got []replayed
+	start := time.Now()
+	err := Replay(bytes.NewReader(rec), func(data []byte, delta time.Duration) {
+		got = append(got, replayed{string(data), delta, time.Now()})
+	})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	return start, got
+}
+
+// checkGap fails unless gap is close to want.
+func checkGap(t *testing.T, i int, gap, want time.Duration) {
+	t.Helper()
+	if gap < want-5*time.Millisecond || gap > want+50*time.Millisecond {
+		t.Errorf("Gap before message %d = %v, want about %v", i, gap, want)
+	}
+}
+
+func TestReplayTiming(t *testing.T) {
+	var rec bytes.Buffer
+	enc := json.NewEncoder(&rec)
+	deltas := []time.Duration{0, 50 * time.Millisecond, 100 * time.Millisecond}
+	for i, d := range deltas {
+		env, _ := relay.MakeEnvelope(relay.TypeMove, relay.MovePayload{TokenID: "tok1", Direction: "up", Distance: i + 1})
+		enc.Encode(relay.RecordedMessage{Delta: d, Envelope: env})
+	}
+
+	start, got := replayAll(t, rec.Bytes())
+	if len(got) != len(deltas) {
+		t.Fatalf("Replayed %d messages, want %d", len(got), len(deltas))
+	}
+	prev := start
+	for i, r := range got {
+		if r.delta != deltas[i] {
+			t.Errorf("Message %d delta = %v, want %v", i, r.delta, deltas[i])
+		}
+		if want := fmt.Sprintf(`"distance":%d`, i+1); !strings.Contains(r.data, want) {
+			t.Errorf("Message %d = %s, want %s", i, r.data, want)
+		}
+		checkGap(t, i, r.at.Sub(prev), deltas[i])
+		prev = r.at
+	}
+}
+
+func TestReplayInvalid(t *testing.T) {
+	rec := `{"delta":0,"envelope":{"type":"PING","payload":{}}}` + "\nnot json\n"
+	var sent int
+	err := Replay(strings.NewReader(rec), func([]byte, time.Duration) { sent++ })
+	if err == nil || !strings.Contains(err.Error(), "message 2") {
+		t.Errorf("Replay = %v, want an error for message 2", err)
+	}
+	if sent != 1 {
+		t.Errorf("Sent %d messages before the error, want 1", sent)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ns, err := natsutil.Start()
+	if err != nil {
+		t.Fatalf("Failed to start NATS: %v", err)
+	}
+	defer ns.Shutdown()
+	r, err := relay.NewRelay(relay.Config{NatsURL: ns.ClientURL()})
+	if err != nil {
+		t.Fatalf("Failed to create relay: %v", err)
+	}
+	defer r.Close()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		r.HandleClient(conn)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"REPLAY"}}`))
+
+	var rec lockedBuffer
+	stop := r.StartRecording("REPLAY", &rec)
+	msgs := []string{
+		`{"type":"MOVE","payload":{"direction":"up","tokenId":"tok1"}}`,
+		`{"type":"MOVE","payload":{"direction":"left","tokenId":"tok1"}}`,
+		`{"type":"ROLL_DICE","payload":{"formula":"1d20","tokenId":"tok1"}}`,
+	}
+	gaps := []time.Duration{0, 30 * time.Millisecond, 80 * time.Millisecond}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i, msg := range msgs {
+		time.Sleep(gaps[i])
+		conn.WriteMessage(websocket.TextMessage, []byte(msg))
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("Waiting for echo of %s: %v", msg, err)
+			}
+			if string(data) == msg {
+				break
+			}
+		}
+	}
+	stop()
+
+	_, got := replayAll(t, rec.Bytes())
+	if len(got) != len(msgs) {
+		t.Fatalf("Replayed %d messages, want %d", len(got), len(msgs))
+	}
+	for i, r := range got {
+		if r.data != msgs[i] {
+			t.Errorf("Message %d = %s, want %s", i, r.data, msgs[i])
+		}
+		if i > 0 {
+			checkGap(t, i, r.at.Sub(got[i-1].at), gaps[i])
+		}
+	}
+}
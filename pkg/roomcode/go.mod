@@ -0,0 +1,3 @@
+module github.com/sam-phinizy/vtt-remote/pkg/roomcode
+
+go 1.24.0
@@ -0,0 +1,104 @@
+// Package roomcode generates random room codes.
+package roomcode
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// Mode selects the characters a code is built from.
+type Mode string
+
+const (
+	// Alphanumeric uses uppercase letters and digits, without the easily
+	// confused 0/O and 1/I.
+	Alphanumeric Mode = "alphanumeric"
+	// Digits uses 0-9 only.
+	Digits Mode = "digits"
+	// Pronounceable alternates consonants and vowels ("BAKOTI") so codes
+	// are easy to read aloud over voice chat.
+	Pronounceable Mode = "pronounceable"
+)
+
+// Code length bounds, matching the relay's room code format.
+const (
+	MinLength     = 4
+	MaxLength     = 8
+	DefaultLength = 6
+)
+
+const (
+	alphanumericChars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	digitChars        = "0123456789"
+	// Consonants and vowels exclude letters that are hard to tell apart
+	// when spoken (C/K/Q, V/B) or read (Y).
+	consonants = "BDFGHJKLMNPRSTWZ"
+	vowels     = "AEIOU"
+)
+
+// Options configures Generate.
+type Options struct {
+	// Mode defaults to Alphanumeric.
+	Mode Mode
+	// Length defaults to DefaultLength and must be MinLength-MaxLength.
+	Length int
+}
+
+// ParseMode converts a mode name to a Mode. The empty string is
+// Alphanumeric.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case "":
+		return Alphanumeric, nil
+	case Alphanumeric, Digits, Pronounceable:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown room code mode %q", s)
+	}
+}
+
+// Generate returns a random uppercase code.
+func Generate(opts Options) (string, error) {
+	mode, err := ParseMode(string(opts.Mode))
+	if err != nil {
+		return "", err
+	}
+	length := opts.Length
+	if length == 0 {
+		length = DefaultLength
+	}
+	if length < MinLength || length > MaxLength {
+		return "", fmt.Errorf("room code length %d outside %d-%d", length, MinLength, MaxLength)
+	}
+
+	code := make([]byte, length)
+	for i := range code {
+		var chars string
+		switch {
+		case mode == Digits:
+			chars = digitChars
+		case mode == Pronounceable && i%2 == 0:
+			chars = consonants
+		case mode == Pronounceable:
+			chars = vowels
+		default:
+			chars = alphanumericChars
+		}
+		c, err := randomChar(chars)
+		if err != nil {
+			return "", err
+		}
+		code[i] = c
+	}
+	return string(code), nil
+}
+
+// randomChar picks a uniformly random byte from chars.
+func randomChar(chars string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return chars[n.Int64()], nil
+}
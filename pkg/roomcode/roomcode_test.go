@@ -0,0 +1,94 @@
+package roomcode
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// roomCodeRegex mirrors relay.ValidateRoomCode, which this package
+// cannot import.
+var roomCodeRegex = regexp.MustCompile(`^[A-Z0-9]{4,8}$`)
+
+func TestGenerateModes(t *testing.T) {
+	const iterations = 2000
+
+	tests := []struct {
+		mode      Mode
+		allowed   string
+		minUnique int // of iterations, to catch a broken RNG or alphabet
+	}{
+		{mode: Alphanumeric, allowed: alphanumericChars, minUnique: iterations - 5},
+		{mode: Digits, allowed: digitChars, minUnique: iterations * 9 / 10},
+		{mode: Pronounceable, allowed: consonants + vowels, minUnique: iterations * 9 / 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			seen := make(map[string]struct{})
+			for i := 0; i < iterations; i++ {
+				code, err := Generate(Options{Mode: tt.mode})
+				if err != nil {
+					t.Fatalf("Generate failed: %v", err)
+				}
+				if len(code) != DefaultLength || !roomCodeRegex.MatchString(code) {
+					t.Fatalf("Invalid code %q", code)
+				}
+				for j, c := range code {
+					if !strings.ContainsRune(tt.allowed, c) {
+						t.Fatalf("Code %q has unexpected character %q", code, c)
+					}
+					if tt.mode == Pronounceable {
+						wantVowel := j%2 == 1
+						if strings.ContainsRune(vowels, c) != wantVowel {
+							t.Fatalf("Code %q does not alternate consonants and vowels", code)
+						}
+					}
+				}
+				seen[code] = struct{}{}
+			}
+			if len(seen) < tt.minUnique {
+				t.Errorf("Only %d unique codes in %d, want at least %d", len(seen), iterations, tt.minUnique)
+			}
+		})
+	}
+}
+
+func TestGenerateLength(t *testing.T) {
+	for length := MinLength; length <= MaxLength; length++ {
+		for _, mode := range []Mode{Alphanumeric, Digits, Pronounceable} {
+			code, err := Generate(Options{Mode: mode, Length: length})
+			if err != nil {
+				t.Fatalf("Generate(%s, %d) failed: %v", mode, length, err)
+			}
+			if len(code) != length || !roomCodeRegex.MatchString(code) {
+				t.Errorf("Generate(%s, %d) = %q", mode, length, code)
+			}
+		}
+	}
+
+	for _, length := range []int{MinLength - 1, MaxLength + 1} {
+		if _, err := Generate(Options{Length: length}); err == nil {
+			t.Errorf("Generate with length %d succeeded, want error", length)
+		}
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for in, want := range map[string]Mode{
+		"":              Alphanumeric,
+		"alphanumeric":  Alphanumeric,
+		"digits":        Digits,
+		"pronounceable": Pronounceable,
+	} {
+		if got, err := ParseMode(in); err != nil || got != want {
+			t.Errorf("ParseMode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseMode("emoji"); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+	if _, err := Generate(Options{Mode: "emoji"}); err == nil {
+		t.Error("Expected Generate to reject unknown mode")
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sam-phinizy/vtt-remote/pkg/relay"
+	"github.com/sam-phinizy/vtt-remote/pkg/roomcode"
+)
+
+// Config is the server's configuration, as set by command-line flags or
+// VTT_* environment variables.
+type Config struct {
+	Port           int
+	Host           string // bind address; empty binds all interfaces
+	Hostname       string // display hostname for URLs and origins
+	AllowedOrigins string // comma-separated extra WebSocket origins or hosts
+	OriginsFile    string // more origins, reread on SIGHUP
+	LogJSON        bool
+	LogLevel       string // minimum relay log level; empty logs everything
+	TrustProxy     bool   // take client IPs from X-Forwarded-For
+
+	TLSCert       string
+	TLSKey        string
+	TLSSelfSigned bool
+
+	ResumeTTL             time.Duration
+	DedupWindow           time.Duration
+	RoomCodeMode          string
+	RequireReservationKey bool
+	RelayDice             bool
+	RelayPairing          bool
+	AllowRoomSwitch       bool
+	EchoToSender          bool
+	OrderedRooms          bool
+	Presence              bool
+	Compress              bool
+	MaxConnections        int
+	MaxConnectRate        int // new connections per IP per minute
+	AuthToken             string
+
+	NatsURL           string // external NATS; empty starts an embedded server
+	NatsReconnectWait time.Duration
+
+	Check bool // validate the configuration and exit
+}
+
+// defaultConfig returns the configuration used when no flags are given.
+func defaultConfig() Config {
+	return Config{
+		Port:           8080,
+		ResumeTTL:      2 * time.Minute,
+		RoomCodeMode:   "alphanumeric",
+		MaxConnections: 1000,
+		MaxConnectRate: 60,
+		EchoToSender:   true,
+	}
+}
+
+// registerFlags binds cfg's fields to flags on fs, using the current
+// field values as defaults.
+func (cfg *Config) registerFlags(fs *flag.FlagSet) {
+	fs.IntVar(&cfg.Port, "port", cfg.Port, "HTTP server port")
+	fs.StringVar(&cfg.Host, "host", cfg.Host, "IP address or hostname to bind (default all interfaces)")
+	fs.StringVar(&cfg.Hostname, "hostname", cfg.Hostname, "Custom hostname for display (e.g., myserver.local)")
+	fs.StringVar(&cfg.AllowedOrigins, "allowed-origins", cfg.AllowedOrigins, "Comma-separated extra WebSocket origins or hosts to allow (\"*\" allows all)")
+	fs.StringVar(&cfg.OriginsFile, "origins-file", cfg.OriginsFile, "File of extra allowed origins or hosts, one per line; reread on SIGHUP")
+	fs.BoolVar(&cfg.LogJSON, "log-json", cfg.LogJSON, "Emit relay logs as JSON lines on stdout")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "Minimum relay log level: debug, info, warn, or error (default all)")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "TLS certificate file (enables HTTPS/WSS; requires -tls-key)")
+	fs.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "TLS private key file (requires -tls-cert)")
+	fs.DurationVar(&cfg.ResumeTTL, "resume-ttl", cfg.ResumeTTL, "How long a dropped client may resume its session (0 disables)")
+	fs.DurationVar(&cfg.DedupWindow, "dedup-window", cfg.DedupWindow, "Drop a client message identical to its previous one within this long (0 disables)")
+	fs.BoolVar(&cfg.TLSSelfSigned, "tls-selfsigned", cfg.TLSSelfSigned, "Serve HTTPS/WSS with a self-signed certificate generated at startup")
+	fs.StringVar(&cfg.RoomCodeMode, "room-code-mode", cfg.RoomCodeMode, "Style of codes from POST /rooms: alphanumeric, digits, or pronounceable")
+	fs.BoolVar(&cfg.RequireReservationKey, "require-reservation-key", cfg.RequireReservationKey, "Only let the reserver (POST /rooms) join a reserved room code")
+	fs.BoolVar(&cfg.RelayDice, "relay-dice", cfg.RelayDice, "Roll ROLL_DICE formulas on the relay when a room has no Foundry connected")
+	fs.BoolVar(&cfg.RelayPairing, "relay-pairing", cfg.RelayPairing, "Match PAIR codes on the relay against the Foundry's PAIR_CODES list")
+	fs.BoolVar(&cfg.AllowRoomSwitch, "allow-room-switch", cfg.AllowRoomSwitch, "Let a client move to another room by sending JOIN again on the same connection")
+	fs.BoolVar(&cfg.EchoToSender, "echo-to-sender", cfg.EchoToSender, "Send clients their own relayed messages")
+	fs.BoolVar(&cfg.OrderedRooms, "ordered-rooms", cfg.OrderedRooms, "Relay each room's messages one at a time so all clients see the same order (adds latency)")
+	fs.BoolVar(&cfg.Presence, "presence", cfg.Presence, "Broadcast a PRESENCE roster to the room whenever a client joins, leaves, or identifies")
+	fs.BoolVar(&cfg.Compress, "compress", cfg.Compress, "Allow permessage-deflate compression on WebSocket connections")
+	fs.StringVar(&cfg.NatsURL, "nats-url", cfg.NatsURL, "Connect to an external NATS server or cluster (comma-separated URLs) instead of starting one")
+	fs.DurationVar(&cfg.NatsReconnectWait, "nats-reconnect-wait", cfg.NatsReconnectWait, "Delay between NATS reconnect attempts (default 2s)")
+	fs.IntVar(&cfg.MaxConnections, "max-connections", cfg.MaxConnections, "Maximum concurrent WebSocket connections (0 for no limit)")
+	fs.IntVar(&cfg.MaxConnectRate, "max-connect-rate", cfg.MaxConnectRate, "New WebSocket connections allowed per client IP per minute (0 for no limit)")
+	fs.BoolVar(&cfg.TrustProxy, "trust-proxy", cfg.TrustProxy, "Take client IPs from X-Forwarded-For; set only behind a reverse proxy")
+	fs.StringVar(&cfg.AuthToken, "auth-token", cfg.AuthToken, "Shared secret required by /ws and the /rooms endpoints")
+	fs.BoolVar(&cfg.Check, "check", cfg.Check, "Validate the configuration, print a report, and exit without serving")
+}
+
+// envPrefix starts the environment variable matching each flag: -port is
+// VTT_PORT, -allowed-origins is VTT_ALLOWED_ORIGINS, and so on.
+const envPrefix = "VTT_"
+
+// envName returns the environment variable for a flag name.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// LoadConfig reads the configuration from VTT_* environment variables and
+// the command line, with flags taking precedence.
+func LoadConfig() (Config, error) {
+	return loadConfig(os.Args[0], os.Args[1:])
+}
+
+// loadConfig is LoadConfig with explicit program name and arguments.
+func loadConfig(name string, args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	cfg.registerFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s:\n", name)
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nEach flag can also be set with an environment variable, e.g. %s for -port.\n", envName("port"))
+	}
+
+	// Environment first, so flags parsed afterwards override it
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "check" {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid $%s: %w", envName(f.Name), err))
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, err
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// natsDialTimeout bounds each reachability check of an external NATS URL.
+const natsDialTimeout = 2 * time.Second
+
+// validateConfig checks cfg without opening any listeners. It reports
+// every problem found, joined into one error.
+func validateConfig(cfg Config) error {
+	var errs []error
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		errs = append(errs, fmt.Errorf("-port %d is outside 1-65535", cfg.Port))
+	}
+	if err := validateBindHost(cfg.Host); err != nil {
+		errs = append(errs, fmt.Errorf("invalid -host: %w", err))
+	}
+	if err := validateOrigins(cfg.AllowedOrigins); err != nil {
+		errs = append(errs, fmt.Errorf("invalid -allowed-origins: %w", err))
+	}
+	if cfg.LogLevel != "" {
+		if _, err := relay.ParseLogLevel(cfg.LogLevel); err != nil {
+			errs = append(errs, fmt.Errorf("invalid -log-level: %w", err))
+		}
+	}
+	if cfg.OriginsFile != "" {
+		if _, err := readOriginsFile(cfg.OriginsFile); err != nil {
+			errs = append(errs, fmt.Errorf("invalid -origins-file: %w", err))
+		}
+	}
+
+	switch {
+	case (cfg.TLSCert == "") != (cfg.TLSKey == ""):
+		errs = append(errs, errors.New("-tls-cert and -tls-key must be given together"))
+	case cfg.TLSSelfSigned && cfg.TLSCert != "":
+		errs = append(errs, errors.New("-tls-selfsigned cannot be combined with -tls-cert/-tls-key"))
+	case cfg.TLSCert != "":
+		if _, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey); err != nil {
+			errs = append(errs, fmt.Errorf("cannot load -tls-cert/-tls-key: %w", err))
+		}
+	}
+
+	if _, err := roomcode.ParseMode(cfg.RoomCodeMode); err != nil {
+		errs = append(errs, fmt.Errorf("invalid -room-code-mode: %w", err))
+	}
+	if cfg.ResumeTTL < 0 {
+		errs = append(errs, fmt.Errorf("-resume-ttl %v is negative", cfg.ResumeTTL))
+	}
+	if cfg.DedupWindow < 0 {
+		errs = append(errs, fmt.Errorf("-dedup-window %v is negative", cfg.DedupWindow))
+	}
+	if cfg.MaxConnections < 0 {
+		errs = append(errs, fmt.Errorf("-max-connections %d is negative", cfg.MaxConnections))
+	}
+	if cfg.MaxConnectRate < 0 {
+		errs = append(errs, fmt.Errorf("-max-connect-rate %d is negative", cfg.MaxConnectRate))
+	}
+	if cfg.NatsReconnectWait < 0 {
+		errs = append(errs, fmt.Errorf("-nats-reconnect-wait %v is negative", cfg.NatsReconnectWait))
+	}
+	if cfg.NatsURL != "" {
+		if err := checkNATSReachable(cfg.NatsURL, natsDialTimeout); err != nil {
+			errs = append(errs, fmt.Errorf("invalid -nats-url: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateOrigins checks a comma-separated -allowed-origins list. Each
+// entry is "*", a full origin such as "https://host:port", or a bare
+// hostname or IP address.
+func validateOrigins(list string) error {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSuffix(strings.TrimSpace(entry), "/")
+		switch {
+		case entry == "" || entry == "*":
+			continue
+		case strings.Contains(entry, "://"):
+			u, err := url.Parse(entry)
+			if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+				return fmt.Errorf("%q is not an origin like https://host:port", entry)
+			}
+		default:
+			if err := validateBindHost(entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkNATSReachable parses a comma-separated NATS URL list and reports
+// whether at least one server accepts a TCP connection.
+func checkNATSReachable(urls string, timeout time.Duration) error {
+	var lastErr error
+	for _, raw := range strings.Split(urls, ",") {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("%q is not a URL like nats://host:4222", raw)
+		}
+		addr := u.Host
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), "4222")
+		}
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		conn.Close()
+		return nil
+	}
+	return fmt.Errorf("no NATS server reachable: %w", lastErr)
+}
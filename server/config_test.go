@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-phinizy/vtt-remote/pkg/certgen"
+	"github.com/sam-phinizy/vtt-remote/pkg/natsutil"
+)
+
+// writeTestCert writes a self-signed certificate and key as PEM files.
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	cert, err := certgen.Generate(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.TLS.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.TLS.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// closedPort returns a local TCP port with nothing listening on it.
+func closedPort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestValidateConfig(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	ns, err := natsutil.Start()
+	if err != nil {
+		t.Fatalf("Failed to start NATS: %v", err)
+	}
+	defer ns.Shutdown()
+
+	valid := defaultConfig()
+	valid.AllowedOrigins = "*,https://vtt.example.com:8443,lan-box.local,192.168.1.5"
+	valid.LogLevel = "WARN"
+	valid.TLSCert, valid.TLSKey = certFile, keyFile
+	valid.NatsURL = "nats://" + closedPort(t) + "," + ns.ClientURL()
+	if err := validateConfig(valid); err != nil {
+		t.Fatalf("validateConfig(valid) = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"port zero", func(c *Config) { c.Port = 0 }, "-port 0"},
+		{"port too high", func(c *Config) { c.Port = 70000 }, "-port 70000"},
+		{"bad host", func(c *Config) { c.Host = "bad host" }, "-host"},
+		{"bad origin", func(c *Config) { c.AllowedOrigins = "https://" }, "-allowed-origins"},
+		{"origin with path", func(c *Config) { c.AllowedOrigins = "https://a.example/app" }, "-allowed-origins"},
+		{"bad bare origin", func(c *Config) { c.AllowedOrigins = "foo/bar" }, "-allowed-origins"},
+		{"log level", func(c *Config) { c.LogLevel = "verbose" }, "-log-level"},
+		{"cert without key", func(c *Config) { c.TLSKey = "" }, "given together"},
+		{"selfsigned with cert", func(c *Config) { c.TLSSelfSigned = true }, "-tls-selfsigned"},
+		{"unreadable cert", func(c *Config) { c.TLSCert = filepath.Join(t.TempDir(), "missing.pem") }, "cannot load"},
+		{"mismatched pair", func(c *Config) { c.TLSCert, c.TLSKey = keyFile, certFile }, "cannot load"},
+		{"room code mode", func(c *Config) { c.RoomCodeMode = "emoji" }, "-room-code-mode"},
+		{"negative resume ttl", func(c *Config) { c.ResumeTTL = -time.Second }, "-resume-ttl"},
+		{"negative dedup window", func(c *Config) { c.DedupWindow = -time.Second }, "-dedup-window"},
+		{"negative max connections", func(c *Config) { c.MaxConnections = -1 }, "-max-connections"},
+		{"negative connect rate", func(c *Config) { c.MaxConnectRate = -1 }, "-max-connect-rate"},
+		{"negative reconnect wait", func(c *Config) { c.NatsReconnectWait = -time.Second }, "-nats-reconnect-wait"},
+		{"unparseable nats url", func(c *Config) { c.NatsURL = "not a url" }, "-nats-url"},
+		{"unreachable nats", func(c *Config) { c.NatsURL = "nats://" + closedPort(t) }, "no NATS server reachable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+			err := validateConfig(cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("validateConfig = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConfigReportsAll(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Port = -1
+	cfg.RoomCodeMode = "emoji"
+	err := validateConfig(cfg)
+	if err == nil {
+		t.Fatal("validateConfig succeeded")
+	}
+	if lines := strings.Split(err.Error(), "\n"); len(lines) != 2 {
+		t.Errorf("Got %d problems, want 2: %v", len(lines), err)
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := loadConfig("server", nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg != defaultConfig() {
+		t.Errorf("loadConfig = %+v, want defaults %+v", cfg, defaultConfig())
+	}
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	t.Setenv("VTT_PORT", "9090")
+	t.Setenv("VTT_HOSTNAME", "vtt.local")
+	t.Setenv("VTT_ALLOWED_ORIGINS", "https://a.example")
+	t.Setenv("VTT_AUTH_TOKEN", "s3cret")
+	t.Setenv("VTT_RELAY_DICE", "true")
+	t.Setenv("VTT_RESUME_TTL", "30s")
+	t.Setenv("VTT_CHECK", "true")
+
+	cfg, err := loadConfig("server", nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	want := defaultConfig()
+	want.Port = 9090
+	want.Hostname = "vtt.local"
+	want.AllowedOrigins = "https://a.example"
+	want.AuthToken = "s3cret"
+	want.RelayDice = true
+	want.ResumeTTL = 30 * time.Second
+	if cfg != want {
+		t.Errorf("loadConfig = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestLoadConfigFlagsOverrideEnv(t *testing.T) {
+	t.Setenv("VTT_PORT", "9090")
+	t.Setenv("VTT_AUTH_TOKEN", "from-env")
+	t.Setenv("VTT_HOSTNAME", "env.local")
+
+	cfg, err := loadConfig("server", []string{"-port", "7070", "-auth-token=from-flag"})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Port != 7070 || cfg.AuthToken != "from-flag" {
+		t.Errorf("Port, AuthToken = %d, %q; want the flag values", cfg.Port, cfg.AuthToken)
+	}
+	if cfg.Hostname != "env.local" {
+		t.Errorf("Hostname = %q, want env.local from the environment", cfg.Hostname)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"env int", map[string]string{"VTT_PORT": "eighty"}, nil, "$VTT_PORT"},
+		{"env bool", map[string]string{"VTT_COMPRESS": "maybe"}, nil, "$VTT_COMPRESS"},
+		{"env duration", map[string]string{"VTT_RESUME_TTL": "2 minutes"}, nil, "$VTT_RESUME_TTL"},
+		{"flag int", nil, []string{"-port", "eighty"}, "-port"},
+		{"unknown flag", nil, []string{"-no-such-flag"}, "no-such-flag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := loadConfig("server", tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadConfig = %v, want error mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -3,59 +3,200 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/skip2/go-qrcode"
+
+	"github.com/sam-phinizy/vtt-remote/pkg/certgen"
 	"github.com/sam-phinizy/vtt-remote/pkg/natsutil"
 	"github.com/sam-phinizy/vtt-remote/pkg/relay"
+	"github.com/sam-phinizy/vtt-remote/pkg/roomcode"
 )
 
-var relayInstance *relay.Relay
+// startTime records when the process started, for uptime reporting.
+var startTime = time.Now()
+
+// Build information, set at link time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=...".
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
 
 //go:embed public/*
 var publicFS embed.FS
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// TODO: Implement proper origin checking for production
-		return true
-	},
+// relayServer holds the state shared by the HTTP handlers. main builds
+// one from flags; tests build one per server so that handlers left
+// running by an earlier server never see a later one's relay.
+type relayServer struct {
+	relay *relay.Relay
+
+	// natsURL is the client URL of the NATS server the relay uses,
+	// reported by /metrics with credentials masked.
+	natsURL string
+
+	// connLimiter caps concurrent /ws connections; set from
+	// -max-connections. Nil allows any number.
+	connLimiter *relay.ConnLimiter
+
+	// ipLimiter caps new /ws connections per client IP; set from
+	// -max-connect-rate. Nil allows any rate. Client IPs honor
+	// X-Forwarded-For when trustProxy is set.
+	ipLimiter  *relay.IPRateLimiter
+	trustProxy bool
+
+	// origins is the allowlist checkOrigin consults, built from
+	// -allowed-origins and -origins-file. Reloads swap in a whole new
+	// checker, so upgrades never take a lock.
+	origins atomic.Pointer[relay.OriginChecker]
+
+	// upgrader's CheckOrigin is s.checkOrigin, EnableCompression is set
+	// from -compress, and Subprotocols from the relay's supported protocol
+	// versions.
+	upgrader websocket.Upgrader
+}
+
+// routes registers the relay's HTTP endpoints on mux.
+func (s *relayServer) routes(mux *http.ServeMux) {
+	// WebSocket endpoint for relay
+	mux.HandleFunc("/ws", s.handleWebSocket)
+
+	// Health check endpoint
+	mux.HandleFunc("/health", handleHealth)
+	mux.HandleFunc("/version", handleVersion)
+
+	// Relay statistics endpoint
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/metrics/prometheus", s.handlePrometheus)
+
+	// Room listing for admin dashboards
+	mux.HandleFunc("/rooms", s.handleRooms)
+	mux.HandleFunc("POST /rooms", s.handleReserveRoom)
+	mux.HandleFunc("GET /rooms/{code}/status", s.handleRoomStatus)
+
+	// Pairing QR code for headless deployments
+	mux.HandleFunc("/qr", handleQR)
 }
 
 func main() {
-	port := flag.Int("port", 8080, "HTTP server port")
-	hostname := flag.String("hostname", "", "Custom hostname for display (e.g., myserver.local)")
-	flag.Parse()
+	cfg, err := LoadConfig()
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if err := validateConfig(cfg); err != nil {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			log.Printf("Config error: %s", line)
+		}
+		log.Fatalf("Invalid configuration")
+	}
+	if cfg.Check {
+		log.Printf("Configuration OK")
+		return
+	}
+	useTLS := cfg.TLSCert != "" || cfg.TLSSelfSigned
+	log.Printf("VTT Remote %s (commit %s, built %s)", version, commit, buildDate)
+	codeMode, err := roomcode.ParseMode(cfg.RoomCodeMode)
+	if err != nil {
+		log.Fatalf("Invalid -room-code-mode: %v", err)
+	}
+	var minLogLevel relay.LogLevel
+	if cfg.LogLevel != "" {
+		if minLogLevel, err = relay.ParseLogLevel(cfg.LogLevel); err != nil {
+			log.Fatalf("Invalid -log-level: %v", err)
+		}
+	}
 
-	// Start embedded NATS server
-	natsServer, err := natsutil.Start()
+	// Restrict WebSocket upgrades to same-host, localhost, and LAN origins
+	origins := append(defaultAllowedOrigins(cfg.Hostname), strings.Split(cfg.AllowedOrigins, ",")...)
+	if cfg.Host != "" {
+		origins = append(origins, cfg.Host)
+	}
+	checker, err := loadOrigins(origins, cfg.OriginsFile)
 	if err != nil {
-		log.Fatalf("Failed to start NATS: %v", err)
+		log.Fatalf("Invalid -origins-file: %v", err)
+	}
+	srv := &relayServer{}
+	srv.origins.Store(checker)
+	srv.upgrader.CheckOrigin = srv.checkOrigin
+	if cfg.OriginsFile != "" {
+		// SIGHUP rereads the file without dropping connections
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go srv.reloadOrigins(hup, origins, cfg.OriginsFile)
 	}
-	defer natsServer.Shutdown()
 
-	log.Printf("Embedded NATS server running at %s", natsServer.ClientURL())
+	// Start embedded NATS server unless an external one was given
+	var stopNATS func()
+	srv.natsURL, stopNATS, err = startNATS(cfg.NatsURL)
+	if err != nil {
+		log.Fatalf("Failed to start NATS: %v", err)
+	}
+	defer stopNATS()
 
-	// Create relay connected to embedded NATS
-	relayInstance, err = relay.NewRelay(relay.Config{
-		NatsURL: natsServer.ClientURL(),
+	// Create relay connected to NATS
+	relayConfig := relay.Config{
+		NatsURL:           srv.natsURL,
+		NatsReconnectWait: cfg.NatsReconnectWait,
+		AlwaysPublish:     cfg.NatsURL != "", // other relays may share an external server's rooms
 		OnLog: func(level relay.LogLevel, message string) {
 			log.Printf("[%s] %s", level, message)
 		},
-	})
+		MinLogLevel:       minLogLevel,
+		AuthToken:         cfg.AuthToken,
+		ResumeTTL:         cfg.ResumeTTL,
+		DedupWindow:       cfg.DedupWindow,
+		EnableCompression: cfg.Compress,
+		RelaySideDice:     cfg.RelayDice,
+		RelaySidePairing:  cfg.RelayPairing,
+		EchoToSender:      &cfg.EchoToSender,
+		OrderedRooms:      cfg.OrderedRooms,
+		PresenceEnabled:   cfg.Presence,
+		AllowRoomSwitch:   cfg.AllowRoomSwitch,
+
+		RoomCodeMode:          codeMode,
+		RequireReservationKey: cfg.RequireReservationKey,
+		ServerVersion:         version,
+	}
+	if cfg.LogJSON {
+		relayConfig.OnLog = nil
+		relayConfig.OnLogStructured = jsonRelayLogger(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	}
+	srv.relay, err = relay.NewRelay(relayConfig)
 	if err != nil {
 		log.Fatalf("Failed to create relay: %v", err)
 	}
-	defer relayInstance.Close()
+	defer srv.relay.Close()
+	srv.upgrader.EnableCompression = srv.relay.CompressionEnabled()
+	srv.upgrader.Subprotocols = srv.relay.Subprotocols()
+	srv.connLimiter = relay.NewConnLimiter(cfg.MaxConnections)
+	srv.ipLimiter = relay.NewIPRateLimiter(cfg.MaxConnectRate)
+	srv.trustProxy = cfg.TrustProxy
 
 	// Set up HTTP routes
 	mux := http.NewServeMux()
@@ -84,47 +225,254 @@ func main() {
 		fileServer.ServeHTTP(w, r)
 	}))
 
-	// WebSocket endpoint for relay
-	mux.HandleFunc("/ws", handleWebSocket)
-
-	// Health check endpoint
-	mux.HandleFunc("/health", handleHealth)
+	srv.routes(mux)
 
-	// Start HTTP server (bind to all interfaces for LAN access)
-	addr := fmt.Sprintf(":%d", *port)
-	log.Printf("VTT Remote server starting:")
-	log.Printf("  Local:   http://localhost:%d", *port)
-	if *hostname != "" {
-		log.Printf("  Network: http://%s:%d", *hostname, *port)
-	} else if ip := getLocalIP(); ip != "" {
-		log.Printf("  Network: http://%s:%d", ip, *port)
+	// Start HTTP server (all interfaces for LAN access unless -host is set)
+	httpServer := &http.Server{
+		Addr:    listenAddr(cfg.Host, cfg.Port),
+		Handler: mux,
+	}
+	if cfg.TLSSelfSigned {
+		cert, err := selfSignedCert(advertisedHost(cfg.Hostname, cfg.Host))
+		if err != nil {
+			log.Fatalf("Failed to generate self-signed certificate: %v", err)
+		}
+		httpServer.TLSConfig = cert.TLSConfig()
+		log.Printf("Generated self-signed certificate for %s", strings.Join(cert.Leaf.DNSNames, ", "))
+		log.Printf("  SHA-256 fingerprint: %s", cert.Fingerprint())
 	}
+	logListenURLs(cfg.Port, cfg.Hostname, cfg.Host, useTLS)
 
 	// Graceful shutdown
+	shutdownDone := make(chan struct{})
 	go func() {
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 		<-sigChan
 		log.Println("Shutting down...")
-		natsServer.Shutdown()
-		os.Exit(0)
+		srv.shutdown(httpServer)
+		close(shutdownDone)
 	}()
 
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	if err := serve(httpServer, cfg.TLSCert, cfg.TLSKey); err != http.ErrServerClosed {
 		log.Fatalf("Server failed: %v", err)
 	}
+	<-shutdownDone
+}
+
+// serve runs the HTTP server, over TLS when a certificate file is supplied
+// or srv.TLSConfig already holds one. It blocks until the server stops and
+// returns http.ErrServerClosed after a graceful shutdown.
+func serve(srv *http.Server, certFile, keyFile string) error {
+	if certFile != "" || srv.TLSConfig != nil {
+		return srv.ListenAndServeTLS(certFile, keyFile)
+	}
+	return srv.ListenAndServe()
+}
+
+// shutdown drains WebSocket clients, then stops accepting HTTP requests.
+// NATS and the relay connection are closed by main's deferred calls.
+func (s *relayServer) shutdown(srv *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Send close frames to connected clients before tearing down NATS
+	if err := s.relay.Shutdown(ctx); err != nil {
+		log.Printf("Client drain incomplete: %v", err)
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("HTTP shutdown incomplete: %v", err)
+	}
+}
+
+// selfSignedCert generates a certificate covering the advertised host
+// (a name or IP), the machine's hostname, and the detected LAN IP.
+func selfSignedCert(host string) (*certgen.Certificate, error) {
+	var hostnames []string
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		hostnames = append(hostnames, host)
+	}
+	if h, err := os.Hostname(); err == nil {
+		hostnames = append(hostnames, h)
+	}
+	if ip := net.ParseIP(getLocalIP()); ip != nil {
+		ips = append(ips, ip)
+	}
+	return certgen.Generate(hostnames, ips)
+}
+
+// validateBindHost checks that a -host value is empty, an IP address, or
+// a syntactically valid hostname.
+func validateBindHost(host string) error {
+	if host == "" || net.ParseIP(host) != nil {
+		return nil
+	}
+	name := strings.TrimSuffix(host, ".")
+	if len(name) == 0 || len(name) > 253 {
+		return fmt.Errorf("%q is not an IP address or hostname", host)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("%q is not an IP address or hostname", host)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return fmt.Errorf("%q is not an IP address or hostname", host)
+			}
+		}
+	}
+	return nil
+}
+
+// listenAddr returns the server's listen address. An empty host binds
+// all interfaces.
+func listenAddr(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// bindsAllInterfaces reports whether host listens on every interface.
+func bindsAllInterfaces(host string) bool {
+	ip := net.ParseIP(host)
+	return host == "" || (ip != nil && ip.IsUnspecified())
+}
+
+// advertisedHost returns the host clients on the network should use: the
+// display hostname if set, else a specific -host, else the detected LAN
+// IP. It is empty when none is known.
+func advertisedHost(hostname, bindHost string) string {
+	switch {
+	case hostname != "":
+		return hostname
+	case !bindsAllInterfaces(bindHost):
+		return bindHost
+	default:
+		return getLocalIP()
+	}
+}
+
+// logListenURLs prints the addresses clients can use to reach the server.
+func logListenURLs(port int, hostname, bindHost string, useTLS bool) {
+	httpScheme, wsScheme := "http", "ws"
+	if useTLS {
+		httpScheme, wsScheme = "https", "wss"
+	}
+
+	host := advertisedHost(hostname, bindHost)
+	hostPort := net.JoinHostPort(host, strconv.Itoa(port))
+
+	log.Printf("VTT Remote server starting:")
+	if bindsAllInterfaces(bindHost) {
+		log.Printf("  Listening: all interfaces, port %d", port)
+	} else {
+		log.Printf("  Listening: %s", listenAddr(bindHost, port))
+	}
+	if bindsAllInterfaces(bindHost) || isLoopbackHost(bindHost) {
+		log.Printf("  Local:     %s://localhost:%d", httpScheme, port)
+	}
+	if host != "" {
+		log.Printf("  Network:   %s://%s", httpScheme, hostPort)
+		log.Printf("  WebSocket: %s://%s/ws", wsScheme, hostPort)
+	} else {
+		log.Printf("  WebSocket: %s://localhost:%d/ws", wsScheme, port)
+	}
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback IP.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// jsonRelayLogger adapts relay structured log events to a slog logger.
+func jsonRelayLogger(logger *slog.Logger) func(relay.LogLevel, string, map[string]any) {
+	return func(level relay.LogLevel, message string, fields map[string]any) {
+		attrs := make([]any, 0, len(fields)*2)
+		for k, v := range fields {
+			attrs = append(attrs, k, v)
+		}
+
+		slogLevel := slog.LevelInfo
+		switch level {
+		case relay.LogDebug:
+			slogLevel = slog.LevelDebug
+		case relay.LogWarn:
+			slogLevel = slog.LevelWarn
+		case relay.LogError:
+			slogLevel = slog.LevelError
+		}
+		logger.Log(context.Background(), slogLevel, message, attrs...)
+	}
+}
+
+// startNATS returns the NATS URL for the relay and a func to call on
+// exit. With no externalURL it starts an embedded server, which the func
+// shuts down; otherwise it uses externalURL as given.
+func startNATS(externalURL string) (string, func(), error) {
+	if externalURL != "" {
+		log.Printf("Using external NATS at %s", redactNATSURLs(externalURL))
+		return externalURL, func() {}, nil
+	}
+	ns, err := natsutil.Start()
+	if err != nil {
+		return "", nil, err
+	}
+	log.Printf("Embedded NATS server running at %s", redactNATSURLs(ns.ClientURL()))
+	return ns.ClientURL(), ns.Shutdown, nil
+}
+
+// redactNATSURLs masks credentials in a comma-separated NATS URL list for
+// logging and /metrics: passwords, and tokens given as a bare user.
+func redactNATSURLs(urls string) string {
+	parts := strings.Split(urls, ",")
+	for i, part := range parts {
+		if u, err := url.Parse(strings.TrimSpace(part)); err == nil {
+			if _, hasPassword := u.User.Password(); u.User != nil && !hasPassword {
+				u.User = url.User("xxxxx")
+			}
+			parts[i] = u.Redacted()
+		}
+	}
+	return strings.Join(parts, ",")
 }
 
 // handleWebSocket upgrades HTTP connections to WebSocket and bridges to NATS.
-func handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+func (s *relayServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if ip := relay.ClientIP(r, s.trustProxy); !s.ipLimiter.Allow(ip) {
+		log.Printf("Rejected WebSocket connection from %s: connection rate limit reached", ip)
+		http.Error(w, "Too many connection attempts", http.StatusTooManyRequests)
+		return
+	}
+	if !s.relay.Authorize(r) {
+		log.Printf("Rejected unauthorized WebSocket connection from %s", r.RemoteAddr)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !s.connLimiter.TryAcquire() {
+		log.Printf("Rejected WebSocket connection from %s: connection limit reached", r.RemoteAddr)
+		http.Error(w, "Too many connections", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.connLimiter.Release()
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade failed: %v", err)
 		return
 	}
 
+	if !s.relay.CheckSubprotocol(r, conn) {
+		log.Printf("Rejected WebSocket connection from %s: unsupported subprotocol", r.RemoteAddr)
+		return
+	}
+
 	log.Printf("New WebSocket connection from %s", r.RemoteAddr)
-	relayInstance.HandleClient(conn)
+	s.relay.HandleClientContext(r.Context(), conn)
 }
 
 // handleHealth returns a simple health check response.
@@ -134,6 +482,226 @@ func handleHealth(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write([]byte(`{"status":"ok"}`))
 }
 
+// versionResponse is the JSON body returned by /version.
+type versionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// handleVersion returns the build information embedded at link time.
+func handleVersion(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versionResponse{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+	})
+}
+
+// metricsResponse is the JSON body returned by /metrics.
+type metricsResponse struct {
+	RoomCount             int     `json:"roomCount"`
+	ClientCount           int     `json:"clientCount"`
+	FoundryCount          int     `json:"foundryCount"`
+	PhoneCount            int     `json:"phoneCount"`
+	AverageSessionSeconds float64 `json:"averageSessionSeconds"`
+	UptimeSeconds         float64 `json:"uptimeSeconds"`
+	NatsURL               string  `json:"natsUrl"`
+
+	MessagesRelayed uint64                         `json:"messagesRelayed"`
+	BytesRelayed    uint64                         `json:"bytesRelayed"`
+	SlowClientDrops uint64                         `json:"slowClientDrops"`
+	Rooms           map[string]roomMetricsResponse `json:"rooms"`
+}
+
+// roomMetricsResponse is one room's entry in the /metrics response.
+type roomMetricsResponse struct {
+	ClientCount     int    `json:"clientCount"`
+	MessagesRelayed uint64 `json:"messagesRelayed"`
+	BytesRelayed    uint64 `json:"bytesRelayed"`
+	SlowClientDrops uint64 `json:"slowClientDrops"`
+}
+
+// handleMetrics returns relay statistics as JSON.
+func (s *relayServer) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	stats := s.relay.Stats()
+	resp := metricsResponse{
+		RoomCount:             stats.RoomCount,
+		ClientCount:           stats.ClientCount,
+		FoundryCount:          stats.FoundryCount,
+		PhoneCount:            stats.PhoneCount,
+		AverageSessionSeconds: stats.AverageSessionDuration.Seconds(),
+		UptimeSeconds:         time.Since(startTime).Seconds(),
+		NatsURL:               redactNATSURLs(s.natsURL),
+
+		MessagesRelayed: stats.MessagesRelayed,
+		BytesRelayed:    stats.BytesRelayed,
+		SlowClientDrops: stats.SlowClientDrops,
+		Rooms:           make(map[string]roomMetricsResponse, len(stats.Rooms)),
+	}
+	for code, room := range stats.Rooms {
+		resp.Rooms[code] = roomMetricsResponse{
+			ClientCount:     room.ClientCount,
+			MessagesRelayed: room.MessagesRelayed,
+			BytesRelayed:    room.BytesRelayed,
+			SlowClientDrops: room.SlowClientDrops,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleRooms returns every active room and its clients as JSON. It
+// requires the same auth token as /ws, since room codes admit joiners.
+func (s *relayServer) handleRooms(w http.ResponseWriter, r *http.Request) {
+	if !s.relay.Authorize(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(s.relay.ListRooms())
+}
+
+// roomStatusResponse is the JSON body returned by /rooms/{code}/status.
+type roomStatusResponse struct {
+	Exists           bool `json:"exists"`
+	FoundryConnected bool `json:"foundryConnected"`
+	PhoneCount       int  `json:"phoneCount"`
+}
+
+// handleRoomStatus reports whether a room exists and who is in it, for
+// clients that poll instead of joining. Unknown rooms get a 404 with
+// exists false; malformed codes get a 400. It requires the same auth
+// token as /ws.
+func (s *relayServer) handleRoomStatus(w http.ResponseWriter, r *http.Request) {
+	if !s.relay.Authorize(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	code := r.PathValue("code")
+	if !relay.ValidateRoomCode(code) {
+		http.Error(w, "Invalid room code", http.StatusBadRequest)
+		return
+	}
+
+	var resp roomStatusResponse
+	status := http.StatusOK
+	info, err := s.relay.Room(code)
+	if err != nil {
+		status = http.StatusNotFound
+	} else {
+		resp = roomStatusResponse{
+			Exists:           true,
+			FoundryConnected: info.FoundryConnected,
+			PhoneCount:       info.PhoneCount,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleReserveRoom reserves a fresh room code and returns it as JSON.
+// It requires the same auth token as /ws.
+func (s *relayServer) handleReserveRoom(w http.ResponseWriter, r *http.Request) {
+	if !s.relay.Authorize(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	res, err := s.relay.ReserveRoom()
+	if err != nil {
+		log.Printf("Room reservation failed: %v", err)
+		http.Error(w, "No room code available", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// QR code image sizes in pixels.
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 1024
+)
+
+// handleQR renders a PNG QR code of the phone client URL, as reached by
+// this request, with an optional room code from ?room=. The image size
+// in pixels can be set with ?size=.
+func handleQR(w http.ResponseWriter, r *http.Request) {
+	size := defaultQRSize
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < minQRSize || n > maxQRSize {
+			http.Error(w, fmt.Sprintf("size must be %d-%d", minQRSize, maxQRSize), http.StatusBadRequest)
+			return
+		}
+		size = n
+	}
+
+	joinURL := requestBaseURL(r)
+	if room := r.URL.Query().Get("room"); room != "" {
+		if !relay.ValidateRoomCode(room) {
+			http.Error(w, "Invalid room code", http.StatusBadRequest)
+			return
+		}
+		joinURL += "/?room=" + relay.NormalizeRoomCode(room)
+	}
+
+	png, err := qrcode.Encode(joinURL, qrcode.Medium, size)
+	if err != nil {
+		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(png)
+}
+
+// requestBaseURL returns the scheme and host the client used to reach
+// this server, honoring X-Forwarded-Proto from a TLS-terminating proxy.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// handlePrometheus returns relay metrics in Prometheus text format.
+func (s *relayServer) handlePrometheus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	if err := s.relay.WritePrometheus(w); err != nil {
+		log.Printf("Failed to write Prometheus metrics: %v", err)
+	}
+}
+
+// defaultAllowedOrigins returns the hosts always allowed to open a WebSocket:
+// loopback names, the detected LAN IP, and the display hostname if set.
+func defaultAllowedOrigins(hostname string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if ip := getLocalIP(); ip != "" {
+		hosts = append(hosts, ip)
+	}
+	if hostname != "" {
+		hosts = append(hosts, hostname)
+	}
+	return hosts
+}
+
 // getLocalIP returns the preferred outbound IP of this machine.
 func getLocalIP() string {
 	// Use UDP dial to find the preferred outbound IP
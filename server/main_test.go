@@ -0,0 +1,739 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/sam-phinizy/vtt-remote/pkg/natsutil"
+	"github.com/sam-phinizy/vtt-remote/pkg/relay"
+)
+
+// setupTestServer starts embedded NATS, a relay, and an HTTP server
+// exposing the same routes as main.
+func setupTestServer(t *testing.T) (*httptest.Server, *relayServer, func()) {
+	return setupTestServerWithConfig(t, relay.Config{})
+}
+
+// setupTestServerWithConfig is like setupTestServer but with a custom
+// relay config. NatsURL is filled in automatically.
+func setupTestServerWithConfig(t *testing.T, cfg relay.Config) (*httptest.Server, *relayServer, func()) {
+	t.Helper()
+
+	ns, err := natsutil.Start()
+	if err != nil {
+		t.Fatalf("Failed to start NATS: %v", err)
+	}
+
+	cfg.NatsURL = ns.ClientURL()
+	r, err := relay.NewRelay(cfg)
+	if err != nil {
+		ns.Shutdown()
+		t.Fatalf("Failed to create relay: %v", err)
+	}
+
+	srv := &relayServer{relay: r, natsURL: cfg.NatsURL}
+	srv.origins.Store(relay.NewOriginChecker(defaultAllowedOrigins("")))
+	srv.upgrader.CheckOrigin = srv.checkOrigin
+	srv.upgrader.Subprotocols = r.Subprotocols()
+
+	mux := http.NewServeMux()
+	srv.routes(mux)
+	server := httptest.NewServer(mux)
+
+	cleanup := func() {
+		server.Close()
+		r.Close()
+		ns.Shutdown()
+	}
+	return server, srv, cleanup
+}
+
+// dialAndIdentify connects a WebSocket client, joins room, and identifies.
+func dialAndIdentify(t *testing.T, serverURL, room, clientType string) *websocket.Conn {
+	t.Helper()
+	wsURL := "ws" + strings.TrimPrefix(serverURL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial WebSocket: %v", err)
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"`+room+`"}}`))
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"IDENTIFY","payload":{"clientType":"`+clientType+`"}}`))
+	return conn
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	server, _, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	// Simulate values injected with -ldflags -X
+	oldVersion, oldCommit, oldDate := version, commit, buildDate
+	version, commit, buildDate = "1.2.3", "abc1234", "2026-10-14T12:00:00Z"
+	defer func() { version, commit, buildDate = oldVersion, oldCommit, oldDate }()
+
+	resp, err := http.Get(server.URL + "/version")
+	if err != nil {
+		t.Fatalf("GET /version failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var got versionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got.Version != "1.2.3" || got.Commit != "abc1234" || got.BuildDate != "2026-10-14T12:00:00Z" {
+		t.Errorf("Unexpected build info: %+v", got)
+	}
+	if got.GoVersion == "" {
+		t.Error("goVersion is empty")
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	server, srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	foundry := dialAndIdentify(t, server.URL, "METRIC1", "foundry")
+	defer foundry.Close()
+	phone := dialAndIdentify(t, server.URL, "METRIC1", "phone")
+	defer phone.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Status = %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+
+	var m metricsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		t.Fatalf("Failed to decode metrics: %v", err)
+	}
+
+	if m.RoomCount != 1 || m.ClientCount != 2 || m.FoundryCount != 1 || m.PhoneCount != 1 {
+		t.Errorf("Unexpected counts: %+v", m)
+	}
+	if m.UptimeSeconds <= 0 {
+		t.Errorf("UptimeSeconds = %v, want > 0", m.UptimeSeconds)
+	}
+	if m.NatsURL != srv.natsURL {
+		t.Errorf("NatsURL = %q, want %q", m.NatsURL, srv.natsURL)
+	}
+	if room, ok := m.Rooms["METRIC1"]; !ok || room.ClientCount != 2 {
+		t.Errorf("Rooms = %+v, want METRIC1 with 2 clients", m.Rooms)
+	}
+}
+
+func TestPrometheusEndpoint(t *testing.T) {
+	server, _, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	phone := dialAndIdentify(t, server.URL, "PROM1", "phone")
+	defer phone.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := http.Get(server.URL + "/metrics/prometheus")
+	if err != nil {
+		t.Fatalf("GET /metrics/prometheus failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", resp.Header.Get("Content-Type"))
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "vtt_remote_phone_clients 1\n") {
+		t.Errorf("Body missing phone gauge:\n%s", body)
+	}
+}
+
+func TestWebSocketOriginCheck(t *testing.T) {
+	server, _, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	tests := []struct {
+		name       string
+		origin     string
+		wantStatus int
+	}{
+		{name: "missing origin", origin: "", wantStatus: http.StatusSwitchingProtocols},
+		{name: "localhost", origin: "http://localhost:5173", wantStatus: http.StatusSwitchingProtocols},
+		{name: "same host", origin: server.URL, wantStatus: http.StatusSwitchingProtocols},
+		{name: "disallowed", origin: "https://evil.example.com", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+			if conn != nil {
+				conn.Close()
+			}
+			if resp == nil {
+				t.Fatalf("No response: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestWebSocketSubprotocol(t *testing.T) {
+	server, _, cleanup := setupTestServer(t)
+	defer cleanup()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	// A supported subprotocol is echoed back and the client can join
+	dialer := websocket.Dialer{Subprotocols: []string{"vtt-remote.v1"}}
+	conn, resp, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Dial with vtt-remote.v1: %v", err)
+	}
+	defer conn.Close()
+	if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != "vtt-remote.v1" {
+		t.Errorf("Sec-WebSocket-Protocol = %q, want vtt-remote.v1", got)
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"SUBP1"}}`))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Errorf("Expected ROOM_STATUS after JOIN, got %v", err)
+	}
+
+	// An unsupported one is closed before JOIN
+	dialer.Subprotocols = []string{"vtt-remote.v99"}
+	bad, _, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Dial with vtt-remote.v99: %v", err)
+	}
+	defer bad.Close()
+	bad.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := bad.ReadMessage(); !websocket.IsCloseError(err, relay.CloseUnsupportedVersion) {
+		t.Errorf("Expected close %d, got %v", relay.CloseUnsupportedVersion, err)
+	}
+}
+
+func TestRoomsEndpoint(t *testing.T) {
+	server, _, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	foundry := dialAndIdentify(t, server.URL, "ROOMS1", "foundry")
+	defer foundry.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := http.Get(server.URL + "/rooms")
+	if err != nil {
+		t.Fatalf("GET /rooms failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var rooms []relay.RoomInfo
+	if err := json.NewDecoder(resp.Body).Decode(&rooms); err != nil {
+		t.Fatalf("Failed to decode rooms: %v", err)
+	}
+	if len(rooms) != 1 || rooms[0].Room != "ROOMS1" || !rooms[0].FoundryConnected {
+		t.Errorf("Unexpected rooms: %+v", rooms)
+	}
+}
+
+func TestRoomStatusEndpoint(t *testing.T) {
+	server, _, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	foundry := dialAndIdentify(t, server.URL, "STAT1", "foundry")
+	defer foundry.Close()
+	phone := dialAndIdentify(t, server.URL, "STAT1", "phone")
+	defer phone.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	tests := []struct {
+		name       string
+		code       string
+		wantStatus int
+		want       roomStatusResponse
+	}{
+		{"existing", "STAT1", http.StatusOK, roomStatusResponse{Exists: true, FoundryConnected: true, PhoneCount: 1}},
+		{"lowercase", "stat1", http.StatusOK, roomStatusResponse{Exists: true, FoundryConnected: true, PhoneCount: 1}},
+		{"nonexistent", "NOPE1", http.StatusNotFound, roomStatusResponse{}},
+		{"too short", "AB", http.StatusBadRequest, roomStatusResponse{}},
+		{"bad characters", "AB-CD", http.StatusBadRequest, roomStatusResponse{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + "/rooms/" + tt.code + "/status")
+			if err != nil {
+				t.Fatalf("GET status failed: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusBadRequest {
+				return
+			}
+			var got roomStatusResponse
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("Failed to decode status: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Status body = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReserveRoomEndpoint(t *testing.T) {
+	server, srv, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	resp, err := http.Post(server.URL+"/rooms", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /rooms failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Status = %d, want 201", resp.StatusCode)
+	}
+	var res relay.Reservation
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("Failed to decode reservation: %v", err)
+	}
+	if len(res.Code) != 6 || !relay.ValidateRoomCode(res.Code) || res.Key == "" {
+		t.Errorf("Unexpected reservation: %+v", res)
+	}
+
+	// The reserved code can be joined
+	conn := dialAndIdentify(t, server.URL, res.Code, "foundry")
+	defer conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	if stats := srv.relay.Stats(); stats.Rooms[res.Code].FoundryCount != 1 {
+		t.Errorf("Expected Foundry in reserved room %s, got %+v", res.Code, stats.Rooms)
+	}
+}
+
+// decodeQR reads a PNG response body and returns the QR code's text.
+func decodeQR(t *testing.T, r io.Reader) (string, image.Rectangle) {
+	t.Helper()
+	img, err := png.Decode(r)
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		t.Fatalf("Failed to read QR bitmap: %v", err)
+	}
+	result, err := qrcode.NewQRCodeReader().Decode(bmp, nil)
+	if err != nil {
+		t.Fatalf("Failed to decode QR code: %v", err)
+	}
+	return result.GetText(), img.Bounds()
+}
+
+func TestQREndpoint(t *testing.T) {
+	server, _, cleanup := setupTestServer(t)
+	defer cleanup()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		name     string
+		query    string
+		wantText string
+		wantSize int
+	}{
+		{name: "default", query: "", wantText: "http://" + host, wantSize: defaultQRSize},
+		{name: "room and size", query: "?room=game1&size=512", wantText: "http://" + host + "/?room=GAME1", wantSize: 512},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + "/qr" + tt.query)
+			if err != nil {
+				t.Fatalf("GET /qr failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Status = %d, want 200", resp.StatusCode)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+				t.Errorf("Content-Type = %q, want image/png", ct)
+			}
+			text, bounds := decodeQR(t, resp.Body)
+			if text != tt.wantText {
+				t.Errorf("QR text = %q, want %q", text, tt.wantText)
+			}
+			if bounds.Dx() != tt.wantSize {
+				t.Errorf("Image width = %d, want %d", bounds.Dx(), tt.wantSize)
+			}
+		})
+	}
+
+	for _, query := range []string{"?size=10", "?size=abc", "?room=bad-code"} {
+		resp, err := http.Get(server.URL + "/qr" + query)
+		if err != nil {
+			t.Fatalf("GET /qr%s failed: %v", query, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET /qr%s status = %d, want 400", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestWebSocketAuthToken(t *testing.T) {
+	server, _, cleanup := setupTestServerWithConfig(t, relay.Config{AuthToken: "s3cret"})
+	defer cleanup()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	tests := []struct {
+		name       string
+		header     string
+		query      string
+		wantStatus int
+	}{
+		{name: "bearer header", header: "Bearer s3cret", wantStatus: http.StatusSwitchingProtocols},
+		{name: "query param", query: "?token=s3cret", wantStatus: http.StatusSwitchingProtocols},
+		{name: "wrong token", header: "Bearer nope", wantStatus: http.StatusUnauthorized},
+		{name: "wrong query token", query: "?token=nope", wantStatus: http.StatusUnauthorized},
+		{name: "missing token", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.header != "" {
+				header.Set("Authorization", tt.header)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial(wsURL+tt.query, header)
+			if conn != nil {
+				conn.Close()
+			}
+			if resp == nil {
+				t.Fatalf("No response: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRoomEndpointsAuthToken(t *testing.T) {
+	server, _, cleanup := setupTestServerWithConfig(t, relay.Config{AuthToken: "s3cret"})
+	defer cleanup()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=s3cret"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial WebSocket: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"AUTH1"}}`))
+	time.Sleep(100 * time.Millisecond)
+
+	tests := []struct {
+		name       string
+		path       string
+		header     string
+		wantStatus int
+	}{
+		{name: "rooms with token", path: "/rooms", header: "Bearer s3cret", wantStatus: http.StatusOK},
+		{name: "rooms without token", path: "/rooms", wantStatus: http.StatusUnauthorized},
+		{name: "rooms with wrong token", path: "/rooms", header: "Bearer nope", wantStatus: http.StatusUnauthorized},
+		{name: "status with token", path: "/rooms/AUTH1/status", header: "Bearer s3cret", wantStatus: http.StatusOK},
+		{name: "status without token", path: "/rooms/AUTH1/status", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("GET %s failed: %v", tt.path, err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestWebSocketConnectionLimit(t *testing.T) {
+	server, srv, cleanup := setupTestServer(t)
+	defer cleanup()
+	srv.connLimiter = relay.NewConnLimiter(2)
+
+	first := dialAndIdentify(t, server.URL, "LIMIT1", "phone")
+	defer first.Close()
+	second := dialAndIdentify(t, server.URL, "LIMIT1", "phone")
+	defer second.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if conn != nil {
+		conn.Close()
+		t.Fatal("Third connection was accepted")
+	}
+	if resp == nil {
+		t.Fatalf("No response: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Status = %d, want 503", resp.StatusCode)
+	}
+
+	// The earlier connections are still relaying
+	move := `{"type":"MOVE","payload":{"tokenId":"tok1","direction":"up"}}`
+	first.WriteMessage(websocket.TextMessage, []byte(move))
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := second.ReadMessage()
+		if err != nil {
+			t.Fatalf("Existing connection stopped relaying: %v", err)
+		}
+		if string(data) == move {
+			break
+		}
+	}
+
+	// Closing one frees its slot
+	first.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.connLimiter.InUse() > 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Slot was not released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	third, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Dial after release: %v", err)
+	}
+	third.Close()
+}
+
+func TestWebSocketConnectRateLimit(t *testing.T) {
+	server, srv, cleanup := setupTestServer(t)
+	defer cleanup()
+	srv.ipLimiter, srv.trustProxy = relay.NewIPRateLimiter(3), true
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	dial := func(ip string) (*websocket.Conn, *http.Response, error) {
+		return websocket.DefaultDialer.Dial(wsURL, http.Header{"X-Forwarded-For": {ip}})
+	}
+
+	for i := range 3 {
+		conn, _, err := dial("203.0.113.1")
+		if err != nil {
+			t.Fatalf("Connection %d within the limit: %v", i+1, err)
+		}
+		conn.Close()
+	}
+	conn, resp, err := dial("203.0.113.1")
+	if conn != nil {
+		conn.Close()
+		t.Fatal("Fourth rapid connection was accepted")
+	}
+	if resp == nil {
+		t.Fatalf("No response: %v", err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Status = %d, want 429", resp.StatusCode)
+	}
+
+	// Another client IP is unaffected
+	other, _, err := dial("203.0.113.2")
+	if err != nil {
+		t.Fatalf("Connection from another IP: %v", err)
+	}
+	other.Close()
+}
+
+func TestExternalNATS(t *testing.T) {
+	external, err := natsutil.Start()
+	if err != nil {
+		t.Fatalf("Failed to start NATS: %v", err)
+	}
+	defer external.Shutdown()
+
+	url, stop, err := startNATS(external.ClientURL())
+	if err != nil {
+		t.Fatalf("startNATS: %v", err)
+	}
+	if url != external.ClientURL() {
+		t.Errorf("startNATS URL = %q, want %q", url, external.ClientURL())
+	}
+	stop()
+	if !external.Running() {
+		t.Fatal("stop shut down the external server")
+	}
+
+	r, err := relay.NewRelay(relay.Config{NatsURL: url})
+	if err != nil {
+		t.Fatalf("Failed to create relay: %v", err)
+	}
+	defer r.Close()
+	srv := &relayServer{relay: r, natsURL: url}
+	srv.origins.Store(relay.NewOriginChecker(defaultAllowedOrigins("")))
+	srv.upgrader.CheckOrigin = srv.checkOrigin
+	mux := http.NewServeMux()
+	srv.routes(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Messages flow end to end through the external server
+	foundry := dialAndIdentify(t, server.URL, "EXTNAT", "foundry")
+	defer foundry.Close()
+	phone := dialAndIdentify(t, server.URL, "EXTNAT", "phone")
+	defer phone.Close()
+	move := `{"type":"MOVE","payload":{"tokenId":"tok1","direction":"up"}}`
+	phone.WriteMessage(websocket.TextMessage, []byte(move))
+	foundry.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := foundry.ReadMessage()
+		if err != nil {
+			t.Fatalf("MOVE not relayed: %v", err)
+		}
+		if string(data) == move {
+			break
+		}
+	}
+}
+
+func TestRedactNATSURLs(t *testing.T) {
+	got := redactNATSURLs("nats://user:secret@a:4222, nats://b:4222, nats://s3cret@c:4222")
+	if want := "nats://user:xxxxx@a:4222,nats://b:4222,nats://xxxxx@c:4222"; got != want {
+		t.Errorf("redactNATSURLs = %q, want %q", got, want)
+	}
+}
+
+func TestMetricsRedactsNATSURL(t *testing.T) {
+	ns, err := natsutil.Start()
+	if err != nil {
+		t.Fatalf("Failed to start NATS: %v", err)
+	}
+	defer ns.Shutdown()
+
+	url := strings.Replace(ns.ClientURL(), "nats://", "nats://user:secret@", 1)
+	r, err := relay.NewRelay(relay.Config{NatsURL: url})
+	if err != nil {
+		t.Fatalf("Failed to create relay: %v", err)
+	}
+	defer r.Close()
+	srv := &relayServer{relay: r, natsURL: url}
+	mux := http.NewServeMux()
+	srv.routes(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+	if strings.Contains(string(body), "secret") {
+		t.Errorf("/metrics exposes the NATS password: %s", body)
+	}
+}
+
+func TestValidateBindHost(t *testing.T) {
+	valid := []string{"", "127.0.0.1", "0.0.0.0", "::", "fd00::2", "localhost", "vtt.example.com", "lan-box.local."}
+	for _, host := range valid {
+		if err := validateBindHost(host); err != nil {
+			t.Errorf("validateBindHost(%q) = %v, want nil", host, err)
+		}
+	}
+	invalid := []string{"-bad", "bad-", "has space", "a..b", "http://host", "host:8080", strings.Repeat("a", 64)}
+	for _, host := range invalid {
+		if err := validateBindHost(host); err == nil {
+			t.Errorf("validateBindHost(%q) succeeded", host)
+		}
+	}
+}
+
+func TestAdvertisedHost(t *testing.T) {
+	if got := advertisedHost("table.local", "192.168.1.20"); got != "table.local" {
+		t.Errorf("Display hostname should win, got %q", got)
+	}
+	if got := advertisedHost("", "192.168.1.20"); got != "192.168.1.20" {
+		t.Errorf("Specific bind host should be advertised, got %q", got)
+	}
+	if got := advertisedHost("", "0.0.0.0"); got != getLocalIP() {
+		t.Errorf("All-interfaces bind should advertise the LAN IP, got %q", got)
+	}
+}
+
+func TestListenAddrLoopbackOnly(t *testing.T) {
+	ln, err := net.Listen("tcp", listenAddr("127.0.0.1", 0))
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	if !addr.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatalf("Listener bound %s, want 127.0.0.1", addr)
+	}
+	port := strconv.Itoa(addr.Port)
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		t.Fatalf("Loopback dial failed: %v", err)
+	}
+	conn.Close()
+
+	lanIP := getLocalIP()
+	if lanIP == "" || net.ParseIP(lanIP).IsLoopback() {
+		t.Skip("No non-loopback address to dial")
+	}
+	if conn, err := net.DialTimeout("tcp", net.JoinHostPort(lanIP, port), time.Second); err == nil {
+		conn.Close()
+		t.Errorf("Dial via %s reached a loopback-only listener", lanIP)
+	}
+}
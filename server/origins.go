@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sam-phinizy/vtt-remote/pkg/relay"
+)
+
+// checkOrigin is the upgrader's CheckOrigin, using s's current allowlist.
+func (s *relayServer) checkOrigin(r *http.Request) bool {
+	return s.origins.Load().Check(r)
+}
+
+// readOriginsFile reads an -origins-file: origins or hosts separated by
+// newlines or commas, with blank lines and #-comments ignored.
+func readOriginsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var origins []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if err := validateOrigins(line); err != nil {
+			return nil, err
+		}
+		for _, entry := range strings.Split(line, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				origins = append(origins, entry)
+			}
+		}
+	}
+	return origins, scanner.Err()
+}
+
+// loadOrigins builds an allowlist from base plus the entries in path, if
+// one is given.
+func loadOrigins(base []string, path string) (*relay.OriginChecker, error) {
+	origins := base
+	if path != "" {
+		extra, err := readOriginsFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		origins = append(append([]string(nil), base...), extra...)
+	}
+	return relay.NewOriginChecker(origins), nil
+}
+
+// reloadOrigins rereads path on every value from sigs and swaps in the
+// new allowlist for s. Connections already upgraded are unaffected. A file
+// that fails to load leaves the previous list in place.
+func (s *relayServer) reloadOrigins(sigs <-chan os.Signal, base []string, path string) {
+	for range sigs {
+		checker, err := loadOrigins(base, path)
+		if err != nil {
+			log.Printf("Keeping previous allowed origins: %v", err)
+			continue
+		}
+		s.origins.Store(checker)
+		log.Printf("Reloaded allowed origins from %s", path)
+	}
+}
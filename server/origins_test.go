@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestReadOriginsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "origins")
+	content := "# LAN hosts\nhttps://vtt.example.com:8443\n\n lan-box.local , 192.168.1.5 # office\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readOriginsFile(path)
+	if err != nil {
+		t.Fatalf("readOriginsFile: %v", err)
+	}
+	want := []string{"https://vtt.example.com:8443", "lan-box.local", "192.168.1.5"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readOriginsFile = %q, want %q", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte("https://a.example/app\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readOriginsFile(path); err == nil {
+		t.Error("readOriginsFile accepted an origin with a path")
+	}
+}
+
+func TestReloadOriginsOnSignal(t *testing.T) {
+	server, srv, cleanup := setupTestServer(t)
+	defer cleanup()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	path := filepath.Join(t.TempDir(), "origins")
+	if err := os.WriteFile(path, []byte("https://first.example\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	base := defaultAllowedOrigins("")
+	checker, err := loadOrigins(base, path)
+	if err != nil {
+		t.Fatalf("loadOrigins: %v", err)
+	}
+	srv.origins.Store(checker)
+
+	hup := make(chan os.Signal)
+	defer close(hup)
+	go srv.reloadOrigins(hup, base, path)
+
+	status := func(origin string) int {
+		conn, resp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {origin}})
+		if conn != nil {
+			conn.Close()
+		}
+		if resp == nil {
+			t.Fatalf("No response: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	// A connection upgraded before the reload stays open after it
+	kept, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {"https://first.example"}})
+	if err != nil {
+		t.Fatalf("Dial with first origin: %v", err)
+	}
+	defer kept.Close()
+	if got := status("https://second.example"); got != http.StatusForbidden {
+		t.Fatalf("Second origin before reload: status %d, want %d", got, http.StatusForbidden)
+	}
+
+	if err := os.WriteFile(path, []byte("https://second.example\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	hup <- syscall.SIGHUP
+	deadline := time.Now().Add(time.Second)
+	for status("https://second.example") != http.StatusSwitchingProtocols {
+		if time.Now().After(deadline) {
+			t.Fatal("Second origin still rejected after SIGHUP")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := status("https://first.example"); got != http.StatusForbidden {
+		t.Errorf("First origin after reload: status %d, want %d", got, http.StatusForbidden)
+	}
+	if got := status("http://localhost:5173"); got != http.StatusSwitchingProtocols {
+		t.Errorf("Default origin after reload: status %d, want %d", got, http.StatusSwitchingProtocols)
+	}
+	if err := kept.WriteMessage(websocket.TextMessage, []byte(`{"type":"JOIN","payload":{"room":"HUP123"}}`)); err != nil {
+		t.Errorf("Existing connection broken by reload: %v", err)
+	}
+
+	// A bad file leaves the current list in place
+	if err := os.WriteFile(path, []byte("not a host/\x00\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	hup <- syscall.SIGHUP
+	hup <- syscall.SIGHUP // returns once the first reload has finished
+	if got := status("https://second.example"); got != http.StatusSwitchingProtocols {
+		t.Errorf("Second origin after failed reload: status %d, want %d", got, http.StatusSwitchingProtocols)
+	}
+}